@@ -0,0 +1,87 @@
+package fbptree
+
+import (
+	"fmt"
+	"time"
+)
+
+// AutoCompact option compacts the file in place, as Compact does, after the
+// write if the share of the free pages of the file exceeds the threshold and
+// the interval has passed since the last compaction or the check of the
+// share, so the file does not grow forever under the churn. The compaction
+// reads the whole tree, the interval limits how often it runs. The failed
+// compaction is reported to the logger and does not fail the write.
+func AutoCompact(threshold float64, interval time.Duration) func(*config) error {
+	return func(c *config) error {
+		if threshold <= 0 || threshold > 1 {
+			return fmt.Errorf("compaction threshold must be in (0, 1]")
+		}
+
+		if interval < 0 {
+			return fmt.Errorf("compaction interval must not be negative")
+		}
+
+		c.compactThreshold = threshold
+		c.compactInterval = interval
+
+		return nil
+	}
+}
+
+// PauseCompaction pauses the automatic compaction, e.g. for the latency
+// sensitive period, until ResumeCompaction is called.
+func (t *FBPTree) PauseCompaction() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.compactionPaused = true
+}
+
+// ResumeCompaction resumes the automatic compaction paused
+// by PauseCompaction.
+func (t *FBPTree) ResumeCompaction() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.compactionPaused = false
+}
+
+// fragmentation returns the share of the free pages of the file.
+func (t *FBPTree) fragmentation() float64 {
+	pager := t.storage.pager
+	if pager.lastPageId == 0 {
+		return 0
+	}
+
+	return float64(len(pager.isFreePage)) / float64(pager.lastPageId)
+}
+
+// autoCompact compacts the file after the write if it is due.
+func (t *FBPTree) autoCompact() {
+	if t.compactThreshold == 0 || t.compactionPaused || t.autoCompacting {
+		return
+	}
+
+	if time.Since(t.lastCompaction) < t.compactInterval {
+		return
+	}
+	t.lastCompaction = time.Now()
+
+	fragmentation := t.fragmentation()
+	if fragmentation <= t.compactThreshold {
+		return
+	}
+
+	// the compaction is the write itself
+	t.autoCompacting = true
+	defer func() { t.autoCompacting = false }()
+
+	w, err := t.beginWrite()
+	if err == nil {
+		err = t.endWrite(w, t.compact())
+	}
+
+	if err != nil && t.logger != nil {
+		t.logger.Warnf("failed to compact the file with %.0f%% free pages: %s", fragmentation*100, err)
+	}
+}
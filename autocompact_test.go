@@ -0,0 +1,84 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestAutoCompact(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4), PageSize(4096), AutoCompact(0.5, 0))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	large := bytes.Repeat([]byte{1}, 100000)
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put(encodeUint32(uint32(i)), large); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	pages := tree.storage.pager.lastPageId
+
+	tree.PauseCompaction()
+	for i := 0; i < 90; i++ {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	if compactions := tree.Stats().Compactions; compactions != 0 {
+		t.Fatalf("expected no compactions while paused, but got %d", compactions)
+	}
+	if tree.storage.pager.lastPageId != pages {
+		t.Fatalf("expected %d pages while paused, but got %d", pages, tree.storage.pager.lastPageId)
+	}
+
+	tree.ResumeCompaction()
+	if _, _, err := tree.Delete(encodeUint32(uint32(90))); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+
+	if compactions := tree.Stats().Compactions; compactions != 1 {
+		t.Fatalf("expected a single compaction, but got %d", compactions)
+	}
+	if tree.storage.pager.lastPageId >= pages {
+		t.Fatalf("expected less than %d pages, but got %d", pages, tree.storage.pager.lastPageId)
+	}
+
+	for i := 91; i < 100; i++ {
+		value, ok, err := tree.Get(encodeUint32(uint32(i)))
+		if err != nil || !ok || !bytes.Equal(value, large) {
+			t.Fatalf("unexpected value of size %d for key %d: %v", len(value), i, err)
+		}
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected no problems, but got %v", report.Problems)
+	}
+}
+
+func TestAutoCompactErrors(t *testing.T) {
+	if _, err := newConfig([]func(*config) error{AutoCompact(0, 0)}); err == nil {
+		t.Fatalf("expected the error for the zero threshold")
+	}
+
+	if _, err := newConfig([]func(*config) error{AutoCompact(0.5, -1)}); err == nil {
+		t.Fatalf("expected the error for the negative interval")
+	}
+}
@@ -0,0 +1,39 @@
+package fbptree
+
+import (
+	"fmt"
+	"io"
+)
+
+// Backup writes the consistent copy of the tree file into the writer while
+// the tree is open, so the backup does not stop the application: the reads
+// go on, the writes wait until the copy is written. The copy is the file as
+// of the last completed write and it is opened as the tree with the same
+// options. The changes of the open writable transaction are not committed,
+// so the backup is rejected with ErrTxOpen until the transaction is done.
+// Returns the number of the written bytes.
+func (t *FBPTree) Backup(w io.Writer) (int64, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return 0, ErrClosed
+	}
+
+	if t.tx != nil {
+		return 0, ErrTxOpen
+	}
+
+	file := t.storage.storedFile()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat the file: %w", err)
+	}
+
+	n, err := io.Copy(w, io.NewSectionReader(file, 0, info.Size()))
+	if err != nil {
+		return n, fmt.Errorf("failed to copy the file: %w", err)
+	}
+
+	return n, nil
+}
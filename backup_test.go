@@ -0,0 +1,95 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestBackup(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(5), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		// the writes wait for the backup
+		for i := 1000; i < 1100; i++ {
+			key := encodeUint32(uint32(i))
+			if _, _, err := tree.Put(key, key); err != nil {
+				panic(fmt.Errorf("failed to put key %d: %w", i, err))
+			}
+		}
+	}()
+
+	var backup bytes.Buffer
+	n, err := tree.Backup(&backup)
+	if err != nil {
+		t.Fatalf("failed to backup: %s", err)
+	}
+	if n != int64(backup.Len()) {
+		t.Fatalf("expected %d written bytes, but got %d", backup.Len(), n)
+	}
+	wg.Wait()
+
+	backupPath := path.Join(dbDir, "backup.data")
+	if err := ioutil.WriteFile(backupPath, backup.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write the backup: %s", err)
+	}
+
+	restored, err := Open(backupPath, Order(5))
+	if err != nil {
+		t.Fatalf("failed to open the backup: %s", err)
+	}
+	defer restored.Close()
+
+	if err := restored.HealthCheck(); err != nil {
+		t.Fatalf("failed health check of the backup: %s", err)
+	}
+
+	size := restored.Size()
+	if size < 1000 || size > 1100 {
+		t.Fatalf("expected between 1000 and 1100 entries, but got %d", size)
+	}
+	for i := 0; i < size; i++ {
+		key := encodeUint32(uint32(i))
+		value, ok, err := restored.Get(key)
+		if err != nil || !ok || !bytes.Equal(value, key) {
+			t.Fatalf("unexpected value %v for key %d: %v", value, i, err)
+		}
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tree.Backup(&backup); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Batch collects the puts and the deletes to apply them to the tree at once.
+// The zero value is an empty batch ready to use.
+type Batch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Put adds the put of the key and the value to the batch.
+func (b *Batch) Put(key, value []byte) {
+	b.ops = append(b.ops, batchOp{key: copyBytes(key), value: copyBytes(value)})
+}
+
+// Delete adds the delete of the key to the batch.
+func (b *Batch) Delete(key []byte) {
+	b.ops = append(b.ops, batchOp{key: copyBytes(key), delete: true})
+}
+
+// Len returns the number of the operations in the batch.
+func (b *Batch) Len() int {
+	return len(b.ops)
+}
+
+// Reset empties the batch.
+func (b *Batch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Apply applies the operations of the batch in the order they were added and
+// fsyncs the file once at the end, the syncs of StrictMetadataSync and of
+// the sync policy are deferred until then. The batch is atomic: the changes
+// are kept in memory until all the operations succeed, so if an operation
+// fails, none of them are applied. The commit is also atomic on the crash
+// with the WriteAheadLog option.
+func (t *FBPTree) Apply(b *Batch) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return err
+	}
+	// the changes are deferred even without the write-ahead log
+	t.storage.begin()
+
+	strictSync, syncPolicy := t.strictMetadataSync, t.syncPolicy
+	t.strictMetadataSync = false
+	t.storage.pager.strictSync = false
+	t.syncPolicy = SyncOnClose
+	defer func() {
+		t.strictMetadataSync = strictSync
+		t.storage.pager.strictSync = strictSync
+		t.syncPolicy = syncPolicy
+	}()
+
+	for i, op := range b.ops {
+		err = t.applyOp(op)
+		if err != nil {
+			err = fmt.Errorf("failed to apply the operation %d: %w", i, err)
+
+			break
+		}
+	}
+
+	if err := t.endWrite(w, err); err != nil {
+		return err
+	}
+
+	if err := t.storage.flush(); err != nil {
+		return fmt.Errorf("failed to flush the batch: %w", err)
+	}
+
+	return nil
+}
+
+// applyOp applies the operation of the batch within the running write.
+func (t *FBPTree) applyOp(op batchOp) error {
+	o := t.beginOperation()
+	if op.delete {
+		value, _, err := t.delete(op.key)
+		t.endOperation(o, OperationDelete, len(op.key), len(value), err)
+
+		return err
+	}
+
+	_, _, err := t.put(op.key, op.value)
+	t.endOperation(o, OperationPut, len(op.key), len(op.value), err)
+
+	return err
+}
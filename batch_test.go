@@ -0,0 +1,148 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestApplyBatch(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), StrictMetadataSync())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	var b Batch
+	for i := 0; i < 1000; i++ {
+		b.Put(encodeUint32(uint32(i)), encodeUint32(uint32(i)))
+	}
+	for i := 0; i < 1000; i += 2 {
+		b.Delete(encodeUint32(uint32(i)))
+	}
+	// the later operations win
+	b.Put(encodeUint32(0), []byte{42})
+
+	if b.Len() != 1501 {
+		t.Fatalf("expected 1501 operations, but got %d", b.Len())
+	}
+
+	before := tree.storage.stats().syncs
+	if err := tree.Apply(&b); err != nil {
+		t.Fatalf("failed to apply the batch: %s", err)
+	}
+
+	if syncs := tree.storage.stats().syncs - before; syncs != 1 {
+		t.Fatalf("expected a single sync, but got %d", syncs)
+	}
+	if !tree.strictMetadataSync || !tree.storage.pager.strictSync {
+		t.Fatalf("expected the strict sync to be restored")
+	}
+
+	if tree.Size() != 501 {
+		t.Fatalf("expected the size 501, but got %d", tree.Size())
+	}
+
+	value, ok, err := tree.Get(encodeUint32(0))
+	if err != nil || !ok || len(value) != 1 || value[0] != 42 {
+		t.Fatalf("expected the value [42], but got %v, %v, %v", value, ok, err)
+	}
+	for i := 1; i < 1000; i++ {
+		_, ok, err := tree.Get(encodeUint32(uint32(i)))
+		if err != nil {
+			t.Fatalf("failed to get key %d: %s", i, err)
+		}
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence %v of key %d", ok, i)
+		}
+	}
+
+	b.Reset()
+	if b.Len() != 0 {
+		t.Fatalf("expected the empty batch")
+	}
+}
+
+func TestApplyBatchIsAtomic(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put(encodeUint32(uint32(i)), []byte{1}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	var b Batch
+	for i := 0; i < 100; i += 2 {
+		b.Delete(encodeUint32(uint32(i)))
+	}
+	for i := 100; i < 200; i++ {
+		b.Put(encodeUint32(uint32(i)), []byte{2})
+	}
+	// the last operation fails after the tree is changed
+	b.Put(make([]byte, maxKeySize+1), nil)
+
+	if err := tree.Apply(&b); err == nil {
+		t.Fatalf("expected the error for the key larger than %d bytes", maxKeySize)
+	}
+	if err := tree.Poisoned(); err != nil {
+		t.Fatalf("expected the tree not to be poisoned, but got %s", err)
+	}
+
+	check := func(tree *FBPTree) {
+		if tree.Size() != 100 {
+			t.Fatalf("expected the size 100, but got %d", tree.Size())
+		}
+
+		for i := 0; i < 200; i++ {
+			_, ok, err := tree.Get(encodeUint32(uint32(i)))
+			if err != nil {
+				t.Fatalf("failed to get key %d: %s", i, err)
+			}
+			if ok != (i < 100) {
+				t.Fatalf("unexpected presence %v of key %d", ok, i)
+			}
+		}
+
+		report, err := tree.Check()
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if !report.OK() {
+			t.Fatalf("expected no problems, but got %v", report.Problems)
+		}
+	}
+	check(tree)
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	check(tree)
+}
@@ -0,0 +1,238 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+// the number of the keys in the tree for the reads and the deletes
+const benchmarkSize = 10000
+
+// the number of the keys traversed by the range scan
+const benchmarkScanSize = 100
+
+var benchmarkOrders = []int{10, 100, 500}
+var benchmarkPageSizes = []int{4096, 16384}
+
+// benchmarkTree opens the tree of every benchmarked order and page size
+// in the new directory and runs the benchmark with it.
+func benchmarkTree(b *testing.B, run func(b *testing.B, dbPath string, options []func(*config) error)) {
+	for _, order := range benchmarkOrders {
+		for _, pageSize := range benchmarkPageSizes {
+			b.Run(fmt.Sprintf("order=%d/pageSize=%d", order, pageSize), func(b *testing.B) {
+				dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+				defer func() {
+					if err := os.RemoveAll(dbDir); err != nil {
+						panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+					}
+				}()
+
+				options := []func(*config) error{Order(order), PageSize(pageSize)}
+				run(b, path.Join(dbDir, "sample.data"), options)
+			})
+		}
+	}
+}
+
+// openBenchmarkTree opens the tree filled with the given number of the keys.
+func openBenchmarkTree(b *testing.B, dbPath string, options []func(*config) error, size int) *FBPTree {
+	tree, err := Open(dbPath, options...)
+	if err != nil {
+		b.Fatalf("failed to open tree: %s", err)
+	}
+
+	keys := benchmarkKeys(size)
+	i := 0
+	err = tree.BulkLoad(size, func() ([]byte, []byte, error) {
+		key := keys[i]
+		i++
+
+		return key, key, nil
+	})
+	if err != nil {
+		b.Fatalf("failed to load the keys: %s", err)
+	}
+
+	return tree
+}
+
+// benchmarkKeys returns the given number of the keys in ascending order.
+func benchmarkKeys(n int) [][]byte {
+	keys := make([][]byte, n)
+	for i := range keys {
+		keys[i] = encodeUint32(uint32(i))
+	}
+
+	return keys
+}
+
+// shuffledKeys returns the given number of the keys in the same random order
+// for every run.
+func shuffledKeys(n int) [][]byte {
+	keys := benchmarkKeys(n)
+	r := rand.New(rand.NewSource(1))
+	r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	return keys
+}
+
+func BenchmarkSequentialPut(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree, err := Open(dbPath, options...)
+		if err != nil {
+			b.Fatalf("failed to open tree: %s", err)
+		}
+		defer tree.Close()
+
+		keys := benchmarkKeys(b.N)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, _, err := tree.Put(keys[i], keys[i]); err != nil {
+				b.Fatalf("failed to put: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkRandomPut(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree, err := Open(dbPath, options...)
+		if err != nil {
+			b.Fatalf("failed to open tree: %s", err)
+		}
+		defer tree.Close()
+
+		keys := shuffledKeys(b.N)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, _, err := tree.Put(keys[i], keys[i]); err != nil {
+				b.Fatalf("failed to put: %s", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree := openBenchmarkTree(b, dbPath, options, benchmarkSize)
+		defer tree.Close()
+
+		keys := shuffledKeys(benchmarkSize)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, ok, err := tree.Get(keys[i%benchmarkSize]); err != nil || !ok {
+				b.Fatalf("failed to get: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkScan(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree := openBenchmarkTree(b, dbPath, options, benchmarkSize)
+		defer tree.Close()
+
+		keys := shuffledKeys(benchmarkSize - benchmarkScanSize)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			start := keys[i%len(keys)]
+			it, err := tree.Scan(start, nil)
+			if err != nil {
+				b.Fatalf("failed to scan: %s", err)
+			}
+
+			for j := 0; j < benchmarkScanSize && it.HasNext(); j++ {
+				if _, _, err := it.Next(); err != nil {
+					b.Fatalf("failed to get the next entry: %s", err)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkDelete(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree := openBenchmarkTree(b, dbPath, options, b.N)
+		defer tree.Close()
+
+		keys := shuffledKeys(b.N)
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			if _, ok, err := tree.Delete(keys[i]); err != nil || !ok {
+				b.Fatalf("failed to delete: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkReopen(b *testing.B) {
+	benchmarkTree(b, func(b *testing.B, dbPath string, options []func(*config) error) {
+		tree := openBenchmarkTree(b, dbPath, options, benchmarkSize)
+		if err := tree.Close(); err != nil {
+			b.Fatalf("failed to close tree: %s", err)
+		}
+		b.ResetTimer()
+
+		for i := 0; i < b.N; i++ {
+			tree, err := Open(dbPath, options...)
+			if err != nil {
+				b.Fatalf("failed to open tree: %s", err)
+			}
+
+			if err := tree.Close(); err != nil {
+				b.Fatalf("failed to close tree: %s", err)
+			}
+		}
+	})
+}
+
+// the map benchmarks are the baseline for the tree benchmarks
+
+func BenchmarkMapPut(b *testing.B) {
+	m := make(map[string][]byte)
+	keys := shuffledKeys(b.N)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m[string(keys[i])] = keys[i]
+	}
+}
+
+func BenchmarkMapGet(b *testing.B) {
+	m := make(map[string][]byte)
+	for _, key := range benchmarkKeys(benchmarkSize) {
+		m[string(key)] = key
+	}
+
+	keys := shuffledKeys(benchmarkSize)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, ok := m[string(keys[i%benchmarkSize])]; !ok {
+			b.Fatalf("failed to get")
+		}
+	}
+}
+
+func BenchmarkMapDelete(b *testing.B) {
+	m := make(map[string][]byte)
+	for _, key := range benchmarkKeys(b.N) {
+		m[string(key)] = key
+	}
+
+	keys := shuffledKeys(b.N)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		delete(m, string(keys[i]))
+	}
+}
@@ -0,0 +1,70 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Ceiling returns the smallest key that is greater than or equal to the
+// given key and its value. It returns false if there is no such key.
+func (t *FBPTree) Ceiling(key []byte) ([]byte, []byte, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, nil, false, ErrClosed
+	}
+
+	c := &Cursor{t: t}
+	if err := c.seek(key); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to seek the key: %w", err)
+	}
+
+	if !c.Valid() {
+		return nil, nil, false, nil
+	}
+
+	value, err := c.value()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	return c.Key(), value, true, nil
+}
+
+// Floor returns the largest key that is less than or equal to the given
+// key and its value. It returns false if there is no such key.
+func (t *FBPTree) Floor(key []byte) ([]byte, []byte, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, nil, false, ErrClosed
+	}
+
+	c := &Cursor{t: t}
+	if err := c.seek(key); err != nil {
+		return nil, nil, false, fmt.Errorf("failed to seek the key: %w", err)
+	}
+
+	if !c.Valid() {
+		// all the keys are less than the key
+		if err := c.descendFromRoot(true); err != nil {
+			return nil, nil, false, fmt.Errorf("failed to find the last key: %w", err)
+		}
+	} else if t.less(key, c.Key()) {
+		if err := c.prev(); err != nil {
+			return nil, nil, false, fmt.Errorf("failed to move to the previous key: %w", err)
+		}
+	}
+
+	if !c.Valid() {
+		return nil, nil, false, nil
+	}
+
+	value, err := c.value()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	return c.Key(), value, true, nil
+}
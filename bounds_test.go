@@ -0,0 +1,67 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFloorAndCeiling(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, ok, err := tree.Floor([]byte{1}); err != nil || ok {
+		t.Fatalf("expected no floor in the empty tree, but got %v, %v", ok, err)
+	}
+	if _, _, ok, err := tree.Ceiling([]byte{1}); err != nil || ok {
+		t.Fatalf("expected no ceiling in the empty tree, but got %v, %v", ok, err)
+	}
+
+	// the even keys from 10 to 98
+	for i := 10; i < 100; i += 2 {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i), byte(i)}); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	for i := 0; i < 110; i++ {
+		floor, ceiling := -1, -1
+		for k := 10; k < 100; k += 2 {
+			if k <= i {
+				floor = k
+			}
+			if k >= i && ceiling == -1 {
+				ceiling = k
+			}
+		}
+
+		key, value, ok, err := tree.Floor([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("failed to find the floor of %d: %s", i, err)
+		}
+		if ok != (floor != -1) || (ok && (!bytes.Equal(key, []byte{byte(floor)}) || !bytes.Equal(value, []byte{byte(floor), byte(floor)}))) {
+			t.Fatalf("expected the floor %d of %d, but got %v, %v", floor, i, key, ok)
+		}
+
+		key, value, ok, err = tree.Ceiling([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("failed to find the ceiling of %d: %s", i, err)
+		}
+		if ok != (ceiling != -1) || (ok && (!bytes.Equal(key, []byte{byte(ceiling)}) || !bytes.Equal(value, []byte{byte(ceiling), byte(ceiling)}))) {
+			t.Fatalf("expected the ceiling %d of %d, but got %v, %v", ceiling, i, key, ok)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package fbptree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// dirtyNode is the encoded node buffered until the end of the write.
+type dirtyNode struct {
+	data []byte
+	// the size of the tails of the long keys at the end of the data,
+	// they are written into the key record of the node
+	tailSize int
+}
+
+// bufferNodes starts buffering the written nodes until flushNodes, so the
+// node changed several times by the split or the merge, or by the
+// operations of the batch, is written to the file once.
+func (s *storage) bufferNodes() {
+	if s.dirty == nil {
+		s.dirty = make(map[uint32]*dirtyNode)
+	}
+}
+
+// flushNodes writes the buffered nodes in the order of their pages
+// and stops buffering.
+func (s *storage) flushNodes() error {
+	if s.dirty == nil {
+		return nil
+	}
+
+	nodeIDs := make([]uint32, 0, len(s.dirty))
+	for nodeID := range s.dirty {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Slice(nodeIDs, func(i, j int) bool { return nodeIDs[i] < nodeIDs[j] })
+
+	for _, nodeID := range nodeIDs {
+		d := s.dirty[nodeID]
+		if err := s.writeNode(nodeID, d.data, d.tailSize); err != nil {
+			s.discardNodes()
+
+			return err
+		}
+		delete(s.dirty, nodeID)
+	}
+	s.dirty = nil
+
+	return nil
+}
+
+// discardNodes drops the buffered nodes and stops buffering.
+func (s *storage) discardNodes() {
+	if len(s.dirty) > 0 {
+		// the cached nodes are not written to the file
+		s.cache.clear()
+	}
+	s.dirty = nil
+}
+
+// writeNode writes the encoded node into its record and the tails
+// of its long keys into the key record.
+func (s *storage) writeNode(nodeID uint32, data []byte, tailSize int) error {
+	err := s.records.write(nodeID, data[:len(data)-tailSize])
+	if err == nil && tailSize > 0 {
+		err = s.records.write(keyRecordOf(data), data[len(data)-tailSize:])
+	}
+
+	if err != nil {
+		// the record might be partially written
+		s.cache.remove(nodeID)
+
+		return fmt.Errorf("failed to write the record %d: %w", nodeID, err)
+	}
+
+	return nil
+}
+
+// bufferedNode returns the encoded node from the cache or from the buffer,
+// the buffered node may be evicted from the cache.
+func (s *storage) bufferedNode(nodeID uint32) ([]byte, bool) {
+	if data, ok := s.cache.get(nodeID); ok {
+		return data, true
+	}
+
+	if d, ok := s.dirty[nodeID]; ok {
+		return d.data, true
+	}
+
+	return nil, false
+}
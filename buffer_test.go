@@ -0,0 +1,125 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestBufferedNodes(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put([]byte{1}, []byte{0}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	storage := tree.storage
+	rootID := tree.metadata.rootID
+	writes := storage.stats().writes
+
+	storage.bufferNodes()
+	for i := 1; i <= 3; i++ {
+		root, err := storage.loadNodeByID(rootID)
+		if err != nil {
+			t.Fatalf("failed to load the root: %s", err)
+		}
+
+		root.pointers[0] = &pointer{value: []byte{byte(i)}}
+		if err := storage.updateNodeByID(rootID, root); err != nil {
+			t.Fatalf("failed to update the root: %s", err)
+		}
+	}
+
+	if storage.stats().writes != writes {
+		t.Fatalf("expected the buffered node not to be written, but got %d writes", storage.stats().writes-writes)
+	}
+
+	// the buffered node is found when it is evicted from the cache
+	storage.cache.clear()
+	root, err := storage.loadNodeByID(rootID)
+	if err != nil {
+		t.Fatalf("failed to load the root: %s", err)
+	}
+	if value := root.pointers[0].asValue(); value[0] != 3 {
+		t.Fatalf("expected the buffered value 3, but got %d", value[0])
+	}
+
+	if err := storage.flushNodes(); err != nil {
+		t.Fatalf("failed to flush the nodes: %s", err)
+	}
+	if storage.stats().writes != writes+1 {
+		t.Fatalf("expected the node to be written once, but got %d writes", storage.stats().writes-writes)
+	}
+
+	storage.cache.clear()
+	if value, ok, err := tree.Get([]byte{1}); err != nil || !ok || value[0] != 3 {
+		t.Fatalf("expected the flushed value 3, but got %v, %v, %v", value, ok, err)
+	}
+}
+
+func TestBufferedNodesDiscardedOnRollback(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	for i := 10; i < 20; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tx.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back the transaction: %s", err)
+	}
+
+	if len(tree.storage.dirty) != 0 {
+		t.Fatalf("expected no buffered nodes, but got %d", len(tree.storage.dirty))
+	}
+	if tree.Size() != 10 {
+		t.Fatalf("expected size 10, but got %d", tree.Size())
+	}
+	if _, ok, err := tree.Get(encodeUint32(15)); err != nil || ok {
+		t.Fatalf("expected the key of the failed transaction to be missing: %v", err)
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
@@ -0,0 +1,211 @@
+package fbptree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// DeleteMany deletes the values by the keys and returns the number of
+// the deleted keys. The keys are sorted, so the keys that belong to the same leaf
+// are deleted with a single leaf visit and write, the rebalancing happens only
+// when the leaf underflows and the tree size is updated once.
+func (t *FBPTree) DeleteMany(keys [][]byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	op := t.beginOperation()
+	deleted, err := t.deleteMany(keys)
+	err = t.endWrite(w, err)
+
+	keySize := 0
+	for _, key := range keys {
+		keySize += len(key)
+	}
+	t.endOperation(op, OperationDeleteMany, keySize, 0, err)
+
+	return deleted, err
+}
+
+func (t *FBPTree) deleteMany(keys [][]byte) (int, error) {
+	sorted := t.sortedUniqueKeys(keys)
+
+	deleted := 0
+	for i := 0; i < len(sorted) && t.metadata != nil; {
+		leaf, err := t.descend(sorted[i])
+		if err != nil {
+			return deleted, fmt.Errorf("failed to find the leaf: %w", err)
+		}
+
+		removed := make([][]byte, 0)
+		// the values of the removed keys, their overflow records are freed
+		freed := make([]*pointer, 0)
+		underflow := false
+		parentID := t.parentOf(leaf)
+		for first := true; i < len(sorted); first = false {
+			key := sorted[i]
+			if !first && (leaf.keyNum == 0 || t.compare(key, leaf.keys[leaf.keyNum-1]) > 0) {
+				// the key belongs to the next leaves
+				break
+			}
+
+			position := leaf.keyPosition(key, t.compare)
+			if position == -1 {
+				i++
+				continue
+			}
+
+			if (parentID == 0 && leaf.keyNum == 1) || (parentID != 0 && leaf.keyNum-1 < t.minKeyNum) {
+				underflow = true
+				break
+			}
+
+			freed = append(freed, leaf.pointers[position])
+			leaf.deleteAt(position, position)
+			removed = append(removed, key)
+			i++
+		}
+
+		if len(removed) > 0 {
+			if err := t.storage.updateNodeByID(leaf.id, leaf); err != nil {
+				return deleted, fmt.Errorf("failed to update the leaf %d: %w", leaf.id, err)
+			}
+
+			for _, p := range freed {
+				if err := t.storage.freeValue(p); err != nil {
+					return deleted, err
+				}
+			}
+
+			if err := t.addToCounts(leaf, -len(removed)); err != nil {
+				return deleted, fmt.Errorf("failed to update the counts of the keys: %w", err)
+			}
+
+			if parentID != 0 {
+				for _, key := range removed {
+					if err := t.removeFromIndex(key); err != nil {
+						return deleted, fmt.Errorf("failed to remove the key from the index: %w", err)
+					}
+				}
+			}
+
+			deleted += len(removed)
+		}
+
+		if underflow {
+			// the leaf requires rebalancing, so the key is deleted one by one
+			_, ok, err := t.deleteAtLeafAndRebalance(leaf, sorted[i])
+			if err != nil {
+				return deleted, fmt.Errorf("failed to delete and rebalance: %w", err)
+			}
+			if ok {
+				deleted++
+			}
+
+			i++
+		}
+	}
+
+	t.storage.lifetime.Deletes += uint64(deleted)
+	if t.metadata != nil && deleted > 0 {
+		t.metadata.size -= uint32(deleted)
+		if err := t.updateSize(t.metadata.size); err != nil {
+			return deleted, fmt.Errorf("failed to update the tree size to %d: %w", t.metadata.size, err)
+		}
+	}
+
+	return deleted, nil
+}
+
+// GetMany returns the values by the keys and whether they are found, in
+// the order of the given keys. The keys are sorted and looked up in one pass
+// from left to right, so the keys that belong to the same leaf are answered
+// with a single leaf visit.
+func (t *FBPTree) GetMany(keys [][]byte) ([][]byte, []bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, nil, ErrClosed
+	}
+
+	op := t.beginOperation()
+	values, found, err := t.getMany(keys)
+
+	keySize, valueSize := 0, 0
+	for i, key := range keys {
+		keySize += len(key)
+		if err == nil {
+			valueSize += len(values[i])
+		}
+	}
+	t.endOperation(op, OperationGetMany, keySize, valueSize, err)
+
+	return values, found, err
+}
+
+func (t *FBPTree) getMany(keys [][]byte) ([][]byte, []bool, error) {
+	values := make([][]byte, len(keys))
+	found := make([]bool, len(keys))
+	if t.metadata == nil {
+		return values, found, nil
+	}
+
+	// the positions of the keys in ascending key order
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return t.less(keys[order[i]], keys[order[j]])
+	})
+
+	var leaf *node
+	for _, i := range order {
+		key := keys[i]
+		if leaf == nil || leaf.keyNum == 0 || t.compare(key, leaf.keys[leaf.keyNum-1]) > 0 {
+			// the key belongs to the next leaves
+			next, err := t.findLeaf(key)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to find the leaf: %w", err)
+			}
+			leaf = next
+		}
+
+		position := leaf.livePosition(key, t.compare)
+		if position == -1 {
+			continue
+		}
+
+		value, err := t.storage.readValue(leaf.pointers[position])
+		if err != nil {
+			return nil, nil, err
+		}
+		values[i] = value
+		found[i] = true
+	}
+
+	return values, found, nil
+}
+
+// sortedUniqueKeys returns the sorted copy of the keys without duplicates.
+func (t *FBPTree) sortedUniqueKeys(keys [][]byte) [][]byte {
+	sorted := make([][]byte, len(keys))
+	copy(sorted, keys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return t.less(sorted[i], sorted[j])
+	})
+
+	unique := sorted[:0]
+	for i, key := range sorted {
+		if i == 0 || t.compare(key, sorted[i-1]) != 0 {
+			unique = append(unique, key)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,140 @@
+package fbptree
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestDeleteMany(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	size := 2000
+	keys := r.Perm(size)
+
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for order := 3; order <= 7; order++ {
+		tree, err := Open(path.Join(dbDir, fmt.Sprintf("sample_%d.data", order)), Order(order), DebugChecks())
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for _, k := range keys {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			tree.Put(key, key)
+		}
+
+		// every odd key and some non-existent keys and duplicates
+		toDelete := make([][]byte, 0)
+		for _, k := range keys {
+			if k%2 == 1 {
+				key := make([]byte, 4)
+				binary.BigEndian.PutUint32(key, uint32(k))
+				toDelete = append(toDelete, key, key)
+			}
+		}
+		toDelete = append(toDelete, []byte{0xFF, 0xFF, 0xFF, 0xFF})
+
+		deleted, err := tree.DeleteMany(toDelete)
+		if err != nil {
+			t.Fatalf("failed to delete many, order %d: %s", order, err)
+		}
+		if deleted != size/2 {
+			t.Fatalf("expected %d deleted keys, but got %d, order %d", size/2, deleted, order)
+		}
+		if tree.Size() != size/2 {
+			t.Fatalf("expected size %d, but got %d, order %d", size/2, tree.Size(), order)
+		}
+
+		for k := 0; k < size; k++ {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			_, ok, err := tree.Get(key)
+			if err != nil {
+				t.Fatalf("failed to get key %d: %s", k, err)
+			}
+			if ok != (k%2 == 0) {
+				t.Fatalf("unexpected presence %v of key %d, order %d", ok, k, order)
+			}
+		}
+
+		all := make([][]byte, 0)
+		for k := 0; k < size; k++ {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			all = append(all, key)
+		}
+
+		deleted, err = tree.DeleteMany(all)
+		if err != nil {
+			t.Fatalf("failed to delete many, order %d: %s", order, err)
+		}
+		if deleted != size/2 || tree.Size() != 0 {
+			t.Fatalf("expected to delete the rest, but deleted %d, size %d", deleted, tree.Size())
+		}
+
+		tree.Close()
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, found, err := tree.GetMany([][]byte{{1}}); err != nil || found[0] {
+		t.Fatalf("expected no keys in the empty tree, but got %v, %v", found, err)
+	}
+
+	// the even keys are in the tree
+	for i := 0; i < 1000; i += 2 {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	keys := make([][]byte, 500)
+	for i := range keys {
+		keys[i] = make([]byte, 4)
+		binary.BigEndian.PutUint32(keys[i], uint32(r.Intn(1100)))
+	}
+
+	values, found, err := tree.GetMany(keys)
+	if err != nil {
+		t.Fatalf("failed to get many: %s", err)
+	}
+
+	for i, key := range keys {
+		value, ok, err := tree.Get(key)
+		if err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+
+		if found[i] != ok || string(values[i]) != string(value) {
+			t.Fatalf("expected %v, %v for the key %v, but got %v, %v", value, ok, key, values[i], found[i])
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package fbptree
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// the default number of the nodes in the cache
+const defaultCacheSize = 1024
+
+// CacheSize option sets the maximum number of the nodes kept in the LRU
+// cache of the tree, 1024 by default. Every open tree has its own cache.
+// The zero size disables the cache.
+func CacheSize(size int) func(*config) error {
+	return func(c *config) error {
+		if size < 0 {
+			return fmt.Errorf("cache size must be >= 0")
+		}
+
+		c.cacheSize = size
+
+		return nil
+	}
+}
+
+// nodeCache is the LRU cache of the encoded nodes by their identifiers.
+// The nodes are cached encoded, so the decoded nodes are never shared.
+// It is safe for the concurrent use by the readers.
+type nodeCache struct {
+	mu sync.Mutex
+
+	capacity int
+	entries  map[uint32]*list.Element
+	// the most recently used entries are at the front
+	order *list.List
+}
+
+type cacheEntry struct {
+	id   uint32
+	data []byte
+}
+
+// newNodeCache instantiates the cache for the given number of the nodes,
+// the zero capacity disables the cache.
+func newNodeCache(capacity int) *nodeCache {
+	return &nodeCache{
+		capacity: capacity,
+		entries:  make(map[uint32]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the encoded node and marks it as recently used.
+func (c *nodeCache) get(id uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+
+	return element.Value.(*cacheEntry).data, true
+}
+
+// contains returns true if the node is cached without marking it as used.
+func (c *nodeCache) contains(id uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.entries[id]
+
+	return ok
+}
+
+// put caches the encoded node and evicts the least recently used one
+// if the cache is full.
+func (c *nodeCache) put(id uint32, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.capacity <= 0 {
+		return
+	}
+
+	if element, ok := c.entries[id]; ok {
+		element.Value.(*cacheEntry).data = data
+		c.order.MoveToFront(element)
+
+		return
+	}
+
+	c.entries[id] = c.order.PushFront(&cacheEntry{id, data})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+// remove removes the node from the cache.
+func (c *nodeCache) remove(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.order.Remove(element)
+		delete(c.entries, id)
+	}
+}
+
+// clear removes all the nodes from the cache.
+func (c *nodeCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[uint32]*list.Element)
+	c.order.Init()
+}
+
+// clone returns the copy of the cache with the same nodes in the same order.
+func (c *nodeCache) clone() *nodeCache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clone := newNodeCache(c.capacity)
+	for element := c.order.Back(); element != nil; element = element.Prev() {
+		entry := element.Value.(*cacheEntry)
+		clone.entries[entry.id] = clone.order.PushFront(&cacheEntry{entry.id, entry.data})
+	}
+
+	return clone
+}
+
+// len returns the number of the cached nodes.
+func (c *nodeCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
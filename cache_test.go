@@ -0,0 +1,96 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNodeCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newNodeCache(2)
+
+	c.put(1, []byte{1})
+	c.put(2, []byte{2})
+	if _, ok := c.get(1); !ok {
+		t.Fatal("node 1 must be cached")
+	}
+
+	c.put(3, []byte{3})
+	if c.contains(2) {
+		t.Fatal("node 2 must be evicted as the least recently used")
+	}
+	if !c.contains(1) || !c.contains(3) {
+		t.Fatal("nodes 1 and 3 must be cached")
+	}
+
+	c.put(1, []byte{4})
+	if data, _ := c.get(1); !bytes.Equal(data, []byte{4}) {
+		t.Fatalf("expected the updated data, but got %v", data)
+	}
+
+	c.remove(1)
+	if c.contains(1) || c.len() != 1 {
+		t.Fatal("node 1 must be removed")
+	}
+}
+
+func TestNodeCacheDisabled(t *testing.T) {
+	c := newNodeCache(0)
+
+	c.put(1, []byte{1})
+	if c.contains(1) {
+		t.Fatal("the disabled cache must not cache")
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if _, err := Open(path.Join(dbDir, "invalid.data"), CacheSize(-1)); err == nil {
+		t.Fatalf("expected an error for the negative cache size")
+	}
+
+	small, err := Open(path.Join(dbDir, "small.data"), Order(3), CacheSize(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer small.Close()
+
+	disabled, err := Open(path.Join(dbDir, "disabled.data"), Order(3), CacheSize(0))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer disabled.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		for _, tree := range []*FBPTree{small, disabled} {
+			if _, _, err := tree.Put(key, key); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+	}
+
+	// the trees do not share the cache
+	if small.storage.cache.len() != 4 {
+		t.Fatalf("expected 4 cached nodes, but got %d", small.storage.cache.len())
+	}
+	if disabled.storage.cache.len() != 0 {
+		t.Fatalf("expected no cached nodes, but got %d", disabled.storage.cache.len())
+	}
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if value, ok, err := disabled.Get(key); err != nil || !ok || !bytes.Equal(value, key) {
+			t.Fatalf("expected the value of key %d, but got %v, %v, %v", i, value, ok, err)
+		}
+	}
+}
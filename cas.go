@@ -0,0 +1,80 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// CompareAndPut atomically puts the value only if the current value of the
+// key equals the expected one and returns true if the value is put. The nil
+// expected value means that the key must not exist, the empty one matches
+// the empty value. It enables the optimistic concurrency for the stores
+// built on top of the tree.
+func (t *FBPTree) CompareAndPut(key, expected, value []byte) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return false, err
+	}
+
+	op := t.beginOperation()
+	swapped, err := t.compareAndPut(key, expected, value)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationCompareAndPut, len(key), len(value), err)
+
+	return swapped, err
+}
+
+func (t *FBPTree) compareAndPut(key, expected, value []byte) (bool, error) {
+	if value == nil {
+		// the empty values are stored as the presence markers
+		value = []byte{}
+	}
+
+	if err := t.checkPut(key, value); err != nil {
+		return false, err
+	}
+
+	if t.metadata == nil {
+		if expected != nil {
+			return false, nil
+		}
+
+		if err := t.initializeRoot(key, value); err != nil {
+			return false, fmt.Errorf("failed to initialize root: %w", err)
+		}
+
+		return true, nil
+	}
+
+	leaf, err := t.descend(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	position := leaf.livePosition(key, t.compare)
+	if position == -1 && expected != nil {
+		return false, nil
+	}
+	if position != -1 && expected == nil {
+		return false, nil
+	}
+	if position != -1 {
+		current, err := t.storage.readValue(leaf.pointers[position])
+		if err != nil {
+			return false, fmt.Errorf("failed to read the value: %w", err)
+		}
+
+		if !bytes.Equal(current, expected) {
+			return false, nil
+		}
+	}
+
+	if _, _, err := t.putIntoLeaf(leaf, key, value); err != nil {
+		return false, fmt.Errorf("failed to put into the leaf %d: %w", leaf.id, err)
+	}
+
+	return true, nil
+}
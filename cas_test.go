@@ -0,0 +1,66 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCompareAndPut(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	cases := []struct {
+		key      byte
+		expected []byte
+		value    []byte
+		swapped  bool
+	}{
+		// the key must exist, but the tree is empty
+		{1, []byte{1}, []byte{2}, false},
+		{1, nil, []byte{1}, true},
+		{1, nil, []byte{2}, false},
+		{1, []byte{2}, []byte{3}, false},
+		{1, []byte{1}, []byte{3}, true},
+		{1, []byte{3}, nil, true},
+		// the empty value matches the presence marker
+		{1, []byte{}, []byte{4}, true},
+		{2, []byte{4}, []byte{5}, false},
+		{2, nil, []byte{5}, true},
+	}
+
+	for i, c := range cases {
+		swapped, err := tree.CompareAndPut([]byte{c.key}, c.expected, c.value)
+		if err != nil {
+			t.Fatalf("case %d: failed to compare and put: %s", i, err)
+		}
+
+		if swapped != c.swapped {
+			t.Fatalf("case %d: expected swapped %v, but got %v", i, c.swapped, swapped)
+		}
+	}
+
+	for key, expected := range map[byte][]byte{1: {4}, 2: {5}} {
+		value, ok, err := tree.Get([]byte{key})
+		if err != nil || !ok || !bytes.Equal(value, expected) {
+			t.Fatalf("expected value %v for key %d, but got %v, %v, %v", expected, key, value, ok, err)
+		}
+	}
+
+	if tree.Size() != 2 {
+		t.Fatalf("expected size 2, but got %d", tree.Size())
+	}
+}
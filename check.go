@@ -0,0 +1,371 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// DebugChecks option validates the node invariants (sorted keys, key number
+// bounds and pointer kinds) before every node write and the minimum fill of
+// the changed nodes at the end of every write, and fails the operation on the
+// first violation, so the structural bugs surface at the faulty operation
+// during the development rather than as a corrupted file later.
+func DebugChecks() func(*config) error {
+	return func(c *config) error {
+		c.debugChecks = true
+
+		return nil
+	}
+}
+
+// validate checks the invariants of the single node,
+// it must have at least the given number of the keys.
+func (n *node) validate(compare func(x, y []byte) int, minKeyNum int) error {
+	if len(n.pointers) != len(n.keys)+1 {
+		return fmt.Errorf("node %d has %d pointers for %d keys", n.id, len(n.pointers), len(n.keys))
+	}
+
+	if n.keyNum < 0 || n.keyNum > len(n.keys) {
+		return fmt.Errorf("node %d has key number %d out of bounds [0, %d]", n.id, n.keyNum, len(n.keys))
+	}
+
+	if n.keyNum < minKeyNum {
+		return fmt.Errorf("node %d has %d keys, but the minimum is %d", n.id, n.keyNum, minKeyNum)
+	}
+
+	for i := 1; i < n.keyNum; i++ {
+		if compare(n.keys[i-1], n.keys[i]) >= 0 {
+			return fmt.Errorf("node %d keys are not sorted at position %d", n.id, i)
+		}
+	}
+
+	if n.leaf {
+		for i := 0; i < n.keyNum; i++ {
+			if n.pointers[i] == nil || !(n.pointers[i].isValue() || n.pointers[i].isOverflow()) {
+				return fmt.Errorf("leaf node %d pointer %d is not a value", n.id, i)
+			}
+		}
+
+		if next := n.next(); next != nil && !next.isNodeID() {
+			return fmt.Errorf("leaf node %d next pointer is not a node", n.id)
+		}
+
+		return nil
+	}
+
+	for i := 0; i <= n.keyNum; i++ {
+		if n.pointers[i] == nil || !n.pointers[i].isNodeID() {
+			return fmt.Errorf("internal node %d pointer %d is not a node", n.id, i)
+		}
+
+		if n.pointers[i].asNodeID() == n.id {
+			return fmt.Errorf("internal node %d points to itself", n.id)
+		}
+	}
+
+	return nil
+}
+
+// minKeysOf returns the minimum number of the keys of the node, the root
+// may have any number of the keys and the nodes split by the size may
+// have fewer keys than the order requires.
+func (t *FBPTree) minKeysOf(n *node, root bool) int {
+	if root {
+		return 0
+	}
+
+	if t.maxNodeSize != 0 {
+		return 1
+	}
+
+	return t.minKeyNum
+}
+
+// validateWrite validates the nodes changed by the write, their fill is
+// validated once the write is complete, since the nodes underflow in the
+// middle of the rebalancing.
+func (t *FBPTree) validateWrite() error {
+	for nodeID, d := range t.storage.dirty {
+		n, err := decodeNode(copyBytes(d.data))
+		if err != nil {
+			return fmt.Errorf("failed to decode node %d: %w", nodeID, err)
+		}
+
+		root := t.metadata == nil || t.metadata.rootID == nodeID
+		if err := n.validate(t.compare, t.minKeysOf(n, root)); err != nil {
+			return fmt.Errorf("node invariant is violated: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// CheckProblem is the violated invariant found by Check.
+type CheckProblem struct {
+	// Page is the identifier of the node or the page the problem refers
+	// to, zero if the problem refers to the whole tree.
+	Page uint32
+	// Reason describes the violated invariant.
+	Reason string
+}
+
+func (p CheckProblem) String() string {
+	if p.Page == 0 {
+		return p.Reason
+	}
+
+	return fmt.Sprintf("page %d: %s", p.Page, p.Reason)
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	// Nodes is the number of the reachable nodes.
+	Nodes int
+	// Entries is the number of the entries in the reachable leaves.
+	Entries int
+	// Pages is the number of the pages in use by the tree and the free page lists.
+	Pages int
+	// FreePages is the number of the free pages.
+	FreePages int
+	// Problems are the violated invariants, empty for the consistent tree.
+	Problems []CheckProblem
+}
+
+// OK returns true if no problems are found.
+func (r *CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Check walks the whole tree reading every node from the file, bypassing
+// the cache, and verifies the key ordering within the separator bounds, the
+// node fill, the leaf chain, the tree size and that
+// every page in use exists, is used once and is not free. Unlike HealthCheck
+// it reads the whole tree. The found problems are reported, the error is
+// returned only if the check itself fails.
+func (t *FBPTree) Check() (*CheckReport, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	return t.check().report, nil
+}
+
+// check walks the whole tree and returns the checker
+// with the report and the pages in use.
+func (t *FBPTree) check() *checker {
+	c := &checker{
+		t:      t,
+		report: &CheckReport{},
+		used:   make(map[uint32]uint32),
+		nextOf: make(map[uint32]uint32),
+		prevOf: make(map[uint32]uint32),
+	}
+
+	pager := t.storage.pager
+	for pageID := range pager.freePages {
+		// the free page lists occupy the pages too
+		c.use(pageID, 0)
+	}
+
+	if t.metadata != nil {
+		c.walk(t.metadata.rootID, 0, nil, nil, 0)
+		c.checkLeafChain()
+
+		if c.report.Entries != int(t.metadata.size) {
+			c.problem(0, "the tree size is %d, but the leaves have %d entries", t.metadata.size, c.report.Entries)
+		}
+	}
+
+	for pageID := range pager.isFreePage {
+		c.report.FreePages++
+
+		if pageID > pager.lastPageId {
+			c.problem(pageID, "the free page does not exist, the last page is %d", pager.lastPageId)
+		} else if owner, ok := c.used[pageID]; ok {
+			c.problem(pageID, "the page is free, but it is used by record %d", owner)
+		}
+	}
+	c.report.Pages = len(c.used)
+
+	return c
+}
+
+// checker collects the problems of the tree walk.
+type checker struct {
+	t      *FBPTree
+	report *CheckReport
+
+	// the pages in use and the records that use them,
+	// zero for the free page lists
+	used map[uint32]uint32
+	// the leaves in the key order and their next and previous leaves
+	leaves    []uint32
+	nextOf    map[uint32]uint32
+	prevOf    map[uint32]uint32
+	leafDepth int
+}
+
+func (c *checker) problem(page uint32, format string, args ...interface{}) {
+	c.report.Problems = append(c.report.Problems, CheckProblem{page, fmt.Sprintf(format, args...)})
+}
+
+// use marks the page as used by the record, returns false if the page
+// can not be used.
+func (c *checker) use(pageID, recordID uint32) bool {
+	if pageID == 0 || pageID > c.t.storage.pager.lastPageId {
+		c.problem(recordID, "page %d does not exist, the last page is %d", pageID, c.t.storage.pager.lastPageId)
+
+		return false
+	}
+
+	if owner, ok := c.used[pageID]; ok {
+		c.problem(recordID, "page %d is already used by record %d", pageID, owner)
+
+		return false
+	}
+	c.used[pageID] = recordID
+
+	return true
+}
+
+// useRecord marks all the pages of the record as used, returns false if
+// the record can not be used.
+func (c *checker) useRecord(recordID uint32) bool {
+	if !c.use(recordID, recordID) {
+		return false
+	}
+
+	pages, err := c.t.storage.records.pages(recordID)
+	if err != nil {
+		c.problem(recordID, "failed to read the record pages: %s", err)
+
+		return false
+	}
+
+	for _, pageID := range pages[1:] {
+		if !c.use(pageID, recordID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// walk checks the subtree of the node, its keys must be in [lower, upper)
+// range, the nil bounds are the tree bounds.
+func (c *checker) walk(nodeID, parentID uint32, lower, upper []byte, depth int) uint32 {
+	if !c.useRecord(nodeID) {
+		return 0
+	}
+
+	// the fill is not validated as for the root, it is reported below,
+	// so the subtree of the underflowed node is checked too
+	n, err := c.t.checkNode(nodeID, true)
+	if err != nil {
+		c.problem(nodeID, "%s", err)
+
+		return 0
+	}
+	c.report.Nodes++
+
+	if minKeyNum := c.t.minKeysOf(n, parentID == 0); n.keyNum < minKeyNum {
+		c.problem(nodeID, "the node has %d keys, but the minimum is %d", n.keyNum, minKeyNum)
+	} else if parentID == 0 && n.keyNum == 0 {
+		c.problem(nodeID, "the root has no keys")
+	}
+
+	for i := 0; i < n.keyNum; i++ {
+		if lower != nil && c.t.compare(n.keys[i], lower) < 0 {
+			c.problem(nodeID, "key %d is less than the lower bound of the subtree", i)
+		}
+		if upper != nil && c.t.compare(n.keys[i], upper) >= 0 {
+			c.problem(nodeID, "key %d is not less than the upper bound of the subtree", i)
+		}
+	}
+
+	if n.keyRecordID != 0 {
+		c.useRecord(n.keyRecordID)
+	}
+
+	if n.leaf {
+		if len(c.leaves) == 0 {
+			c.leafDepth = depth
+		} else if depth != c.leafDepth {
+			c.problem(nodeID, "the leaf is at depth %d, but the other leaves are at depth %d", depth, c.leafDepth)
+		}
+
+		for i := 0; i < n.keyNum; i++ {
+			if n.pointers[i].isOverflow() {
+				c.useRecord(n.pointers[i].asOverflow().recordID)
+			}
+		}
+
+		c.report.Entries += n.keyNum
+		c.leaves = append(c.leaves, nodeID)
+		if next := n.next(); next != nil {
+			c.nextOf[nodeID] = next.asNodeID()
+		}
+		c.prevOf[nodeID] = n.prevID
+
+		return uint32(n.keyNum)
+	}
+
+	for i := 0; i <= n.keyNum; i++ {
+		childLower, childUpper := lower, upper
+		if i > 0 {
+			childLower = n.keys[i-1]
+		}
+		if i < n.keyNum {
+			childUpper = n.keys[i]
+		}
+
+		childID := n.pointers[i].asNodeID()
+		count := c.walk(childID, nodeID, childLower, childUpper, depth+1)
+		if n.counted() && n.pointers[i].count != count {
+			c.problem(nodeID, "the count of the keys of the child %d is %d, but its subtree has %d keys", childID, n.pointers[i].count, count)
+		}
+	}
+
+	return n.size()
+}
+
+// checkLeafChain checks that the leaves are linked in the key order
+// starting from the leftmost leaf.
+func (c *checker) checkLeafChain() {
+	if len(c.leaves) == 0 {
+		return
+	}
+
+	if leftmostID := c.t.metadata.leftmostID; c.leaves[0] != leftmostID {
+		c.problem(0, "the leftmost leaf is %d, but the metadata refers to %d", c.leaves[0], leftmostID)
+	}
+
+	// the leaves of the read-only tree created before the links to the
+	// previous leaves were introduced have none
+	linked := false
+	for _, leafID := range c.leaves[1:] {
+		linked = linked || c.prevOf[leafID] != 0
+	}
+
+	for i, leafID := range c.leaves {
+		var expected uint32
+		if i+1 < len(c.leaves) {
+			expected = c.leaves[i+1]
+		}
+
+		if next := c.nextOf[leafID]; next != expected {
+			c.problem(leafID, "the leaf links to the next leaf %d, but the next leaf is %d", next, expected)
+		}
+
+		var expectedPrev uint32
+		if i > 0 {
+			expectedPrev = c.leaves[i-1]
+		}
+
+		if prev := c.prevOf[leafID]; linked && prev != expectedPrev {
+			c.problem(leafID, "the leaf links to the previous leaf %d, but the previous leaf is %d", prev, expectedPrev)
+		}
+	}
+}
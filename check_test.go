@@ -0,0 +1,199 @@
+package fbptree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestNodeValidate(t *testing.T) {
+	valid := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{1}, {2}},
+		keyNum:   2,
+		pointers: []*pointer{{value: []byte{1}}, {value: []byte{2}}, nil},
+	}
+	if err := valid.validate(bytes.Compare, 0); err != nil {
+		t.Fatalf("expected valid node, but got: %s", err)
+	}
+
+	unsorted := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{2}, {1}},
+		keyNum:   2,
+		pointers: []*pointer{{value: []byte{1}}, {value: []byte{2}}, nil},
+	}
+	if err := unsorted.validate(bytes.Compare, 0); err == nil {
+		t.Fatal("must return an error for unsorted keys")
+	}
+
+	wrongPointer := &node{
+		id:       1,
+		leaf:     false,
+		keys:     [][]byte{{1}, nil},
+		keyNum:   1,
+		pointers: []*pointer{{value: uint32(2)}, {value: []byte{2}}, nil},
+	}
+	if err := wrongPointer.validate(bytes.Compare, 0); err == nil {
+		t.Fatal("must return an error for the value pointer in the internal node")
+	}
+
+	overflow := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{1}, {2}},
+		keyNum:   3,
+		pointers: []*pointer{{value: []byte{1}}, {value: []byte{2}}, nil},
+	}
+	if err := overflow.validate(bytes.Compare, 0); err == nil {
+		t.Fatal("must return an error for the key number out of bounds")
+	}
+
+	if err := valid.validate(bytes.Compare, 3); err == nil {
+		t.Fatal("must return an error for the node with fewer keys than the minimum")
+	}
+}
+
+func TestDebugChecksRandomized(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+	keys := r.Perm(1000)
+
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for order := 3; order <= 7; order++ {
+		tree, err := Open(path.Join(dbDir, fmt.Sprintf("sample_%d.data", order)), Order(order), DebugChecks())
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for _, k := range keys {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			if _, _, err := tree.Put(key, key); err != nil {
+				t.Fatalf("failed to put key %d, order %d: %s", k, order, err)
+			}
+		}
+
+		for _, k := range keys {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			if _, _, err := tree.Delete(key); err != nil {
+				t.Fatalf("failed to delete key %d, order %d: %s", k, order, err)
+			}
+		}
+
+		tree.Close()
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := rand.New(rand.NewSource(time.Now().Unix()))
+
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for order := 3; order <= 7; order++ {
+		tree, err := Open(path.Join(dbDir, fmt.Sprintf("sample_%d.data", order)), PageSize(4096), Order(order))
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for _, k := range r.Perm(500) {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+
+			value := key
+			if k%100 == 0 {
+				value = bytes.Repeat(key, 20000)
+			}
+
+			if _, _, err := tree.Put(key, value); err != nil {
+				t.Fatalf("failed to put: %s", err)
+			}
+		}
+
+		for _, k := range r.Perm(500)[:300] {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, uint32(k))
+			if _, _, err := tree.Delete(key); err != nil {
+				t.Fatalf("failed to delete: %s", err)
+			}
+		}
+
+		report, err := tree.Check()
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if !report.OK() {
+			t.Fatalf("expected no problems for order %d, but got %v", order, report.Problems)
+		}
+		if report.Entries != 200 {
+			t.Fatalf("expected 200 entries, but got %d", report.Entries)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
+
+func TestCheckReportsProblems(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 20; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	leftmostID := tree.metadata.leftmostID
+	leaf, err := tree.storage.loadNodeByID(leftmostID)
+	if err != nil {
+		t.Fatalf("failed to load the leaf: %s", err)
+	}
+	// the key is out of the separator bounds
+	leaf.keys[leaf.keyNum-1] = []byte{100}
+	if err := tree.storage.updateNodeByID(leftmostID, leaf); err != nil {
+		t.Fatalf("failed to write the leaf: %s", err)
+	}
+	tree.metadata.size++
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if len(report.Problems) != 2 {
+		t.Fatalf("expected 2 problems, but got %v", report.Problems)
+	}
+	if report.Problems[0].Page != leftmostID || report.Problems[1].Page != 0 {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
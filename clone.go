@@ -0,0 +1,115 @@
+package fbptree
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// CloneTo creates the copy of the tree file by the path, which must not
+// exist. On the file systems that support reflinks, like XFS and Btrfs, the
+// copy is instant and shares the data blocks with the original until either
+// of them changes. Otherwise, the file is copied. The tree must not be
+// modified while it is cloned. The tree in memory is copied into the file.
+func (t *FBPTree) CloneTo(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	return t.cloneTo(path)
+}
+
+func (t *FBPTree) cloneTo(path string) error {
+	if err := t.storage.checkpoint(); err != nil {
+		return fmt.Errorf("failed to checkpoint the tree: %w", err)
+	}
+
+	if t.path == InMemory {
+		if err := copyToFile(t.storage.storedFile(), path); err != nil {
+			return fmt.Errorf("failed to copy the tree to %s: %w", path, err)
+		}
+
+		return nil
+	}
+
+	if err := cloneFile(t.path, path); err != nil {
+		return fmt.Errorf("failed to clone %s to %s: %w", t.path, path, err)
+	}
+
+	return nil
+}
+
+// cloneFile clones the source file into the new destination file.
+func cloneFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return createFile(dstPath, func(dst *os.File) error {
+		return copyFile(dst, src)
+	})
+}
+
+// copyToFile copies the content of the source file into the new destination file.
+func copyToFile(src randomAccessFile, dstPath string) error {
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	return createFile(dstPath, func(dst *os.File) error {
+		_, err := io.Copy(dst, io.NewSectionReader(src, 0, info.Size()))
+
+		return err
+	})
+}
+
+// createFile creates the new file, writes it and syncs it
+// or removes it if any step fails.
+func createFile(path string, write func(f *os.File) error) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+// copyFile copies the content of the source into the empty destination,
+// preferring the reflink.
+func copyFile(dst, src *os.File) error {
+	if err := reflink(dst, src); err == nil {
+		return nil
+	}
+
+	// on Linux the copy is done with copy_file_range when it is possible
+	_, err := io.Copy(dst, src)
+
+	return err
+}
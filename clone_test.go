@@ -0,0 +1,67 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCloneTo(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	clonePath := path.Join(dbDir, "clone.data")
+	if err := tree.CloneTo(clonePath); err != nil {
+		t.Fatalf("failed to clone: %s", err)
+	}
+
+	if err := tree.CloneTo(clonePath); err == nil {
+		t.Fatalf("expected an error for the existent file")
+	}
+
+	clone, err := Open(clonePath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open the clone: %s", err)
+	}
+	defer clone.Close()
+
+	expected := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		expected = append(expected, key, value)
+	})
+	actual := make([][]byte, 0)
+	clone.ForEach(func(key, value []byte) {
+		actual = append(actual, key, value)
+	})
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("the clone does not match the tree")
+	}
+
+	// the clone is independent of the tree
+	if _, _, err := clone.Delete(encodeUint32(0)); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	if _, ok, err := tree.Get(encodeUint32(0)); err != nil || !ok {
+		t.Fatalf("expected the key in the tree, but got %v, %v", ok, err)
+	}
+}
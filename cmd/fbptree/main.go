@@ -0,0 +1,170 @@
+// Command fbptree provides the maintenance utilities for the fbptree files.
+//
+// Usage:
+//
+//	fbptree upgrade <path>
+//	fbptree inspect <path> [page]
+//	fbptree repair <path> <repaired path>
+//
+// The inspect command lists the pages of the file with their roles or
+// prints the decoded headers and the hex dump of the given page. The repair
+// command rebuilds the damaged file into the new one, see fbptree.Repair.
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/krasun/fbptree"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "upgrade":
+		if len(os.Args) != 3 {
+			usage()
+		}
+
+		if err := upgrade(os.Args[2]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to upgrade %s: %s\n", os.Args[2], err)
+			os.Exit(1)
+		}
+	case "inspect":
+		if len(os.Args) != 3 && len(os.Args) != 4 {
+			usage()
+		}
+
+		if err := inspect(os.Args[2], os.Args[3:]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to inspect %s: %s\n", os.Args[2], err)
+			os.Exit(1)
+		}
+	case "repair":
+		if len(os.Args) != 4 {
+			usage()
+		}
+
+		if err := repair(os.Args[2], os.Args[3]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to repair %s: %s\n", os.Args[2], err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+func upgrade(path string) error {
+	lastPercent := -1
+	err := fbptree.Upgrade(path, func(done, total int) {
+		if percent := done * 100 / total; percent != lastPercent {
+			lastPercent = percent
+			fmt.Printf("\rupgrading %s: %d%%", path, percent)
+		}
+	})
+	if lastPercent != -1 {
+		fmt.Println()
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s is upgraded\n", path)
+
+	return nil
+}
+
+func inspect(path string, args []string) error {
+	r, err := fbptree.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if len(args) == 0 {
+		for pageID := 1; pageID <= r.Pages(); pageID++ {
+			page, err := r.Page(uint32(pageID))
+			if err != nil {
+				fmt.Printf("%d: %s\n", pageID, err)
+
+				continue
+			}
+
+			fmt.Printf("%d: %s, next page %d\n", page.ID, page.Kind, page.NextID)
+		}
+
+		return nil
+	}
+
+	pageID, err := strconv.ParseUint(args[0], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid page %s: %w", args[0], err)
+	}
+
+	page, err := r.Page(uint32(pageID))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("page %d: %s\n", page.ID, page.Kind)
+	fmt.Printf("next page: %d\n", page.NextID)
+	switch page.Kind {
+	case fbptree.PageFreeList:
+		fmt.Printf("free pages: %v\n", page.FreeIDs)
+	case fbptree.PageContinuation:
+		fmt.Printf("record: %d\n", page.RecordID)
+	default:
+		fmt.Printf("record size: %d\n", page.RecordSize)
+		fmt.Printf("checksum: %08x\n", page.Checksum)
+	}
+
+	if node := page.Node; node != nil {
+		keys := make([]string, len(node.Keys))
+		for i, key := range node.Keys {
+			keys[i] = fmt.Sprintf("%x", key)
+		}
+		fmt.Printf("keys: [%s]\n", strings.Join(keys, " "))
+
+		if node.Leaf {
+			fmt.Printf("leaf: prev %d, next %d\n", node.PrevID, node.NextID)
+		} else {
+			fmt.Printf("children: %v\n", node.Children)
+		}
+	}
+
+	fmt.Print(hex.Dump(page.Data))
+
+	return nil
+}
+
+func repair(path, dstPath string) error {
+	report, err := fbptree.Repair(path, dstPath)
+	if err != nil {
+		return err
+	}
+
+	if report.MetadataDamaged {
+		fmt.Println("the metadata is damaged")
+	}
+	if len(report.DamagedPages) > 0 {
+		fmt.Printf("damaged nodes: %v\n", report.DamagedPages)
+	}
+	fmt.Printf("%d keys are recovered into %s, %d of them are salvaged from the unreachable leaves\n", report.Keys, dstPath, report.Salvaged)
+	if report.LostValues > 0 {
+		fmt.Printf("%d keys are lost with their values\n", report.LostValues)
+	}
+
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fbptree upgrade <path>")
+	fmt.Fprintln(os.Stderr, "       fbptree inspect <path> [page]")
+	fmt.Fprintln(os.Stderr, "       fbptree repair <path> <repaired path>")
+	os.Exit(2)
+}
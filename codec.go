@@ -0,0 +1,148 @@
+package fbptree
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+)
+
+// the maximum length of the codec name
+const maxCodecNameSize = 255
+
+// Codec compresses the records of the tree: the nodes, the key records
+// and the overflow records of the large values. The records are encoded
+// before they are split into the pages and decoded after the pages are read,
+// so the compressible records take fewer pages. The name identifies the codec:
+// it is recorded in the file and the tree must be opened with the codec of
+// the same name every time. Snappy, zstd or any other compression is plugged
+// in by implementing the interface.
+type Codec interface {
+	// Name returns the name of the codec recorded in the file.
+	Name() string
+	// Encode returns the compressed data.
+	Encode(data []byte) ([]byte, error)
+	// Decode returns the data decompressed from the result of Encode.
+	Decode(data []byte) ([]byte, error)
+}
+
+// Compression option compresses the records with the given codec. The
+// records are rewritten entirely when they change, so the writes that change
+// a few bytes of the large values, like Append and WriteAt, write more pages.
+func Compression(codec Codec) func(*config) error {
+	return func(c *config) error {
+		if codec == nil {
+			return fmt.Errorf("codec must not be nil")
+		}
+
+		if err := checkCodecName(codec.Name()); err != nil {
+			return err
+		}
+
+		c.codec = codec
+
+		return nil
+	}
+}
+
+func checkCodecName(name string) error {
+	if name == "" {
+		return fmt.Errorf("codec name must not be empty")
+	}
+
+	if len(name) > maxCodecNameSize {
+		return fmt.Errorf("codec name must be less than or equal to %d bytes", maxCodecNameSize)
+	}
+
+	return nil
+}
+
+// codecName returns the name of the codec recorded in the file, empty if
+// the records are not compressed.
+func codecName(codec Codec) string {
+	if codec == nil {
+		return ""
+	}
+
+	return codec.Name()
+}
+
+// codecDescription describes the codec by its name for the errors.
+func codecDescription(name string) string {
+	if name == "" {
+		return "no"
+	}
+
+	return name
+}
+
+// FlateCodec returns the codec that compresses the records with DEFLATE
+// from the standard library.
+func FlateCodec() Codec {
+	return flateCodec{}
+}
+
+type flateCodec struct{}
+
+func (flateCodec) Name() string {
+	return "flate"
+}
+
+func (flateCodec) Encode(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (flateCodec) Decode(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// missingCodec fails to decode the records compressed with the codec that
+// is not given, so the metadata is still readable without it.
+type missingCodec struct {
+	name string
+}
+
+func (c missingCodec) Name() string {
+	return c.name
+}
+
+func (c missingCodec) Encode(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("the codec %s is not given", c.name)
+}
+
+func (c missingCodec) Decode(data []byte) ([]byte, error) {
+	return nil, fmt.Errorf("the codec %s is not given", c.name)
+}
+
+// resolveCodec returns the codec of the given name among the given codecs
+// and the built-in ones.
+func resolveCodec(name string, codecs []Codec) Codec {
+	if name == "" {
+		return nil
+	}
+
+	for _, codec := range append(codecs, FlateCodec()) {
+		if codec != nil && codec.Name() == name {
+			return codec
+		}
+	}
+
+	return missingCodec{name}
+}
@@ -0,0 +1,176 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+type reversingCodec struct{}
+
+func (reversingCodec) Name() string {
+	return "reversing"
+}
+
+func (reversingCodec) Encode(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func (reversingCodec) Decode(data []byte) ([]byte, error) {
+	return reverse(data), nil
+}
+
+func reverse(data []byte) []byte {
+	reversed := make([]byte, len(data))
+	for i := range data {
+		reversed[len(data)-1-i] = data[i]
+	}
+
+	return reversed
+}
+
+func TestCompression(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	sizes := make(map[string]int64)
+	for _, name := range []string{"plain.data", "compressed.data"} {
+		options := []func(*config) error{PageSize(4096), Order(100)}
+		if name == "compressed.data" {
+			options = append(options, Compression(FlateCodec()))
+		}
+
+		dbPath := path.Join(dbDir, name)
+		tree, err := Open(dbPath, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key-%04d", i))
+			if _, _, err := tree.Put(key, bytes.Repeat(key, 50)); err != nil {
+				t.Fatalf("failed to put: %s", err)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+
+		tree, err = Open(dbPath, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := []byte(fmt.Sprintf("key-%04d", i))
+			value, ok, err := tree.Get(key)
+			if err != nil {
+				t.Fatalf("failed to get: %s", err)
+			}
+			if !ok || !bytes.Equal(value, bytes.Repeat(key, 50)) {
+				t.Fatalf("unexpected value for key %s", key)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+
+		info, err := os.Stat(dbPath)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", dbPath, err)
+		}
+		sizes[name] = info.Size()
+	}
+
+	if sizes["compressed.data"]*2 > sizes["plain.data"] {
+		t.Fatalf("expected the compressed file of size %d to be at least two times smaller than %d", sizes["compressed.data"], sizes["plain.data"])
+	}
+
+	if _, err := Open(path.Join(dbDir, "compressed.data"), PageSize(4096), Order(100)); err == nil {
+		t.Fatalf("expected the error for the tree opened without the codec")
+	}
+
+	r, err := OpenReader(path.Join(dbDir, "compressed.data"))
+	if err != nil {
+		t.Fatalf("failed to open reader: %s", err)
+	}
+	defer r.Close()
+
+	count := 0
+	if err := r.ForEach(func(key, value []byte) { count++ }); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if count != 1000 {
+		t.Fatalf("expected 1000 entries, but got %d", count)
+	}
+}
+
+func TestCustomCodec(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), Compression(reversingCodec{}))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(3), Compression(FlateCodec())); err == nil {
+		t.Fatalf("expected the error for the tree opened with the other codec")
+	}
+
+	r, err := OpenReader(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open reader: %s", err)
+	}
+	if r.Size() != 10 {
+		t.Fatalf("expected size 10, but got %d", r.Size())
+	}
+	if err := r.ForEach(func(key, value []byte) {}); err == nil {
+		t.Fatalf("expected the error for the reader without the codec")
+	}
+	r.Close()
+
+	r, err = OpenReader(dbPath, reversingCodec{})
+	if err != nil {
+		t.Fatalf("failed to open reader: %s", err)
+	}
+	defer r.Close()
+
+	if err := r.ForEach(func(key, value []byte) {}); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+}
+
+func TestCompressionErrors(t *testing.T) {
+	if _, err := newConfig([]func(*config) error{Compression(nil)}); err == nil {
+		t.Fatalf("expected the error for the nil codec")
+	}
+
+	if _, err := newConfig([]func(*config) error{Compression(missingCodec{""})}); err == nil {
+		t.Fatalf("expected the error for the empty codec name")
+	}
+}
@@ -0,0 +1,54 @@
+package fbptree
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// the prefix of the key ordering name for the collations
+const collationPrefix = "collation:"
+
+// Collation option orders the keys as the human-language strings according
+// to the collation rules of the given locale, e.g. "en", "de" or
+// "sv-u-co-standard", instead of the raw bytes. The keys that are equal
+// according to the collation are the same key for the tree. The collation is
+// recorded in the file and the tree must be opened with the same collation
+// every time.
+func Collation(locale string) func(*config) error {
+	return func(c *config) error {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return fmt.Errorf("failed to parse the locale %s: %w", locale, err)
+		}
+
+		// the collator keeps the internal buffers, so the concurrent
+		// readers take their own collators from the pool
+		collators := &sync.Pool{
+			New: func() interface{} {
+				return collate.New(tag)
+			},
+		}
+
+		c.compare = func(x, y []byte) int {
+			collator := collators.Get().(*collate.Collator)
+			defer collators.Put(collator)
+
+			return collator.Compare(x, y)
+		}
+		c.ordering = collationPrefix + tag.String()
+
+		return nil
+	}
+}
+
+// orderingName returns the human-readable name of the key ordering.
+func orderingName(ordering string) string {
+	if ordering == "" {
+		return "byte"
+	}
+
+	return ordering
+}
@@ -0,0 +1,150 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCollation(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	words := []string{"zebra", "Apple", "éclair", "banana", "apple", "Zürich", "eclair", "Banana"}
+	for _, word := range words {
+		if _, _, err := tree.Put([]byte(word), []byte(word)); err != nil {
+			t.Fatalf("failed to put %s: %s", word, err)
+		}
+	}
+
+	expected := []string{"apple", "Apple", "banana", "Banana", "eclair", "éclair", "zebra", "Zürich"}
+	actual := make([]string, 0)
+	err = tree.ForEach(func(key, value []byte) {
+		actual = append(actual, string(key))
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(3)); err == nil {
+		t.Fatalf("expected the error on the key order mismatch")
+	}
+
+	if _, err := Open(dbPath, Order(3), Collation("sv")); err == nil {
+		t.Fatalf("expected the error on the collation mismatch")
+	}
+
+	tree, err = Open(dbPath, Order(3), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for _, word := range words {
+		value, ok, err := tree.Get([]byte(word))
+		if err != nil {
+			t.Fatalf("failed to get %s: %s", word, err)
+		}
+		if !ok || string(value) != word {
+			t.Fatalf("expected %s, but got %s", word, value)
+		}
+	}
+
+	for _, word := range words {
+		if _, ok, err := tree.Delete([]byte(word)); err != nil || !ok {
+			t.Fatalf("failed to delete %s: %v, %s", word, ok, err)
+		}
+	}
+
+	if tree.Size() != 0 {
+		t.Fatalf("expected the empty tree, but got size %d", tree.Size())
+	}
+}
+
+func TestCollationInvalidLocale(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if _, err := Open(path.Join(dbDir, "sample.data"), Collation("not a locale")); err == nil {
+		t.Fatalf("expected the error for the invalid locale")
+	}
+}
+
+func TestCollationConcurrentReads(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	words := make([]string, 0)
+	for i := 0; i < 200; i++ {
+		word := fmt.Sprintf("Wört-%d", i)
+		words = append(words, word)
+		if _, _, err := tree.Put([]byte(word), []byte(word)); err != nil {
+			t.Fatalf("failed to put %s: %s", word, err)
+		}
+	}
+
+	// the readers compare the keys in parallel, run with -race
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for _, word := range words {
+				value, ok, err := tree.Get([]byte(word))
+				if err != nil {
+					errs <- err
+
+					return
+				}
+				if !ok || string(value) != word {
+					errs <- fmt.Errorf("expected value %s, but got %s", word, value)
+
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatalf("failed to read concurrently: %s", err)
+	}
+}
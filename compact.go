@@ -0,0 +1,556 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Compact shrinks the file in place after the heavy deletes: the lost pages,
+// e.g. of the extents allocated before the crash, are freed, the records at
+// the end of the file are moved into the lowest free pages and the free pages
+// at the end are truncated, the free page lists are rebuilt in the lowest of
+// the remaining free pages. Unlike CompactRewrite it does not need the space
+// for the copy of the tree. It reads the whole tree and fails if Check
+// reports any problem.
+func (t *FBPTree) Compact() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return t.endWrite(w, t.compact())
+}
+
+func (t *FBPTree) compact() error {
+	c := t.check()
+	if !c.report.OK() {
+		return fmt.Errorf("the tree is not consistent: %s", c.report.Problems[0])
+	}
+
+	// the free page lists and the moved records take the lowest free pages
+	pager := t.storage.pager
+	pages := pager.lastPageId
+	pager.allocateLowest()
+	err := t.relocate(c.used)
+	pager.allocateAny()
+
+	if err != nil {
+		return err
+	}
+
+	// the moved nodes are written before the file is truncated
+	if err := t.storage.flushNodes(); err != nil {
+		return err
+	}
+
+	if err := pager.compact(); err != nil {
+		return fmt.Errorf("failed to truncate the free pages: %w", err)
+	}
+	t.storage.lifetime.Compactions++
+	debugf(t.logger, "compacted the file from %d to %d pages, %d free pages left", pages, pager.lastPageId, len(pager.isFreePage))
+
+	return nil
+}
+
+// relocate frees the lost pages and moves the records above the pages
+// in use into the free pages.
+func (t *FBPTree) relocate(used map[uint32]uint32) error {
+	// the pages that are neither in use nor free are lost
+	pager := t.storage.pager
+	for pageID := uint32(1); pageID <= pager.lastPageId; pageID++ {
+		if _, ok := used[pageID]; ok || pager.isFree(pageID) || pager.freePages[pageID] != nil {
+			continue
+		}
+
+		if err := pager.free(pageID); err != nil {
+			return fmt.Errorf("failed to free the lost page %d: %w", pageID, err)
+		}
+	}
+
+	if t.metadata == nil {
+		return nil
+	}
+
+	// the pages in use fit below the bound if there are no free pages
+	m := &mover{t: t, bound: pager.lastPageId - uint32(len(pager.isFreePage))}
+
+	return m.moveTree()
+}
+
+// mover moves the records that have the pages above the bound
+// into the new records.
+type mover struct {
+	t     *FBPTree
+	bound uint32
+
+	leftmostID uint32
+	// the leaf is written once the next leaf is moved
+	pending *movedNode
+}
+
+// movedNode is the node to write and its previous records to free.
+type movedNode struct {
+	n           *node
+	oldID       uint32
+	oldKeyRecID uint32
+	changed     bool
+}
+
+// moveTree moves the nodes of the tree and updates the metadata.
+func (m *mover) moveTree() error {
+	rootID, err := m.moveNode(m.t.metadata.rootID)
+	if err != nil {
+		return err
+	}
+
+	if err := m.write(m.pending); err != nil {
+		return err
+	}
+
+	metadata := m.t.metadata
+	if rootID == metadata.rootID && m.leftmostID == metadata.leftmostID {
+		return nil
+	}
+
+	if err := m.t.updateMetadata(rootID, m.leftmostID, metadata.size); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+
+	return nil
+}
+
+// moveNode moves the subtree of the node and returns the new node identifier.
+func (m *mover) moveNode(nodeID uint32) (uint32, error) {
+	n, err := m.t.storage.loadNodeByID(nodeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load node %d: %w", nodeID, err)
+	}
+
+	moved := &movedNode{n: n, oldID: nodeID}
+
+	if above, err := m.above(nodeID); err != nil {
+		return 0, err
+	} else if above {
+		if n.id, err = m.t.storage.newNode(); err != nil {
+			return 0, fmt.Errorf("failed to instantiate new node: %w", err)
+		}
+		moved.changed = true
+	}
+
+	if n.keyRecordID != 0 {
+		if above, err := m.above(n.keyRecordID); err != nil {
+			return 0, err
+		} else if above {
+			moved.oldKeyRecID = n.keyRecordID
+			if n.keyRecordID, err = m.t.storage.records.new(); err != nil {
+				return 0, fmt.Errorf("failed to instantiate the key record: %w", err)
+			}
+			moved.changed = true
+		}
+	}
+
+	if !n.leaf {
+		for i := 0; i <= n.keyNum; i++ {
+			childID, err := m.moveNode(n.pointers[i].asNodeID())
+			if err != nil {
+				return 0, err
+			}
+
+			if childID != n.pointers[i].asNodeID() {
+				n.pointers[i] = &pointer{value: childID, count: n.pointers[i].count}
+				moved.changed = true
+			}
+		}
+
+		return n.id, m.write(moved)
+	}
+
+	for i := 0; i < n.keyNum; i++ {
+		if !n.pointers[i].isOverflow() {
+			continue
+		}
+
+		p, err := m.moveValue(n.pointers[i])
+		if err != nil {
+			return 0, err
+		}
+
+		if p != n.pointers[i] {
+			n.pointers[i] = p
+			moved.changed = true
+		}
+	}
+
+	var prevID uint32
+	if m.pending != nil {
+		prevID = m.pending.n.id
+	}
+	if n.prevID != prevID {
+		n.prevID = prevID
+		moved.changed = true
+	}
+
+	if m.pending == nil {
+		m.leftmostID = n.id
+	} else {
+		prev := m.pending.n
+		if next := prev.next(); next == nil || next.asNodeID() != n.id {
+			prev.setNext(&pointer{value: n.id})
+			m.pending.changed = true
+		}
+
+		if err := m.write(m.pending); err != nil {
+			return 0, err
+		}
+	}
+	m.pending = moved
+
+	return n.id, nil
+}
+
+// moveValue moves the overflow record of the value if it is above the bound.
+func (m *mover) moveValue(p *pointer) (*pointer, error) {
+	recordID := p.asOverflow().recordID
+	if above, err := m.above(recordID); err != nil || !above {
+		return p, err
+	}
+
+	value, err := m.t.storage.readValue(p)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := m.t.storage.newValue(value)
+	if err != nil {
+		return nil, err
+	}
+	moved.expiresAt = p.expiresAt
+
+	if err := m.t.storage.freeValue(p); err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+// write writes the changed node and frees its previous records.
+func (m *mover) write(moved *movedNode) error {
+	if moved == nil || !moved.changed {
+		return nil
+	}
+
+	storage := m.t.storage
+	n := moved.n
+	if err := storage.updateNodeByID(n.id, n); err != nil {
+		return fmt.Errorf("failed to update node %d: %w", n.id, err)
+	}
+
+	if moved.oldKeyRecID != 0 {
+		if err := storage.records.free(moved.oldKeyRecID); err != nil {
+			return fmt.Errorf("failed to free the key record %d: %w", moved.oldKeyRecID, err)
+		}
+	}
+
+	if moved.oldID != n.id {
+		storage.cache.remove(moved.oldID)
+		storage.forgetLeaf(moved.oldID)
+
+		if err := storage.records.free(moved.oldID); err != nil {
+			return fmt.Errorf("failed to free the record %d: %w", moved.oldID, err)
+		}
+	}
+
+	return nil
+}
+
+// above returns true if any page of the record is above the bound.
+func (m *mover) above(recordID uint32) (bool, error) {
+	pages, err := m.t.storage.records.pages(recordID)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the pages of the record %d: %w", recordID, err)
+	}
+
+	for _, pageID := range pages {
+		if pageID > m.bound {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// CompactRewrite builds a fully compacted copy of the tree in a temporary
+// file in the same directory, atomically renames it over the original file
+// and syncs the directory. The original file is never modified, so the
+// failure at any step before the rename leaves it as it was.
+func (t *FBPTree) CompactRewrite() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.compactTo(t.path, nil)
+}
+
+// CompactTo streams all the entries into a freshly bulk-loaded tree file
+// with the same options and atomically renames it to the given path,
+// replacing the existing file. The copy is built in a temporary file in the
+// destination directory, so the destination is either left as it was or
+// replaced by the complete copy. The tree itself keeps its file, unless the
+// path is the path of the tree, then it is CompactRewrite.
+func (t *FBPTree) CompactTo(dstPath string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	return t.compactTo(dstPath, nil)
+}
+
+// compactTo rewrites the tree into the file by the path and reports
+// the progress if the callback is given.
+func (t *FBPTree) compactTo(dstPath string, progress func(done, total int)) error {
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+
+	replace, err := samePath(dstPath, t.path)
+	if err != nil {
+		return err
+	}
+
+	if dstPath == InMemory || (replace && t.path == InMemory) {
+		return ErrInMemory
+	}
+
+	// the stale log next to the destination must not be replayed over the
+	// compacted file, while the log of this tree is empty between the writes
+	staleLog := !replace || !t.storage.logged()
+	if staleLog {
+		if err := removeLog(dstPath); err != nil {
+			return err
+		}
+	}
+
+	dir, tmpPath, err := tempFileFor(dstPath)
+	if err != nil {
+		return err
+	}
+
+	err = t.rewriteTo(tmpPath, t.cfg, progress)
+	// the log of the compacted tree is empty once it is closed
+	if logErr := removeLog(tmpPath); err == nil {
+		err = logErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return err
+	}
+
+	if staleLog {
+		if err := removeLog(dstPath); err != nil {
+			os.Remove(tmpPath)
+
+			return err
+		}
+	}
+
+	debugf(t.logger, "rewrote the tree of %d entries into %s", t.size(), tmpPath)
+
+	if !replace {
+		if err := os.Rename(tmpPath, dstPath); err != nil {
+			os.Remove(tmpPath)
+
+			return fmt.Errorf("failed to replace the file: %w", err)
+		}
+
+		if err := syncDir(dir); err != nil {
+			return fmt.Errorf("failed to sync the directory %s: %w", dir, err)
+		}
+
+		return nil
+	}
+
+	// the compacted file is locked before it replaces the file,
+	// so the other trees can not open it until it is reopened
+	locked, err := openFile(tmpPath, os.O_RDWR, 0600)
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to open the compacted file: %w", err)
+	}
+	if err := lockFile(locked, false); err != nil {
+		locked.Close()
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to lock the compacted file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, t.path); err != nil {
+		locked.Close()
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to replace the file: %w", err)
+	}
+
+	// the replaced file stays locked until it is closed
+	closeErr := t.storage.close()
+	if err := syncDir(dir); err != nil && closeErr == nil {
+		closeErr = fmt.Errorf("failed to sync the directory %s: %w", dir, err)
+	}
+
+	if err := t.reopen(locked); err != nil {
+		return fmt.Errorf("failed to reopen the tree: %w", err)
+	}
+
+	if closeErr != nil {
+		return fmt.Errorf("failed to close the replaced file: %w", closeErr)
+	}
+
+	return nil
+}
+
+// tempFileFor creates the empty temporary file in the directory of the
+// destination path and returns the directory and the temporary file path.
+func tempFileFor(dstPath string) (string, string, error) {
+	dir, base := filepath.Split(dstPath)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, base+".compact-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create the temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+
+		return "", "", fmt.Errorf("failed to close the temporary file: %w", err)
+	}
+
+	return dir, tmpPath, nil
+}
+
+// removeLog removes the write-ahead log of the file by the path if it exists.
+func removeLog(path string) error {
+	if err := os.Remove(path + walSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove the log %s: %w", path+walSuffix, err)
+	}
+
+	return nil
+}
+
+// samePath returns true if both paths refer to the same file.
+func samePath(x, y string) (bool, error) {
+	absX, err := filepath.Abs(x)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve the path %s: %w", x, err)
+	}
+
+	absY, err := filepath.Abs(y)
+	if err != nil {
+		return false, fmt.Errorf("failed to resolve the path %s: %w", y, err)
+	}
+
+	return absX == absY, nil
+}
+
+// rewriteTo bulk-builds the copy of the tree in the new file by the path
+// with the given configuration.
+func (t *FBPTree) rewriteTo(path string, cfg *config, progress func(done, total int)) error {
+	compacted, err := open(path, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to open the compacted tree: %w", err)
+	}
+
+	it, err := t.iterator()
+	if err != nil {
+		compacted.Close()
+
+		return fmt.Errorf("failed to initialize iterator: %w", err)
+	}
+
+	total, done := t.size(), 0
+	next := func() ([]byte, []byte, int64, error) {
+		// the expired entries are kept until they are purged,
+		// since they are counted in the size of the tree
+		var expiresAt int64
+		if it.HasNext() {
+			expiresAt = it.next.pointers[it.i].expiresAt
+		}
+
+		key, value, err := it.Next()
+		if err == nil && progress != nil {
+			done++
+			progress(done, total)
+		}
+
+		return key, value, expiresAt, err
+	}
+
+	if err := compacted.buildExpiring(total, next); err != nil {
+		compacted.Close()
+
+		return fmt.Errorf("failed to build the compacted tree: %w", err)
+	}
+
+	if err := compacted.SetUserMetadata(t.userMetadata()); err != nil {
+		compacted.Close()
+
+		return fmt.Errorf("failed to copy the user metadata: %w", err)
+	}
+
+	// the statistics and the sequence move to the new file with the close
+	compacted.storage.pager.metadata.sequence = t.storage.pager.metadata.sequence
+	compacted.storage.lifetime = t.storage.lifetime
+	compacted.storage.lifetime.Compactions++
+
+	if err := compacted.Close(); err != nil {
+		return fmt.Errorf("failed to close the compacted tree: %w", err)
+	}
+
+	return nil
+}
+
+// reopen opens the storage by the tree path again.
+func (t *FBPTree) reopen(locked *os.File) error {
+	storage, err := newStorage(t.path, t.cfg, locked)
+	if err != nil {
+		return fmt.Errorf("failed to initialize the storage: %w", err)
+	}
+
+	metadata, err := storage.loadMetadata()
+	if err != nil {
+		storage.close()
+
+		return fmt.Errorf("failed to load the metadata: %w", err)
+	}
+
+	t.storage = storage
+	t.metadata = metadata
+
+	return nil
+}
+
+// syncDir flushes the directory entries to the disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := d.Sync(); err != nil {
+		d.Close()
+
+		return err
+	}
+
+	return d.Close()
+}
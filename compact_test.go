@@ -0,0 +1,380 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCompactRewrite(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if i%10 == 0 {
+			continue
+		}
+
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	expected := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		expected = append(expected, key, value)
+	})
+
+	before, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatalf("failed to stat the file: %s", err)
+	}
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	after, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatalf("failed to stat the file: %s", err)
+	}
+	if after.Size() >= before.Size() {
+		t.Fatalf("expected the file to shrink from %d bytes, but got %d bytes", before.Size(), after.Size())
+	}
+
+	files, err := ioutil.ReadDir(dbDir)
+	if err != nil {
+		t.Fatalf("failed to read the directory: %s", err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected the only tree file, but got %d files", len(files))
+	}
+
+	// the tree keeps working after the rewrite
+	if _, _, err := tree.Put([]byte{42}, []byte{42}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, _, err := tree.Delete([]byte{42}); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	actual := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		actual = append(actual, key, value)
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestCompactRewriteClustersLeaves(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	// the values span several pages, so the leaves span several pages too
+	value := make([]byte, 100)
+	for i := 0; i < 300; i++ {
+		key := encodeUint32(uint32((i * 7) % 300))
+		if _, _, err := tree.Put(key, value); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	leaves := 0
+	for leafID := tree.metadata.leftmostID; leafID != 0; leaves++ {
+		leaf, err := tree.storage.loadNodeByID(leafID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf %d: %s", leafID, err)
+		}
+
+		next := leaf.next()
+		if next == nil {
+			break
+		}
+
+		expected := leaf.id + uint32(tree.storage.pageCount(leaf))
+		if next.asNodeID() != expected {
+			t.Fatalf("expected the leaf after %d at page %d, but got %d", leaf.id, expected, next.asNodeID())
+		}
+
+		leafID = next.asNodeID()
+	}
+
+	if leaves < 2 {
+		t.Fatalf("expected several leaves, but got %d", leaves)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for _, wal := range []bool{false, true} {
+		dbPath := path.Join(dbDir, fmt.Sprintf("sample_%t.data", wal))
+		options := []func(*config) error{Order(4), PageSize(4096)}
+		if wal {
+			options = append(options, WriteAheadLog())
+		}
+
+		tree, err := Open(dbPath, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		large := bytes.Repeat([]byte{1}, 100000)
+		for i := 0; i < 2000; i++ {
+			key := encodeUint32(uint32(i))
+			value := key
+			if i%100 == 0 {
+				value = large
+			}
+
+			if _, _, err := tree.Put(key, value); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+		for i := 0; i < 1900; i++ {
+			if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+				t.Fatalf("failed to delete key %d: %s", i, err)
+			}
+		}
+
+		before := tree.storage.pager.lastPageId
+		if err := tree.Compact(); err != nil {
+			t.Fatalf("failed to compact: %s", err)
+		}
+		after := tree.storage.pager.lastPageId
+		if after*4 > before {
+			t.Fatalf("expected at most %d pages, but got %d", before/4, after)
+		}
+
+		report, err := tree.Check()
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if !report.OK() {
+			t.Fatalf("expected no problems, but got %v", report.Problems)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+
+		info, err := os.Stat(dbPath)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", dbPath, err)
+		}
+		if expected := int64(after)*4096 + metadataSize; info.Size() != expected {
+			t.Fatalf("expected file size %d, but got %d", expected, info.Size())
+		}
+
+		tree, err = Open(dbPath, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 1900; i < 2000; i++ {
+			key := encodeUint32(uint32(i))
+			expected := key
+			if i%100 == 0 {
+				expected = large
+			}
+
+			value, ok, err := tree.Get(key)
+			if err != nil {
+				t.Fatalf("failed to get key %d: %s", i, err)
+			}
+			if !ok || !bytes.Equal(value, expected) {
+				t.Fatalf("unexpected value for key %d", i)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
+
+func TestCompactTo(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 900; i++ {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	dstPath := path.Join(dbDir, "compacted.data")
+	if err := ioutil.WriteFile(dstPath, []byte("stale"), 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", dstPath, err)
+	}
+
+	if err := tree.CompactTo(dstPath); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	original, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatalf("failed to stat %s: %s", dbPath, err)
+	}
+	compacted, err := os.Stat(dstPath)
+	if err != nil {
+		t.Fatalf("failed to stat %s: %s", dstPath, err)
+	}
+	if compacted.Size()*4 > original.Size() {
+		t.Fatalf("expected the compacted file of size %d to be at least 4 times smaller than %d", compacted.Size(), original.Size())
+	}
+
+	if _, _, err := tree.Put(encodeUint32(0), nil); err != nil {
+		t.Fatalf("failed to put into the original tree: %s", err)
+	}
+
+	copied, err := Open(dstPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open the compacted tree: %s", err)
+	}
+	defer copied.Close()
+
+	if size := copied.Size(); size != 100 {
+		t.Fatalf("expected 100 entries, but got %d", size)
+	}
+	for i := 900; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		value, ok, err := copied.Get(key)
+		if err != nil || !ok || !reflect.DeepEqual(value, key) {
+			t.Fatalf("unexpected value %v for key %d: %v", value, i, err)
+		}
+	}
+
+	entries, err := ioutil.ReadDir(dbDir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", dbDir, err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected only the original and the compacted files, but got %d files", len(entries))
+	}
+}
+
+func TestCompactToRemovesStaleLog(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the committed record of the previous tree by the path
+	// truncates the file if it is replayed
+	dstPath := path.Join(dbDir, "compacted.data")
+	stale := encodeWALRecord([]*walOp{{offset: 0, truncate: true}})
+	if err := ioutil.WriteFile(dstPath+walSuffix, stale, 0600); err != nil {
+		t.Fatalf("failed to write the stale log: %s", err)
+	}
+
+	if err := tree.CompactTo(dstPath); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	copied, err := Open(dstPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open the compacted tree: %s", err)
+	}
+	defer copied.Close()
+
+	if size := copied.Size(); size != 100 {
+		t.Fatalf("expected 100 entries, but got %d", size)
+	}
+
+	entries, err := ioutil.ReadDir(dbDir)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", dbDir, err)
+	}
+	for _, entry := range entries {
+		switch entry.Name() {
+		case "sample.data", "sample.data" + walSuffix, "compacted.data", "compacted.data" + walSuffix:
+		default:
+			t.Fatalf("expected only the trees and their logs, but found %s", entry.Name())
+		}
+	}
+}
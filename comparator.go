@@ -0,0 +1,39 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// the prefix of the key ordering name for the custom comparators
+const comparatorPrefix = "comparator:"
+
+// the maximum length of the comparator name
+const maxComparatorNameSize = 255
+
+// Comparator option orders the keys with the given comparison function,
+// e.g. numerically, case-insensitively or by the fields of the composite
+// keys. The function returns a negative number if x sorts before y, zero if
+// they are the same key and a positive number otherwise. The name identifies
+// the order: it is recorded in the file and the tree must be opened with the
+// comparator of the same name every time. The comparator of the same name
+// must not change the order of the existing keys.
+func Comparator(name string, compare func(x, y []byte) int) func(*config) error {
+	return func(c *config) error {
+		if name == "" {
+			return fmt.Errorf("comparator name must not be empty")
+		}
+
+		if len(name) > maxComparatorNameSize {
+			return fmt.Errorf("comparator name must be less than or equal to %d bytes", maxComparatorNameSize)
+		}
+
+		if compare == nil {
+			return fmt.Errorf("comparator must not be nil")
+		}
+
+		c.compare = compare
+		c.ordering = comparatorPrefix + name
+
+		return nil
+	}
+}
@@ -0,0 +1,91 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestComparator(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	caseInsensitive := Comparator("case-insensitive", func(x, y []byte) int {
+		return bytes.Compare(bytes.ToLower(x), bytes.ToLower(y))
+	})
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), caseInsensitive)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	words := []string{"b", "C", "a", "D", "e", "A"}
+	for _, word := range words {
+		if _, _, err := tree.Put([]byte(word), []byte(word)); err != nil {
+			t.Fatalf("failed to put %s: %s", word, err)
+		}
+	}
+
+	// "A" is the same key as "a"
+	expected := []string{"a", "b", "C", "D", "e"}
+	values := []string{"A", "b", "C", "D", "e"}
+	actualKeys, actualValues := make([]string, 0), make([]string, 0)
+	err = tree.ForEach(func(key, value []byte) {
+		actualKeys = append(actualKeys, string(key))
+		actualValues = append(actualValues, string(value))
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if !reflect.DeepEqual(expected, actualKeys) {
+		t.Fatalf("expected keys %v, but got %v", expected, actualKeys)
+	}
+	if !reflect.DeepEqual(values, actualValues) {
+		t.Fatalf("expected values %v, but got %v", values, actualValues)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(3)); err == nil {
+		t.Fatalf("expected the error on the key order mismatch")
+	}
+
+	if _, err := Open(dbPath, Order(3), Comparator("other", bytes.Compare)); err == nil {
+		t.Fatalf("expected the error on the comparator mismatch")
+	}
+
+	tree, err = Open(dbPath, Order(3), caseInsensitive)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if value, ok, err := tree.Get([]byte("d")); err != nil || !ok || string(value) != "D" {
+		t.Fatalf("expected the value D, but got %s, %v, %v", value, ok, err)
+	}
+}
+
+func TestComparatorValidation(t *testing.T) {
+	options := []func(*config) error{
+		Comparator("", bytes.Compare),
+		Comparator(string(make([]byte, maxComparatorNameSize+1)), bytes.Compare),
+		Comparator("nil", nil),
+	}
+
+	for i, option := range options {
+		if _, err := newConfig([]func(*config) error{option}); err == nil {
+			t.Fatalf("expected an error for the option %d", i)
+		}
+	}
+}
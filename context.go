@@ -0,0 +1,134 @@
+package fbptree
+
+import "context"
+
+// lockContext locks the tree for the write unless the context is done while
+// it waits for the lock, e.g. behind the long write or compaction. The lock
+// acquired after the context is done is released at once.
+func (t *FBPTree) lockContext(ctx context.Context) error {
+	return waitContext(ctx, t.mu.Lock, t.mu.Unlock)
+}
+
+// rlockContext locks the tree for the read unless the context is done
+// while it waits for the lock, see lockContext.
+func (t *FBPTree) rlockContext(ctx context.Context) error {
+	return waitContext(ctx, t.mu.RLock, t.mu.RUnlock)
+}
+
+// waitContext waits for the lock unless the context is done first.
+func waitContext(ctx context.Context, lock, unlock func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		lock()
+		close(locked)
+	}()
+
+	select {
+	case <-locked:
+		return nil
+	case <-ctx.Done():
+		go func() {
+			<-locked
+			unlock()
+		}()
+
+		return ctx.Err()
+	}
+}
+
+// GetContext is Get that returns the error of the context if it is done
+// before the lookup starts, e.g. while the writer holds the tree.
+func (t *FBPTree) GetContext(ctx context.Context, key []byte) ([]byte, bool, error) {
+	if err := t.rlockContext(ctx); err != nil {
+		return nil, false, err
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, false, ErrClosed
+	}
+
+	op := t.beginOperation()
+	value, ok, err := t.get(key)
+	t.endOperation(op, OperationGet, len(key), len(value), err)
+
+	return value, ok, err
+}
+
+// PutContext is Put that returns the error of the context if it is done
+// before the write starts, e.g. while another write holds the tree. The started write is not interrupted, so the
+// tree is never left half-modified.
+func (t *FBPTree) PutContext(ctx context.Context, key, value []byte) ([]byte, bool, error) {
+	if err := t.lockContext(ctx); err != nil {
+		return nil, false, err
+	}
+	defer t.mu.Unlock()
+
+	return t.runPut(key, value)
+}
+
+// DeleteContext is Delete that returns the error of the context if it is
+// done before the write starts. The started write is not interrupted.
+func (t *FBPTree) DeleteContext(ctx context.Context, key []byte) ([]byte, bool, error) {
+	if err := t.lockContext(ctx); err != nil {
+		return nil, false, err
+	}
+	defer t.mu.Unlock()
+
+	return t.runDelete(key)
+}
+
+// ForEachContext is ForEach that stops and returns the error of the context
+// once it is done, so the long traversals can be cancelled or time-limited.
+func (t *FBPTree) ForEachContext(ctx context.Context, action func(key []byte, value []byte)) error {
+	return t.ScanContext(ctx, nil, nil, func(key, value []byte) bool {
+		action(key, value)
+
+		return true
+	})
+}
+
+// ScanContext calls the action for the keys in [start, end) range in
+// ascending key order until the action returns false or the context is
+// done. The nil start and end are the bounds of the tree. It returns the
+// error of the context if the scan is stopped by it.
+func (t *FBPTree) ScanContext(ctx context.Context, start, end []byte, action func(key []byte, value []byte) bool) error {
+	if err := t.rlockContext(ctx); err != nil {
+		return err
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	op := t.beginOperation()
+	err := t.scanContext(ctx, start, end, action)
+	t.endOperation(op, OperationForEach, 0, 0, err)
+
+	return err
+}
+
+func (t *FBPTree) scanContext(ctx context.Context, start, end []byte, action func(key []byte, value []byte) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var ctxErr error
+	err := t.scan(start, end, func(key, value []byte) bool {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			return false
+		}
+
+		return action(key, value)
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctxErr
+}
@@ -0,0 +1,124 @@
+package fbptree
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestContext(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.PutContext(ctx, []byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	if value, ok, err := tree.GetContext(ctx, []byte{5}); err != nil || !ok || value[0] != 5 {
+		t.Fatalf("unexpected value %v, %v, %v", value, ok, err)
+	}
+	if _, ok, err := tree.DeleteContext(ctx, []byte{5}); err != nil || !ok {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	count := 0
+	if err := tree.ForEachContext(ctx, func(key, value []byte) { count++ }); err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if count != 99 {
+		t.Fatalf("expected 99 entries, but got %d", count)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	count = 0
+	err = tree.ScanContext(cancelled, []byte{10}, nil, func(key, value []byte) bool {
+		count++
+		if count == 10 {
+			cancel()
+		}
+
+		return true
+	})
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if count != 10 {
+		t.Fatalf("expected the scan to stop after 10 entries, but got %d", count)
+	}
+
+	if _, _, err := tree.GetContext(cancelled, []byte{1}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if _, _, err := tree.PutContext(cancelled, []byte{5}, []byte{5}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if _, _, err := tree.DeleteContext(cancelled, []byte{1}); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if _, ok, _ := tree.Get([]byte{5}); ok {
+		t.Fatalf("expected the cancelled put to be skipped")
+	}
+	if tree.Size() != 99 {
+		t.Fatalf("expected size 99, but got %d", tree.Size())
+	}
+}
+
+func TestContextCancelsWaitForLock(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	// the long write holds the tree
+	tree.mu.Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := tree.GetContext(ctx, []byte{1}); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, but got %v", err)
+	}
+	if _, _, err := tree.PutContext(ctx, []byte{1}, []byte{1}); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, but got %v", err)
+	}
+	if _, _, err := tree.DeleteContext(ctx, []byte{1}); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, but got %v", err)
+	}
+	if err := tree.ForEachContext(ctx, func(key, value []byte) {}); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, but got %v", err)
+	}
+
+	tree.mu.Unlock()
+
+	// the locks acquired after the cancellation are released
+	if _, _, err := tree.PutContext(context.Background(), []byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, ok, err := tree.GetContext(context.Background(), []byte{1}); err != nil || !ok {
+		t.Fatalf("failed to get: %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CorruptionError is returned when the data read from the file can not be
+// decoded, e.g. because the page is truncated or overwritten.
+type CorruptionError struct {
+	// Record is the identifier of the record, zero if the data is not
+	// the record, e.g. the file metadata.
+	Record uint32
+	// Offset is the position of the corrupted field in the record data.
+	Offset int
+	// Reason describes the violated constraint.
+	Reason string
+}
+
+func (e *CorruptionError) Error() string {
+	if e.Record == 0 {
+		return fmt.Sprintf("corrupted data at offset %d: %s", e.Offset, e.Reason)
+	}
+
+	return fmt.Sprintf("corrupted record %d at offset %d: %s", e.Record, e.Offset, e.Reason)
+}
+
+// Is makes the corruption error match ErrCorrupted.
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// corruptionOf attributes the corruption error to the record.
+func corruptionOf(err error, recordID uint32) error {
+	var corruption *CorruptionError
+	if errors.As(err, &corruption) && corruption.Record == 0 {
+		corruption.Record = recordID
+	}
+
+	return err
+}
+
+// decoder reads the fields of the encoded data and checks that every field
+// is within the data. The first violation is kept and the following reads
+// return zero values.
+type decoder struct {
+	data     []byte
+	position int
+	err      error
+}
+
+// fail records the violation at the current position.
+func (d *decoder) fail(format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = &CorruptionError{Offset: d.position, Reason: fmt.Sprintf(format, args...)}
+	}
+}
+
+// bytes returns the next n bytes of the data without copying.
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n > len(d.data)-d.position {
+		d.fail("%d bytes required, but only %d bytes left", n, len(d.data)-d.position)
+
+		return nil
+	}
+
+	data := d.data[d.position : d.position+n]
+	d.position += n
+
+	return data
+}
+
+func (d *decoder) byte() byte {
+	data := d.bytes(1)
+	if data == nil {
+		return 0
+	}
+
+	return data[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	data := d.bytes(2)
+	if data == nil {
+		return 0
+	}
+
+	return decodeUint16(data)
+}
+
+func (d *decoder) uint32() uint32 {
+	data := d.bytes(4)
+	if data == nil {
+		return 0
+	}
+
+	return decodeUint32(data)
+}
+
+func (d *decoder) uint64() uint64 {
+	data := d.bytes(8)
+	if data == nil {
+		return 0
+	}
+
+	return decodeUint64(data)
+}
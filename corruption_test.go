@@ -0,0 +1,172 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDecodeTruncatedNode(t *testing.T) {
+	n := &node{
+		id:       42,
+		leaf:     true,
+		keys:     [][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}, nil},
+		pointers: []*pointer{{value: []byte{1, 2, 3, 4}}, {value: []byte{}}, nil, nil},
+		keyNum:   2,
+	}
+	n.setNext(&pointer{value: uint32(17)})
+
+	data := encodeNode(n)
+	for size := 0; size < len(data); size++ {
+		_, err := decodeNode(data[:size])
+
+		var corruption *CorruptionError
+		if !errors.As(err, &corruption) {
+			t.Fatalf("expected the corruption error for %d bytes, but got %v", size, err)
+		}
+	}
+}
+
+func TestDecodeCorruptedNodeDoesNotPanic(t *testing.T) {
+	n := &node{
+		id:       1,
+		keys:     [][]byte{{1, 2}, {3, 4}, nil},
+		pointers: []*pointer{{value: uint32(2)}, {value: uint32(3)}, {value: uint32(4)}, nil},
+		keyNum:   2,
+	}
+	data := encodeNode(n)
+
+	random := rand.New(rand.NewSource(42))
+	for i := 0; i < 10000; i++ {
+		corrupted := copyBytes(data)
+		for j := random.Intn(4); j >= 0; j-- {
+			corrupted[random.Intn(len(corrupted))] = byte(random.Intn(256))
+		}
+
+		// the decoding either succeeds or fails, but never panics
+		decodeNode(corrupted)
+	}
+}
+
+func TestDecodeMetadataWithCorruptedRegion(t *testing.T) {
+	data := encodeMetadata(&metadata{pageSize: 4096, user: []byte{1, 2, 3}})
+	copy(data[userMetadataPosition:], encodeUint16(1000))
+	// the legacy file without the checksum
+	copy(data[metadataChecksumPosition:], encodeUint32(0))
+
+	_, err := decodeMetadata(data)
+
+	var corruption *CorruptionError
+	if !errors.As(err, &corruption) {
+		t.Fatalf("expected the corruption error, but got %v", err)
+	}
+	if corruption.Offset != userMetadataPosition {
+		t.Fatalf("expected the offset %d, but got %d", userMetadataPosition, corruption.Offset)
+	}
+}
+
+func TestReadCorruptedRecord(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put([]byte{1}, make([]byte, 100)); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	rootID := tree.metadata.rootID
+	page, err := tree.storage.pager.read(rootID)
+	if err != nil {
+		t.Fatalf("failed to read the page: %s", err)
+	}
+
+	// the record size larger than the file
+	corrupted := copyBytes(page)
+	copy(corrupted[8:16], encodeUint32(1<<31))
+	if err := tree.storage.pager.write(rootID, corrupted); err != nil {
+		t.Fatalf("failed to write the page: %s", err)
+	}
+
+	var corruption *CorruptionError
+	if _, err := tree.storage.records.read(rootID); !errors.As(err, &corruption) || corruption.Record != rootID {
+		t.Fatalf("expected the corruption error of record %d, but got %v", rootID, err)
+	}
+
+	// the page links to itself
+	corrupted = copyBytes(page)
+	setNextRecordId(corrupted, rootID)
+	if err := tree.storage.pager.write(rootID, corrupted); err != nil {
+		t.Fatalf("failed to write the page: %s", err)
+	}
+
+	tree.storage.cache.clear()
+	if _, _, err := tree.Get([]byte{1}); !errors.As(err, &corruption) {
+		t.Fatalf("expected the corruption error, but got %v", err)
+	}
+}
+
+func TestRecordChecksum(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put([]byte{1}, make([]byte, 100)); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	rootID := tree.metadata.rootID
+	page, err := tree.storage.pager.read(rootID)
+	if err != nil {
+		t.Fatalf("failed to read the page: %s", err)
+	}
+
+	// the bit rot in the value, the node is still decodable
+	nextID := nextRecordId(page)
+	next, err := tree.storage.pager.read(nextID)
+	if err != nil {
+		t.Fatalf("failed to read the page: %s", err)
+	}
+	next[20] ^= 1
+	if err := tree.storage.pager.write(nextID, next); err != nil {
+		t.Fatalf("failed to write the page: %s", err)
+	}
+
+	tree.storage.cache.clear()
+	var corruption *CorruptionError
+	if _, _, err := tree.Get([]byte{1}); !errors.As(err, &corruption) || corruption.Record != rootID || corruption.Offset != recordChecksumPosition {
+		t.Fatalf("expected the checksum corruption error of record %d, but got %v", rootID, err)
+	}
+
+	// the records without the checksum are not verified
+	copy(page[recordChecksumPosition:16], encodeUint32(0))
+	if err := tree.storage.pager.write(rootID, page); err != nil {
+		t.Fatalf("failed to write the page: %s", err)
+	}
+
+	tree.storage.cache.clear()
+	if _, ok, err := tree.Get([]byte{1}); err != nil || !ok {
+		t.Fatalf("expected the value without the checksum verification, but got %v", err)
+	}
+}
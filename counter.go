@@ -0,0 +1,83 @@
+package fbptree
+
+import (
+	"fmt"
+	"math"
+)
+
+// counterSize is the size of the counter value, int64 in big-endian.
+const counterSize = 8
+
+// Increment atomically adds delta to the counter stored under the key and
+// returns the new value. The counter is stored as 8-byte big-endian int64 and
+// initialized to delta if the key does not exist. It takes a single
+// descent instead of Get and Put round trips.
+func (t *FBPTree) Increment(key []byte, delta int64) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	op := t.beginOperation()
+	counter, err := t.increment(key, delta)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationIncrement, len(key), counterSize, err)
+
+	return counter, err
+}
+
+func (t *FBPTree) increment(key []byte, delta int64) (int64, error) {
+	if err := t.checkPut(key, nil); err != nil {
+		return 0, err
+	}
+
+	if t.metadata == nil {
+		if err := t.initializeRoot(key, encodeUint64(uint64(delta))); err != nil {
+			return 0, fmt.Errorf("failed to initialize root: %w", err)
+		}
+
+		return delta, nil
+	}
+
+	leaf, err := t.descend(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	counter := delta
+	if position := leaf.livePosition(key, t.compare); position != -1 {
+		value, err := t.storage.readValue(leaf.pointers[position])
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the value: %w", err)
+		}
+		current, err := DecodeCounter(value)
+		if err != nil {
+			return 0, err
+		}
+
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return 0, fmt.Errorf("the counter %d overflows with delta %d", current, delta)
+		}
+
+		counter = current + delta
+	}
+
+	if _, _, err := t.putIntoLeaf(leaf, key, encodeUint64(uint64(counter))); err != nil {
+		return 0, fmt.Errorf("failed to put into the leaf %d: %w", leaf.id, err)
+	}
+
+	return counter, nil
+}
+
+// DecodeCounter returns the counter stored by Increment, so the counter
+// read with Get or during the iteration is decoded the same way.
+func DecodeCounter(value []byte) (int64, error) {
+	if len(value) != counterSize {
+		return 0, fmt.Errorf("the value of size %d is not a counter", len(value))
+	}
+
+	return int64(decodeUint64(value)), nil
+}
@@ -0,0 +1,90 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestIncrement(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		for _, c := range treeCases {
+			counter, err := tree.Increment([]byte{c.key}, int64(c.key))
+			if err != nil {
+				t.Fatalf("failed to increment key %d: %s", c.key, err)
+			}
+
+			if counter != int64(c.key)*int64(i+1) {
+				t.Fatalf("expected counter %d for key %d, but got %d", int64(c.key)*int64(i+1), c.key, counter)
+			}
+		}
+	}
+
+	if tree.Size() != len(treeCases) {
+		t.Fatalf("expected size %d, but got %d", len(treeCases), tree.Size())
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	counter, err := tree.Increment([]byte{42}, -126)
+	if err != nil {
+		t.Fatalf("failed to increment: %s", err)
+	}
+	if counter != 0 {
+		t.Fatalf("expected counter 0, but got %d", counter)
+	}
+
+	tree.Put([]byte{100}, []byte{1, 2, 3})
+	if _, err := tree.Increment([]byte{100}, 1); err == nil {
+		t.Fatal("must return an error for the value that is not a counter")
+	}
+
+	tree.Increment([]byte{101}, math.MaxInt64)
+	if _, err := tree.Increment([]byte{101}, 1); err == nil {
+		t.Fatal("must return an error for the overflow")
+	}
+
+	value, _, err := tree.Get([]byte{42})
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if counter, err := DecodeCounter(value); err != nil || counter != 0 {
+		t.Fatalf("expected counter 0, but got %d, %v", counter, err)
+	}
+
+	value, _, err = tree.Get([]byte{101})
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if counter, err := DecodeCounter(value); err != nil || counter != math.MaxInt64 {
+		t.Fatalf("expected counter %d, but got %d, %v", int64(math.MaxInt64), counter, err)
+	}
+
+	if _, err := DecodeCounter([]byte{1, 2, 3}); err == nil {
+		t.Fatal("must return an error for the value that is not a counter")
+	}
+}
@@ -0,0 +1,226 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// The pointers of the internal nodes keep the number of the keys in the
+// subtrees of their children, so the number of the keys in a range is found
+// by descending the tree instead of traversing the leaves. The counts are
+// updated along the path to the root when a key is added or removed, and
+// the splits, the merges and the borrowing only redistribute the keys
+// between the children of the same parent.
+
+// CountRange returns the number of the keys in [start, end) range without
+// reading the values. The nil start and end are the bounds of the tree. The
+// keys are counted by descending the tree twice, unless the tree was created
+// before the counts were introduced and is opened read-only, then the keys
+// of the range are traversed.
+func (t *FBPTree) CountRange(start, end []byte) (int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return 0, ErrClosed
+	}
+
+	return t.countRange(start, end)
+}
+
+func (t *FBPTree) countRange(start, end []byte) (int, error) {
+	if t.metadata == nil {
+		return 0, nil
+	}
+
+	root, err := t.storage.loadNodeByID(t.metadata.rootID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load the root node %d: %w", t.metadata.rootID, err)
+	}
+
+	if !root.counted() {
+		return t.scanCount(start, end)
+	}
+
+	lower := 0
+	if start != nil {
+		if lower, err = t.rank(root, start); err != nil {
+			return 0, err
+		}
+	}
+
+	upper := int(t.metadata.size)
+	if end != nil {
+		if upper, err = t.rank(root, end); err != nil {
+			return 0, err
+		}
+	}
+
+	if upper < lower {
+		return 0, nil
+	}
+
+	return upper - lower, nil
+}
+
+// rank returns the number of the keys less than the key.
+func (t *FBPTree) rank(root *node, key []byte) (int, error) {
+	rank := 0
+	current := root
+	for !current.leaf {
+		position := 0
+		for position < current.keyNum && !t.less(key, current.keys[position]) {
+			rank += int(current.pointers[position].count)
+			position++
+		}
+
+		nextID := current.pointers[position].asNodeID()
+		next, err := t.storage.loadNodeByID(nextID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load the node %d: %w", nextID, err)
+		}
+
+		current = next
+	}
+
+	for i := 0; i < current.keyNum && t.less(current.keys[i], key); i++ {
+		rank++
+	}
+
+	return rank, nil
+}
+
+// scanCount counts the keys in [start, end) range by traversing them.
+func (t *FBPTree) scanCount(start, end []byte) (int, error) {
+	it, err := t.newScan(start, end)
+	if err != nil {
+		return 0, err
+	}
+	it.keysOnly = true
+
+	count := 0
+	for it.HasNext() {
+		if _, _, err := it.Next(); err != nil {
+			return 0, err
+		}
+
+		count++
+	}
+
+	return count, nil
+}
+
+// size returns the number of the keys in the subtree of the node.
+func (n *node) size() uint32 {
+	if n.leaf {
+		return uint32(n.keyNum)
+	}
+
+	size := uint32(0)
+	for i := 0; i <= n.keyNum; i++ {
+		size += n.pointers[i].count
+	}
+
+	return size
+}
+
+// setCount updates the count of the keys in the subtree of the child if
+// it is the child of the node. The pointer is replaced, since the split
+// node may share it with its new sibling.
+func (n *node) setCount(child *node) {
+	if position := n.pointerPositionOf(child); position != -1 {
+		n.pointers[position] = &pointer{value: child.id, count: child.size()}
+	}
+}
+
+// counted returns true if the pointers of the internal node keep the counts
+// of the keys in the subtrees, the nodes written before the counts were
+// introduced have zero counts, while the subtrees are never empty.
+func (n *node) counted() bool {
+	return n.leaf || n.pointers[0].count != 0
+}
+
+// addToCounts adds the delta to the counts of the keys on the path from
+// the node to the root of the last descent.
+func (t *FBPTree) addToCounts(n *node, delta int) error {
+	for child := n; t.parentOf(child) != 0; {
+		parentID := t.parentOf(child)
+		parent, err := t.storage.loadNodeByID(parentID)
+		if err != nil {
+			return fmt.Errorf("failed to load the parent node %d: %w", parentID, err)
+		}
+
+		position := parent.pointerPositionOf(child)
+		if position == -1 {
+			return fmt.Errorf("the node %d is not found in its parent %d", child.id, parent.id)
+		}
+		parent.pointers[position].count = uint32(int(parent.pointers[position].count) + delta)
+
+		if err := t.storage.updateNodeByID(parent.id, parent); err != nil {
+			return fmt.Errorf("failed to update the parent node %d: %w", parent.id, err)
+		}
+
+		child = parent
+	}
+
+	return nil
+}
+
+// countKeys writes the counts of the keys into the internal nodes of the
+// tree created before the counts were introduced.
+func (t *FBPTree) countKeys() error {
+	if t.metadata == nil || t.storage.pager.readOnly {
+		return nil
+	}
+
+	// the root is read past the cache, so opening does not fill it
+	data, err := t.storage.readNode(t.metadata.rootID)
+	if err != nil {
+		return fmt.Errorf("failed to read the root node %d: %w", t.metadata.rootID, err)
+	}
+
+	root, err := decodeNode(data)
+	if err != nil {
+		return fmt.Errorf("failed to decode the root node %d: %w", t.metadata.rootID, corruptionOf(err, t.metadata.rootID))
+	}
+
+	if root.counted() {
+		return nil
+	}
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	_, err = t.countSubtree(root)
+
+	return t.endWrite(w, err)
+}
+
+// countSubtree writes the counts of the keys into the internal nodes of the
+// subtree and returns the number of its keys.
+func (t *FBPTree) countSubtree(n *node) (uint32, error) {
+	if n.leaf {
+		return uint32(n.keyNum), nil
+	}
+
+	for i := 0; i <= n.keyNum; i++ {
+		childID := n.pointers[i].asNodeID()
+		child, err := t.storage.loadNodeByID(childID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load the node %d: %w", childID, err)
+		}
+
+		count, err := t.countSubtree(child)
+		if err != nil {
+			return 0, err
+		}
+		n.pointers[i].count = count
+	}
+
+	if err := t.storage.updateNodeByID(n.id, n); err != nil {
+		return 0, fmt.Errorf("failed to update the node %d: %w", n.id, err)
+	}
+
+	return n.size(), nil
+}
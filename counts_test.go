@@ -0,0 +1,162 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCountRange(t *testing.T) {
+	for order := 3; order <= 6; order++ {
+		tree, err := Open(InMemory, Order(order))
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		r := rand.New(rand.NewSource(int64(order)))
+		present := make(map[byte]bool)
+		for i := 0; i < 1000; i++ {
+			key := byte(r.Intn(200))
+			if r.Intn(3) == 0 {
+				if _, _, err := tree.Delete([]byte{key}); err != nil {
+					t.Fatalf("failed to delete: %s", err)
+				}
+				delete(present, key)
+			} else {
+				if _, _, err := tree.Put([]byte{key}, []byte{key}); err != nil {
+					t.Fatalf("failed to put: %s", err)
+				}
+				present[key] = true
+			}
+
+			if i%10 != 0 {
+				continue
+			}
+
+			start, end := []byte{byte(r.Intn(256))}, []byte{byte(r.Intn(256))}
+			if r.Intn(5) == 0 {
+				start = nil
+			}
+			if r.Intn(5) == 0 {
+				end = nil
+			}
+
+			expected := 0
+			for key := range present {
+				if (start == nil || key >= start[0]) && (end == nil || key < end[0]) {
+					expected++
+				}
+			}
+
+			count, err := tree.CountRange(start, end)
+			if err != nil {
+				t.Fatalf("failed to count: %s", err)
+			}
+			if count != expected {
+				t.Fatalf("expected %d keys in [%v, %v), but got %d", expected, start, end, count)
+			}
+		}
+
+		report, err := tree.Check()
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if !report.OK() {
+			t.Fatalf("expected no problems for order %d, but got %v", order, report.Problems)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
+
+func TestCountRangeCountsTheOldTrees(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put([]byte{byte(i * 2)}, []byte{1}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	uncount(t, tree, tree.metadata.rootID)
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	readOnly, err := Open(dbPath, Order(3), ReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if count, err := readOnly.CountRange([]byte{10}, []byte{20}); err != nil || count != 5 {
+		t.Fatalf("expected 5 keys, but got %d, %v", count, err)
+	}
+	if err := readOnly.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected the counts to be written, but got %v", report.Problems)
+	}
+
+	root, err := tree.storage.loadNodeByID(tree.metadata.rootID)
+	if err != nil {
+		t.Fatalf("failed to load the root: %s", err)
+	}
+	if !root.counted() {
+		t.Fatalf("expected the root to be counted")
+	}
+
+	if count, err := tree.CountRange([]byte{10}, []byte{20}); err != nil || count != 5 {
+		t.Fatalf("expected 5 keys, but got %d, %v", count, err)
+	}
+	if count, err := tree.CountRange(nil, nil); err != nil || count != 100 {
+		t.Fatalf("expected 100 keys, but got %d, %v", count, err)
+	}
+}
+
+// uncount resets the counts of the keys in the subtree of the node, as if
+// it were written before the counts were introduced.
+func uncount(t *testing.T, tree *FBPTree, nodeID uint32) {
+	n, err := tree.storage.loadNodeByID(nodeID)
+	if err != nil {
+		t.Fatalf("failed to load the node: %s", err)
+	}
+	if n.leaf {
+		return
+	}
+
+	for i := 0; i <= n.keyNum; i++ {
+		uncount(t, tree, n.pointers[i].asNodeID())
+		n.pointers[i].count = 0
+	}
+	if err := tree.storage.updateNodeByID(n.id, n); err != nil {
+		t.Fatalf("failed to update the node: %s", err)
+	}
+}
@@ -0,0 +1,390 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"sort"
+	"testing"
+)
+
+// errCrashed is returned by the files after the simulated crash.
+var errCrashed = errors.New("crashed")
+
+// crashDisk simulates the crash of the process or of the machine for the
+// files it wraps: the writes fail after the given number of the bytes, the
+// last write is torn, and the changes since the last sync of every file can
+// be dropped as the crash of the machine loses them.
+type crashDisk struct {
+	// the number of the bytes written before the crash, negative for no crash
+	budget  int64
+	written int64
+	crashed bool
+	files   []*crashFile
+}
+
+// crashFile is the file of the crash disk, the syncs are not passed
+// to the file, since the crash of the machine is simulated, and the file
+// is closed by the disk, so the unsynced changes can be dropped after the
+// crashed tree is closed.
+type crashFile struct {
+	randomAccessFile
+	disk *crashDisk
+	// the changes since the last sync in the order they are made
+	unsynced []*crashUndo
+}
+
+// crashUndo restores the file changed by the write or by the truncation:
+// the file is truncated to the size and the data is written at the offset.
+type crashUndo struct {
+	size   int64
+	offset int64
+	data   []byte
+}
+
+// wrap wraps the file, see wrapFile.
+func (d *crashDisk) wrap(path string, file randomAccessFile) randomAccessFile {
+	f := &crashFile{randomAccessFile: file, disk: d}
+	d.files = append(d.files, f)
+
+	return f
+}
+
+// close closes the files and, if requested, restores them
+// as they were on the last sync.
+func (d *crashDisk) close(dropUnsynced bool) error {
+	for _, f := range d.files {
+		if err := f.close(dropUnsynced); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// close closes the file and, if requested, drops the unsynced changes.
+func (f *crashFile) close(dropUnsynced bool) error {
+	if dropUnsynced {
+		for i := len(f.unsynced) - 1; i >= 0; i-- {
+			undo := f.unsynced[i]
+			if err := f.randomAccessFile.Truncate(undo.size); err != nil {
+				f.randomAccessFile.Close()
+
+				return err
+			}
+			if _, err := f.randomAccessFile.WriteAt(undo.data, undo.offset); err != nil {
+				f.randomAccessFile.Close()
+
+				return err
+			}
+		}
+	}
+	f.unsynced = nil
+
+	return f.randomAccessFile.Close()
+}
+
+// size returns the size of the underlying file.
+func (f *crashFile) size() (int64, error) {
+	info, err := f.randomAccessFile.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (f *crashFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.disk.crashed {
+		return 0, errCrashed
+	}
+
+	size, err := f.size()
+	if err != nil {
+		return 0, err
+	}
+
+	undo := &crashUndo{size: size, offset: off}
+	if off < size {
+		undo.data = make([]byte, len(p))
+		if off+int64(len(p)) > size {
+			undo.data = undo.data[:size-off]
+		}
+		if _, err := f.randomAccessFile.ReadAt(undo.data, off); err != nil {
+			return 0, err
+		}
+	}
+	f.unsynced = append(f.unsynced, undo)
+
+	n := int64(len(p))
+	if f.disk.budget >= 0 && f.disk.written+n > f.disk.budget {
+		// the write is torn
+		n = f.disk.budget - f.disk.written
+		f.disk.crashed = true
+	}
+	f.disk.written += n
+
+	if _, err := f.randomAccessFile.WriteAt(p[:n], off); err != nil {
+		return 0, err
+	}
+
+	if f.disk.crashed {
+		return int(n), errCrashed
+	}
+
+	return len(p), nil
+}
+
+func (f *crashFile) Truncate(size int64) error {
+	if f.disk.crashed {
+		return errCrashed
+	}
+
+	prevSize, err := f.size()
+	if err != nil {
+		return err
+	}
+
+	undo := &crashUndo{size: prevSize, offset: size}
+	if size < prevSize {
+		undo.data = make([]byte, prevSize-size)
+		if _, err := f.randomAccessFile.ReadAt(undo.data, size); err != nil {
+			return err
+		}
+	}
+	f.unsynced = append(f.unsynced, undo)
+
+	return f.randomAccessFile.Truncate(size)
+}
+
+func (f *crashFile) Sync() error {
+	if f.disk.crashed {
+		return errCrashed
+	}
+	f.unsynced = nil
+
+	return nil
+}
+
+func (f *crashFile) Close() error {
+	return nil
+}
+
+// model is the map of the keys to the values that the tree must contain.
+type model map[string][]byte
+
+// sortedKeys returns the keys of the model in ascending order.
+func (m model) sortedKeys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// modelValue returns the random value, empty, small or large enough
+// to span several pages.
+func modelValue(r *rand.Rand) []byte {
+	size := r.Intn(40)
+	switch r.Intn(10) {
+	case 0:
+		size = 0
+	case 1:
+		size = 500 + r.Intn(5000)
+	}
+
+	value := make([]byte, size)
+	r.Read(value)
+
+	return value
+}
+
+// crashOperation is the write of the crash test.
+type crashOperation struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// apply applies the operation to the tree.
+func (o *crashOperation) apply(tree *FBPTree) error {
+	if o.delete {
+		_, _, err := tree.Delete(o.key)
+
+		return err
+	}
+
+	_, _, err := tree.Put(o.key, o.value)
+
+	return err
+}
+
+// applyTo applies the operation to the model.
+func (o *crashOperation) applyTo(m model) {
+	if o.delete {
+		delete(m, string(o.key))
+	} else {
+		m[string(o.key)] = o.value
+	}
+}
+
+func TestCrashRecovery(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	r := rand.New(rand.NewSource(1))
+	initial := make(model)
+	for i := 0; i < 30; i++ {
+		initial[string(encodeUint32(uint32(i)))] = modelValue(r)
+	}
+	// the puts and the deletes split and merge the nodes,
+	// the large values are written to the separate records
+	operations := make([]*crashOperation, 0)
+	for i := 0; i < 40; i++ {
+		key := encodeUint32(uint32(r.Intn(60)))
+		operations = append(operations, &crashOperation{key: key, value: modelValue(r), delete: r.Intn(3) == 0})
+	}
+
+	// the tree without the write-ahead log is not expected
+	// to survive the torn writes
+	options := []func(*config) error{Order(3), PageSize(256), WriteAheadLog()}
+	// the run without the crash measures the number of the written bytes
+	written := expectCrashRecovery(t, path.Join(dbDir, "sample.data"), options, initial, operations, -1, false)
+
+	step := written/300 + 1
+	if testing.Short() {
+		step = written/30 + 1
+	}
+	for budget := int64(0); budget < written; budget += step {
+		for _, dropUnsynced := range []bool{false, true} {
+			dbPath := path.Join(dbDir, fmt.Sprintf("sample_%d_%v.data", budget, dropUnsynced))
+			expectCrashRecovery(t, dbPath, options, initial, operations, budget, dropUnsynced)
+		}
+	}
+}
+
+// expectCrashRecovery applies the operations to the tree with the initial
+// entries until the crash after the given number of the written bytes, and
+// fails if the reopened tree is inconsistent or has neither the entries
+// before the crashed operation nor after it. It returns the number of the
+// bytes written by the operations.
+func expectCrashRecovery(t *testing.T, dbPath string, options []func(*config) error, initial model, operations []*crashOperation, budget int64, dropUnsynced bool) int64 {
+	t.Helper()
+
+	disk := &crashDisk{budget: budget}
+	recovered, before, after := crash(t, dbPath, options, initial, operations, disk, dropUnsynced)
+	defer recovered.Close()
+
+	report, err := recovered.Check()
+	if err != nil {
+		t.Fatalf("failed to check tree: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("the tree is inconsistent after the crash at %d bytes: %v", budget, report.Problems)
+	}
+
+	entries := make(model)
+	err = recovered.ForEach(func(key, value []byte) {
+		entries[string(key)] = copyBytes(value)
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	if !equalModels(entries, before) && !equalModels(entries, after) {
+		t.Fatalf("the tree has neither the entries before the crash at %d bytes nor after it", budget)
+	}
+
+	return disk.written
+}
+
+// crash applies the operations to the tree with the initial entries until
+// the disk crashes and reopens the tree. It returns the reopened tree and
+// the entries before the crashed operation and after it.
+func crash(t *testing.T, dbPath string, options []func(*config) error, initial model, operations []*crashOperation, disk *crashDisk, dropUnsynced bool) (*FBPTree, model, model) {
+	t.Helper()
+
+	tree, err := Open(dbPath, options...)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	before := make(model)
+	for _, key := range initial.sortedKeys() {
+		before[key] = initial[key]
+		if _, _, err := tree.Put([]byte(key), initial[key]); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	prevWrapFile := wrapFile
+	wrapFile = disk.wrap
+	defer func() {
+		wrapFile = prevWrapFile
+	}()
+
+	after := before
+	tree, err = Open(dbPath, options...)
+	if err == nil {
+		for _, operation := range operations {
+			after = make(model)
+			for key, value := range before {
+				after[key] = value
+			}
+			operation.applyTo(after)
+
+			if err := operation.apply(tree); err != nil {
+				break
+			}
+			before = after
+		}
+	}
+
+	if tree != nil {
+		// the crashed tree fails to close
+		tree.Close()
+	}
+	wrapFile = prevWrapFile
+
+	if disk.budget >= 0 && !disk.crashed {
+		t.Fatalf("expected the crash after %d bytes, but %d bytes are written", disk.budget, disk.written)
+	}
+
+	if err := disk.close(dropUnsynced); err != nil {
+		t.Fatalf("failed to close the files: %s", err)
+	}
+
+	recovered, err := Open(dbPath, options...)
+	if err != nil {
+		t.Fatalf("failed to open the tree after the crash at %d bytes: %s", disk.budget, err)
+	}
+
+	return recovered, before, after
+}
+
+// equalModels returns true if the models have the same entries.
+func equalModels(x, y model) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	for key, value := range x {
+		if other, ok := y[key]; !ok || !bytes.Equal(value, other) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,347 @@
+package fbptree
+
+import "fmt"
+
+// Cursor is a stateful position in the tree that moves in both directions.
+// It keeps the path from the root to the current leaf, so it moves to the
+// neighbour leaves without the sibling links. The cursor is not valid after
+// the tree is modified, it must be positioned again. The expired keys are
+// skipped.
+type Cursor struct {
+	t *FBPTree
+	// the path from the root to the leaf and the positions in the nodes
+	stack []cursorFrame
+
+	// the storage and its version the cursor was positioned at
+	storage *storage
+	version uint64
+}
+
+type cursorFrame struct {
+	node  *node
+	index int
+}
+
+// Cursor returns a new cursor, it is not valid until it is positioned.
+func (t *FBPTree) Cursor() *Cursor {
+	return &Cursor{t: t}
+}
+
+// First moves the cursor to the first key of the tree.
+func (c *Cursor) First() error {
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if c.t.closed {
+		return ErrClosed
+	}
+
+	c.position()
+
+	return c.descendFromRoot(false)
+}
+
+// Last moves the cursor to the last key of the tree.
+func (c *Cursor) Last() error {
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if c.t.closed {
+		return ErrClosed
+	}
+
+	c.position()
+
+	return c.descendFromRoot(true)
+}
+
+// Seek moves the cursor to the first key that is greater than or equal
+// to the given key. The cursor is not valid if there is no such key.
+func (c *Cursor) Seek(key []byte) error {
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if c.t.closed {
+		return ErrClosed
+	}
+
+	c.position()
+
+	return c.seek(key)
+}
+
+// position records the version of the tree the cursor is positioned at.
+func (c *Cursor) position() {
+	c.storage = c.t.storage
+	c.version = c.t.storage.version
+}
+
+// checkVersion returns ErrModified if the tree is modified after
+// the cursor was positioned and ErrClosed if the tree is closed.
+func (c *Cursor) checkVersion() error {
+	if c.t.closed {
+		return ErrClosed
+	}
+
+	if c.storage != c.t.storage || c.version != c.t.storage.version {
+		return ErrModified
+	}
+
+	return nil
+}
+
+func (c *Cursor) seek(key []byte) error {
+	c.stack = c.stack[:0]
+	if c.t.metadata == nil {
+		return nil
+	}
+
+	current, err := c.t.storage.loadNodeByID(c.t.metadata.rootID)
+	if err != nil {
+		return fmt.Errorf("failed to load root node: %w", err)
+	}
+
+	for !current.leaf {
+		position := 0
+		for position < current.keyNum && !c.t.less(key, current.keys[position]) {
+			position++
+		}
+		c.stack = append(c.stack, cursorFrame{current, position})
+
+		current, err = c.t.storage.loadNodeByID(current.pointers[position].asNodeID())
+		if err != nil {
+			return fmt.Errorf("failed to load the node: %w", err)
+		}
+	}
+
+	position := 0
+	for position < current.keyNum && c.t.less(current.keys[position], key) {
+		position++
+	}
+	c.stack = append(c.stack, cursorFrame{current, position})
+
+	if position == current.keyNum {
+		// all the keys of the leaf are less than the key
+		if err := c.nextLeaf(); err != nil {
+			return err
+		}
+	}
+
+	return c.skipExpired(false)
+}
+
+// Next moves the cursor to the next key. The cursor is not valid
+// after the last key. It returns ErrModified if the tree is modified
+// after the cursor was positioned.
+func (c *Cursor) Next() error {
+	if !c.Valid() {
+		return fmt.Errorf("the cursor is not valid")
+	}
+
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if err := c.checkVersion(); err != nil {
+		return err
+	}
+
+	if err := c.step(false); err != nil {
+		return err
+	}
+
+	return c.skipExpired(false)
+}
+
+// Prev moves the cursor to the previous key. The cursor is not valid
+// before the first key. It returns ErrModified if the tree is modified
+// after the cursor was positioned.
+func (c *Cursor) Prev() error {
+	if !c.Valid() {
+		return fmt.Errorf("the cursor is not valid")
+	}
+
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	if err := c.checkVersion(); err != nil {
+		return err
+	}
+
+	return c.prev()
+}
+
+func (c *Cursor) prev() error {
+	if err := c.step(true); err != nil {
+		return err
+	}
+
+	return c.skipExpired(true)
+}
+
+// step moves the cursor to the next or the previous key.
+func (c *Cursor) step(backward bool) error {
+	leaf := &c.stack[len(c.stack)-1]
+	if backward {
+		leaf.index--
+		if leaf.index >= 0 {
+			return nil
+		}
+
+		return c.prevLeaf()
+	}
+
+	leaf.index++
+	if leaf.index < leaf.node.keyNum {
+		return nil
+	}
+
+	return c.nextLeaf()
+}
+
+// skipExpired moves the cursor past the expired keys in the direction.
+func (c *Cursor) skipExpired(backward bool) error {
+	for c.Valid() {
+		leaf := c.stack[len(c.stack)-1]
+		if !leaf.node.pointers[leaf.index].expired() {
+			return nil
+		}
+
+		if err := c.step(backward); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Valid returns true if the cursor points to a key.
+func (c *Cursor) Valid() bool {
+	if len(c.stack) == 0 {
+		return false
+	}
+
+	leaf := c.stack[len(c.stack)-1]
+
+	return leaf.index >= 0 && leaf.index < leaf.node.keyNum
+}
+
+// Key returns the key at the cursor or nil if the cursor is not valid.
+func (c *Cursor) Key() []byte {
+	if !c.Valid() {
+		return nil
+	}
+
+	leaf := c.stack[len(c.stack)-1]
+
+	return leaf.node.keys[leaf.index]
+}
+
+// Value returns the value at the cursor or nil if the cursor is not valid.
+// The large value is read from its overflow record, nil is returned if the
+// read fails.
+func (c *Cursor) Value() []byte {
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+
+	value, _ := c.value()
+
+	return value
+}
+
+func (c *Cursor) value() ([]byte, error) {
+	if !c.Valid() {
+		return nil, nil
+	}
+
+	leaf := c.stack[len(c.stack)-1]
+
+	return c.t.storage.readValue(leaf.node.pointers[leaf.index])
+}
+
+// descendFromRoot moves the cursor to the first or the last key.
+func (c *Cursor) descendFromRoot(last bool) error {
+	c.stack = c.stack[:0]
+	if c.t.metadata == nil {
+		return nil
+	}
+
+	root, err := c.t.storage.loadNodeByID(c.t.metadata.rootID)
+	if err != nil {
+		return fmt.Errorf("failed to load root node: %w", err)
+	}
+
+	if err := c.descend(root, last); err != nil {
+		return err
+	}
+
+	return c.skipExpired(last)
+}
+
+// descend pushes the path from the node to its leftmost or rightmost key.
+func (c *Cursor) descend(current *node, last bool) error {
+	for {
+		position := 0
+		if last {
+			position = current.keyNum
+			if current.leaf {
+				position--
+			}
+		}
+		c.stack = append(c.stack, cursorFrame{current, position})
+
+		if current.leaf {
+			return nil
+		}
+
+		next, err := c.t.storage.loadNodeByID(current.pointers[position].asNodeID())
+		if err != nil {
+			return fmt.Errorf("failed to load the node: %w", err)
+		}
+
+		current = next
+	}
+}
+
+// nextLeaf moves the cursor to the first key of the next leaf.
+func (c *Cursor) nextLeaf() error {
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		parent := &c.stack[len(c.stack)-1]
+		if parent.index < parent.node.keyNum {
+			parent.index++
+
+			child, err := c.t.storage.loadNodeByID(parent.node.pointers[parent.index].asNodeID())
+			if err != nil {
+				return fmt.Errorf("failed to load the node: %w", err)
+			}
+
+			return c.descend(child, false)
+		}
+
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+
+	return nil
+}
+
+// prevLeaf moves the cursor to the last key of the previous leaf.
+func (c *Cursor) prevLeaf() error {
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		parent := &c.stack[len(c.stack)-1]
+		if parent.index > 0 {
+			parent.index--
+
+			child, err := c.t.storage.loadNodeByID(parent.node.pointers[parent.index].asNodeID())
+			if err != nil {
+				return fmt.Errorf("failed to load the node: %w", err)
+			}
+
+			return c.descend(child, true)
+		}
+
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	c := tree.Cursor()
+	if err := c.First(); err != nil {
+		t.Fatalf("failed to move to the first key: %s", err)
+	}
+	if c.Valid() {
+		t.Fatalf("expected the cursor not to be valid in the empty tree")
+	}
+
+	// the even keys from 0 to 198
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i * 2))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	expected := make([]uint32, 0)
+	for i := 0; i < 200; i += 2 {
+		expected = append(expected, uint32(i))
+	}
+
+	forward := make([]uint32, 0)
+	for err := c.First(); c.Valid(); err = c.Next() {
+		if err != nil {
+			t.Fatalf("failed to move forward: %s", err)
+		}
+		if !reflect.DeepEqual(c.Key(), c.Value()) {
+			t.Fatalf("unexpected value %v for key %v", c.Value(), c.Key())
+		}
+
+		forward = append(forward, decodeUint32(c.Key()))
+	}
+	if !reflect.DeepEqual(expected, forward) {
+		t.Fatalf("expected %v, but got %v", expected, forward)
+	}
+
+	backward := make([]uint32, 0)
+	for err := c.Last(); c.Valid(); err = c.Prev() {
+		if err != nil {
+			t.Fatalf("failed to move backward: %s", err)
+		}
+
+		backward = append([]uint32{decodeUint32(c.Key())}, backward...)
+	}
+	if !reflect.DeepEqual(expected, backward) {
+		t.Fatalf("expected %v, but got %v", expected, backward)
+	}
+
+	for i := 0; i < 201; i++ {
+		if err := c.Seek(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to seek %d: %s", i, err)
+		}
+
+		if i >= 199 {
+			if c.Valid() {
+				t.Fatalf("expected the cursor not to be valid after seeking %d", i)
+			}
+
+			continue
+		}
+
+		expected := uint32(i + i%2)
+		if !c.Valid() || decodeUint32(c.Key()) != expected {
+			t.Fatalf("expected %d after seeking %d, but got %v", expected, i, c.Key())
+		}
+
+		// the cursor moves in both directions from the seek position
+		if err := c.Prev(); err != nil {
+			t.Fatalf("failed to move backward: %s", err)
+		}
+		if expected == 0 {
+			if c.Valid() {
+				t.Fatalf("expected the cursor not to be valid before the first key")
+			}
+
+			continue
+		}
+		if decodeUint32(c.Key()) != expected-2 {
+			t.Fatalf("expected %d before %d, but got %d", expected-2, expected, decodeUint32(c.Key()))
+		}
+
+		if err := c.Next(); err != nil {
+			t.Fatalf("failed to move forward: %s", err)
+		}
+		if decodeUint32(c.Key()) != expected {
+			t.Fatalf("expected %d, but got %d", expected, decodeUint32(c.Key()))
+		}
+	}
+
+	if err := c.Next(); err == nil {
+		t.Fatalf("expected an error for the invalid cursor")
+	}
+}
+
+func TestCursorDetectsModification(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	c := tree.Cursor()
+	if err := c.Seek([]byte{4}); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+	if err := c.Next(); err != nil {
+		t.Fatalf("failed to move: %s", err)
+	}
+
+	if _, _, err := tree.Put([]byte{4}, []byte{40}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if err := c.Next(); err != ErrModified {
+		t.Fatalf("expected ErrModified, but got %v", err)
+	}
+	if err := c.Prev(); err != ErrModified {
+		t.Fatalf("expected ErrModified, but got %v", err)
+	}
+
+	// the repositioned cursor sees the change
+	if err := c.Seek([]byte{4}); err != nil {
+		t.Fatalf("failed to seek: %s", err)
+	}
+	if !bytes.Equal(c.Value(), []byte{40}) {
+		t.Fatalf("expected the value 40, but got %v", c.Value())
+	}
+	if err := c.Next(); err != nil {
+		t.Fatalf("failed to move: %s", err)
+	}
+}
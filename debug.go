@@ -0,0 +1,149 @@
+package fbptree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DebugFormat is the format of DebugDump.
+type DebugFormat int
+
+const (
+	// DebugText is the indented text with one node per line.
+	DebugText DebugFormat = iota
+	// DebugDOT is the Graphviz DOT graph, e.g. for dot -Tsvg.
+	DebugDOT
+)
+
+// DebugDump writes the structure of the tree: the identifiers of the nodes,
+// their keys in hex, the children of the internal nodes and the links of the
+// leaves, followed by the leaf chain in the text format. The values are not
+// written. It helps to debug the splits and the merges, it is not intended
+// for the large trees.
+func (t *FBPTree) DebugDump(w io.Writer, format DebugFormat) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if format != DebugText && format != DebugDOT {
+		return fmt.Errorf("unknown debug format %d", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := t.debugDump(bw, format); err != nil {
+		return err
+	}
+
+	// the writer keeps the first write error until the flush
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write the dump: %w", err)
+	}
+
+	return nil
+}
+
+func (t *FBPTree) debugDump(w *bufio.Writer, format DebugFormat) error {
+	if format == DebugDOT {
+		fmt.Fprintf(w, "digraph fbptree {\n")
+		fmt.Fprintf(w, "  node [shape=box, fontname=monospace];\n")
+	} else {
+		fmt.Fprintf(w, "tree of order %d with %d keys\n", t.order, t.size())
+	}
+
+	if t.metadata == nil {
+		if format == DebugDOT {
+			fmt.Fprintf(w, "}\n")
+		}
+
+		return nil
+	}
+
+	if err := t.debugNode(w, format, t.metadata.rootID, 0); err != nil {
+		return err
+	}
+
+	if format == DebugDOT {
+		fmt.Fprintf(w, "}\n")
+
+		return nil
+	}
+
+	fmt.Fprintf(w, "leaf chain:")
+	for nodeID := t.metadata.leftmostID; nodeID != 0; {
+		leaf, err := t.storage.loadNodeByID(nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to load the leaf %d: %w", nodeID, err)
+		}
+
+		fmt.Fprintf(w, " %d", nodeID)
+		nodeID = leaf.nextID()
+	}
+	fmt.Fprintf(w, "\n")
+
+	return nil
+}
+
+// debugNode writes the node and its subtree at the given depth.
+func (t *FBPTree) debugNode(w *bufio.Writer, format DebugFormat, nodeID uint32, depth int) error {
+	n, err := t.storage.loadNodeByID(nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to load the node %d: %w", nodeID, err)
+	}
+
+	keys := make([]string, n.keyNum)
+	for i := 0; i < n.keyNum; i++ {
+		keys[i] = fmt.Sprintf("%x", n.keys[i])
+	}
+
+	children := make([]uint32, 0)
+	if !n.leaf {
+		for i := 0; i <= n.keyNum; i++ {
+			children = append(children, n.pointers[i].asNodeID())
+		}
+	}
+
+	if format == DebugDOT {
+		fmt.Fprintf(w, "  n%d [label=\"%d\\n%s\"", n.id, n.id, strings.Join(keys, " "))
+		if n.leaf {
+			fmt.Fprintf(w, ", style=rounded")
+		}
+		fmt.Fprintf(w, "];\n")
+
+		for _, childID := range children {
+			fmt.Fprintf(w, "  n%d -> n%d;\n", n.id, childID)
+		}
+		if n.leaf && n.nextID() != 0 {
+			fmt.Fprintf(w, "  n%d -> n%d [style=dashed, constraint=false];\n", n.id, n.nextID())
+		}
+	} else {
+		indent := strings.Repeat("  ", depth)
+		if n.leaf {
+			fmt.Fprintf(w, "%snode %d (leaf): [%s] prev %d next %d\n", indent, n.id, strings.Join(keys, " "), n.prevID, n.nextID())
+		} else {
+			fmt.Fprintf(w, "%snode %d (internal): [%s] => %s\n", indent, n.id, strings.Join(keys, " "), joinNodeIDs(children))
+		}
+	}
+
+	for _, childID := range children {
+		if err := t.debugNode(w, format, childID, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// joinNodeIDs returns the node identifiers separated by the spaces.
+func joinNodeIDs(nodeIDs []uint32) string {
+	s := make([]string, len(nodeIDs))
+	for i, nodeID := range nodeIDs {
+		s[i] = fmt.Sprint(nodeID)
+	}
+
+	return strings.Join(s, " ")
+}
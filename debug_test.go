@@ -0,0 +1,84 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDebugDump(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	var empty bytes.Buffer
+	if err := tree.DebugDump(&empty, DebugText); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+	if empty.String() != "tree of order 3 with 0 keys\n" {
+		t.Fatalf("unexpected dump of the empty tree %q", empty.String())
+	}
+
+	for i := 1; i <= 4; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	var text bytes.Buffer
+	if err := tree.DebugDump(&text, DebugText); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(text.String()), "\n")
+	if lines[0] != "tree of order 3 with 4 keys" {
+		t.Fatalf("unexpected header %q", lines[0])
+	}
+	if !strings.HasPrefix(lines[1], "node ") || !strings.Contains(lines[1], "(internal)") {
+		t.Fatalf("expected the internal root, but got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[len(lines)-1], "leaf chain: ") {
+		t.Fatalf("expected the leaf chain, but got %q", lines[len(lines)-1])
+	}
+
+	leaves := 0
+	for _, line := range lines {
+		if strings.Contains(line, "(leaf)") {
+			if !strings.HasPrefix(line, "  ") {
+				t.Fatalf("expected the indented leaf, but got %q", line)
+			}
+			leaves++
+		}
+	}
+	if chain := strings.Fields(strings.TrimPrefix(lines[len(lines)-1], "leaf chain:")); len(chain) != leaves {
+		t.Fatalf("expected %d leaves in the chain, but got %v", leaves, chain)
+	}
+
+	var dot bytes.Buffer
+	if err := tree.DebugDump(&dot, DebugDOT); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph fbptree {\n") || !strings.HasSuffix(dot.String(), "}\n") {
+		t.Fatalf("unexpected graph %q", dot.String())
+	}
+	if !strings.Contains(dot.String(), "style=dashed") {
+		t.Fatalf("expected the leaf links in the graph %q", dot.String())
+	}
+
+	if err := tree.DebugDump(&dot, DebugFormat(5)); err == nil {
+		t.Fatalf("expected the error for the unknown format")
+	}
+}
@@ -0,0 +1,186 @@
+package fbptree
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// The dump format is a header followed by the entries in the key order,
+// all the integers are big-endian:
+//
+//	magic     8 bytes "FBPTDUMP"
+//	version   uint16, currently 2
+//	ordering  uint16 length and the name of the key order, empty for the byte order
+//	count     uint32 number of the entries
+//	entries   count times: uint32 key length, key, uint32 value length, value
+//
+// The version 1 dumps with uint16 key and value lengths are still read.
+var dumpMagic = []byte("FBPTDUMP")
+
+const dumpVersion = 2
+
+// Dump streams all the entries of the tree in the key order in the dump
+// format directly from the leaf chain.
+func (t *FBPTree) Dump(w io.Writer) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	op := t.beginOperation()
+	err := t.dump(w)
+	t.endOperation(op, OperationDump, 0, 0, err)
+
+	return err
+}
+
+func (t *FBPTree) dump(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 0, len(dumpMagic)+8+len(t.ordering))
+	header = append(header, dumpMagic...)
+	header = append(header, encodeUint16(dumpVersion)...)
+	header = append(header, encodeUint16(uint16(len(t.ordering)))...)
+	header = append(header, t.ordering...)
+	header = append(header, encodeUint32(uint32(t.size()))...)
+	if _, err := bw.Write(header); err != nil {
+		return fmt.Errorf("failed to write the header: %w", err)
+	}
+
+	var writeErr error
+	err := t.forEach(func(key, value []byte) {
+		if writeErr != nil {
+			return
+		}
+
+		writeErr = writeDumpEntry(bw, key, value)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to traverse the tree: %w", err)
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write the entry: %w", writeErr)
+	}
+
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush the dump: %w", err)
+	}
+
+	return nil
+}
+
+func writeDumpEntry(w io.Writer, key, value []byte) error {
+	for _, data := range [][]byte{encodeUint32(uint32(len(key))), key, encodeUint32(uint32(len(value))), value} {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DumpHeader describes the dump.
+type DumpHeader struct {
+	// Ordering is the name of the key order, empty for the byte order.
+	Ordering string
+	// Count is the number of the entries.
+	Count int
+
+	// the version of the dump format
+	version uint16
+}
+
+// ReadDump reads the dump from the reader and calls the action for every
+// entry in the order they were dumped. It does not require the tree.
+func ReadDump(r io.Reader, action func(key []byte, value []byte)) (*DumpHeader, error) {
+	br := bufio.NewReader(r)
+
+	header, err := readDumpHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < header.Count; i++ {
+		key, value, err := readDumpEntry(br, header.version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the entry %d: %w", i, err)
+		}
+
+		action(key, value)
+	}
+
+	return header, nil
+}
+
+func readDumpHeader(r io.Reader) (*DumpHeader, error) {
+	prefix := make([]byte, len(dumpMagic)+4)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+
+	if !bytes.Equal(prefix[:len(dumpMagic)], dumpMagic) {
+		return nil, fmt.Errorf("the data is not a dump")
+	}
+
+	version := decodeUint16(prefix[len(dumpMagic) : len(dumpMagic)+2])
+	if version != 1 && version != dumpVersion {
+		return nil, fmt.Errorf("unsupported dump version %d", version)
+	}
+
+	ordering := make([]byte, decodeUint16(prefix[len(dumpMagic)+2:]))
+	if _, err := io.ReadFull(r, ordering); err != nil {
+		return nil, fmt.Errorf("failed to read the key ordering: %w", err)
+	}
+
+	var count [4]byte
+	if _, err := io.ReadFull(r, count[:]); err != nil {
+		return nil, fmt.Errorf("failed to read the entry count: %w", err)
+	}
+
+	return &DumpHeader{Ordering: string(ordering), Count: int(decodeUint32(count[:])), version: version}, nil
+}
+
+func readDumpEntry(r io.Reader, version uint16) ([]byte, []byte, error) {
+	key, err := readDumpField(r, version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the key: %w", err)
+	}
+
+	value, err := readDumpField(r, version)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	return key, value, nil
+}
+
+// readDumpField reads the field prefixed with its length, which is uint16
+// in the version 1 and uint32 since the version 2.
+func readDumpField(r io.Reader, version uint16) ([]byte, error) {
+	var data []byte
+	if version == 1 {
+		var size [2]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+
+		data = make([]byte, decodeUint16(size[:]))
+	} else {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+
+		data = make([]byte, decodeUint32(size[:]))
+	}
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
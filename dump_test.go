@@ -0,0 +1,110 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Put([]byte{c.key}, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+	if _, _, err := tree.Put([]byte{200}, nil); err != nil {
+		t.Fatalf("failed to put the empty value: %s", err)
+	}
+
+	expectedKeys, expectedValues := make([][]byte, 0), make([][]byte, 0)
+	err = tree.ForEach(func(key, value []byte) {
+		expectedKeys = append(expectedKeys, key)
+		expectedValues = append(expectedValues, value)
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tree.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	actualKeys, actualValues := make([][]byte, 0), make([][]byte, 0)
+	header, err := ReadDump(bytes.NewReader(buf.Bytes()), func(key, value []byte) {
+		actualKeys = append(actualKeys, key)
+		actualValues = append(actualValues, value)
+	})
+	if err != nil {
+		t.Fatalf("failed to read the dump: %s", err)
+	}
+
+	if header.Count != tree.Size() || header.Ordering != "" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+
+	if !reflect.DeepEqual(expectedKeys, actualKeys) {
+		t.Fatalf("expected keys %v, but got %v", expectedKeys, actualKeys)
+	}
+	if !reflect.DeepEqual(expectedValues, actualValues) {
+		t.Fatalf("expected values %v, but got %v", expectedValues, actualValues)
+	}
+
+	truncated := buf.Bytes()[:buf.Len()-1]
+	if _, err := ReadDump(bytes.NewReader(truncated), func(key, value []byte) {}); err == nil {
+		t.Fatalf("expected the error for the truncated dump")
+	}
+
+	if _, err := ReadDump(bytes.NewReader([]byte("not a dump at all")), func(key, value []byte) {}); err == nil {
+		t.Fatalf("expected the error for the invalid dump")
+	}
+}
+
+func TestDumpEmptyTree(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	var buf bytes.Buffer
+	if err := tree.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	header, err := ReadDump(&buf, func(key, value []byte) {
+		t.Fatal("call is not expected")
+	})
+	if err != nil {
+		t.Fatalf("failed to read the dump: %s", err)
+	}
+
+	if header.Count != 0 || header.Ordering != "collation:en" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+}
@@ -2,6 +2,7 @@ package fbptree
 
 import (
 	"encoding/binary"
+	"fmt"
 )
 
 func decodeUint16(data []byte) uint16 {
@@ -26,6 +27,17 @@ func encodeUint32(v uint32) []byte {
 	return data[:]
 }
 
+func decodeUint64(data []byte) uint64 {
+	return binary.BigEndian.Uint64(data)
+}
+
+func encodeUint64(v uint64) []byte {
+	var data [8]byte
+	binary.BigEndian.PutUint64(data[:], v)
+
+	return data[:]
+}
+
 func encodeBool(v bool) []byte {
 	var data [1]byte
 	if v {
@@ -43,18 +55,60 @@ func encodeNode(node *node) []byte {
 	data := make([]byte, 0)
 
 	data = append(data, encodeUint32(node.id)...)
-	data = append(data, encodeUint32(node.parentID)...)
-	data = append(data, encodeBool(node.leaf)...)
+	// the parent is not stored since the format version 2, the leaves
+	// keep the previous leaf in its place since the format version 3
+	data = append(data, encodeUint32(node.prevID)...)
+
+	// the second bit of the flags marks the node with the long keys, only
+	// their prefixes are in the node and the rest is in the key record
+	long := node.keyTailSize() > 0
+	// the third bit marks the front-coded keys, every key is stored as the
+	// size of the prefix shared with the previous key and the rest of the key
+	frontCoded := !long && sharesPrefixes(node)
+	flags := encodeBool(node.leaf)
+	// the fourth bit marks the leaf with the links to its siblings in the
+	// header, the previous leaf and the next one after the key record
+	if node.leaf {
+		flags[0] |= 8
+	}
+	if long {
+		flags[0] |= 2
+		data = append(data, flags...)
+		data = append(data, encodeUint32(node.keyRecordID)...)
+	} else if frontCoded {
+		flags[0] |= 4
+		data = append(data, flags...)
+	} else {
+		data = append(data, flags...)
+	}
+	if node.leaf {
+		data = append(data, encodeUint32(node.nextID())...)
+	}
+
 	data = append(data, encodeUint16(uint16(node.keyNum))...)
 	data = append(data, encodeUint16(uint16(len(node.keys)))...)
 
-	for _, key := range node.keys {
-		if key == nil {
-			break
+	for i := 0; i < node.keyNum; i++ {
+		key := node.keys[i]
+		if frontCoded {
+			shared := 0
+			if i > 0 {
+				shared = sharedPrefixSize(node.keys[i-1], key)
+			}
+
+			data = append(data, encodeUint16(uint16(shared))...)
+			data = append(data, encodeUint16(uint16(len(key)-shared))...)
+			data = append(data, key[shared:]...)
+		} else if !long {
+			data = append(data, encodeUint16(uint16(len(key)))...)
+			data = append(data, key...)
+		} else if !isLongKey(key) {
+			data = append(data, encodeUint32(uint32(len(key)))...)
+			data = append(data, key...)
+		} else {
+			data = append(data, encodeUint32(uint32(len(key)))...)
+			data = append(data, key[:keyPrefixSize]...)
 		}
-
-		data = append(data, encodeUint16(uint16(len(key)))...)
-		data = append(data, key...)
 	}
 
 	pointerNum := node.keyNum
@@ -66,116 +120,367 @@ func encodeNode(node *node) []byte {
 	data = append(data, encodeUint16(uint16(len(node.pointers)))...)
 	for i := 0; i < pointerNum; i++ {
 		pointer := node.pointers[i]
+		if pointer.expiresAt != 0 {
+			// the expiration time precedes the value
+			data = append(data, 5)
+			data = append(data, encodeUint64(uint64(pointer.expiresAt))...)
+		}
+
 		if pointer.isNodeID() {
-			data = append(data, 0)
+			data = append(data, 4)
 			data = append(data, encodeUint32(pointer.asNodeID())...)
+			data = append(data, encodeUint32(pointer.count)...)
+		} else if pointer.isValue() && len(pointer.asValue()) == 0 {
+			// only the presence marker for the empty values
+			data = append(data, 2)
 		} else if pointer.isValue() {
 			data = append(data, 1)
 			data = append(data, encodeUint16(uint16(len(pointer.asValue())))...)
 			data = append(data, pointer.asValue()...)
+		} else if pointer.isOverflow() {
+			data = append(data, 3)
+			data = append(data, encodeUint32(pointer.asOverflow().recordID)...)
+			data = append(data, encodeUint32(pointer.asOverflow().size)...)
 		}
 	}
 
-	var nextID uint32
-	if node.next() != nil {
-		nextID = node.next().asNodeID()
+	if node.leaf {
+		// the next leaf is in the header
+	} else if node.next() != nil {
 		data = append(data, encodeBool(true)...)
-		data = append(data, encodeUint32(nextID)...)
+		data = append(data, encodeUint32(node.next().asNodeID())...)
 	} else {
 		data = append(data, encodeBool(false)...)
 		data = append(data, 0)
 	}
 
+	// the tails of the long keys follow the node, they are written into
+	// the key record
+	for i := 0; long && i < node.keyNum; i++ {
+		if isLongKey(node.keys[i]) {
+			data = append(data, node.keys[i][keyPrefixSize:]...)
+		}
+	}
+
 	return data
 }
 
+// sharesPrefixes returns true if the front coding of the node keys is shorter
+// than the plain encoding, which spends two bytes less per key.
+func sharesPrefixes(node *node) bool {
+	shared := 0
+	for i := 1; i < node.keyNum; i++ {
+		shared += sharedPrefixSize(node.keys[i-1], node.keys[i])
+	}
+
+	return shared > 2*node.keyNum
+}
+
+// sharedPrefixSize returns the size of the common prefix of the keys.
+func sharedPrefixSize(x, y []byte) int {
+	size := 0
+	for size < len(x) && size < len(y) && x[size] == y[size] {
+		size++
+	}
+
+	return size
+}
+
+// frontCodedKeysSize returns the total size of the given number of the
+// front-coded keys at the start of the data. The size of the keys that are
+// truncated or share more than the previous key is not counted, the decoding
+// fails on them.
+func frontCodedKeysSize(data []byte, keyNum int) int {
+	size, prevSize, position := 0, 0, 0
+	for k := 0; k < keyNum && position+4 <= len(data); k++ {
+		shared := int(decodeUint16(data[position : position+2]))
+		suffixSize := int(decodeUint16(data[position+2 : position+4]))
+		position += 4 + suffixSize
+		if shared > prevSize || position > len(data) {
+			break
+		}
+
+		prevSize = shared + suffixSize
+		size += prevSize
+	}
+
+	return size
+}
+
+// keyRecordOf returns the identifier of the key record of the encoded
+// node or zero if the node has no long keys.
+func keyRecordOf(data []byte) uint32 {
+	if len(data) < 13 || data[8]&2 == 0 {
+		return 0
+	}
+
+	return decodeUint32(data[9:13])
+}
+
+// decodeNode decodes the node, the keys and the values refer to the data or
+// are allocated in the blocks of the node, so the node is released at once.
 func decodeNode(data []byte) (*node, error) {
-	position := 0
-	nodeID := decodeUint32(data[position : position+4])
-	position += 4
-	parentID := decodeUint32(data[position : position+4])
-	position += 4
-	leaf := decodeBool(data[position : position+1])
-	position += 1
-
-	keyNum := decodeUint16(data[position : position+2])
-	position += 2
-	keyLen := int(decodeUint16(data[position : position+2]))
-	position += 2
-	keys := make([][]byte, keyLen)
-	for k := 0; k < int(keyNum); k++ {
-		keySize := int(decodeUint16(data[position : position+2]))
-		position += 2
+	d := &decoder{data: data}
+	nodeID := d.uint32()
+	// the parent written by the format version 1 is ignored
+	prevID := d.uint32()
+	flags := d.byte()
+	leaf := flags&1 == 1
+	long := flags&2 != 0
+	frontCoded := flags&4 != 0
+	linked := flags&8 != 0
+	if !linked {
+		prevID = 0
+	}
 
-		key := data[position : position+keySize]
-		keys[k] = key
-		position += keySize
+	var keyRecordID uint32
+	if long {
+		keyRecordID = d.uint32()
 	}
 
-	pointerNum := decodeUint16(data[position : position+2])
-	position += 2
-	pointerLen := int(decodeUint16(data[position : position+2]))
-	position += 2
-	pointers := make([]*pointer, pointerLen)
-	for p := 0; p < int(pointerNum); p++ {
-		if data[position] == 0 {
-			position += 1
-			// nodeID
+	var nextID uint32
+	if linked {
+		nextID = d.uint32()
+	}
 
-			nodeID := decodeUint32(data[position : position+4])
-			position += 4
+	keyNum := int(d.uint16())
+	keyLen := int(d.uint16())
+	if keyNum > keyLen {
+		d.fail("key number %d is greater than the key capacity %d", keyNum, keyLen)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
 
-			pointers[p] = &pointer{nodeID}
-		} else if data[position] == 1 {
-			position += 1
-			// value
+	keys := make([][]byte, keyLen)
+	// the front-coded keys are decoded into one block, the other keys
+	// refer to the data
+	var keyBlock []byte
+	if frontCoded {
+		keyBlock = make([]byte, frontCodedKeysSize(data[d.position:], keyNum))
+	}
+	// the sizes of the long keys, only their prefixes are read for now
+	var longKeySizes map[int]int
+	for k := 0; k < keyNum && d.err == nil; k++ {
+		if frontCoded {
+			shared := int(d.uint16())
+			if (k == 0 && shared > 0) || (k > 0 && shared > len(keys[k-1])) {
+				d.fail("the shared prefix size %d is greater than the previous key size", shared)
+			}
+
+			suffix := d.bytes(int(d.uint16()))
+			if d.err == nil {
+				size := shared + len(suffix)
+				var key []byte
+				if size <= len(keyBlock) {
+					// the capacity is limited, so appending to the key
+					// does not overwrite the next one
+					key, keyBlock = keyBlock[:size:size], keyBlock[size:]
+				} else {
+					key = make([]byte, size)
+				}
+				if k > 0 {
+					copy(key, keys[k-1][:shared])
+				}
+				copy(key[shared:], suffix)
+				keys[k] = key
+			}
+
+			continue
+		} else if !long {
+			keySize := int(d.uint16())
+			keys[k] = d.bytes(keySize)
+
+			continue
+		}
 
-			valueSize := int(decodeUint16(data[position : position+2]))
-			position += 2
+		keySize := int(d.uint32())
+		if keySize > maxKeySize {
+			d.fail("key size %d is greater than the maximum key size %d", keySize, maxKeySize)
+		} else if keySize > maxInlineKeySize {
+			if longKeySizes == nil {
+				longKeySizes = make(map[int]int)
+			}
+			longKeySizes[k] = keySize
+			keySize = keyPrefixSize
+		}
+		keys[k] = d.bytes(keySize)
+	}
 
-			value := data[position : position+valueSize]
-			position += valueSize
+	pointerNum := int(d.uint16())
+	pointerLen := int(d.uint16())
+	if pointerNum > pointerLen {
+		d.fail("pointer number %d is greater than the pointer capacity %d", pointerNum, pointerLen)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	pointers := make([]*pointer, pointerLen)
+	// all the pointers of the node, including the next one, are allocated
+	// in one block that is released together with the node, and so are the
+	// references to the overflow records, while the inline values and the
+	// node identifiers are boxed into the pointers one by one
+	arena := make([]pointer, pointerNum+1)
+	var overflows []overflow
+	for p := 0; p < pointerNum && d.err == nil; p++ {
+		kind := d.byte()
+		if kind == 5 {
+			// the expiration time of the value that follows
+			arena[p].expiresAt = int64(d.uint64())
+			kind = d.byte()
+		}
 
-			pointers[p] = &pointer{value}
+		switch kind {
+		case 0:
+			// nodeID without the count of the keys in the subtree,
+			// written before the counts were introduced
+			arena[p].value = d.uint32()
+		case 1:
+			// value
+			valueSize := int(d.uint16())
+			arena[p].value = d.bytes(valueSize)
+		case 2:
+			// empty value
+			arena[p].value = data[d.position:d.position]
+		case 3:
+			// value in the overflow record
+			if overflows == nil {
+				overflows = make([]overflow, pointerNum)
+			}
+			overflows[p] = overflow{d.uint32(), d.uint32()}
+			arena[p].value = &overflows[p]
+		case 4:
+			// nodeID and the count of the keys in the subtree
+			arena[p].value = d.uint32()
+			arena[p].count = d.uint32()
+		default:
+			d.position--
+			d.fail("unknown pointer kind %d", kind)
 		}
+
+		pointers[p] = &arena[p]
 	}
 
 	n := &node{
-		nodeID,
-		leaf,
-		parentID,
-		keys,
-		int(keyNum),
-		pointers,
+		id:          nodeID,
+		leaf:        leaf,
+		keys:        keys,
+		keyNum:      keyNum,
+		pointers:    pointers,
+		keyRecordID: keyRecordID,
+		prevID:      prevID,
 	}
 
-	hasNextID := decodeBool(data[position : position+1])
-	position += 1
+	if linked {
+		if nextID != 0 && pointerLen == 0 {
+			d.fail("the next pointer does not fit into the pointer capacity")
+		} else if nextID != 0 {
+			next := &arena[len(arena)-1]
+			next.value = nextID
+			n.setNext(next)
+		}
+	} else if hasNextID := d.byte() == 1; hasNextID && pointerLen == 0 {
+		d.fail("the next pointer does not fit into the pointer capacity")
+	} else if hasNextID && d.err == nil {
+		nextID := d.uint32()
+		// the next pointer of the full internal node is its last child,
+		// which is already decoded with the count of its keys
+		if leaf || pointerNum < pointerLen {
+			next := &arena[len(arena)-1]
+			next.value = nextID
+			n.setNext(next)
+		}
+	} else if long {
+		// the padding of the missing next pointer precedes the key tails
+		d.byte()
+	}
 
-	if hasNextID {
-		nextID := decodeUint32(data[position : position+4])
-		n.setNext(&pointer{nextID})
+	for k := 0; k < keyNum && d.err == nil; k++ {
+		if size, ok := longKeySizes[k]; ok {
+			tail := d.bytes(size - keyPrefixSize)
+			keys[k] = append(keys[k][:keyPrefixSize:keyPrefixSize], tail...)
+		}
+	}
+
+	if d.err != nil {
+		return nil, d.err
 	}
 
 	return n, nil
 }
 
+// encodeTreeMetadata encodes the tree metadata, the key ordering is appended
+// only if it is not the byte order, the codec name only if the records are
+// compressed and the maximum node size only if it is set, so the files
+// created without them stay the same.
 func encodeTreeMetadata(metadata *treeMetadata) []byte {
-	var data [14]byte
+	data := make([]byte, 14)
 
 	copy(data[0:2], encodeUint16(metadata.order))
 	copy(data[2:6], encodeUint32(metadata.rootID))
 	copy(data[6:10], encodeUint32(metadata.leftmostID))
 	copy(data[10:14], encodeUint32(metadata.size))
 
-	return data[:]
+	if metadata.ordering != "" || metadata.codec != "" || metadata.maxNodeSize != 0 {
+		data = append(data, encodeUint16(uint16(len(metadata.ordering)))...)
+		data = append(data, metadata.ordering...)
+	}
+
+	if metadata.codec != "" || metadata.maxNodeSize != 0 {
+		data = append(data, encodeUint16(uint16(len(metadata.codec)))...)
+		data = append(data, metadata.codec...)
+	}
+
+	if metadata.maxNodeSize != 0 {
+		data = append(data, encodeUint32(metadata.maxNodeSize)...)
+	}
+
+	return data
 }
 
 func decodeTreeMetadata(data []byte) (*treeMetadata, error) {
-	return &treeMetadata{
+	if len(data) < 14 {
+		return nil, &CorruptionError{Reason: fmt.Sprintf("the tree metadata must be at least 14 bytes, but got %d", len(data))}
+	}
+
+	metadata := &treeMetadata{
 		order:      decodeUint16(data[0:2]),
 		rootID:     decodeUint32(data[2:6]),
 		leftmostID: decodeUint32(data[6:10]),
 		size:       decodeUint32(data[10:14]),
-	}, nil
+	}
+
+	if len(data) > 14 {
+		if len(data) < 16 {
+			return nil, &CorruptionError{Offset: 14, Reason: "the tree metadata key ordering is truncated"}
+		}
+
+		orderingSize := int(decodeUint16(data[14:16]))
+		if len(data) < 16+orderingSize {
+			return nil, &CorruptionError{Offset: 14, Reason: "the tree metadata key ordering is truncated"}
+		}
+		metadata.ordering = string(data[16 : 16+orderingSize])
+
+		rest := data[16+orderingSize:]
+		if len(rest) > 0 {
+			if len(rest) < 2 || len(rest) < 2+int(decodeUint16(rest[0:2])) {
+				return nil, &CorruptionError{Offset: 16 + orderingSize, Reason: "the tree metadata codec is truncated"}
+			}
+
+			codecSize := int(decodeUint16(rest[0:2]))
+			metadata.codec = string(rest[2 : 2+codecSize])
+			rest = rest[2+codecSize:]
+		}
+
+		if len(rest) > 0 {
+			if len(rest) < 4 {
+				return nil, &CorruptionError{Offset: len(data) - len(rest), Reason: "the tree metadata maximum node size is truncated"}
+			}
+
+			metadata.maxNodeSize = decodeUint32(rest[0:4])
+		}
+	}
+
+	return metadata, nil
 }
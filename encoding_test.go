@@ -1,6 +1,8 @@
 package fbptree
 
 import (
+	"bytes"
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -24,18 +26,17 @@ func TestEncodeDecodeTreeMetadata(t *testing.T) {
 
 func TestEncodeDecodeNode(t *testing.T) {
 	node := &node{
-		id:       42,
-		leaf:     true,
-		parentID: 75,
+		id:   42,
+		leaf: true,
 		keys: [][]byte{
 			{1, 2, 3, 4},
 			{5, 6, 7, 8},
 			nil,
 		},
 		pointers: []*pointer{
-			{uint32(42)},
-			{[]byte{1, 2, 3, 4}},
-			{uint32(17)},
+			{value: uint32(42)},
+			{value: []byte{1, 2, 3, 4}},
+			{value: uint32(17)},
 		},
 		keyNum: 2,
 	}
@@ -49,3 +50,238 @@ func TestEncodeDecodeNode(t *testing.T) {
 		t.Fatalf("node %v != decoded node %v", node, decoded)
 	}
 }
+
+func TestDecodeNodeAllocations(t *testing.T) {
+	cases := []struct {
+		name  string
+		leaf  bool
+		key   func(i int) []byte
+		value func(i int) *pointer
+		// the allocations besides the node, the keys, the pointers
+		// and their blocks
+		allocs int
+	}{
+		// one box per inline value
+		{"inline values", true, func(i int) []byte { return []byte{byte(i)} }, func(i int) *pointer { return &pointer{value: []byte{byte(i), 1}} }, 100},
+		{"front-coded keys", true, func(i int) []byte { return []byte(fmt.Sprintf("https://example.com/%03d", i)) }, func(i int) *pointer { return &pointer{value: []byte{byte(i), 1}} }, 100},
+		{"overflow values", true, func(i int) []byte { return []byte{byte(i)} }, func(i int) *pointer { return &pointer{value: &overflow{uint32(i + 1000), 70000}} }, 0},
+		// one box per node identifier
+		{"children", false, func(i int) []byte { return []byte{byte(i)} }, func(i int) *pointer { return &pointer{value: uint32(i + 1000), count: 3} }, 100},
+	}
+
+	for _, c := range cases {
+		n := &node{id: 1, leaf: c.leaf, keys: make([][]byte, 100), keyNum: 100, pointers: make([]*pointer, 101)}
+		for i := 0; i < 100; i++ {
+			n.keys[i] = c.key(i)
+			n.pointers[i] = c.value(i)
+		}
+		if c.leaf {
+			n.setNext(&pointer{value: uint32(7)})
+		} else {
+			n.keys[99] = nil
+			n.keyNum = 99
+		}
+		data := encodeNode(n)
+
+		allocs := testing.AllocsPerRun(10, func() {
+			if _, err := decodeNode(data); err != nil {
+				t.Fatalf("failed to decode node: %s", err)
+			}
+		})
+		// the node, the keys, the pointers and the blocks of the pointers,
+		// of the front-coded keys and of the overflow records
+		if int(allocs) > c.allocs+6 {
+			t.Fatalf("%s: expected at most %d allocations, but got %.0f", c.name, c.allocs+6, allocs)
+		}
+
+		decoded, err := decodeNode(data)
+		if err != nil {
+			t.Fatalf("%s: failed to decode node: %s", c.name, err)
+		}
+		if !reflect.DeepEqual(n, decoded) {
+			t.Fatalf("%s: node %v != decoded node %v", c.name, n, decoded)
+		}
+	}
+}
+
+func TestDecodeFrontCodedKeysDoNotShareCapacity(t *testing.T) {
+	n := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{[]byte("https://example.com/a"), []byte("https://example.com/b"), nil},
+		keyNum:   2,
+		pointers: []*pointer{{value: []byte{1}}, {value: []byte{2}}, nil, nil},
+	}
+
+	decoded, err := decodeNode(encodeNode(n))
+	if err != nil {
+		t.Fatalf("failed to decode node: %s", err)
+	}
+
+	_ = append(decoded.keys[0], 'x')
+	if string(decoded.keys[1]) != "https://example.com/b" {
+		t.Fatalf("appending to the key overwrites the next key %s", decoded.keys[1])
+	}
+}
+
+func TestEncodeEmptyValueAsMarker(t *testing.T) {
+	withValue := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{1}, nil},
+		keyNum:   1,
+		pointers: []*pointer{{value: []byte{1}}, nil, nil},
+	}
+	empty := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{1}, nil},
+		keyNum:   1,
+		pointers: []*pointer{{value: []byte{}}, nil, nil},
+	}
+
+	// the marker only, without the value size and the value
+	if len(encodeNode(withValue))-len(encodeNode(empty)) != 3 {
+		t.Fatalf("the empty value must be encoded as the marker only")
+	}
+
+	decoded, err := decodeNode(encodeNode(empty))
+	if err != nil {
+		t.Fatalf("failed to decode node: %s", err)
+	}
+
+	value := decoded.pointers[0].asValue()
+	if value == nil || len(value) != 0 {
+		t.Fatalf("expected the empty value, but got %v", value)
+	}
+}
+
+func TestEncodeDecodeNodeWithLongKeys(t *testing.T) {
+	long := bytes.Repeat([]byte{1}, maxInlineKeySize+10)
+	n := &node{
+		id:          1,
+		leaf:        true,
+		keys:        [][]byte{{0}, long, nil},
+		keyNum:      2,
+		pointers:    []*pointer{{value: []byte{1}}, {value: []byte{2}}, nil, nil},
+		keyRecordID: 5,
+	}
+
+	data := encodeNode(n)
+	if keyRecordOf(data) != 5 {
+		t.Fatalf("expected the key record 5, but got %d", keyRecordOf(data))
+	}
+	if n.keyTailSize() != len(long)-keyPrefixSize {
+		t.Fatalf("expected the tail size %d, but got %d", len(long)-keyPrefixSize, n.keyTailSize())
+	}
+
+	decoded, err := decodeNode(data)
+	if err != nil {
+		t.Fatalf("failed to decode node: %s", err)
+	}
+	if !reflect.DeepEqual(n, decoded) {
+		t.Fatalf("node %v != decoded node %v", n, decoded)
+	}
+
+	// the node without the tails is truncated
+	if _, err := decodeNode(data[:len(data)-n.keyTailSize()]); err == nil {
+		t.Fatalf("expected the error for the missing key tails")
+	}
+}
+
+func TestEncodeDecodeNodeWithFrontCodedKeys(t *testing.T) {
+	n := &node{
+		id:   1,
+		leaf: true,
+		keys: [][]byte{
+			[]byte("https://example.com/a"),
+			[]byte("https://example.com/ab"),
+			[]byte("https://example.com/b"),
+			nil,
+		},
+		keyNum:   3,
+		pointers: []*pointer{{value: []byte{1}}, {value: []byte{2}}, {value: []byte{3}}, nil, nil},
+	}
+
+	data := encodeNode(n)
+	if data[8]&4 == 0 {
+		t.Fatalf("expected the front-coded keys")
+	}
+
+	// the reversed keys of the same sizes do not share the prefixes
+	reversed := &node{id: 1, leaf: true, keys: make([][]byte, 4), keyNum: 3, pointers: n.pointers}
+	for i := 0; i < n.keyNum; i++ {
+		for j := len(n.keys[i]) - 1; j >= 0; j-- {
+			reversed.keys[i] = append(reversed.keys[i], n.keys[i][j])
+		}
+	}
+	if plain := encodeNode(reversed); plain[8]&4 != 0 || len(data) >= len(plain) {
+		t.Fatalf("expected the front-coded keys to be shorter than the plain keys")
+	}
+
+	decoded, err := decodeNode(data)
+	if err != nil {
+		t.Fatalf("failed to decode node: %s", err)
+	}
+	if !reflect.DeepEqual(n, decoded) {
+		t.Fatalf("node %v != decoded node %v", n, decoded)
+	}
+
+	// the second key can not share more than the size of the first key
+	corrupted := copyBytes(data)
+	// past the header with the next leaf, the key number and capacity
+	// and the first key
+	offset := 9 + 4 + 4 + 4 + len(n.keys[0])
+	copy(corrupted[offset:], encodeUint16(100))
+	if _, err := decodeNode(corrupted); err == nil {
+		t.Fatalf("expected the error for the shared prefix larger than the previous key")
+	}
+}
+
+func TestEncodeDecodeTreeMetadataWithOrdering(t *testing.T) {
+	treeMetadata := &treeMetadata{
+		order:      3,
+		rootID:     1,
+		leftmostID: 2,
+		size:       3,
+		ordering:   "collation:en",
+	}
+
+	data := encodeTreeMetadata(treeMetadata)
+	decoded, err := decodeTreeMetadata(data)
+	if err != nil {
+		t.Fatalf("failed to decode tree metadata: %s", err)
+	}
+
+	if !reflect.DeepEqual(treeMetadata, decoded) {
+		t.Fatalf("tree metadata %v != decoded tree metadata %v", treeMetadata, decoded)
+	}
+
+	if _, err := decodeTreeMetadata(data[:15]); err == nil {
+		t.Fatalf("expected the error for the truncated key ordering")
+	}
+}
+
+func TestEncodeDecodeTreeMetadataWithCodec(t *testing.T) {
+	treeMetadata := &treeMetadata{
+		order:      3,
+		rootID:     1,
+		leftmostID: 2,
+		size:       3,
+		codec:      "flate",
+	}
+
+	data := encodeTreeMetadata(treeMetadata)
+	decoded, err := decodeTreeMetadata(data)
+	if err != nil {
+		t.Fatalf("failed to decode tree metadata: %s", err)
+	}
+
+	if !reflect.DeepEqual(treeMetadata, decoded) {
+		t.Fatalf("tree metadata %v != decoded tree metadata %v", treeMetadata, decoded)
+	}
+
+	if _, err := decodeTreeMetadata(data[:len(data)-1]); err == nil {
+		t.Fatalf("expected the error for the truncated codec")
+	}
+}
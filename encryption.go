@@ -0,0 +1,208 @@
+package fbptree
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// Encryption option encrypts the file at rest with the given AEAD cipher,
+// e.g. AES-GCM from crypto/cipher with the user-supplied key. Every page
+// and the metadata block are sealed separately with a random nonce, which
+// is stored with the authentication tag next to the page, so the file takes
+// NonceSize+Overhead more bytes per page. The position of the page is
+// authenticated too, so the pages can not be swapped. The write-ahead log
+// holds the encrypted pages as well. The tree must be opened with the same
+// key every time, the encrypted file can not be read by Reader. As the
+// nonces are random, the key should be rotated with CompactTo into the tree
+// with the new key before about 2^32 page writes.
+func Encryption(aead cipher.AEAD) func(*config) error {
+	return func(c *config) error {
+		if aead == nil {
+			return fmt.Errorf("cipher must not be nil")
+		}
+
+		c.cipher = aead
+
+		return nil
+	}
+}
+
+// cipherFile encrypts the blocks of the file: the metadata block and the
+// pages. The blocks are stored with their nonces and tags, so the offsets
+// in the file are translated.
+type cipherFile struct {
+	file     randomAccessFile
+	aead     cipher.AEAD
+	pageSize int64
+	// the size added to every block
+	overhead int64
+}
+
+func newCipherFile(file randomAccessFile, aead cipher.AEAD, pageSize uint16) *cipherFile {
+	return &cipherFile{
+		file:     file,
+		aead:     aead,
+		pageSize: int64(pageSize),
+		overhead: int64(aead.NonceSize() + aead.Overhead()),
+	}
+}
+
+// block returns the index of the block that contains the offset.
+func (f *cipherFile) block(off int64) int64 {
+	if off < metadataSize {
+		return 0
+	}
+
+	return 1 + (off-metadataSize)/f.pageSize
+}
+
+// bounds returns the offset and the size of the block in the plain file.
+func (f *cipherFile) bounds(block int64) (int64, int64) {
+	if block == 0 {
+		return 0, metadataSize
+	}
+
+	return metadataSize + (block-1)*f.pageSize, f.pageSize
+}
+
+// physical returns the offset of the block in the encrypted file.
+func (f *cipherFile) physical(block int64) int64 {
+	if block == 0 {
+		return 0
+	}
+
+	return metadataSize + f.overhead + (block-1)*(f.pageSize+f.overhead)
+}
+
+// readBlock reads and decrypts the block, returns io.EOF
+// if the block does not exist.
+func (f *cipherFile) readBlock(block int64) ([]byte, error) {
+	_, size := f.bounds(block)
+	sealed := make([]byte, size+f.overhead)
+	if n, err := f.file.ReadAt(sealed, f.physical(block)); err != nil {
+		if err == io.EOF && n == 0 {
+			return nil, io.EOF
+		}
+		if err == io.EOF {
+			return nil, fmt.Errorf("the encrypted block %d is truncated", block)
+		}
+
+		return nil, err
+	}
+
+	nonceSize := f.aead.NonceSize()
+	data, err := f.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], encodeUint64(uint64(block)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt block %d, the key is wrong or the file is corrupted: %w", block, err)
+	}
+
+	return data, nil
+}
+
+// writeBlock encrypts and writes the block.
+func (f *cipherFile) writeBlock(block int64, data []byte) error {
+	nonce := make([]byte, f.aead.NonceSize(), int64(len(data))+f.overhead)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate the nonce: %w", err)
+	}
+
+	sealed := f.aead.Seal(nonce, nonce, data, encodeUint64(uint64(block)))
+	if _, err := f.file.WriteAt(sealed, f.physical(block)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (f *cipherFile) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		block := f.block(off + int64(n))
+		data, err := f.readBlock(block)
+		if err != nil {
+			return n, err
+		}
+
+		start, _ := f.bounds(block)
+		n += copy(p[n:], data[off+int64(n)-start:])
+	}
+
+	return n, nil
+}
+
+func (f *cipherFile) WriteAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		block := f.block(off + int64(n))
+		start, size := f.bounds(block)
+
+		var data []byte
+		if from := off + int64(n) - start; from > 0 || int64(len(p)-n) < size {
+			// the block is partially written
+			var err error
+			data, err = f.readBlock(block)
+			if err == io.EOF {
+				data, err = make([]byte, size), nil
+			}
+			if err != nil {
+				return n, err
+			}
+
+			n += copy(data[from:], p[n:])
+		} else {
+			data = p[n : int64(n)+size]
+			n += int(size)
+		}
+
+		if err := f.writeBlock(block, data); err != nil {
+			return n, err
+		}
+	}
+
+	return n, nil
+}
+
+func (f *cipherFile) Truncate(size int64) error {
+	block := f.block(size)
+	if start, _ := f.bounds(block); start != size {
+		return fmt.Errorf("the encrypted file can be truncated only by the pages")
+	}
+
+	return f.file.Truncate(f.physical(block))
+}
+
+func (f *cipherFile) Stat() (fs.FileInfo, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// the incomplete block is not a part of the file
+	size := int64(0)
+	if info.Size() >= metadataSize+f.overhead {
+		size = metadataSize + (info.Size()-metadataSize-f.overhead)/(f.pageSize+f.overhead)*f.pageSize
+	}
+
+	return sizedFileInfo{info, size}, nil
+}
+
+func (f *cipherFile) Sync() error {
+	return f.file.Sync()
+}
+
+func (f *cipherFile) Close() error {
+	return f.file.Close()
+}
+
+// sizedFileInfo describes the file with the size of its plain content.
+type sizedFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i sizedFileInfo) Size() int64 {
+	return i.size
+}
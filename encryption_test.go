@@ -0,0 +1,132 @@
+package fbptree
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func newTestCipher(t *testing.T, key byte) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Fatalf("failed to create the cipher: %s", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("failed to create the cipher: %s", err)
+	}
+
+	return aead
+}
+
+func TestEncryption(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	options := []func(*config) error{Order(4), PageSize(256), Encryption(newTestCipher(t, 1)), WriteAheadLog()}
+	tree, err := Open(dbPath, options...)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	secret := []byte("secret-value")
+	for i := 0; i < 500; i++ {
+		if _, _, err := tree.Put(encodeUint32(uint32(i)), secret); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 500; i += 3 {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+	if err := tree.Compact(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	var backup bytes.Buffer
+	if _, err := tree.Backup(&backup); err != nil {
+		t.Fatalf("failed to backup: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	for _, name := range []string{dbPath, dbPath + walSuffix} {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", name, err)
+		}
+		if bytes.Contains(data, secret) || bytes.Contains(data, formatMagic) {
+			t.Fatalf("expected %s to be encrypted", name)
+		}
+	}
+	if bytes.Contains(backup.Bytes(), secret) {
+		t.Fatalf("expected the backup to be encrypted")
+	}
+
+	if _, err := Open(dbPath, Order(4), PageSize(256)); !errors.Is(err, ErrNotTree) {
+		t.Fatalf("expected ErrNotTree for the tree opened without the key, but got %v", err)
+	}
+	if _, err := Open(dbPath, Order(4), PageSize(256), Encryption(newTestCipher(t, 2))); err == nil {
+		t.Fatalf("expected the error for the wrong key")
+	}
+
+	backupPath := path.Join(dbDir, "backup.data")
+	if err := ioutil.WriteFile(backupPath, backup.Bytes(), 0600); err != nil {
+		t.Fatalf("failed to write the backup: %s", err)
+	}
+
+	for _, name := range []string{dbPath, backupPath} {
+		tree, err = Open(name, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		if size := tree.Size(); size != 333 {
+			t.Fatalf("expected 333 entries, but got %d", size)
+		}
+		for i := 1; i < 500; i += 3 {
+			value, ok, err := tree.Get(encodeUint32(uint32(i)))
+			if err != nil || !ok || !bytes.Equal(value, secret) {
+				t.Fatalf("unexpected value %v for key %d: %v", value, i, err)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+
+	// the tampered page fails the authentication
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", dbPath, err)
+	}
+	data[len(data)-1] ^= 1
+	if err := ioutil.WriteFile(dbPath, data, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", dbPath, err)
+	}
+
+	tree, err = Open(dbPath, options...)
+	if err == nil {
+		err = tree.ForEach(func(key, value []byte) {})
+		tree.Close()
+	}
+	if err == nil {
+		t.Fatalf("expected the error for the tampered page")
+	}
+}
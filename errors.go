@@ -0,0 +1,26 @@
+package fbptree
+
+import (
+	"errors"
+)
+
+// ErrKeyTooLarge is returned by the writes of the key larger than the
+// maximum key size.
+var ErrKeyTooLarge = errors.New("the key is too large")
+
+// ErrValueTooLarge is returned by the writes of the value larger than the
+// maximum value size.
+var ErrValueTooLarge = errors.New("the value is too large")
+
+// ErrCorrupted is matched by the errors of the data that can not be read
+// from the file, e.g. CorruptionError or the metadata checksum mismatch.
+var ErrCorrupted = errors.New("the tree is corrupted")
+
+// ErrLocked is returned by Open if the file is opened for writing by the
+// other tree, e.g. in the other process, or if it is opened for reading by
+// the other trees and the tree is opened for writing.
+var ErrLocked = errors.New("the file is locked by the other tree")
+
+// ErrClosed is returned by the methods of the closed tree and by the
+// closed iterators.
+var ErrClosed = errors.New("the tree is closed")
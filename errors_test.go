@@ -0,0 +1,69 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestErrKeyTooLarge(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put(make([]byte, maxKeySize+1), nil); !errors.Is(err, ErrKeyTooLarge) {
+		t.Fatalf("expected ErrKeyTooLarge, but got %v", err)
+	}
+}
+
+func TestErrCorrupted(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if err := error(&CorruptionError{Record: 1, Reason: "broken"}); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected the corruption error to match ErrCorrupted")
+	}
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	file, err := os.OpenFile(dbPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("failed to open the file: %s", err)
+	}
+	if _, err := file.WriteAt([]byte{1, 2, 3, 4}, metadataChecksumPosition); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("failed to close the file: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(3)); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, but got %v", err)
+	}
+}
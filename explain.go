@@ -0,0 +1,294 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Explanation is the estimated cost of the operation. The cost of Get and
+// Scan is calculated by reading the nodes they would visit, the writes are
+// run without committing them, so nothing is written either way.
+type Explanation struct {
+	// NodesRead is the number of the nodes that would be loaded.
+	NodesRead int
+	// PagesRead is the number of the pages that would be read.
+	PagesRead int
+	// NodesWritten is the number of the nodes that would be written.
+	NodesWritten int
+	// PagesWritten is the number of the page writes including the metadata.
+	PagesWritten int
+	// Splits is the number of the expected node splits.
+	Splits int
+	// Merges is the number of the expected node merges.
+	Merges int
+	// CacheHits is the number of the nodes that would be
+	// served from the memory without reading the file.
+	CacheHits int
+}
+
+// ExplainGet estimates the cost of Get for the key.
+func (t *FBPTree) ExplainGet(key []byte) (*Explanation, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	e := new(Explanation)
+	if t.metadata == nil {
+		return e, nil
+	}
+
+	if _, err := t.explainPath(e, key); err != nil {
+		return nil, fmt.Errorf("failed to explain the path: %w", err)
+	}
+
+	return e, nil
+}
+
+// ExplainScan estimates the cost of scanning the keys in the range [start, end).
+// The nil end means the scan till the end of the tree.
+func (t *FBPTree) ExplainScan(start, end []byte) (*Explanation, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	e := new(Explanation)
+	if t.metadata == nil {
+		return e, nil
+	}
+
+	path, err := t.explainPath(e, start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain the path: %w", err)
+	}
+
+	leaf := path[len(path)-1]
+	for leaf.next() != nil && (end == nil || t.less(leaf.keys[leaf.keyNum-1], end)) {
+		nextID := leaf.next().asNodeID()
+		leaf, err = t.explainLoad(e, nextID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the next leaf %d: %w", nextID, err)
+		}
+
+		t.explainRead(e, leaf)
+	}
+
+	return e, nil
+}
+
+// ExplainPut estimates the cost of Put for the key and the value. The put
+// is run without committing it: the changes of the file are deferred and
+// discarded, so the explanation counts the reads and the writes of the file
+// the put would make with the current cache, including the splits, the
+// counts of the keys in the ancestors and the metadata. It takes the write
+// lock and fails the same way as Put, e.g. for the read-only tree.
+func (t *FBPTree) ExplainPut(key, value []byte) (*Explanation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.explainWrite(func() error {
+		_, _, err := t.put(key, value)
+
+		return err
+	})
+}
+
+// ExplainDelete estimates the cost of Delete for the key,
+// it is run without committing it, see ExplainPut.
+func (t *FBPTree) ExplainDelete(key []byte) (*Explanation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.explainWrite(func() error {
+		_, _, err := t.delete(key)
+
+		return err
+	})
+}
+
+// dryRun is the in-memory state of the tree before the write that is run
+// to explain it, the state is restored after the write is discarded.
+type dryRun struct {
+	metadata   *treeMetadata
+	parents    map[uint32]uint32
+	lifetime   Stats
+	stats      ioStats
+	cache      *nodeCache
+	leafAccess map[uint32]uint64
+	hotLeaves  []uint32
+	// the pager and the records are not changed by the write,
+	// it changes their copies loaded from the file
+	pager   *pager
+	records *records
+	// the size of the file before the write
+	size int64
+
+	version     uint64
+	invalidated uint64
+	changed     map[uint32]uint64
+
+	metrics        Metrics
+	counterMetrics Metrics
+	logger         Logger
+}
+
+// explainWrite runs the write with the changes of the file deferred, counts
+// its reads and writes and discards it.
+func (t *FBPTree) explainWrite(run func() error) (*Explanation, error) {
+	if err := t.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	d, err := t.beginDryRun()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin the write: %w", err)
+	}
+	err = run()
+
+	e := new(Explanation)
+	if err == nil {
+		e.NodesWritten = len(t.storage.dirty)
+		err = t.storage.flushNodes()
+	}
+
+	stats := t.storage.stats()
+	e.NodesRead = int(stats.hits + stats.misses - d.stats.hits - d.stats.misses)
+	e.CacheHits = int(stats.hits - d.stats.hits)
+	e.PagesRead = int(stats.reads - d.stats.reads)
+	e.PagesWritten = int(stats.writes - d.stats.writes)
+	e.Splits = int(t.storage.lifetime.Splits - d.lifetime.Splits)
+	e.Merges = int(t.storage.lifetime.Merges - d.lifetime.Merges)
+
+	t.endDryRun(d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// beginDryRun saves the in-memory state of the tree and starts deferring
+// the changes of the file. The write runs on the copy of the pager loaded
+// from the file, so discarding it never has to read the file again. The
+// metrics and the logger do not receive the events of the discarded write.
+func (t *FBPTree) beginDryRun() (*dryRun, error) {
+	s := t.storage
+	stats := s.stats()
+	pager, records, err := s.loadPager()
+	if err != nil {
+		return nil, err
+	}
+	// the reads of the copy are not the reads of the write
+	s.counter.set(stats)
+	if s.pager.lowestFree != nil {
+		pager.lowestFree = append([]uint32(nil), s.pager.lowestFree...)
+	}
+
+	d := &dryRun{
+		parents:        t.parents,
+		lifetime:       s.lifetime,
+		stats:          stats,
+		cache:          s.cache,
+		leafAccess:     s.leafAccess,
+		hotLeaves:      append([]uint32(nil), s.hotLeaves...),
+		pager:          s.pager,
+		records:        s.records,
+		size:           s.wal.size,
+		version:        s.version,
+		invalidated:    s.invalidated,
+		metrics:        s.metrics,
+		counterMetrics: s.counter.metrics,
+		logger:         s.logger,
+	}
+	if t.metadata != nil {
+		metadata := *t.metadata
+		d.metadata = &metadata
+	}
+	if s.changed != nil {
+		d.changed = make(map[uint32]uint64, len(s.changed))
+		for nodeID, version := range s.changed {
+			d.changed[nodeID] = version
+		}
+	}
+
+	// the write caches the nodes it changes
+	s.cache = s.cache.clone()
+	s.leafAccess = make(map[uint32]uint64)
+	s.pager, s.records = pager, records
+	s.metrics, s.counter.metrics = nil, nil
+	s.logger, s.pager.logger = nil, nil
+
+	s.begin()
+	s.bufferNodes()
+
+	return d, nil
+}
+
+// endDryRun discards the deferred changes of the file and restores the
+// saved state, the file is not changed by the write, so the state matches it.
+func (t *FBPTree) endDryRun(d *dryRun) {
+	s := t.storage
+	s.dirty = nil
+	s.wal.discard(d.size)
+
+	t.metadata = d.metadata
+	t.parents = d.parents
+	s.lifetime = d.lifetime
+	s.counter.set(d.stats)
+	s.cache = d.cache
+	s.leafAccess = d.leafAccess
+	s.hotLeaves = d.hotLeaves
+	s.pager, s.records = d.pager, d.records
+	s.version, s.invalidated, s.changed = d.version, d.invalidated, d.changed
+	s.metrics, s.counter.metrics = d.metrics, d.counterMetrics
+	s.logger = d.logger
+}
+
+// explainPath loads the path from the root to the leaf
+// that might contain the key.
+func (t *FBPTree) explainPath(e *Explanation, key []byte) ([]*node, error) {
+	current, err := t.explainLoad(e, t.metadata.rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root node: %w", err)
+	}
+	t.explainRead(e, current)
+
+	path := []*node{current}
+	for !current.leaf {
+		position := 0
+		for position < current.keyNum && !t.less(key, current.keys[position]) {
+			position++
+		}
+
+		nextID := current.pointers[position].asNodeID()
+		current, err = t.explainLoad(e, nextID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load next node %d: %w", nextID, err)
+		}
+		t.explainRead(e, current)
+
+		path = append(path, current)
+	}
+
+	return path, nil
+}
+
+// explainLoad loads the node and accounts the cache hit
+// if the node is already cached.
+func (t *FBPTree) explainLoad(e *Explanation, nodeID uint32) (*node, error) {
+	if t.storage.cache.contains(nodeID) {
+		e.CacheHits++
+	}
+
+	return t.storage.loadNodeByID(nodeID)
+}
+
+func (t *FBPTree) explainRead(e *Explanation, n *node) {
+	e.NodesRead++
+	e.PagesRead += t.storage.pageCount(n)
+}
@@ -0,0 +1,250 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), PageSize(4096))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	e, err := tree.ExplainPut([]byte{1}, []byte{1})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.NodesWritten != 1 || e.Splits != 0 {
+		t.Fatalf("unexpected explanation for the empty tree: %+v", e)
+	}
+
+	tree.Put([]byte{1}, []byte{1})
+	tree.Put([]byte{2}, []byte{2})
+
+	// the root leaf is full for the order 3
+	e, err = tree.ExplainPut([]byte{3}, []byte{3})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.Splits != 1 || e.NodesRead != 1 {
+		t.Fatalf("expected one split and one read, but got %+v", e)
+	}
+
+	e, err = tree.ExplainPut([]byte{2}, []byte{3})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.Splits != 0 || e.NodesWritten != 1 {
+		t.Fatalf("expected to override without split, but got %+v", e)
+	}
+
+	for _, c := range treeCases {
+		tree.Put([]byte{c.key}, []byte(c.value))
+	}
+
+	trace, err := tree.Trace([]byte{0})
+	if err != nil {
+		t.Fatalf("failed to trace: %s", err)
+	}
+	height := len(trace.Steps)
+
+	e, err = tree.ExplainGet([]byte{0})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.NodesRead != height || e.NodesWritten != 0 {
+		t.Fatalf("expected to read %d nodes only, but got %+v", height, e)
+	}
+
+	// the path is cached after the first read
+	e, err = tree.ExplainGet([]byte{0})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.CacheHits != height {
+		t.Fatalf("expected %d cache hits, but got %+v", height, e)
+	}
+
+	e, err = tree.ExplainScan(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	leaves := 0
+	for it, _ := tree.Iterator(); it.HasNext(); {
+		it.Next()
+		if it.i == 0 {
+			leaves++
+		}
+	}
+	if e.NodesRead != height-1+leaves {
+		t.Fatalf("expected to read %d nodes, but got %+v", height-1+leaves, e)
+	}
+
+	e, err = tree.ExplainDelete([]byte{200})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	if e.NodesWritten != 0 {
+		t.Fatalf("expected no writes for the non-existent key, but got %+v", e)
+	}
+
+	merges := 0
+	for _, c := range treeCases {
+		e, err := tree.ExplainDelete([]byte{c.key})
+		if err != nil {
+			t.Fatalf("failed to explain: %s", err)
+		}
+		merges += e.Merges
+
+		tree.Delete([]byte{c.key})
+	}
+	if merges == 0 {
+		t.Fatal("expected merges while deleting all the keys")
+	}
+}
+
+func TestExplainMatchesWrites(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	cases := [][]func(*config) error{
+		{Order(4), CacheSize(0)},
+		{Order(4), PageSize(512)},
+		{Order(32), PageSize(512), MaxNodeSize(512), SecureDelete(), WriteAheadLog()},
+	}
+	for i, options := range cases {
+		tree, err := Open(path.Join(dbDir, fmt.Sprintf("sample_%d.data", i)), options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		r := rand.New(rand.NewSource(int64(i)))
+		for j := 0; j < 400; j++ {
+			key := encodeUint32(uint32(r.Intn(100)))
+			value := make([]byte, r.Intn(100))
+			if r.Intn(10) == 0 {
+				value = make([]byte, 1000)
+			}
+
+			deleting := r.Intn(3) == 0
+			var e *Explanation
+			if deleting {
+				e, err = tree.ExplainDelete(key)
+			} else {
+				e, err = tree.ExplainPut(key, value)
+			}
+			if err != nil {
+				t.Fatalf("failed to explain: %s", err)
+			}
+
+			before, lifetime := tree.storage.stats(), tree.storage.lifetime
+			if deleting {
+				_, _, err = tree.Delete(key)
+			} else {
+				_, _, err = tree.Put(key, value)
+			}
+			if err != nil {
+				t.Fatalf("failed to write: %s", err)
+			}
+			after := tree.storage.stats()
+
+			actual := &Explanation{
+				NodesRead:    int(after.hits + after.misses - before.hits - before.misses),
+				PagesRead:    int(after.reads - before.reads),
+				PagesWritten: int(after.writes - before.writes),
+				Splits:       int(tree.storage.lifetime.Splits - lifetime.Splits),
+				Merges:       int(tree.storage.lifetime.Merges - lifetime.Merges),
+				CacheHits:    int(after.hits - before.hits),
+				// the file does not count the nodes
+				NodesWritten: e.NodesWritten,
+			}
+			if *e != *actual {
+				t.Fatalf("case %d, write %d: the explanation %+v does not match the write %+v", i, j, e, actual)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
+
+func TestExplainDiscardsWrite(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4), CacheSize(0))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		tree.Put(encodeUint32(uint32(i*2)), []byte{1})
+	}
+
+	it, err := tree.Iterator()
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	defer it.Close()
+	it.Next()
+
+	before := tree.storage.stats()
+	e, err := tree.ExplainPut(encodeUint32(51), []byte{1})
+	if err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+	// the path, the reloaded ancestors, the flushed nodes and the metadata
+	if e.PagesRead != 14 || e.PagesWritten != 6 {
+		t.Fatalf("expected to read 14 pages and to write 6 pages, but got %+v", e)
+	}
+	if _, err := tree.ExplainDelete(encodeUint32(2)); err != nil {
+		t.Fatalf("failed to explain: %s", err)
+	}
+
+	if tree.storage.stats() != before {
+		t.Fatal("expected the explained writes not to be counted")
+	}
+	if tree.Size() != 100 {
+		t.Fatalf("expected the size 100, but got %d", tree.Size())
+	}
+	if _, exists, _ := tree.Get(encodeUint32(51)); exists {
+		t.Fatal("expected the explained put to be discarded")
+	}
+	if _, exists, _ := tree.Get(encodeUint32(2)); !exists {
+		t.Fatal("expected the explained delete to be discarded")
+	}
+	if _, _, err := it.Next(); err != nil {
+		t.Fatalf("expected the iterator to continue, but got %s", err)
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check tree: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("the tree is inconsistent: %v", report.Problems)
+	}
+}
@@ -2,22 +2,36 @@ package fbptree
 
 import (
 	"bytes"
+	"crypto/cipher"
 	"fmt"
 	"math"
 	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const defaultOrder = 500
 
-const maxKeySize = math.MaxUint16
-const maxValueSize = math.MaxUint16
+// the tails of the long keys of the node are kept in one record,
+// so they must fit into it for the maximum order
+const maxKeySize = 4 << 20
+const maxValueSize = maxRecordSize - 1
 const maxTreeSize = math.MaxUint32
 
 // the limit for the  B+ tree order, must be less than math.MaxUint16
 const maxOrder = 1000
 
-// FBPTree represents B+ tree store in the file.
+// FBPTree represents B+ tree store in the file. It is safe for the
+// concurrent use: the reads run in parallel and the writes are exclusive.
+// The callbacks, like the ForEach action, must not call the tree.
 type FBPTree struct {
+	// the reads share the tree and the writes hold it exclusively
+	mu sync.RWMutex
+
+	path string
+	cfg  *config
+
 	order int
 
 	storage *storage
@@ -26,6 +40,54 @@ type FBPTree struct {
 
 	// minimum allowed number of keys in the tree ceil(order/2)-1
 	minKeyNum int
+
+	// the parents of the nodes on the path of the last descent of the
+	// write, the nodes do not store their parents, see descend
+	parents map[uint32]uint32
+
+	// the leaves larger than this size are split, 0 if they are split
+	// only by the order, see MaxNodeSize
+	maxNodeSize uint32
+
+	// fsync after every change of the tree shape
+	strictMetadataSync bool
+
+	onOperation func(info OperationInfo)
+
+	logger          Logger
+	slowOpThreshold time.Duration
+
+	// the key order, bytes.Compare by default
+	compare func(x, y []byte) int
+	// the name of the key order recorded in the metadata,
+	// empty for the byte order
+	ordering string
+
+	// the error of the write that failed midway, see ErrPoisoned
+	poisoned error
+
+	// true after Close, the methods return ErrClosed
+	closed bool
+	// the number of the iterators that are not exhausted or closed,
+	// changed atomically by the iterators under the read lock
+	iterators int32
+
+	// the open writable transaction and the number
+	// of the open read-only transactions
+	tx      *Tx
+	readers int
+
+	// the sync policy and the time of the last sync by it
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+	lastSync     time.Time
+
+	// the automatic compaction, see AutoCompact
+	compactThreshold float64
+	compactInterval  time.Duration
+	lastCompaction   time.Time
+	compactionPaused bool
+	autoCompacting   bool
 }
 
 type treeMetadata struct {
@@ -33,11 +95,42 @@ type treeMetadata struct {
 	rootID     uint32
 	leftmostID uint32
 	size       uint32
+	ordering   string
+	// the name of the codec of the records, empty if they are not compressed
+	codec string
+	// the maximum size of the leaf, 0 if the leaves are split only by the order
+	maxNodeSize uint32
 }
 
 type config struct {
-	order    uint16
-	pageSize uint16
+	order              uint16
+	pageSize           uint16
+	strictMetadataSync bool
+	retryPolicy        *retryPolicy
+	onOperation        func(info OperationInfo)
+	logger             Logger
+	slowOpThreshold    time.Duration
+	debugChecks        bool
+	compare            func(x, y []byte) int
+	ordering           string
+	warmup             bool
+	warmupLeaves       int
+	secureDelete       bool
+	wal                bool
+	cacheSize          int
+	syncPolicy         SyncPolicy
+	syncInterval       time.Duration
+	codec              Codec
+	readOnly           bool
+	cipher             cipher.AEAD
+	metrics            Metrics
+	compactThreshold   float64
+	compactInterval    time.Duration
+	growth             GrowthPolicy
+	autoOrder          bool
+	autoKeySize        int
+	autoValueSize      int
+	maxNodeSize        uint32
 }
 
 // Order option specifies the order of the B+ tree, between 3 and 1000.
@@ -52,6 +145,7 @@ func Order(order int) func(*config) error {
 		}
 
 		c.order = uint16(order)
+		c.autoOrder = false
 
 		return nil
 	}
@@ -74,14 +168,41 @@ func PageSize(pageSize int) func(*config) error {
 	}
 }
 
+// StrictMetadataSync option makes the tree fsync the file after every
+// structural change that affects the metadata: the root change, the leftmost
+// leaf change and the allocation of a new free page list container. It trades
+// the write throughput for never losing the shape of the tree.
+func StrictMetadataSync() func(*config) error {
+	return func(c *config) error {
+		c.strictMetadataSync = true
+
+		return nil
+	}
+}
+
 // Open opens an existent B+ tree or creates a new file.
 func Open(path string, options ...func(*config) error) (*FBPTree, error) {
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return open(path, cfg)
+}
+
+// newConfig applies the options to the default configuration.
+func newConfig(options []func(*config) error) (*config, error) {
 	defaultPageSize := os.Getpagesize()
 	if defaultPageSize > maxPageSize {
 		defaultPageSize = maxPageSize
 	}
 
-	cfg := &config{pageSize: uint16(defaultPageSize), order: defaultOrder}
+	cfg := &config{
+		pageSize:  uint16(defaultPageSize),
+		order:     defaultOrder,
+		compare:   bytes.Compare,
+		cacheSize: defaultCacheSize,
+	}
 	for _, option := range options {
 		err := option(cfg)
 		if err != nil {
@@ -89,23 +210,104 @@ func Open(path string, options ...func(*config) error) (*FBPTree, error) {
 		}
 	}
 
-	storage, err := newStorage(path, cfg.pageSize)
+	if cfg.autoOrder {
+		cfg.order = uint16(pageOrder(int(cfg.pageSize), cfg.autoKeySize, cfg.autoValueSize))
+	}
+
+	if cfg.slowOpThreshold > 0 && cfg.logger == nil {
+		return nil, fmt.Errorf("slow operation threshold requires the logger")
+	}
+
+	return cfg, nil
+}
+
+// open opens the tree by the path with the parsed configuration.
+func open(path string, cfg *config) (*FBPTree, error) {
+	storage, err := newStorage(path, cfg, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize the storage: %w", err)
 	}
 
 	metadata, err := storage.loadMetadata()
 	if err != nil {
+		storage.close()
+
 		return nil, fmt.Errorf("failed to load the metadata: %w", err)
 	}
 
+	if metadata != nil && cfg.autoOrder {
+		cfg.order = metadata.order
+	}
+
 	if metadata != nil && metadata.order != cfg.order {
+		storage.close()
+
 		return nil, fmt.Errorf("the tree was created with %d order, but the new order value is given %d", metadata.order, cfg.order)
 	}
 
+	if metadata != nil && metadata.ordering != cfg.ordering {
+		storage.close()
+
+		return nil, fmt.Errorf("the tree was created with %s key order, but the new key order is given %s", orderingName(metadata.ordering), orderingName(cfg.ordering))
+	}
+
+	if metadata != nil && metadata.codec != codecName(cfg.codec) {
+		storage.close()
+
+		return nil, fmt.Errorf("the tree was created with %s codec, but the new codec is given %s", codecDescription(metadata.codec), codecDescription(codecName(cfg.codec)))
+	}
+
+	if metadata != nil && metadata.maxNodeSize != cfg.maxNodeSize {
+		storage.close()
+
+		return nil, fmt.Errorf("the tree was created with %d maximum node size, but the new maximum node size is given %d", metadata.maxNodeSize, cfg.maxNodeSize)
+	}
+
 	minKeyNum := ceil(int(cfg.order), 2) - 1
 
-	return &FBPTree{storage: storage, order: int(cfg.order), metadata: metadata, minKeyNum: minKeyNum}, nil
+	tree := &FBPTree{
+		path:               path,
+		cfg:                cfg,
+		storage:            storage,
+		order:              int(cfg.order),
+		metadata:           metadata,
+		minKeyNum:          minKeyNum,
+		maxNodeSize:        cfg.maxNodeSize,
+		strictMetadataSync: cfg.strictMetadataSync,
+		onOperation:        cfg.onOperation,
+		logger:             cfg.logger,
+		slowOpThreshold:    cfg.slowOpThreshold,
+		compare:            cfg.compare,
+		ordering:           cfg.ordering,
+		syncPolicy:         cfg.syncPolicy,
+		syncInterval:       cfg.syncInterval,
+		lastSync:           time.Now(),
+		compactThreshold:   cfg.compactThreshold,
+		compactInterval:    cfg.compactInterval,
+		lastCompaction:     time.Now(),
+	}
+
+	if err := tree.countKeys(); err != nil {
+		tree.Close()
+
+		return nil, fmt.Errorf("failed to count the keys of the subtrees: %w", err)
+	}
+
+	if err := tree.linkLeaves(); err != nil {
+		tree.Close()
+
+		return nil, fmt.Errorf("failed to link the leaves: %w", err)
+	}
+
+	if cfg.warmup {
+		if err := tree.Warmup(cfg.warmupLeaves); err != nil {
+			tree.Close()
+
+			return nil, fmt.Errorf("failed to warm up the cache: %w", err)
+		}
+	}
+
+	return tree, nil
 }
 
 // node reprents a node in the B+ tree.
@@ -114,8 +316,7 @@ type node struct {
 
 	// true for leaf node and root without children
 	// and false for internal node and root with children
-	leaf     bool
-	parentID uint32
+	leaf bool
 
 	// Real key number is stored under the keyNum.
 	keys   [][]byte
@@ -128,11 +329,28 @@ type node struct {
 	// In the leaf node, the last pointers element points to
 	// the next leaf node.
 	pointers []*pointer
+
+	// the record with the tails of the long keys, zero if there are no
+	// long keys in the node
+	keyRecordID uint32
+
+	// the previous leaf node, zero for the leftmost leaf, the next leaf
+	// is the last pointer. Only relevant for the leaf nodes.
+	prevID uint32
+
+	// the encoded size of the node on its last update, see oversized
+	encoded int
 }
 
 // pointer wraps the node or the value.
 type pointer struct {
 	value interface{}
+	// the number of the keys in the subtree of the node,
+	// only for the pointers of the internal nodes
+	count uint32
+	// the expiration time of the value in Unix nanoseconds, zero if the
+	// value does not expire, only for the pointers of the leaves
+	expiresAt int64
 }
 
 func (p *pointer) isNodeID() bool {
@@ -160,6 +378,21 @@ func (p *pointer) asValue() []byte {
 // Get return the value by the key. Returns true if the
 // key exists.
 func (t *FBPTree) Get(key []byte) ([]byte, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, false, ErrClosed
+	}
+
+	op := t.beginOperation()
+	value, ok, err := t.get(key)
+	t.endOperation(op, OperationGet, len(key), len(value), err)
+
+	return value, ok, err
+}
+
+func (t *FBPTree) get(key []byte) ([]byte, bool, error) {
 	if t.metadata == nil {
 		return nil, false, nil
 	}
@@ -170,8 +403,17 @@ func (t *FBPTree) Get(key []byte) ([]byte, bool, error) {
 	}
 
 	for i := 0; i < leaf.keyNum; i++ {
-		if compare(key, leaf.keys[i]) == 0 {
-			return leaf.pointers[i].asValue(), true, nil
+		if t.compare(key, leaf.keys[i]) == 0 {
+			if leaf.pointers[i].expired() {
+				return nil, false, nil
+			}
+
+			value, err := t.storage.readValue(leaf.pointers[i])
+			if err != nil {
+				return nil, false, err
+			}
+
+			return value, true, nil
 		}
 	}
 
@@ -180,16 +422,41 @@ func (t *FBPTree) Get(key []byte) ([]byte, bool, error) {
 
 // findLeaf finds a leaf that might contain the key.
 func (t *FBPTree) findLeaf(key []byte) (*node, error) {
+	return t.findLeafOnPath(key, nil)
+}
+
+// descend finds the leaf that might contain the key for the write and
+// remembers the parents of the nodes on the path to it, so the write can
+// go up from the leaf without storing the parents in the nodes.
+func (t *FBPTree) descend(key []byte) (*node, error) {
+	t.parents = make(map[uint32]uint32)
+
+	return t.findLeafOnPath(key, t.parents)
+}
+
+// parentOf returns the parent of the node on the path of the last
+// descent, 0 for the root.
+func (t *FBPTree) parentOf(n *node) uint32 {
+	return t.parents[n.id]
+}
+
+// findLeafOnPath finds the leaf that might contain the key and records
+// the parents of the nodes on the path if the map is given.
+func (t *FBPTree) findLeafOnPath(key []byte, parents map[uint32]uint32) (*node, error) {
 	root, err := t.storage.loadNodeByID(t.metadata.rootID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load root node: %w", err)
 	}
 
+	if parents != nil {
+		parents[root.id] = 0
+	}
+
 	current := root
 	for !current.leaf {
 		position := 0
 		for position < current.keyNum {
-			if less(key, current.keys[position]) {
+			if t.less(key, current.keys[position]) {
 				break
 			} else {
 				position += 1
@@ -202,21 +469,50 @@ func (t *FBPTree) findLeaf(key []byte) (*node, error) {
 			return nil, fmt.Errorf("failed to load next node %d: %w", nextID, err)
 		}
 
+		if parents != nil {
+			parents[nextID] = current.id
+		}
+
 		current = nextNode
 	}
+	t.storage.recordLeafAccess(current.id)
 
 	return current, nil
 }
 
 // Put puts the key and the value into the tree. Returns true if the
-// key already exists and anyway overwrites it.
+// key already exists and anyway overwrites it. The nil or empty value is stored
+// only as a presence marker and Get returns the empty slice for it.
 func (t *FBPTree) Put(key, value []byte) ([]byte, bool, error) {
-	if len(key) > maxKeySize {
-		return nil, false, fmt.Errorf("maximum key size is %d, but received %d", maxKeySize, len(key))
-	} else if len(value) > maxValueSize {
-		return nil, false, fmt.Errorf("maximum value size is %d, but received %d", maxValueSize, len(value))
-	} else if t.metadata != nil && t.metadata.size >= maxTreeSize {
-		return nil, false, fmt.Errorf("maximum tree size is reached: %d", maxTreeSize)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.runPut(key, value)
+}
+
+// runPut runs put as the separate write.
+func (t *FBPTree) runPut(key, value []byte) ([]byte, bool, error) {
+	w, err := t.beginWrite()
+	if err != nil {
+		return nil, false, err
+	}
+
+	op := t.beginOperation()
+	prev, exists, err := t.put(key, value)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationPut, len(key), len(value), err)
+
+	return prev, exists, err
+}
+
+func (t *FBPTree) put(key, value []byte) ([]byte, bool, error) {
+	if value == nil {
+		// the empty values are stored as the presence markers
+		value = []byte{}
+	}
+
+	if err := t.checkPut(key, value); err != nil {
+		return nil, false, err
 	}
 
 	if t.metadata == nil {
@@ -228,7 +524,7 @@ func (t *FBPTree) Put(key, value []byte) ([]byte, bool, error) {
 		return nil, false, nil
 	}
 
-	leaf, err := t.findLeaf(key)
+	leaf, err := t.descend(key)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to find leaf: %w", err)
 	}
@@ -241,6 +537,19 @@ func (t *FBPTree) Put(key, value []byte) ([]byte, bool, error) {
 	return oldValue, overridden, nil
 }
 
+// checkPut checks that the key and the value can be put into the tree.
+func (t *FBPTree) checkPut(key, value []byte) error {
+	if len(key) > maxKeySize {
+		return fmt.Errorf("%w: maximum key size is %d, but received %d", ErrKeyTooLarge, maxKeySize, len(key))
+	} else if len(value) > maxValueSize {
+		return fmt.Errorf("%w: maximum value size is %d, but received %d", ErrValueTooLarge, maxValueSize, len(value))
+	} else if t.metadata != nil && t.metadata.size >= maxTreeSize {
+		return fmt.Errorf("maximum tree size is reached: %d", maxTreeSize)
+	}
+
+	return nil
+}
+
 // initializeRoot initializes root in the empty tree.
 func (t *FBPTree) initializeRoot(key, value []byte) error {
 	newNodeID, err := t.storage.newNode()
@@ -253,12 +562,14 @@ func (t *FBPTree) initializeRoot(key, value []byte) error {
 	keys[0] = copyBytes(key)
 
 	pointers := make([]*pointer, t.order)
-	pointers[0] = &pointer{value}
+	pointers[0], err = t.storage.newValue(value)
+	if err != nil {
+		return fmt.Errorf("failed to store the value: %w", err)
+	}
 
 	rootNode := &node{
 		id:       newNodeID,
 		leaf:     true,
-		parentID: 0,
 		keys:     keys,
 		keyNum:   1,
 		pointers: pointers,
@@ -269,6 +580,7 @@ func (t *FBPTree) initializeRoot(key, value []byte) error {
 		return fmt.Errorf("failed to store root node: %w", err)
 	}
 
+	t.storage.lifetime.Puts++
 	err = t.updateMetadata(newNodeID, newNodeID, 1)
 	if err != nil {
 		return fmt.Errorf("failed to update metadata: %w", err)
@@ -278,10 +590,14 @@ func (t *FBPTree) initializeRoot(key, value []byte) error {
 }
 
 func (t *FBPTree) updateMetadata(rootID, leftmostID, size uint32) error {
+	structural := t.metadata == nil || t.metadata.rootID != rootID || t.metadata.leftmostID != leftmostID
 	if t.metadata == nil {
 		// initialization
 		t.metadata = new(treeMetadata)
 		t.metadata.order = uint16(t.order)
+		t.metadata.ordering = t.ordering
+		t.metadata.codec = codecName(t.storage.records.codec)
+		t.metadata.maxNodeSize = t.maxNodeSize
 	}
 
 	t.metadata.rootID = rootID
@@ -293,6 +609,12 @@ func (t *FBPTree) updateMetadata(rootID, leftmostID, size uint32) error {
 		return fmt.Errorf("failed to store metadata: %w", err)
 	}
 
+	if structural && t.strictMetadataSync {
+		if err := t.storage.flush(); err != nil {
+			return fmt.Errorf("failed to flush metadata: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -304,6 +626,12 @@ func (t *FBPTree) deleteMetadata() error {
 		return fmt.Errorf("failed to delete metadata: %w", err)
 	}
 
+	if t.strictMetadataSync {
+		if err := t.storage.flush(); err != nil {
+			return fmt.Errorf("failed to flush metadata: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -321,30 +649,21 @@ func (t *FBPTree) putIntoNewRoot(key []byte, l, r *node) error {
 		leaf:     false,
 		keys:     make([][]byte, t.order-1),
 		pointers: make([]*pointer, t.order),
-		parentID: 0,
 		keyNum:   1, // we are going to put just one key
 	}
 
 	newRoot.keys[0] = key
-	newRoot.pointers[0] = &pointer{l.id}
-	newRoot.pointers[1] = &pointer{r.id}
+	newRoot.pointers[0] = &pointer{value: l.id, count: l.size()}
+	newRoot.pointers[1] = &pointer{value: r.id, count: r.size()}
 
 	err = t.storage.updateNodeByID(newNodeID, newRoot)
 	if err != nil {
 		return fmt.Errorf("failed to update node by ID %d: %w", newNodeID, err)
 	}
 
-	l.parentID = newNodeID
-	err = t.storage.updateNodeByID(l.id, l)
-	if err != nil {
-		return fmt.Errorf("failed to update left node %d: %w", l.id, err)
-	}
-
-	r.parentID = newNodeID
-	err = t.storage.updateNodeByID(r.id, r)
-	if err != nil {
-		return fmt.Errorf("failed to update right node %d: %w", r.id, err)
-	}
+	t.parents[newNodeID] = 0
+	t.parents[l.id] = newNodeID
+	t.parents[r.id] = newNodeID
 
 	err = t.updateRootID(newNodeID)
 	if err != nil {
@@ -371,17 +690,39 @@ func (t *FBPTree) updateRootID(rootID uint32) error {
 func (t *FBPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool, error) {
 	insertPos := 0
 	for insertPos < n.keyNum {
-		cmp := compare(k, n.keys[insertPos])
+		cmp := t.compare(k, n.keys[insertPos])
 		if cmp == 0 {
-			// found the exact match
-			oldValue := n.pointers[insertPos].overrideValue(v)
+			// found the exact match, the expired value is replaced
+			// as if the key did not exist
+			expired := n.pointers[insertPos].expired()
+			var oldValue []byte
+			if !expired {
+				var err error
+				oldValue, err = t.storage.readValue(n.pointers[insertPos])
+				if err != nil {
+					return nil, false, fmt.Errorf("failed to read the value: %w", err)
+				}
+			}
 
-			err := t.storage.updateNodeByID(n.id, n)
+			p, err := t.storage.replaceValue(n.pointers[insertPos], v)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to store the value: %w", err)
+			}
+			n.pointers[insertPos] = p
+
+			err = t.storage.updateNodeByID(n.id, n)
 			if err != nil {
 				return nil, false, fmt.Errorf("failed to update the node %d: %w", n.id, err)
 			}
 
-			return oldValue, true, nil
+			if t.oversized(n) {
+				if err := t.splitBySize(n); err != nil {
+					return nil, false, fmt.Errorf("failed to split the node %d by size: %w", n.id, err)
+				}
+			}
+			t.storage.lifetime.Puts++
+
+			return oldValue, !expired, nil
 		} else if cmp < 0 {
 			// found the insert position,
 			// can break the loop
@@ -392,8 +733,16 @@ func (t *FBPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool, error) {
 	}
 
 	// if we did not find the same key, we continue to insert
+	if err := t.addToCounts(n, 1); err != nil {
+		return nil, false, fmt.Errorf("failed to update the counts of the keys: %w", err)
+	}
+
 	if n.keyNum < len(n.keys) {
 		// if the node is not full
+		p, err := t.storage.newValue(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to store the value: %w", err)
+		}
 
 		// shift the keys and pointers
 		for j := n.keyNum; j > insertPos; j-- {
@@ -403,70 +752,44 @@ func (t *FBPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool, error) {
 
 		// insert
 		n.keys[insertPos] = k
-		n.pointers[insertPos] = &pointer{v}
+		n.pointers[insertPos] = p
 		// and update key num
 		n.keyNum++
 
-		err := t.storage.updateNodeByID(n.id, n)
+		err = t.storage.updateNodeByID(n.id, n)
 		if err != nil {
 			return nil, false, fmt.Errorf("failed to update the node %d: %w", n.id, err)
 		}
+
+		if t.oversized(n) {
+			if err := t.splitBySize(n); err != nil {
+				return nil, false, fmt.Errorf("failed to split the node %d by size: %w", n.id, err)
+			}
+		}
 	} else {
 		// if the node is full
 		var parentNode *node
-		if n.parentID != 0 {
-			p, err := t.storage.loadNodeByID(n.parentID)
+		if parentID := t.parentOf(n); parentID != 0 {
+			p, err := t.storage.loadNodeByID(parentID)
 			if err != nil {
-				return nil, false, fmt.Errorf("failed to load parent node %d: %w", n.parentID, err)
+				return nil, false, fmt.Errorf("failed to load parent node %d: %w", parentID, err)
 			}
 
 			parentNode = p
 		}
-		parent := parentNode
 
 		left, right, err := t.putIntoLeafAndSplit(n, insertPos, k, v)
 		if err != nil {
 			return nil, false, fmt.Errorf("failed to split the node %d: %w", n.id, err)
 		}
+		t.storage.split(left.id, right.id)
 
-		insertKey := right.keys[0]
-		for left != nil && right != nil {
-			if parent == nil {
-				t.putIntoNewRoot(insertKey, left, right)
-				break
-			} else {
-				if parent.keyNum < len(parent.keys) {
-					// if the parent is not full
-					err := t.putIntoParent(parent, insertKey, left, right)
-					if err != nil {
-						return nil, false, fmt.Errorf("failed to put into the parent: %w", err)
-					}
-
-					break
-				} else {
-					// if the parent is full
-					// split parent, insert into the new parent and continue
-					insertKey, left, right, err = t.putIntoParentAndSplit(parent, insertKey, left, right)
-					if err != nil {
-						return nil, false, fmt.Errorf("failed to put into the parent and split: %w", err)
-					}
-				}
-			}
-
-			var parentParentNode *node
-			if parent.parentID != 0 {
-				p, err := t.storage.loadNodeByID(parent.parentID)
-				if err != nil {
-					return nil, false, fmt.Errorf("failed to load the parent of the parent node %d: %w", parent.parentID, err)
-				}
-
-				parentParentNode = p
-			}
-
-			parent = parentParentNode
+		if err := t.putIntoParents(parentNode, right.keys[0], left, right); err != nil {
+			return nil, false, err
 		}
 	}
 
+	t.storage.lifetime.Puts++
 	t.metadata.size++
 	err := t.updateSize(t.metadata.size)
 	if err != nil {
@@ -476,12 +799,64 @@ func (t *FBPTree) putIntoLeaf(n *node, k, v []byte) ([]byte, bool, error) {
 	return nil, false, nil
 }
 
+// putIntoParents puts the split nodes into the parent, splitting the parent
+// and its ancestors while they are full.
+func (t *FBPTree) putIntoParents(parent *node, insertKey []byte, left, right *node) error {
+	for left != nil && right != nil {
+		if parent == nil {
+			if err := t.putIntoNewRoot(insertKey, left, right); err != nil {
+				return fmt.Errorf("failed to put into the new root: %w", err)
+			}
+
+			return nil
+		}
+
+		if parent.keyNum < len(parent.keys) {
+			// if the parent is not full
+			if err := t.putIntoParent(parent, insertKey, left, right); err != nil {
+				return fmt.Errorf("failed to put into the parent: %w", err)
+			}
+
+			if t.oversized(parent) {
+				if err := t.splitBySize(parent); err != nil {
+					return fmt.Errorf("failed to split the parent %d by size: %w", parent.id, err)
+				}
+			}
+
+			return nil
+		}
+
+		// if the parent is full
+		// split parent, insert into the new parent and continue
+		var err error
+		insertKey, left, right, err = t.putIntoParentAndSplit(parent, insertKey, left, right)
+		if err != nil {
+			return fmt.Errorf("failed to put into the parent and split: %w", err)
+		}
+		t.storage.split(left.id, right.id)
+
+		var parentParentNode *node
+		if parentID := t.parentOf(parent); parentID != 0 {
+			p, err := t.storage.loadNodeByID(parentID)
+			if err != nil {
+				return fmt.Errorf("failed to load the parent of the parent node %d: %w", parentID, err)
+			}
+
+			parentParentNode = p
+		}
+
+		parent = parentParentNode
+	}
+
+	return nil
+}
+
 // putIntoParent puts the node into the parent and update the left and the right
 // pointers.
 func (t *FBPTree) putIntoParent(parent *node, k []byte, l, r *node) error {
 	insertPos := 0
 	for insertPos < parent.keyNum {
-		if less(k, parent.keys[insertPos]) {
+		if t.less(k, parent.keys[insertPos]) {
 			// found the insert position,
 			// can break the loop
 			break
@@ -499,8 +874,8 @@ func (t *FBPTree) putIntoParent(parent *node, k []byte, l, r *node) error {
 
 	// insert
 	parent.keys[insertPos] = k
-	parent.pointers[insertPos] = &pointer{l.id}
-	parent.pointers[insertPos+1] = &pointer{r.id}
+	parent.pointers[insertPos] = &pointer{value: l.id, count: l.size()}
+	parent.pointers[insertPos+1] = &pointer{value: r.id, count: r.size()}
 	// and update key num
 	parent.keyNum++
 
@@ -509,17 +884,8 @@ func (t *FBPTree) putIntoParent(parent *node, k []byte, l, r *node) error {
 		return fmt.Errorf("failed to update parent node %d: %w", parent.id, err)
 	}
 
-	l.parentID = parent.id
-	err = t.storage.updateNodeByID(l.id, l)
-	if err != nil {
-		return fmt.Errorf("failed to update left node %d: %w", l.id, err)
-	}
-
-	r.parentID = parent.id
-	err = t.storage.updateNodeByID(r.id, r)
-	if err != nil {
-		return fmt.Errorf("failed to update right node %d: %w", r.id, err)
-	}
+	t.parents[l.id] = parent.id
+	t.parents[r.id] = parent.id
 
 	return nil
 }
@@ -529,7 +895,7 @@ func (t *FBPTree) putIntoParent(parent *node, k []byte, l, r *node) error {
 func (t *FBPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]byte, *node, *node, error) {
 	insertPos := 0
 	for insertPos < parent.keyNum {
-		if less(k, parent.keys[insertPos]) {
+		if t.less(k, parent.keys[insertPos]) {
 			// found the insert position,
 			// can break the loop
 			break
@@ -549,7 +915,6 @@ func (t *FBPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]b
 		keys:     make([][]byte, t.order-1),
 		keyNum:   0,
 		pointers: make([]*pointer, t.order),
-		parentID: 0,
 	}
 
 	middlePos := ceil(len(parent.keys), 2)
@@ -587,21 +952,14 @@ func (t *FBPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]b
 	}
 
 	insertNode.keys[insertPos] = k
-	insertNode.pointers[insertPos] = &pointer{l.id}
-	insertNode.pointers[insertPos+1] = &pointer{r.id}
+	insertNode.pointers[insertPos] = &pointer{value: l.id, count: l.size()}
+	insertNode.pointers[insertPos+1] = &pointer{value: r.id, count: r.size()}
 	insertNode.keyNum++
 
-	l.parentID = insertNode.id
-	err = t.storage.updateNodeByID(l.id, l)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to update the l node %d: %w", parent.id, err)
-	}
-
-	r.parentID = insertNode.id
-	err = t.storage.updateNodeByID(r.id, r)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to update the r node %d: %w", right.id, err)
-	}
+	// the children of the right node are not rewritten, since the nodes
+	// do not store their parents
+	t.parents[l.id] = insertNode.id
+	t.parents[r.id] = insertNode.id
 
 	middleKey := right.keys[0]
 
@@ -615,45 +973,11 @@ func (t *FBPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]b
 	right.keys[right.keyNum-1] = nil
 	right.keyNum--
 
-	// update the pointers
-	for _, p := range left.pointers {
-		if p != nil {
-			nodeID := p.asNodeID()
-			node, err := t.storage.loadNodeByID(nodeID)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to load the node by id %d: %w", nodeID, err)
-			}
-
-			if node.parentID == left.id {
-				continue
-			}
-
-			node.parentID = left.id
-			err = t.storage.updateNodeByID(node.id, node)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to update node by id %d: %w", node.id, err)
-			}
-		}
-	}
-
-	for _, p := range right.pointers {
-		if p != nil {
-			nodeID := p.asNodeID()
-			node, err := t.storage.loadNodeByID(nodeID)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to load the node by id %d: %w", nodeID, err)
-			}
-
-			if node.parentID == right.id {
-				continue
-			}
-
-			node.parentID = right.id
-			err = t.storage.updateNodeByID(node.id, node)
-			if err != nil {
-				return nil, nil, nil, fmt.Errorf("failed to update node by id %d: %w", node.id, err)
-			}
-		}
+	// the pointer with the new count may leave with the middle key,
+	// while the other node keeps the stale pointer to the same child
+	for _, n := range []*node{left, right} {
+		n.setCount(l)
+		n.setCount(r)
 	}
 
 	err = t.storage.updateNodeByID(parent.id, parent)
@@ -678,6 +1002,11 @@ func (t *FBPTree) putIntoParentAndSplit(parent *node, k []byte, l, r *node) ([]b
 // The tree is right-biased, so the first element in
 // the right node is the "middle" key.
 func (t *FBPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*node, *node, error) {
+	p, err := t.storage.newValue(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to store the value: %w", err)
+	}
+
 	newNodeID, err := t.storage.newNode()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to instantiate new node: %w", err)
@@ -689,7 +1018,6 @@ func (t *FBPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*nod
 		keys:     make([][]byte, t.order-1),
 		keyNum:   0,
 		pointers: make([]*pointer, t.order),
-		parentID: 0,
 	}
 
 	middlePos := ceil(len(n.keys), 2)
@@ -704,18 +1032,18 @@ func (t *FBPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*nod
 
 	// copy the pointer to the next node
 	right.setNext(n.next())
+	right.prevID = n.id
 	right.keyNum = len(right.keys) - copyFrom
 
 	// the given node becomes the left node
 	left := n
-	left.parentID = 0
 	left.keyNum = copyFrom
 	// clean up keys and pointers
 	for i := len(left.keys) - 1; i >= copyFrom; i-- {
 		left.keys[i] = nil
 		left.pointers[i] = nil
 	}
-	left.setNext(&pointer{right.id})
+	left.setNext(&pointer{value: right.id})
 
 	insertNode := left
 	if insertPos >= middlePos {
@@ -725,7 +1053,7 @@ func (t *FBPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*nod
 	}
 
 	// insert into the node
-	insertNode.insertAt(insertPos, k, insertPos, &pointer{v})
+	insertNode.insertAt(insertPos, k, insertPos, p)
 
 	err = t.storage.updateNodeByID(right.id, right)
 	if err != nil {
@@ -737,6 +1065,10 @@ func (t *FBPTree) putIntoLeafAndSplit(n *node, insertPos int, k, v []byte) (*nod
 		return nil, nil, fmt.Errorf("failed to update the left node %d: %w", left.id, err)
 	}
 
+	if err := t.storage.linkNext(right); err != nil {
+		return nil, nil, err
+	}
+
 	return left, right, nil
 }
 
@@ -761,14 +1093,6 @@ func (n *node) insertAt(keyPosition int, key []byte, pointerPosition int, pointe
 	n.keyNum++
 }
 
-// overrideValue overrides the value
-func (p *pointer) overrideValue(newValue []byte) []byte {
-	oldValue := p.value.([]byte)
-	p.value = newValue
-
-	return oldValue
-}
-
 // setNext sets the "next" pointer (the last pointer) to the next node. Only relevant
 // for the leaf nodes.
 func (n *node) setNext(p *pointer) {
@@ -784,15 +1108,40 @@ func (n *node) next() *pointer {
 // Delete deletes the value by the key. Returns true if the
 // key exists.
 func (t *FBPTree) Delete(key []byte) ([]byte, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.runDelete(key)
+}
+
+// runDelete runs delete as the separate write.
+func (t *FBPTree) runDelete(key []byte) ([]byte, bool, error) {
+	w, err := t.beginWrite()
+	if err != nil {
+		return nil, false, err
+	}
+
+	op := t.beginOperation()
+	value, deleted, err := t.delete(key)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationDelete, len(key), len(value), err)
+
+	return value, deleted, err
+}
+
+func (t *FBPTree) delete(key []byte) ([]byte, bool, error) {
 	if t.metadata == nil {
 		return nil, false, nil
 	}
 
-	leaf, err := t.findLeaf(key)
+	leaf, err := t.descend(key)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to find the leaf: %w", err)
 	}
 
+	// the expired key is deleted, but it does not exist for the caller
+	expired := leaf.livePosition(key, t.compare) != leaf.keyPosition(key, t.compare)
+
 	value, deleted, err := t.deleteAtLeafAndRebalance(leaf, key)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to delete and rebalance: %w", err)
@@ -801,6 +1150,7 @@ func (t *FBPTree) Delete(key []byte) ([]byte, bool, error) {
 	if !deleted {
 		return nil, false, nil
 	}
+	t.storage.lifetime.Deletes++
 
 	if t.metadata != nil {
 		t.metadata.size--
@@ -810,24 +1160,41 @@ func (t *FBPTree) Delete(key []byte) ([]byte, bool, error) {
 		}
 	}
 
+	if expired {
+		return nil, false, nil
+	}
+
 	return value, true, nil
 }
 
 // deleteAtLeafAndRebalance deletes the key from the given node and rebalances it.
 func (t *FBPTree) deleteAtLeafAndRebalance(n *node, key []byte) ([]byte, bool, error) {
-	keyPos := n.keyPosition(key)
+	keyPos := n.keyPosition(key, t.compare)
 	if keyPos == -1 {
 		return nil, false, nil
 	}
 
-	value := n.pointers[keyPos].asValue()
+	p := n.pointers[keyPos]
+	value, err := t.storage.readValue(p)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	if err := t.addToCounts(n, -1); err != nil {
+		return nil, false, fmt.Errorf("failed to update the counts of the keys: %w", err)
+	}
+
 	n.deleteAt(keyPos, keyPos)
-	err := t.storage.updateNodeByID(n.id, n)
+	err = t.storage.updateNodeByID(n.id, n)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to update the node by id %d: %w", n.id, err)
 	}
 
-	if n.parentID == 0 {
+	if err := t.storage.freeValue(p); err != nil {
+		return nil, false, err
+	}
+
+	if t.parentOf(n) == 0 {
 		if n.keyNum == 0 {
 			// remove the root (as leaf)
 			err := t.storage.deleteNodeByID(n.id)
@@ -901,7 +1268,7 @@ func (t *FBPTree) removeFromIndex(key []byte) error {
 
 		position := 0
 		for position < current.keyNum {
-			cmp := compare(key, current.keys[position])
+			cmp := t.compare(key, current.keys[position])
 			if cmp < 0 {
 				break
 			} else if cmp > 0 {
@@ -958,7 +1325,7 @@ func (t *FBPTree) findLeftmostKey(nodeID uint32) ([]byte, error) {
 }
 
 //  keyPosition returns the position of the key, but -1 if it is not present.
-func (n *node) keyPosition(key []byte) int {
+func (n *node) keyPosition(key []byte, compare func(x, y []byte) int) int {
 	keyPosition := 0
 	for ; keyPosition < n.keyNum; keyPosition++ {
 		if compare(key, n.keys[keyPosition]) == 0 {
@@ -971,9 +1338,10 @@ func (n *node) keyPosition(key []byte) int {
 
 // rebalanceFromLeafNode starts rebalancing the tree from the leaf node.
 func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
-	parent, err := t.storage.loadNodeByID(n.parentID)
+	parentID := t.parentOf(n)
+	parent, err := t.storage.loadNodeByID(parentID)
 	if err != nil {
-		return fmt.Errorf("failed to load the parent node by id %d: %w", n.parentID, err)
+		return fmt.Errorf("failed to load the parent node by id %d: %w", parentID, err)
 	}
 
 	pointerPositionInParent := parent.pointerPositionOf(n)
@@ -1001,6 +1369,8 @@ func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
 			n.insertAt(0, leftSibling.keys[leftSibling.keyNum-1], 0, leftSibling.pointers[leftSibling.keyNum-1])
 			leftSibling.deleteAt(leftSibling.keyNum-1, leftSibling.keyNum-1)
 			parent.keys[keyPositionInParent] = n.keys[0]
+			parent.setCount(n)
+			parent.setCount(leftSibling)
 
 			err = t.storage.updateNodeByID(n.id, n)
 			if err != nil {
@@ -1032,9 +1402,11 @@ func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
 
 		if rightSibling.keyNum > t.minKeyNum {
 			// borrow from the right sibling
-			n.append(rightSibling.keys[0], rightSibling.pointers[0], t.storage)
+			n.append(rightSibling.keys[0], rightSibling.pointers[0])
 			rightSibling.deleteAt(0, 0)
 			parent.keys[rightSiblingPosition-1] = rightSibling.keys[0]
+			parent.setCount(n)
+			parent.setCount(rightSibling)
 
 			err := t.storage.updateNodeByID(n.id, n)
 			if err != nil {
@@ -1063,7 +1435,12 @@ func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
 		if err != nil {
 			return fmt.Errorf("failed to copy to the left sibling %d: %w", rightSibling.id, err)
 		}
+		t.storage.merge(leftSibling.id, n.id)
+		if err := t.storage.deleteNodeByID(n.id); err != nil {
+			return fmt.Errorf("failed to delete the merged node %d: %w", n.id, err)
+		}
 		parent.deleteAt(keyPositionInParent, pointerPositionInParent)
+		parent.setCount(leftSibling)
 
 		err = t.storage.updateNodeByID(leftSibling.id, leftSibling)
 		if err != nil {
@@ -1078,7 +1455,12 @@ func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
 		if err != nil {
 			return fmt.Errorf("failed to copy from the right sibling %d: %w", rightSibling.id, err)
 		}
+		t.storage.merge(n.id, rightSibling.id)
+		if err := t.storage.deleteNodeByID(rightSibling.id); err != nil {
+			return fmt.Errorf("failed to delete the merged node %d: %w", rightSibling.id, err)
+		}
 		parent.deleteAt(keyPositionInParent, rightSiblingPosition)
+		parent.setCount(n)
 
 		err = t.storage.updateNodeByID(n.id, n)
 		if err != nil {
@@ -1100,25 +1482,20 @@ func (t *FBPTree) rebalanceFromLeafNode(n *node) error {
 
 // rebalanceInternalNode rebalances the tree from the internal node. It expects that
 func (t *FBPTree) rebalanceParentNode(n *node) error {
-	if n.parentID == 0 {
+	parentID := t.parentOf(n)
+	if parentID == 0 {
 		if n.keyNum == 0 {
 			rootID := n.pointers[0].asNodeID()
+			t.parents[rootID] = 0
 
-			root, err := t.storage.loadNodeByID(rootID)
+			err := t.updateRootID(rootID)
 			if err != nil {
-				return fmt.Errorf("failed to load the root node by id %d", rootID)
+				return fmt.Errorf("failed to update the root id to %d", rootID)
 			}
 
-			root.parentID = 0
-
-			err = t.storage.updateNodeByID(rootID, root)
-			if err != nil {
-				return fmt.Errorf("failed to update the root node %d: %w", rootID, err)
-			}
-
-			err = t.updateRootID(rootID)
-			if err != nil {
-				return fmt.Errorf("failed to update the root id to %d", rootID)
+			// the empty root is replaced by its only child
+			if err := t.storage.deleteNodeByID(n.id); err != nil {
+				return fmt.Errorf("failed to delete the previous root %d: %w", n.id, err)
 			}
 		}
 
@@ -1130,9 +1507,9 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 		return nil
 	}
 
-	parent, err := t.storage.loadNodeByID(n.parentID)
+	parent, err := t.storage.loadNodeByID(parentID)
 	if err != nil {
-		return fmt.Errorf("failed to load parent node %d: %w", n.parentID, err)
+		return fmt.Errorf("failed to load parent node %d: %w", parentID, err)
 	}
 
 	pointerPositionInParent := parent.pointerPositionOf(n)
@@ -1159,23 +1536,12 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 			splitKey := parent.keys[keyPositionInParent]
 
 			// borrow from the left sibling
-			childID := leftSibling.pointers[leftSibling.keyNum].asNodeID()
-			child, err := t.storage.loadNodeByID(childID)
-			if err != nil {
-				return fmt.Errorf("failed to load the child node %d for the left sibling %d: %w", childID, leftSiblingID, err)
-			}
-
-			child.parentID = n.id
-
-			err = t.storage.updateNodeByID(child.id, child)
-			if err != nil {
-				return fmt.Errorf("failed to update the child node %d for the left sibling %d: %w", childID, leftSiblingID, err)
-			}
-
 			n.insertAt(0, splitKey, 0, leftSibling.pointers[leftSibling.keyNum])
 
 			parent.keys[keyPositionInParent] = leftSibling.keys[leftSibling.keyNum-1]
 			leftSibling.deleteAt(leftSibling.keyNum-1, leftSibling.keyNum)
+			parent.setCount(n)
+			parent.setCount(leftSibling)
 
 			err = t.storage.updateNodeByID(n.id, n)
 			if err != nil {
@@ -1211,13 +1577,12 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 			splitKey := parent.keys[splitKeyPosition]
 
 			// borrow from the right sibling
-			err := n.append(splitKey, rightSibling.pointers[0], t.storage)
-			if err != nil {
-				return fmt.Errorf("failed to append to node %d: %w", n.id, err)
-			}
+			n.append(splitKey, rightSibling.pointers[0])
 
 			parent.keys[splitKeyPosition] = rightSibling.keys[0]
 			rightSibling.deleteAt(0, 0)
+			parent.setCount(n)
+			parent.setCount(rightSibling)
 
 			err = t.storage.updateNodeByID(n.id, n)
 			if err != nil {
@@ -1249,12 +1614,17 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 		if err != nil {
 			return fmt.Errorf("failed to copy from to left sibling %d: %w", leftSibling.id, err)
 		}
+		t.storage.merge(leftSibling.id, n.id)
+		if err := t.storage.deleteNodeByID(n.id); err != nil {
+			return fmt.Errorf("failed to delete the merged node %d: %w", n.id, err)
+		}
 		err = t.storage.updateNodeByID(leftSibling.id, leftSibling)
 		if err != nil {
 			return fmt.Errorf("failed to update the left sibling by id %d: %w", leftSibling.id, err)
 		}
 
 		parent.deleteAt(keyPositionInParent, pointerPositionInParent)
+		parent.setCount(leftSibling)
 		err = t.storage.updateNodeByID(parent.id, parent)
 		if err != nil {
 			return fmt.Errorf("failed to update the parent node %d: %w", parent.id, err)
@@ -1269,6 +1639,10 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 		if err != nil {
 			return fmt.Errorf("failed to copy from the right sibling %d: %w", rightSibling.id, err)
 		}
+		t.storage.merge(n.id, rightSibling.id)
+		if err := t.storage.deleteNodeByID(rightSibling.id); err != nil {
+			return fmt.Errorf("failed to delete the merged node %d: %w", rightSibling.id, err)
+		}
 
 		err = t.storage.updateNodeByID(n.id, n)
 		if err != nil {
@@ -1276,6 +1650,7 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 		}
 
 		parent.deleteAt(keyPositionInParent, rightSiblingPosition)
+		parent.setCount(n)
 		err = t.storage.updateNodeByID(parent.id, parent)
 		if err != nil {
 			return fmt.Errorf("failed to update the parent node %d: %w", parent.id, err)
@@ -1291,7 +1666,7 @@ func (t *FBPTree) rebalanceParentNode(n *node) error {
 }
 
 // append apppends key and the pointer to the node
-func (n *node) append(key []byte, p *pointer, storage *storage) error {
+func (n *node) append(key []byte, p *pointer) {
 	keyPosition := n.keyNum
 	pointerPosition := n.keyNum
 	if !n.leaf && n.pointers[pointerPosition] != nil {
@@ -1301,32 +1676,12 @@ func (n *node) append(key []byte, p *pointer, storage *storage) error {
 	n.keys[keyPosition] = key
 	n.pointers[pointerPosition] = p
 	n.keyNum++
-
-	if !n.leaf {
-		childID := p.asNodeID()
-		child, err := storage.loadNodeByID(childID)
-		if err != nil {
-			return fmt.Errorf("failed load the child node %d: %w", childID, err)
-		}
-
-		child.parentID = n.id
-
-		err = storage.updateNodeByID(childID, child)
-		if err != nil {
-			return fmt.Errorf("failed to update the child node %d: %w", childID, err)
-		}
-	}
-
-	return nil
 }
 
 // copyFromRight copies the keys and the pointer from the given node.
 func (n *node) copyFromRight(from *node, storage *storage) error {
 	for i := 0; i < from.keyNum; i++ {
-		err := n.append(from.keys[i], from.pointers[i], storage)
-		if err != nil {
-			return fmt.Errorf("failed to append to %d: %w", n.id, err)
-		}
+		n.append(from.keys[i], from.pointers[i])
 	}
 
 	if n.leaf {
@@ -1336,21 +1691,12 @@ func (n *node) copyFromRight(from *node, storage *storage) error {
 		if err != nil {
 			return fmt.Errorf("failed to update the node %d: %w", n.id, err)
 		}
-	} else {
-		n.pointers[n.keyNum] = from.pointers[from.keyNum]
-
-		childID := n.pointers[n.keyNum].asNodeID()
-		child, err := storage.loadNodeByID(childID)
-		if err != nil {
-			return fmt.Errorf("failed to load the child node %d: %w", childID, err)
-		}
 
-		child.parentID = n.id
-
-		err = storage.updateNodeByID(child.id, child)
-		if err != nil {
-			return fmt.Errorf("failed to update the parent for the child node %d: %w", childID, err)
+		if err := storage.linkNext(n); err != nil {
+			return err
 		}
+	} else {
+		n.pointers[n.keyNum] = from.pointers[from.keyNum]
 	}
 
 	return nil
@@ -1376,10 +1722,28 @@ func (n *node) pointerPositionOf(x *node) int {
 
 // ForEach traverses tree in ascending key order.
 func (t *FBPTree) ForEach(action func(key []byte, value []byte)) error {
-	it, err := t.Iterator()
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	op := t.beginOperation()
+	err := t.forEach(action)
+	t.endOperation(op, OperationForEach, 0, 0, err)
+
+	return err
+}
+
+func (t *FBPTree) forEach(action func(key []byte, value []byte)) error {
+	it, err := t.iterator()
 	if err != nil {
 		return fmt.Errorf("failed to initialize iterator: %w", err)
 	}
+	if err := it.skipExpired(); err != nil {
+		return fmt.Errorf("failed to skip the expired entries: %w", err)
+	}
 
 	for it := it; it.HasNext(); {
 		key, value, err := it.Next()
@@ -1393,8 +1757,188 @@ func (t *FBPTree) ForEach(action func(key []byte, value []byte)) error {
 	return nil
 }
 
+// ForEachUntil traverses tree in ascending key order until the action
+// returns true to stop or an error. The error of the action is returned
+// as it is.
+func (t *FBPTree) ForEachUntil(action func(key []byte, value []byte) (bool, error)) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	op := t.beginOperation()
+	err := t.forEachUntil(action)
+	t.endOperation(op, OperationForEach, 0, 0, err)
+
+	return err
+}
+
+func (t *FBPTree) forEachUntil(action func(key []byte, value []byte) (bool, error)) error {
+	var actionErr error
+	err := t.scan(nil, nil, func(key, value []byte) bool {
+		var stop bool
+		stop, actionErr = action(key, value)
+
+		return !stop && actionErr == nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return actionErr
+}
+
+// scan calls the action for the keys in [start, end) range in ascending
+// key order until the action returns false. The nil start and end are
+// the tree bounds.
+func (t *FBPTree) scan(start, end []byte, action func(key []byte, value []byte) bool) error {
+	if t.metadata == nil {
+		return nil
+	}
+
+	var leaf *node
+	var err error
+	if start == nil {
+		leaf, err = t.storage.loadNodeByID(t.metadata.leftmostID)
+	} else {
+		leaf, err = t.findLeaf(start)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to find the leaf: %w", err)
+	}
+
+	for {
+		for i := 0; i < leaf.keyNum; i++ {
+			key := leaf.keys[i]
+			if start != nil && t.less(key, start) {
+				continue
+			}
+
+			if end != nil && !t.less(key, end) {
+				return nil
+			}
+
+			if leaf.pointers[i].expired() {
+				continue
+			}
+
+			value, err := t.storage.readValue(leaf.pointers[i])
+			if err != nil {
+				return err
+			}
+
+			if !action(key, value) {
+				return nil
+			}
+		}
+
+		leaf, err = t.storage.nextLeaf(leaf)
+		if err != nil || leaf == nil {
+			return err
+		}
+	}
+}
+
+// ForEachReverse traverses tree in descending key order.
+func (t *FBPTree) ForEachReverse(action func(key []byte, value []byte)) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	op := t.beginOperation()
+	err := t.forEachReverse(action)
+	t.endOperation(op, OperationForEachReverse, 0, 0, err)
+
+	return err
+}
+
+func (t *FBPTree) forEachReverse(action func(key []byte, value []byte)) error {
+	if t.metadata == nil {
+		return nil
+	}
+
+	leaf, err := t.rightmostLeaf()
+	if err != nil {
+		return err
+	}
+
+	if leaf.prevID == 0 && leaf.id != t.metadata.leftmostID {
+		// the leaves of the read-only tree created before the links
+		// to the previous leaves were introduced
+		return t.forEachReverseFrom(t.metadata.rootID, action)
+	}
+
+	for leaf != nil {
+		for i := leaf.keyNum - 1; i >= 0; i-- {
+			if leaf.pointers[i].expired() {
+				continue
+			}
+
+			value, err := t.storage.readValue(leaf.pointers[i])
+			if err != nil {
+				return err
+			}
+
+			action(leaf.keys[i], value)
+		}
+
+		leaf, err = t.storage.prevLeaf(leaf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachReverseFrom descends from the right edge of the subtree and
+// visits its leaves from right to left, every node is loaded once.
+func (t *FBPTree) forEachReverseFrom(nodeID uint32, action func(key []byte, value []byte)) error {
+	n, err := t.storage.loadNodeByID(nodeID)
+	if err != nil {
+		return fmt.Errorf("failed to load node %d: %w", nodeID, err)
+	}
+
+	if n.leaf {
+		for i := n.keyNum - 1; i >= 0; i-- {
+			if n.pointers[i].expired() {
+				continue
+			}
+
+			value, err := t.storage.readValue(n.pointers[i])
+			if err != nil {
+				return err
+			}
+
+			action(n.keys[i], value)
+		}
+
+		return nil
+	}
+
+	for i := n.keyNum; i >= 0; i-- {
+		if err := t.forEachReverseFrom(n.pointers[i].asNodeID(), action); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Size return the size of the tree.
 func (t *FBPTree) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.size()
+}
+
+func (t *FBPTree) size() int {
 	if t.metadata != nil {
 		return int(t.metadata.size)
 	}
@@ -1402,8 +1946,25 @@ func (t *FBPTree) Size() int {
 	return 0
 }
 
-// Close closes the tree and free the underlying resources.
+// Close closes the tree and free the underlying resources. The methods
+// of the closed tree and of its iterators and cursors return ErrClosed.
 func (t *FBPTree) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+	t.closed = true
+
+	if open := atomic.LoadInt32(&t.iterators); open > 0 && t.logger != nil {
+		t.logger.Warnf("the tree is closed with %d open iterators", open)
+	}
+
+	if t.tx != nil {
+		t.tx.rollback()
+	}
+
 	if err := t.storage.close(); err != nil {
 		return fmt.Errorf("failed to close the storage: %w", err)
 	}
@@ -1411,12 +1972,9 @@ func (t *FBPTree) Close() error {
 	return nil
 }
 
-func compare(x, y []byte) int {
-	return bytes.Compare(x, y)
-}
-
-func less(x, y []byte) bool {
-	return compare(x, y) < 0
+// less reports whether x sorts before y in the tree order.
+func (t *FBPTree) less(x, y []byte) bool {
+	return t.compare(x, y) < 0
 }
 
 func copyBytes(s []byte) []byte {
@@ -3,6 +3,7 @@ package fbptree
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
@@ -10,6 +11,7 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"sync"
 	"time"
 
 	"testing"
@@ -376,6 +378,74 @@ func TestForEach(t *testing.T) {
 	}
 }
 
+func TestForEachUntil(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	visited := 0
+	err = tree.ForEachUntil(func(key, value []byte) (bool, error) {
+		visited++
+
+		return visited == 10, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to traverse: %s", err)
+	}
+	if visited != 10 {
+		t.Fatalf("expected 10 visited keys, but got %d", visited)
+	}
+
+	expected := errors.New("stop")
+	visited = 0
+	err = tree.ForEachUntil(func(key, value []byte) (bool, error) {
+		visited++
+		if visited == 20 {
+			return false, expected
+		}
+
+		return false, nil
+	})
+	if err != expected {
+		t.Fatalf("expected the error of the action, but got %v", err)
+	}
+	if visited != 20 {
+		t.Fatalf("expected 20 visited keys, but got %d", visited)
+	}
+
+	visited = 0
+	err = tree.ForEachUntil(func(key, value []byte) (bool, error) {
+		if !bytes.Equal(key, encodeUint32(uint32(visited))) {
+			t.Fatalf("unexpected key %v at %d", key, visited)
+		}
+		visited++
+
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to traverse: %s", err)
+	}
+	if visited != 100 {
+		t.Fatalf("expected 100 visited keys, but got %d", visited)
+	}
+}
+
 func TestForEachForEmptyTree(t *testing.T) {
 	dbDir, err := ioutil.TempDir(os.TempDir(), "example")
 	if err != nil {
@@ -398,6 +468,53 @@ func TestForEachForEmptyTree(t *testing.T) {
 	})
 }
 
+func TestForEachReverse(t *testing.T) {
+	dbDir, err := ioutil.TempDir(os.TempDir(), "example")
+	if err != nil {
+		panic(fmt.Errorf("failed to create %s: %w", dbDir, err))
+	}
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	tree.ForEachReverse(func(key []byte, value []byte) {
+		t.Fatal("call is not expected")
+	})
+
+	for _, c := range treeCases {
+		tree.Put([]byte{c.key}, []byte(c.value))
+	}
+
+	actual := make([]byte, 0)
+	err = tree.ForEachReverse(func(key []byte, value []byte) {
+		actual = append(actual, key...)
+	})
+	if err != nil {
+		t.Fatalf("failed to traverse: %s", err)
+	}
+
+	expected := make([]byte, 0)
+	for _, c := range treeCases {
+		expected = append(expected, c.key)
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i] > expected[j]
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("%v != %v", expected, actual)
+	}
+}
+
 func TestKeyOrder(t *testing.T) {
 	dbDir, err := ioutil.TempDir(os.TempDir(), "example")
 	if err != nil {
@@ -799,3 +916,403 @@ func TestForEachAfterDeletion(t *testing.T) {
 		}
 	}
 }
+
+func TestStrictMetadataSync(t *testing.T) {
+	dbDir, err := ioutil.TempDir(os.TempDir(), "example")
+	if err != nil {
+		panic(fmt.Errorf("failed to create %s: %w", dbDir, err))
+	}
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), StrictMetadataSync())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Put([]byte{c.key}, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3), StrictMetadataSync())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for _, c := range treeCases {
+		value, ok, err := tree.Get([]byte{c.key})
+		if err != nil {
+			t.Fatalf("failed to get key %d: %s", c.key, err)
+		}
+		if !ok || string(value) != c.value {
+			t.Fatalf("expected to get value %s for key %d, but got %s", c.value, c.key, value)
+		}
+	}
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Delete([]byte{c.key}); err != nil {
+			t.Fatalf("failed to delete key %d: %s", c.key, err)
+		}
+	}
+
+	if tree.Size() != 0 {
+		t.Fatalf("expected empty tree, but got size %d", tree.Size())
+	}
+
+	// the puts do not free the pages, so only the root
+	// and the leftmost leaf changes are synced
+	structuralSyncs := 0
+	for i := 0; i < 100; i++ {
+		rootID, leftmostID := uint32(0), uint32(0)
+		if tree.metadata != nil {
+			rootID, leftmostID = tree.metadata.rootID, tree.metadata.leftmostID
+		}
+		syncs := tree.storage.counter.counts().syncs
+
+		// the descending keys change the leftmost leaf on every split
+		key := encodeUint32(uint32(1000 - i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+
+		synced := tree.storage.counter.counts().syncs > syncs
+		structural := tree.metadata.rootID != rootID || tree.metadata.leftmostID != leftmostID
+		if synced != structural {
+			t.Fatalf("expected the put %d to sync %v, but it synced %v", i, structural, synced)
+		}
+		if structural {
+			structuralSyncs++
+		}
+	}
+
+	if structuralSyncs < 2 {
+		t.Fatalf("expected the root and the leftmost leaf to change, but they changed %d times", structuralSyncs)
+	}
+}
+
+func TestPutEmptyValuesAndKeys(t *testing.T) {
+	dbDir, err := ioutil.TempDir(os.TempDir(), "example")
+	if err != nil {
+		panic(fmt.Errorf("failed to create %s: %w", dbDir, err))
+	}
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Put([]byte{c.key}, nil); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+	if _, _, err := tree.Put(nil, []byte{1}); err != nil {
+		t.Fatalf("failed to put the empty key: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for _, c := range treeCases {
+		value, ok, err := tree.Get([]byte{c.key})
+		if err != nil {
+			t.Fatalf("failed to get key %d: %s", c.key, err)
+		}
+		if !ok {
+			t.Fatalf("key %d is not found", c.key)
+		}
+		if value == nil || len(value) != 0 {
+			t.Fatalf("expected the empty value for key %d, but got %v", c.key, value)
+		}
+	}
+
+	value, ok, err := tree.Get(nil)
+	if err != nil || !ok || !bytes.Equal(value, []byte{1}) {
+		t.Fatalf("failed to get the empty key: %v, %v, %v", value, ok, err)
+	}
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 200; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 0; i < 200; i++ {
+				key := encodeUint32(uint32(i))
+				value, ok, err := tree.Get(key)
+				if err != nil {
+					errs <- err
+
+					return
+				}
+				if ok && !bytes.Equal(value, key) {
+					errs <- fmt.Errorf("expected value %v, but got %v", key, value)
+
+					return
+				}
+
+				c := tree.Cursor()
+				if err := c.Seek(key); err != nil {
+					errs <- err
+
+					return
+				}
+				tree.Size()
+			}
+		}()
+	}
+
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := w; i < 200; i += 2 {
+				key := encodeUint32(uint32(i))
+				if _, _, err := tree.Delete(key); err != nil {
+					errs <- err
+
+					return
+				}
+				if _, _, err := tree.Put(key, key); err != nil {
+					errs <- err
+
+					return
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("failed to access the tree concurrently: %s", err)
+	}
+
+	if tree.Size() != 200 {
+		t.Fatalf("expected size 200, but got %d", tree.Size())
+	}
+}
+
+func TestSplitDoesNotRewriteChildren(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	metrics := &countingMetrics{}
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(64), PageSize(4096), WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	maxWrites := uint64(0)
+	for i := 0; i < 20000; i++ {
+		key := encodeUint32(uint32(i))
+		before := metrics.writes
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+
+		if writes := metrics.writes - before; writes > maxWrites {
+			maxWrites = writes
+		}
+	}
+
+	// the split of the internal node writes only the nodes on the path,
+	// their new siblings and the metadata, not the moved children
+	if maxWrites > 16 {
+		t.Fatalf("expected at most 16 page writes per put, but got %d", maxWrites)
+	}
+
+	for i := 0; i < 20000; i += 3 {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
+
+func TestPutDeleteCyclesReuseFreePages(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(512), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	// the leaves span several pages, so the reused pages
+	// must not keep the links of the freed records
+	r := rand.New(rand.NewSource(1))
+	var firstLastPageId uint32
+	for cycle := 0; cycle < 30; cycle++ {
+		values := make([][]byte, 100)
+		for i := range values {
+			values[i] = make([]byte, 1000+(i*37)%2000)
+			r.Read(values[i])
+			if _, _, err := tree.Put(encodeUint32(uint32(i)), values[i]); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+
+		for i := range values {
+			value, ok, err := tree.Get(encodeUint32(uint32(i)))
+			if err != nil {
+				t.Fatalf("failed to get key %d: %s", i, err)
+			}
+			if !ok || !bytes.Equal(value, values[i]) {
+				t.Fatalf("unexpected value of key %d in cycle %d", i, cycle)
+			}
+		}
+
+		for i := range values {
+			if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+				t.Fatalf("failed to delete key %d: %s", i, err)
+			}
+		}
+
+		if cycle == 0 {
+			firstLastPageId = tree.storage.pager.lastPageId
+		}
+	}
+
+	// the file grows only while the free pages are fragmented
+	if lastPageId := tree.storage.pager.lastPageId; lastPageId > firstLastPageId+firstLastPageId/20 {
+		t.Fatalf("expected at most %d pages, but got %d", firstLastPageId+firstLastPageId/20, lastPageId)
+	}
+}
+
+func TestUseAfterClose(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	it, err := tree.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create iterator: %s", err)
+	}
+
+	cursor := tree.Cursor()
+	if err := cursor.First(); err != nil {
+		t.Fatalf("failed to position the cursor: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	if _, _, err := tree.Get([]byte{1}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Get, but got %v", err)
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Put, but got %v", err)
+	}
+	if _, _, err := tree.Delete([]byte{1}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Delete, but got %v", err)
+	}
+	if err := tree.ForEach(func(key, value []byte) {}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from ForEach, but got %v", err)
+	}
+	if _, err := tree.Iterator(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Iterator, but got %v", err)
+	}
+	if _, err := tree.Begin(false); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Begin, but got %v", err)
+	}
+	if err := tree.Compact(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from Compact, but got %v", err)
+	}
+
+	if !it.HasNext() {
+		t.Fatalf("expected the iterator to have the next element")
+	}
+	if _, _, err := it.Next(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from the iterator, but got %v", err)
+	}
+
+	if err := cursor.Next(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from the cursor, but got %v", err)
+	}
+
+	if err := tree.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from the second Close, but got %v", err)
+	}
+}
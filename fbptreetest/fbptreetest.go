@@ -0,0 +1,511 @@
+// Package fbptreetest provides the helpers for the property testing of
+// fbptree and the wrappers around it: the generators of the random operations
+// and the model-based checker that compares the behaviour of the tree with
+// the map, including the reopen cycles and the crashes.
+package fbptreetest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Tree is the behaviour under the test, *fbptree.FBPTree implements it.
+type Tree interface {
+	Get(key []byte) ([]byte, bool, error)
+	Put(key, value []byte) ([]byte, bool, error)
+	Delete(key []byte) ([]byte, bool, error)
+	ForEach(action func(key []byte, value []byte)) error
+	Size() int
+	Close() error
+}
+
+// ReverseTree is the tree that can be traversed in the descending order,
+// the whole content of such tree is compared with the model in both orders.
+type ReverseTree interface {
+	Tree
+	ForEachReverse(action func(key []byte, value []byte)) error
+}
+
+// Verifier is the tree that can verify its own invariants, the invariants
+// are verified every time the whole content is compared with the model.
+type Verifier interface {
+	Verify() error
+}
+
+// Opener opens the tree by the path.
+type Opener func(path string) (Tree, error)
+
+// OpType is the type of the operation.
+type OpType int
+
+const (
+	// Put puts the key and the value.
+	Put OpType = iota
+	// Get gets the value by the key.
+	Get
+	// Delete deletes the key.
+	Delete
+	// Reopen closes and opens the tree.
+	Reopen
+	// Crash abandons the tree without closing it, as the process crash
+	// does, and opens it.
+	Crash
+	// Iterate compares the whole content of the tree with the model.
+	Iterate
+)
+
+// String returns the name of the operation type.
+func (t OpType) String() string {
+	switch t {
+	case Put:
+		return "put"
+	case Get:
+		return "get"
+	case Delete:
+		return "delete"
+	case Reopen:
+		return "reopen"
+	case Crash:
+		return "crash"
+	case Iterate:
+		return "iterate"
+	}
+
+	return fmt.Sprintf("OpType(%d)", int(t))
+}
+
+// Op is the operation applied to both the tree and the model.
+type Op struct {
+	Type  OpType
+	Key   []byte
+	Value []byte
+}
+
+// String returns the readable form of the operation.
+func (op Op) String() string {
+	switch op.Type {
+	case Put:
+		return fmt.Sprintf("put(%x, %d bytes)", op.Key, len(op.Value))
+	case Get, Delete:
+		return fmt.Sprintf("%s(%x)", op.Type, op.Key)
+	}
+
+	return op.Type.String()
+}
+
+// Generator generates the random operations. The small key space makes the
+// operations hit the existent keys more often.
+type Generator struct {
+	// Rand is the source of the randomness, it makes the sequence reproducible.
+	Rand *rand.Rand
+	// KeySpace is the number of the distinct keys.
+	KeySpace int
+	// MaxValueSize is the maximum size of the generated values.
+	MaxValueSize int
+	// LargeValueRate is the probability of the value up to MaxLargeValueSize
+	// instead of MaxValueSize, e.g. to span several pages.
+	LargeValueRate    float64
+	MaxLargeValueSize int
+	// every LongKeyEvery-th key of the key space is longer by LongKeySize,
+	// none if it is zero
+	LongKeyEvery int
+	LongKeySize  int
+	// ReopenRate, CrashRate and IterateRate are the probabilities of the
+	// reopen, the crash and the iterate operations.
+	ReopenRate  float64
+	CrashRate   float64
+	IterateRate float64
+}
+
+// NewGenerator instantiates the generator with the defaults for the seed.
+func NewGenerator(seed int64) *Generator {
+	return &Generator{
+		Rand:         rand.New(rand.NewSource(seed)),
+		KeySpace:     1000,
+		MaxValueSize: 64,
+		ReopenRate:   0.01,
+		CrashRate:    0.01,
+	}
+}
+
+// Key returns the random key from the key space.
+func (g *Generator) Key() []byte {
+	k := g.Rand.Intn(g.KeySpace)
+	key := []byte(fmt.Sprintf("key-%08d", k))
+	if g.LongKeyEvery > 0 && k%g.LongKeyEvery == 0 {
+		// the same key is always equally long
+		key = append(key, bytes.Repeat([]byte{byte(k)}, g.LongKeySize)...)
+	}
+
+	return key
+}
+
+// Value returns the random value, possibly empty.
+func (g *Generator) Value() []byte {
+	maxSize := g.MaxValueSize
+	if g.LargeValueRate > 0 && g.Rand.Float64() < g.LargeValueRate {
+		maxSize = g.MaxLargeValueSize
+	}
+
+	value := make([]byte, g.Rand.Intn(maxSize+1))
+	g.Rand.Read(value)
+
+	return value
+}
+
+// Op returns the random operation.
+func (g *Generator) Op() Op {
+	p := g.Rand.Float64()
+	switch {
+	case p < g.CrashRate:
+		return Op{Type: Crash}
+	case p < g.CrashRate+g.ReopenRate:
+		return Op{Type: Reopen}
+	case p < g.CrashRate+g.ReopenRate+g.IterateRate:
+		return Op{Type: Iterate}
+	}
+
+	switch g.Rand.Intn(4) {
+	case 0, 1:
+		return Op{Type: Put, Key: g.Key(), Value: g.Value()}
+	case 2:
+		return Op{Type: Get, Key: g.Key()}
+	default:
+		return Op{Type: Delete, Key: g.Key()}
+	}
+}
+
+// Ops returns the given number of the random operations.
+func (g *Generator) Ops(n int) []Op {
+	ops := make([]Op, n)
+	for i := range ops {
+		ops[i] = g.Op()
+	}
+
+	return ops
+}
+
+// Check applies the operations to the tree by the path and to the map
+// reference model and returns the error describing the first divergence.
+// After all the operations the whole content of the tree is compared with
+// the model in the ascending byte order of the keys. The tree file must not
+// exist before the check.
+func Check(path string, open Opener, ops []Op) error {
+	tree, err := open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open the tree: %w", err)
+	}
+
+	model := make(map[string][]byte)
+	for i, op := range ops {
+		tree, err = apply(path, open, tree, model, op)
+		if err != nil {
+			if tree != nil {
+				tree.Close()
+			}
+
+			return fmt.Errorf("operation %d %s: %w", i, op, err)
+		}
+	}
+
+	if err := compare(tree, model); err != nil {
+		tree.Close()
+
+		return err
+	}
+
+	if err := tree.Close(); err != nil {
+		return fmt.Errorf("failed to close the tree: %w", err)
+	}
+
+	return nil
+}
+
+// Config is the order and the page size of the tree.
+type Config struct {
+	Order    int
+	PageSize int
+}
+
+// String returns the readable form of the config.
+func (c Config) String() string {
+	return fmt.Sprintf("order %d, page size %d", c.Order, c.PageSize)
+}
+
+// Configs returns every combination of the orders and the page sizes. The
+// small orders and pages make the splits, the merges and the records that
+// span several pages frequent.
+func Configs(orders, pageSizes []int) []Config {
+	configs := make([]Config, 0, len(orders)*len(pageSizes))
+	for _, order := range orders {
+		for _, pageSize := range pageSizes {
+			configs = append(configs, Config{order, pageSize})
+		}
+	}
+
+	return configs
+}
+
+// ConfigOpener opens the tree by the path with the config.
+type ConfigOpener func(path string, config Config) (Tree, error)
+
+// CheckConfigs runs Check for every config with its own file in the
+// directory and the operations returned for it and returns the error
+// describing the first divergence.
+func CheckConfigs(dir string, open ConfigOpener, configs []Config, ops func(config Config) []Op) error {
+	for _, config := range configs {
+		config := config
+		path := filepath.Join(dir, fmt.Sprintf("check_%d_%d.data", config.Order, config.PageSize))
+		opener := func(path string) (Tree, error) {
+			return open(path, config)
+		}
+
+		if err := Check(path, opener, ops(config)); err != nil {
+			return fmt.Errorf("%s: %w", config, err)
+		}
+	}
+
+	return nil
+}
+
+// apply applies the operation to the tree and the model and returns the tree
+// which is the new one after the reopen and the crash.
+func apply(path string, open Opener, tree Tree, model map[string][]byte, op Op) (Tree, error) {
+	switch op.Type {
+	case Put:
+		expected, expectedOk := model[string(op.Key)]
+		value, ok, err := tree.Put(op.Key, op.Value)
+		if err != nil {
+			return tree, err
+		}
+		model[string(op.Key)] = copyBytes(op.Value)
+
+		return tree, expect(expected, expectedOk, value, ok)
+	case Get:
+		expected, expectedOk := model[string(op.Key)]
+		value, ok, err := tree.Get(op.Key)
+		if err != nil {
+			return tree, err
+		}
+
+		return tree, expect(expected, expectedOk, value, ok)
+	case Delete:
+		expected, expectedOk := model[string(op.Key)]
+		value, ok, err := tree.Delete(op.Key)
+		if err != nil {
+			return tree, err
+		}
+		delete(model, string(op.Key))
+
+		return tree, expect(expected, expectedOk, value, ok)
+	case Reopen:
+		if err := tree.Close(); err != nil {
+			return nil, fmt.Errorf("failed to close the tree: %w", err)
+		}
+
+		tree, err := open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the tree: %w", err)
+		}
+
+		return tree, compare(tree, model)
+	case Crash:
+		tree, err := crash(path, open, tree)
+		if err != nil {
+			return tree, err
+		}
+
+		return tree, compare(tree, model)
+	case Iterate:
+		return tree, compare(tree, model)
+	}
+
+	return tree, fmt.Errorf("unknown operation type %d", op.Type)
+}
+
+// crash keeps the file as it is at the moment, so nothing done by the close
+// survives, and opens the tree from it.
+func crash(path string, open Opener, tree Tree) (Tree, error) {
+	crashPath := path + ".crash"
+	if err := copyFile(crashPath, path); err != nil {
+		tree.Close()
+
+		return nil, fmt.Errorf("failed to copy the file: %w", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		os.Remove(crashPath)
+
+		return nil, fmt.Errorf("failed to close the tree: %w", err)
+	}
+
+	if err := os.Rename(crashPath, path); err != nil {
+		os.Remove(crashPath)
+
+		return nil, fmt.Errorf("failed to replace the file: %w", err)
+	}
+
+	tree, err := open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the tree after the crash: %w", err)
+	}
+
+	return tree, nil
+}
+
+func expect(expected []byte, expectedOk bool, actual []byte, ok bool) error {
+	if ok != expectedOk {
+		return fmt.Errorf("expected the key to exist %v, but got %v", expectedOk, ok)
+	}
+
+	if ok && !bytes.Equal(expected, actual) {
+		return fmt.Errorf("expected the value %x, but got %x", expected, actual)
+	}
+
+	return nil
+}
+
+// compare compares the whole content of the tree with the model, in the
+// descending order too if the tree supports it, and verifies the tree
+// if it can verify itself.
+func compare(tree Tree, model map[string][]byte) error {
+	if tree.Size() != len(model) {
+		return fmt.Errorf("expected the size %d, but got %d", len(model), tree.Size())
+	}
+
+	keys := make([]string, 0, len(model))
+	for key := range model {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if err := compareAscending(tree, model, keys); err != nil {
+		return err
+	}
+
+	if reverse, ok := tree.(ReverseTree); ok {
+		if err := compareDescending(reverse, model, keys); err != nil {
+			return err
+		}
+	}
+
+	if verifier, ok := tree.(Verifier); ok {
+		if err := verifier.Verify(); err != nil {
+			return fmt.Errorf("the tree is not valid: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// compareAscending compares the content of the tree with the model
+// with the given keys in the ascending order.
+func compareAscending(tree Tree, model map[string][]byte, keys []string) error {
+	i := 0
+	var mismatch error
+	err := tree.ForEach(func(key []byte, value []byte) {
+		if mismatch != nil {
+			return
+		}
+
+		if i >= len(keys) {
+			mismatch = fmt.Errorf("unexpected key %x", key)
+			return
+		}
+
+		if keys[i] != string(key) {
+			mismatch = fmt.Errorf("expected the key %x at the position %d, but got %x", keys[i], i, key)
+			return
+		}
+
+		if !bytes.Equal(model[keys[i]], value) {
+			mismatch = fmt.Errorf("expected the value %x for the key %x, but got %x", model[keys[i]], key, value)
+			return
+		}
+
+		i++
+	})
+	if err != nil {
+		return fmt.Errorf("failed to traverse the tree: %w", err)
+	}
+
+	if mismatch != nil {
+		return mismatch
+	}
+
+	if i != len(keys) {
+		return fmt.Errorf("expected %d keys, but traversed %d", len(keys), i)
+	}
+
+	return nil
+}
+
+// compareDescending compares the content of the tree with the model
+// with the given keys in the descending order.
+func compareDescending(tree ReverseTree, model map[string][]byte, keys []string) error {
+	i := len(keys) - 1
+	var mismatch error
+	err := tree.ForEachReverse(func(key []byte, value []byte) {
+		if mismatch != nil {
+			return
+		}
+
+		if i < 0 {
+			mismatch = fmt.Errorf("unexpected key %x in the descending order", key)
+			return
+		}
+
+		if keys[i] != string(key) || !bytes.Equal(model[keys[i]], value) {
+			mismatch = fmt.Errorf("expected the key %x at the position %d in the descending order, but got %x", keys[i], i, key)
+			return
+		}
+
+		i--
+	})
+	if err != nil {
+		return fmt.Errorf("failed to traverse the tree in the descending order: %w", err)
+	}
+
+	if mismatch != nil {
+		return mismatch
+	}
+
+	if i != -1 {
+		return fmt.Errorf("expected %d keys, but traversed %d in the descending order", len(keys), len(keys)-1-i)
+	}
+
+	return nil
+}
+
+func copyFile(dstPath, srcPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+
+		return err
+	}
+
+	return dst.Close()
+}
+
+func copyBytes(s []byte) []byte {
+	c := make([]byte, len(s))
+	copy(c, s)
+
+	return c
+}
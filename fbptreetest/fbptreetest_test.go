@@ -0,0 +1,133 @@
+package fbptreetest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/krasun/fbptree"
+)
+
+func TestCheck(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	open := func(path string) (Tree, error) {
+		return fbptree.Open(path, fbptree.Order(3), fbptree.PageSize(128))
+	}
+
+	for seed := int64(0); seed < 10; seed++ {
+		g := NewGenerator(seed)
+		g.KeySpace = 100
+		g.ReopenRate = 0.02
+		g.CrashRate = 0.02
+
+		dbPath := path.Join(dbDir, fmt.Sprintf("sample-%d.data", seed))
+		if err := Check(dbPath, open, g.Ops(1000)); err != nil {
+			t.Fatalf("seed %d: %s", seed, err)
+		}
+	}
+}
+
+// lossyTree forgets every tenth put.
+type lossyTree struct {
+	Tree
+	puts int
+}
+
+func (t *lossyTree) Put(key, value []byte) ([]byte, bool, error) {
+	t.puts++
+	if t.puts%10 == 0 {
+		return t.Tree.Get(key)
+	}
+
+	return t.Tree.Put(key, value)
+}
+
+func TestCheckFindsDivergence(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	open := func(path string) (Tree, error) {
+		tree, err := fbptree.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &lossyTree{Tree: tree}, nil
+	}
+
+	if err := Check(path.Join(dbDir, "sample.data"), open, NewGenerator(0).Ops(1000)); err == nil {
+		t.Fatalf("expected the divergence to be found")
+	}
+}
+
+func TestCheckConfigs(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	open := func(path string, config Config) (Tree, error) {
+		return fbptree.Open(path, fbptree.Order(config.Order), fbptree.PageSize(config.PageSize))
+	}
+
+	ops := func(config Config) []Op {
+		g := NewGenerator(int64(config.Order * config.PageSize))
+		g.KeySpace = 100
+		g.LargeValueRate = 0.1
+		g.MaxLargeValueSize = 2000
+		g.LongKeyEvery = 17
+		g.LongKeySize = 300
+		g.IterateRate = 0.02
+
+		return g.Ops(300)
+	}
+
+	if err := CheckConfigs(dbDir, open, Configs([]int{3, 8}, []int{64, 512}), ops); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// invalidTree fails the verification.
+type invalidTree struct {
+	Tree
+}
+
+func (t *invalidTree) Verify() error {
+	return fmt.Errorf("invalid")
+}
+
+func TestCheckVerifiesTree(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	open := func(path string) (Tree, error) {
+		tree, err := fbptree.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &invalidTree{Tree: tree}, nil
+	}
+
+	if err := Check(path.Join(dbDir, "sample.data"), open, []Op{{Type: Iterate}}); err == nil {
+		t.Fatalf("expected the invalid tree to be found")
+	}
+}
@@ -0,0 +1,76 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// ErrNotTree is returned when the file is not a tree file, e.g. the path
+// refers to the other file.
+var ErrNotTree = errors.New("the file is not a tree")
+
+// The metadata block starts with the page size followed by the signature
+// of the file format and its version. The files created before the signature
+// was introduced have zeros instead and are treated as the version 0.
+var formatMagic = []byte("FBPTRE")
+
+const formatMagicPosition = 2
+const formatVersionPosition = 8
+
+// the version of the file format written by this package
+const formatVersion = 3
+
+// formatMigrations migrate the file from the format version of the index to
+// the next one. They run when the file is opened, before it is read. The
+// migrated version is written with the metadata on the next metadata update.
+var formatMigrations = []func(p *pager) error{
+	// the version 0 differs only by the missing signature,
+	// the later additions to the format are backward compatible
+	func(p *pager) error { return nil },
+	// the version 2 does not store the parents of the nodes, the parents
+	// written by the version 1 are ignored, the version is changed so the
+	// earlier versions of the package do not read the nodes without them
+	func(p *pager) error { return nil },
+	// the version 3 links the leaves to the previous leaves in their
+	// headers, the leaves are linked on open, see linkLeaves
+	func(p *pager) error { return nil },
+}
+
+// encodeFormat writes the signature and the current version of the format
+// into the metadata block.
+func encodeFormat(data []byte) {
+	copy(data[formatMagicPosition:], formatMagic)
+	copy(data[formatVersionPosition:], encodeUint16(formatVersion))
+}
+
+// decodeFormat returns the version of the format of the metadata block.
+func decodeFormat(data []byte) (uint16, error) {
+	magic := data[formatMagicPosition : formatMagicPosition+len(formatMagic)]
+	version := decodeUint16(data[formatVersionPosition : formatVersionPosition+2])
+	if bytes.Equal(magic, make([]byte, len(formatMagic))) && version == 0 {
+		return 0, nil
+	}
+
+	if !bytes.Equal(magic, formatMagic) {
+		return 0, fmt.Errorf("%w: unknown signature %q", ErrNotTree, magic)
+	}
+
+	if version == 0 || version > formatVersion {
+		return 0, fmt.Errorf("unsupported file format version %d, the latest supported version is %d", version, formatVersion)
+	}
+
+	return version, nil
+}
+
+// migrate migrates the file opened by the pager to the current format version.
+func migrate(p *pager) error {
+	for version := p.metadata.version; version < formatVersion; version++ {
+		if err := formatMigrations[version](p); err != nil {
+			return fmt.Errorf("failed to migrate from the format version %d: %w", version, err)
+		}
+	}
+	p.metadata.version = formatVersion
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestFormatSignature(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", dbPath, err)
+	}
+	if string(data[formatMagicPosition:formatMagicPosition+len(formatMagic)]) != string(formatMagic) {
+		t.Fatalf("expected the signature %q in the metadata", formatMagic)
+	}
+	if version := decodeUint16(data[formatVersionPosition:]); version != formatVersion {
+		t.Fatalf("expected the format version %d, but got %d", formatVersion, version)
+	}
+
+	// the version of the future release
+	future := copyBytes(data)
+	copy(future[formatVersionPosition:], encodeUint16(formatVersion+1))
+	copy(future[metadataChecksumPosition:], encodeUint32(metadataChecksum(future[:metadataSize])))
+	if err := ioutil.WriteFile(dbPath, future, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", dbPath, err)
+	}
+	if _, err := Open(dbPath, PageSize(64)); err == nil || !strings.Contains(err.Error(), "unsupported file format version") {
+		t.Fatalf("expected the error for the unsupported format version, but got %v", err)
+	}
+
+	// the file written before the signature was introduced
+	legacy := copyBytes(data)
+	copy(legacy[formatMagicPosition:16], make([]byte, 16-formatMagicPosition))
+	copy(legacy[metadataChecksumPosition:], encodeUint32(metadataChecksum(legacy[:metadataSize])))
+	if err := ioutil.WriteFile(dbPath, legacy, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", dbPath, err)
+	}
+
+	tree, err = Open(dbPath, PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open the legacy tree: %s", err)
+	}
+	if value, ok, err := tree.Get([]byte{1}); err != nil || !ok || value[0] != 1 {
+		t.Fatalf("failed to get the value from the legacy tree: %v", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	metadata, err := readMetadataFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read metadata: %s", err)
+	}
+	if metadata.version != formatVersion {
+		t.Fatalf("expected the migrated format version %d, but got %d", formatVersion, metadata.version)
+	}
+}
+
+func TestOpenForeignFile(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "notes.txt")
+	notes := make([]byte, 4096)
+	for i := range notes {
+		notes[i] = "the notes, not a tree\n"[i%22]
+	}
+	if err := ioutil.WriteFile(dbPath, notes, 0600); err != nil {
+		t.Fatalf("failed to write %s: %s", dbPath, err)
+	}
+
+	if _, err := Open(dbPath); !errors.Is(err, ErrNotTree) {
+		t.Fatalf("expected ErrNotTree, but got %v", err)
+	}
+
+	if _, err := OpenReader(dbPath); !errors.Is(err, ErrNotTree) {
+		t.Fatalf("expected ErrNotTree from the reader, but got %v", err)
+	}
+}
+
+func readMetadataFile(path string) (*metadata, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readMetadata(file)
+}
@@ -0,0 +1,132 @@
+//go:build go1.18
+// +build go1.18
+
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// the decoders return ErrCorrupted for the damaged data and never panic
+
+func FuzzDecodeNode(f *testing.F) {
+	leaf := &node{
+		id:       1,
+		leaf:     true,
+		keys:     [][]byte{{1, 2}, bytes.Repeat([]byte{3}, 100), nil},
+		pointers: []*pointer{{value: []byte{1}}, {value: &overflow{recordID: 7, size: 100000}, expiresAt: 42}, nil, nil},
+		keyNum:   2,
+		prevID:   3,
+	}
+	leaf.setNext(&pointer{value: uint32(2)})
+	internal := &node{
+		id:       4,
+		keys:     [][]byte{{1, 2}, {3, 4}, nil},
+		pointers: []*pointer{{value: uint32(2), count: 3}, {value: uint32(3)}, {value: uint32(5)}, nil},
+		keyNum:   2,
+	}
+	f.Add(encodeNode(leaf))
+	f.Add(encodeNode(internal))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := decodeNode(data); err != nil && !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("expected ErrCorrupted, but got %v", err)
+		}
+	})
+}
+
+func FuzzDecodeMetadata(f *testing.F) {
+	f.Add(encodeMetadata(&metadata{pageSize: 4096, user: []byte{1, 2, 3}, custom: []byte{4, 5, 6}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// the checksum is cleared, so the regions are decoded
+		if len(data) >= metadataChecksumPosition+4 {
+			copy(data[metadataChecksumPosition:], encodeUint32(0))
+		}
+
+		m, err := decodeMetadata(data)
+		if err != nil {
+			return
+		}
+
+		if m.custom != nil {
+			decodeTreeMetadata(m.custom)
+		}
+		decodeStats(m.stats)
+		decodeHotLeaves(m.hotLeaves)
+	})
+}
+
+func FuzzDecodeTreeMetadata(f *testing.F) {
+	f.Add(encodeTreeMetadata(&treeMetadata{order: 3, rootID: 1, leftmostID: 1, size: 10}))
+	f.Add(encodeTreeMetadata(&treeMetadata{order: 3, rootID: 1, leftmostID: 1, size: 10, ordering: "collation:en", codec: "flate", maxNodeSize: 4096}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := decodeTreeMetadata(data); err != nil && !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("expected ErrCorrupted, but got %v", err)
+		}
+	})
+}
+
+func FuzzDecodeFreePage(f *testing.F) {
+	f.Add(append(encodeUint32(2), make([]byte, 28)...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := decodeFreePage(1, data); err != nil && !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("expected ErrCorrupted, but got %v", err)
+		}
+	})
+}
+
+func FuzzReader(f *testing.F) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		f.Fatalf("failed to open tree: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, bytes.Repeat([]byte{byte(i)}, i*10)); err != nil {
+			f.Fatalf("failed to put: %s", err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		f.Fatalf("failed to close tree: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		f.Fatalf("failed to read the file: %s", err)
+	}
+	f.Add(data)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r, err := NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		r.ForEach(func(key, value []byte) {})
+		for pageID := 1; pageID <= r.Pages(); pageID++ {
+			r.Page(uint32(pageID))
+		}
+
+		// the salvaging decodes every page as the node
+		r.metadata = nil
+		for _, entry := range r.recoverEntries(&RepairReport{}) {
+			r.storage.readValue(entry.pointer)
+		}
+	})
+}
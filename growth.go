@@ -0,0 +1,66 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// GrowthPolicy defines how many pages are added to the file at once when
+// there are no free pages left.
+type GrowthPolicy struct {
+	// the number of the bytes added at once, the maximum number
+	// if the file doubles, 0 if the file grows by one page
+	extent int
+	// if true, the file grows by its own size up to the extent
+	doubling bool
+}
+
+// GrowByPage grows the file by one page at a time, the default.
+func GrowByPage() GrowthPolicy {
+	return GrowthPolicy{}
+}
+
+// GrowByExtent grows the file by the extent of the given size in bytes,
+// rounded up to the pages, e.g. 1 MB.
+func GrowByExtent(size int) GrowthPolicy {
+	return GrowthPolicy{extent: size}
+}
+
+// GrowByDoubling grows the file by its own size, so the small file stays
+// small, but by not more than the given size in bytes at a time.
+func GrowByDoubling(maxExtent int) GrowthPolicy {
+	return GrowthPolicy{extent: maxExtent, doubling: true}
+}
+
+// Growth option sets the growth policy of the file, GrowByPage by default.
+// The file grows by the extents in one write, so the file system changes
+// the size of the file and allocates its blocks less often and keeps them
+// contiguous. The pages of the extent are allocated in order once the free
+// pages are used up. The unused pages of the last extent are truncated on
+// close, after the crash they stay in the file as the lost pages until
+// Compact reclaims them.
+func Growth(policy GrowthPolicy) func(*config) error {
+	return func(c *config) error {
+		if policy.extent < 0 || (policy.extent == 0 && policy.doubling) {
+			return fmt.Errorf("growth extent must be positive")
+		}
+
+		c.growth = policy
+
+		return nil
+	}
+}
+
+// pages returns the number of the pages to add to the file
+// with the given number of the pages.
+func (g GrowthPolicy) pages(filePages uint32, pageSize uint16) uint32 {
+	pages := uint32(ceil(g.extent, int(pageSize)))
+	if g.doubling && filePages < pages {
+		pages = filePages
+	}
+
+	if pages == 0 {
+		return 1
+	}
+
+	return pages
+}
@@ -0,0 +1,145 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestGrowth(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	policies := map[string]GrowthPolicy{
+		"page.data":     GrowByPage(),
+		"extent.data":   GrowByExtent(64 * 1024),
+		"doubling.data": GrowByDoubling(64 * 1024),
+	}
+
+	for name, policy := range policies {
+		dbPath := path.Join(dbDir, name)
+		tree, err := Open(dbPath, Order(10), PageSize(4096), Growth(policy))
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := encodeUint32(uint32(i))
+			if _, _, err := tree.Put(key, bytes.Repeat(key, 100)); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+
+		pager := tree.storage.pager
+		// the first page of the free pages is allocated before the policy
+		// is set, then the doubling file grows by 1, 2, 4, 8 and 16 pages
+		if name == "extent.data" && (pager.filePages-1)%16 != 0 {
+			t.Fatalf("expected the file of the 16-page extents, but got %d pages", pager.filePages)
+		}
+		if name == "doubling.data" && pager.filePages%16 != 0 {
+			t.Fatalf("expected the doubled file, but got %d pages", pager.filePages)
+		}
+		if name == "page.data" && pager.filePages != pager.lastPageId {
+			t.Fatalf("expected no pages allocated in advance, but got %d", pager.filePages-pager.lastPageId)
+		}
+		pages := pager.lastPageId
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+
+		info, err := os.Stat(dbPath)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", dbPath, err)
+		}
+		if expected := int64(metadataSize) + int64(pages)*4096; info.Size() != expected {
+			t.Fatalf("expected the file of %d bytes after close, but got %d", expected, info.Size())
+		}
+
+		tree, err = Open(dbPath, Order(10), PageSize(4096), Growth(policy))
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := encodeUint32(uint32(i))
+			value, ok, err := tree.Get(key)
+			if err != nil || !ok || !bytes.Equal(value, bytes.Repeat(key, 100)) {
+				t.Fatalf("unexpected value for key %d: %v", i, err)
+			}
+		}
+
+		report, err := tree.Check()
+		if err != nil {
+			t.Fatalf("failed to check: %s", err)
+		}
+		if !report.OK() {
+			t.Fatalf("expected no problems for %s, but got %v", name, report.Problems)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
+
+func TestGrowthReload(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), PageSize(4096), WriteAheadLog(), Growth(GrowByExtent(1024*1024)))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put(encodeUint32(uint32(i)), encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	pages := tree.storage.pager.lastPageId
+
+	// the pager is reloaded from the file with the pages allocated in advance
+	if err := tree.Recover(); err != nil {
+		t.Fatalf("failed to recover: %s", err)
+	}
+	if tree.storage.pager.lastPageId != pages {
+		t.Fatalf("expected %d pages in use after the reload, but got %d", pages, tree.storage.pager.lastPageId)
+	}
+
+	for i := 10; i < 20; i++ {
+		if _, _, err := tree.Put(encodeUint32(uint32(i)), encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected no problems, but got %v", report.Problems)
+	}
+}
+
+func TestGrowthErrors(t *testing.T) {
+	if _, err := newConfig([]func(*config) error{Growth(GrowByExtent(-1))}); err == nil {
+		t.Fatalf("expected the error for the negative extent")
+	}
+
+	if _, err := newConfig([]func(*config) error{Growth(GrowByDoubling(0))}); err == nil {
+		t.Fatalf("expected the error for the zero extent")
+	}
+}
@@ -0,0 +1,116 @@
+package fbptree
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// the number of the random root-to-leaf paths checked by HealthCheck
+const healthCheckSamples = 16
+
+// the time limit for the sampling of HealthCheck
+const healthCheckBudget = 50 * time.Millisecond
+
+// HealthCheck is a cheap check suitable for the readiness probes. It reads
+// the file, bypassing the cache, and verifies the metadata checksum, that the
+// root and the leftmost leaf are reachable and valid, and the invariants of
+// the nodes on a sample of random root-to-leaf paths within a bounded time.
+// It records the time of the check in the lifetime statistics.
+func (t *FBPTree) HealthCheck() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if err := t.healthCheck(); err != nil {
+		return err
+	}
+
+	t.storage.lifetime.LastCheck = time.Now()
+
+	return nil
+}
+
+func (t *FBPTree) healthCheck() error {
+	metadata, err := readMetadata(t.storage.pager.file)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if metadata.pageSize != t.storage.pager.pageSize {
+		return fmt.Errorf("the page size %d in the metadata does not match the page size %d", metadata.pageSize, t.storage.pager.pageSize)
+	}
+
+	treeMetadata, err := t.storage.loadMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to load the tree metadata: %w", err)
+	}
+
+	if treeMetadata == nil {
+		if t.metadata != nil {
+			return fmt.Errorf("the tree metadata is missing for the tree of size %d", t.metadata.size)
+		}
+
+		return nil
+	}
+
+	root, err := t.checkNode(treeMetadata.rootID, true)
+	if err != nil {
+		return fmt.Errorf("the root is not valid: %w", err)
+	}
+	// the leftmost path must end with the leftmost leaf
+	current := root
+	for !current.leaf {
+		current, err = t.checkNode(current.pointers[0].asNodeID(), false)
+		if err != nil {
+			return fmt.Errorf("the leftmost path is not valid: %w", err)
+		}
+	}
+	if current.id != treeMetadata.leftmostID {
+		return fmt.Errorf("the leftmost leaf is %d, but the metadata refers to %d", current.id, treeMetadata.leftmostID)
+	}
+
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+	deadline := time.Now().Add(healthCheckBudget)
+	for i := 0; i < healthCheckSamples && !root.leaf && time.Now().Before(deadline); i++ {
+		current := root
+		for !current.leaf {
+			childID := current.pointers[random.Intn(current.keyNum+1)].asNodeID()
+			child, err := t.checkNode(childID, false)
+			if err != nil {
+				return fmt.Errorf("the sampled path is not valid: %w", err)
+			}
+
+			current = child
+		}
+	}
+
+	return nil
+}
+
+// checkNode reads the node from the file and validates it,
+// the fill of the root is not validated.
+func (t *FBPTree) checkNode(nodeID uint32, root bool) (*node, error) {
+	data, err := t.storage.readNode(nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node %d: %w", nodeID, err)
+	}
+
+	n, err := decodeNode(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode node %d: %w", nodeID, corruptionOf(err, nodeID))
+	}
+
+	if n.id != nodeID {
+		return nil, fmt.Errorf("node %d has identifier %d", nodeID, n.id)
+	}
+
+	if err := n.validate(t.compare, t.minKeysOf(n, root)); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
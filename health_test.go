@@ -0,0 +1,78 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestHealthCheck(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if err := tree.HealthCheck(); err != nil {
+		t.Fatalf("the empty tree must be healthy: %s", err)
+	}
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Put([]byte{c.key}, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+
+	if err := tree.HealthCheck(); err != nil {
+		t.Fatalf("the tree must be healthy: %s", err)
+	}
+	if tree.Stats().LastCheck.IsZero() {
+		t.Fatal("the check time must be recorded")
+	}
+
+	file, err := os.OpenFile(dbPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("failed to open the file: %s", err)
+	}
+	defer file.Close()
+
+	// corrupt the root node, the cached copy must not hide it
+	root, err := tree.storage.records.read(tree.metadata.rootID)
+	if err != nil {
+		t.Fatalf("failed to read the root: %s", err)
+	}
+	offset := int64(metadataSize) + int64(tree.metadata.rootID-1)*64 + 16
+	if _, err := file.WriteAt([]byte{0xFF, 0xFF, 0xFF, 0xFF}, offset); err != nil {
+		t.Fatalf("failed to corrupt the root: %s", err)
+	}
+
+	if err := tree.HealthCheck(); err == nil {
+		t.Fatal("expected the error for the corrupted root")
+	}
+
+	if _, err := file.WriteAt(root[0:4], offset); err != nil {
+		t.Fatalf("failed to restore the root: %s", err)
+	}
+	if err := tree.HealthCheck(); err != nil {
+		t.Fatalf("the tree must be healthy: %s", err)
+	}
+
+	// corrupt the tree metadata
+	if _, err := file.WriteAt([]byte{0xFF}, customMetadataPosition+3); err != nil {
+		t.Fatalf("failed to corrupt the metadata: %s", err)
+	}
+
+	if err := tree.HealthCheck(); err == nil {
+		t.Fatal("expected the error for the corrupted metadata")
+	}
+}
@@ -0,0 +1,261 @@
+package fbptree
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// PageKind is the role of the page in the tree file, see Reader.Page.
+type PageKind int
+
+const (
+	// PageUnknown is the page that is not referenced by the tree or by the
+	// free page lists, e.g. the lost page or the page of the damaged subtree.
+	PageUnknown PageKind = iota
+	// PageFreeList is the container of the free page list.
+	PageFreeList
+	// PageFree is the free page.
+	PageFree
+	// PageNode is the first page of the node record.
+	PageNode
+	// PageKeys is the first page of the record with the tails of the long
+	// keys of the node.
+	PageKeys
+	// PageValue is the first page of the record of the large value.
+	PageValue
+	// PageContinuation is the next page of the record.
+	PageContinuation
+)
+
+func (k PageKind) String() string {
+	switch k {
+	case PageUnknown:
+		return "unknown"
+	case PageFreeList:
+		return "free list"
+	case PageFree:
+		return "free"
+	case PageNode:
+		return "node"
+	case PageKeys:
+		return "keys"
+	case PageValue:
+		return "value"
+	case PageContinuation:
+		return "continuation"
+	}
+
+	return fmt.Sprintf("kind(%d)", int(k))
+}
+
+// PageInfo is the raw page of the tree file with its decoded headers.
+type PageInfo struct {
+	ID   uint32
+	Kind PageKind
+	// Data is the contents of the page.
+	Data []byte
+	// NextID is the next page of the record or of the free page list.
+	NextID uint32
+	// RecordID is the first page of the record of the continuation page.
+	RecordID uint32
+	// RecordSize and Checksum are the header of the first page of the
+	// record, the zero checksum is not verified.
+	RecordSize uint32
+	Checksum   uint32
+	// FreeIDs are the free pages listed by the free page list container.
+	FreeIDs []uint32
+	// Node is the decoded node of the node page.
+	Node *NodeInfo
+}
+
+// NodeInfo is the decoded node.
+type NodeInfo struct {
+	Leaf bool
+	Keys [][]byte
+	// Children are the child nodes of the internal node.
+	Children []uint32
+	// PrevID and NextID are the neighbour leaves of the leaf.
+	PrevID uint32
+	NextID uint32
+}
+
+// pageLayout is the role of every page referenced by the tree
+// or by the free page lists.
+type pageLayout struct {
+	kinds map[uint32]PageKind
+	// the first page of the record of the continuation pages
+	recordOf map[uint32]uint32
+	// the nodes referenced by the tree that can not be read
+	damaged []uint32
+}
+
+// Pages returns the number of the pages in the file, not including the
+// metadata block, the pages are numbered from 1.
+func (r *Reader) Pages() int {
+	if r.storage.pager.lastPageId == math.MaxUint32 {
+		// the size of the contents is unknown
+		return 0
+	}
+
+	return int(r.storage.pager.lastPageId)
+}
+
+// Page reads the page by its identifier and decodes it according to its
+// role in the file. The role is found by walking the free page lists and the
+// tree once, the damaged parts of the tree are skipped, so their pages are
+// unknown. It is intended for the diagnosis of the damaged files.
+func (r *Reader) Page(pageID uint32) (*PageInfo, error) {
+	if pageID == 0 {
+		return nil, fmt.Errorf("the pages are numbered from 1")
+	}
+
+	if r.layout == nil {
+		r.layout = r.readLayout()
+	}
+
+	data, err := readPage(r.storage.pager.file, pageID, r.storage.pager.pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read page %d: %w", pageID, err)
+	}
+
+	info := &PageInfo{ID: pageID, Kind: r.layout.kinds[pageID], Data: data}
+	switch info.Kind {
+	case PageFreeList:
+		freePage, err := decodeFreePage(pageID, data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode free page %d: %w", pageID, err)
+		}
+
+		info.NextID = freePage.nextPageId
+		info.FreeIDs = make([]uint32, 0, len(freePage.ids))
+		for id := range freePage.ids {
+			info.FreeIDs = append(info.FreeIDs, id)
+		}
+		sort.Slice(info.FreeIDs, func(i, j int) bool { return info.FreeIDs[i] < info.FreeIDs[j] })
+	case PageContinuation:
+		info.NextID = nextRecordId(data)
+		info.RecordID = r.layout.recordOf[pageID]
+	case PageNode, PageKeys, PageValue, PageUnknown:
+		// the unknown page is decoded as the first page of the record
+		info.NextID = nextRecordId(data)
+		info.RecordSize = recordSize(data)
+		info.Checksum = recordChecksum(data)
+	}
+
+	if info.Kind == PageNode {
+		n, err := r.storage.loadNodeByID(pageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode node %d: %w", pageID, err)
+		}
+
+		info.Node = nodeInfoOf(n)
+	}
+
+	return info, nil
+}
+
+// readLayout walks the free page lists and the tree and returns the roles
+// of the pages they reference.
+func (r *Reader) readLayout() *pageLayout {
+	layout := &pageLayout{kinds: make(map[uint32]PageKind), recordOf: make(map[uint32]uint32)}
+	pager := r.storage.pager
+
+	for pageID := firstFreePageId; pageID != 0 && layout.kinds[pageID] == PageUnknown; {
+		freePage, err := readFreePage(pager.file, pageID, pager.pageSize)
+		if err != nil {
+			break
+		}
+
+		layout.kinds[pageID] = PageFreeList
+		for id := range freePage.ids {
+			layout.kinds[id] = PageFree
+		}
+		pageID = freePage.nextPageId
+	}
+
+	if r.metadata == nil {
+		return layout
+	}
+
+	pending := []uint32{r.metadata.rootID}
+	for len(pending) > 0 {
+		nodeID := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if layout.kinds[nodeID] != PageUnknown {
+			continue
+		}
+
+		n, err := r.storage.loadNodeByID(nodeID)
+		if err != nil {
+			layout.damaged = append(layout.damaged, nodeID)
+
+			continue
+		}
+
+		r.markRecord(layout, nodeID, PageNode)
+		if n.keyRecordID != 0 {
+			r.markRecord(layout, n.keyRecordID, PageKeys)
+		}
+
+		for i := 0; i < n.keyNum; i++ {
+			if n.leaf {
+				if n.pointers[i].isOverflow() {
+					r.markRecord(layout, n.pointers[i].asOverflow().recordID, PageValue)
+				}
+
+				continue
+			}
+
+			pending = append(pending, n.pointers[i].asNodeID())
+		}
+		if !n.leaf {
+			pending = append(pending, n.pointers[n.keyNum].asNodeID())
+		}
+	}
+
+	return layout
+}
+
+// markRecord marks the first page of the record and its next pages.
+func (r *Reader) markRecord(layout *pageLayout, recordID uint32, kind PageKind) {
+	layout.kinds[recordID] = kind
+
+	pager := r.storage.pager
+	for pageID := recordID; ; {
+		data, err := readPage(pager.file, pageID, pager.pageSize)
+		if err != nil {
+			return
+		}
+
+		pageID = nextRecordId(data)
+		if pageID == 0 || layout.kinds[pageID] != PageUnknown {
+			return
+		}
+
+		layout.kinds[pageID] = PageContinuation
+		layout.recordOf[pageID] = recordID
+	}
+}
+
+// nodeInfoOf returns the description of the node.
+func nodeInfoOf(n *node) *NodeInfo {
+	info := &NodeInfo{Leaf: n.leaf, Keys: make([][]byte, n.keyNum)}
+	for i := 0; i < n.keyNum; i++ {
+		info.Keys[i] = copyBytes(n.keys[i])
+	}
+
+	if n.leaf {
+		info.PrevID = n.prevID
+		info.NextID = n.nextID()
+
+		return info
+	}
+
+	info.Children = make([]uint32, n.keyNum+1)
+	for i := 0; i <= n.keyNum; i++ {
+		info.Children[i] = n.pointers[i].asNodeID()
+	}
+
+	return info
+}
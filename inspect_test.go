@@ -0,0 +1,111 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestReaderPage(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(4096))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	// the large value spans the several pages of its record
+	if _, _, err := tree.Put(encodeUint32(1000), make([]byte, 100000)); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+	// the pages of the replaced large value are freed
+	if _, _, err := tree.Put(encodeUint32(2000), make([]byte, 100000)); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, _, err := tree.Put(encodeUint32(2000), []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	stats, err := tree.TreeStats()
+	if err != nil {
+		t.Fatalf("failed to get the tree stats: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	r, err := OpenReader(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open the reader: %s", err)
+	}
+	defer r.Close()
+
+	if r.Pages() == 0 {
+		t.Fatalf("expected the pages")
+	}
+
+	kinds := make(map[PageKind]int)
+	keys, free := 0, 0
+	for pageID := 1; pageID <= r.Pages(); pageID++ {
+		page, err := r.Page(uint32(pageID))
+		if err != nil {
+			t.Fatalf("failed to read page %d: %s", pageID, err)
+		}
+		kinds[page.Kind]++
+
+		switch page.Kind {
+		case PageNode:
+			if page.Node == nil {
+				t.Fatalf("expected the decoded node %d", pageID)
+			}
+			if page.Node.Leaf {
+				keys += len(page.Node.Keys)
+			}
+		case PageContinuation:
+			if page.RecordID == 0 {
+				t.Fatalf("expected the record of the continuation page %d", pageID)
+			}
+		case PageFreeList:
+			free += len(page.FreeIDs)
+		}
+	}
+
+	if kinds[PageNode] != stats.InternalNodes+stats.Leaves {
+		t.Fatalf("expected %d node pages, but got %d", stats.InternalNodes+stats.Leaves, kinds[PageNode])
+	}
+	if keys != 52 {
+		t.Fatalf("expected 52 keys in the leaves, but got %d", keys)
+	}
+	if kinds[PageValue] != 1 || kinds[PageContinuation] == 0 {
+		t.Fatalf("expected the value record with the continuation pages, but got %v", kinds)
+	}
+	if kinds[PageFreeList] == 0 || kinds[PageFree] == 0 {
+		t.Fatalf("expected the free pages, but got %v", kinds)
+	}
+	if kinds[PageFree] != stats.FreePages || free != stats.FreePages {
+		t.Fatalf("expected %d free pages, but got %v and %d in the lists", stats.FreePages, kinds, free)
+	}
+
+	if _, err := r.Page(0); err == nil {
+		t.Fatalf("expected the error for the page 0")
+	}
+}
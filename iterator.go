@@ -1,20 +1,75 @@
 package fbptree
 
-import "fmt"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrModified is returned by the iterators and the cursors when the tree
+// is modified after they were created or positioned, since the leaves they
+// hold may be split, merged or freed. The iterator fails only if its current
+// leaf or the next one is changed, so the writes to the other leaves do not
+// interrupt it, while the cursor fails after any write. The iteration must
+// be started again, e.g. with Scan from the key after the last one returned.
+var ErrModified = errors.New("the tree is modified during the iteration")
 
 // Iterator returns a stateful Iterator for traversing the tree
-// in ascending key order.
+// in ascending key order. The expired keys are skipped. The iterator holds
+// the leaf it traverses until it is exhausted or closed, so the iterator
+// that is abandoned before its end must be closed.
 type Iterator struct {
 	next    *node
 	i       int
 	storage *storage
+
+	// the exclusive upper bound of the keys, nil if there is no bound
+	end  []byte
+	less func(x, y []byte) bool
+	// the prefix of the keys, nil if there is no prefix
+	prefix []byte
+	// if true, the values are not read and Next returns nil values
+	keysOnly bool
+	// if true, the expired entries are skipped
+	live bool
+
+	// the tree of the iterator, nil for the internal iterators
+	// that run under its lock
+	t *FBPTree
+	// the version of the storage the iterator was created at
+	version uint64
+	// true if the iterator is counted by the tree as open
+	open bool
+	// true after Close
+	closed bool
 }
 
 // Iterator returns a stateful iterator that traverses the tree
-// in ascending key order.
+// in ascending key order. Cursor also seeks and moves backward.
 func (t *FBPTree) Iterator() (*Iterator, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	it, err := t.iterator()
+	if err != nil {
+		return nil, err
+	}
+	if err := it.skipExpired(); err != nil {
+		return nil, err
+	}
+	it.attach(t)
+
+	return it, nil
+}
+
+func (t *FBPTree) iterator() (*Iterator, error) {
 	if t.metadata == nil {
-		return &Iterator{nil, 0, t.storage}, nil
+		return &Iterator{storage: t.storage}, nil
 	}
 
 	next, err := t.storage.loadNodeByID(t.metadata.leftmostID)
@@ -22,42 +77,250 @@ func (t *FBPTree) Iterator() (*Iterator, error) {
 		return nil, fmt.Errorf("failed to load the leftmost node %d: %w", t.metadata.leftmostID, err)
 	}
 
-	return &Iterator{next, 0, t.storage}, nil
+	return &Iterator{next: next, storage: t.storage}, nil
+}
+
+// Scan returns a stateful iterator that traverses the keys in [start, end)
+// range in ascending key order. It seeks straight to the leaf of the start
+// key. The nil start and end are the bounds of the tree.
+func (t *FBPTree) Scan(start, end []byte) (*Iterator, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	it, err := t.newScan(start, end)
+	if err != nil {
+		return nil, err
+	}
+	if err := it.skipExpired(); err != nil {
+		return nil, err
+	}
+	it.attach(t)
+
+	return it, nil
+}
+
+func (t *FBPTree) newScan(start, end []byte) (*Iterator, error) {
+	it := &Iterator{storage: t.storage, end: end, less: t.less}
+	if t.metadata == nil {
+		return it, nil
+	}
+
+	if start == nil {
+		next, err := t.storage.loadNodeByID(t.metadata.leftmostID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the leftmost node %d: %w", t.metadata.leftmostID, err)
+		}
+		it.next = next
+
+		return it, nil
+	}
+
+	next, err := t.findLeaf(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the leaf: %w", err)
+	}
+	it.next = next
+
+	// the keys of the next leaves are greater than the start
+	for it.i < it.next.keyNum && t.less(it.next.keys[it.i], start) {
+		it.i++
+	}
+	if err := it.advance(); err != nil {
+		return nil, err
+	}
+
+	return it, nil
+}
+
+// ScanPrefix returns a stateful iterator that traverses the keys starting
+// with the prefix in ascending key order. It seeks to the prefix and stops
+// at the first key without it, so the keys with the prefix must be adjacent
+// in the key order, as they are in the default byte order.
+func (t *FBPTree) ScanPrefix(prefix []byte) (*Iterator, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	it, err := t.newScan(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	it.prefix = copyBytes(prefix)
+	if err := it.skipExpired(); err != nil {
+		return nil, err
+	}
+	it.attach(t)
+
+	return it, nil
+}
+
+// KeysIterator returns a stateful iterator that traverses the keys in
+// ascending key order without reading the values: Next returns nil values,
+// so the large values are not read from their overflow records.
+func (t *FBPTree) KeysIterator() (*Iterator, error) {
+	it, err := t.Iterator()
+	if err != nil {
+		return nil, err
+	}
+	it.keysOnly = true
+
+	return it, nil
+}
+
+// ScanKeys returns a stateful iterator that traverses the keys in
+// [start, end) range as Scan does, but without reading the values
+// as KeysIterator does.
+func (t *FBPTree) ScanKeys(start, end []byte) (*Iterator, error) {
+	it, err := t.Scan(start, end)
+	if err != nil {
+		return nil, err
+	}
+	it.keysOnly = true
+
+	return it, nil
+}
+
+// attach makes the iterator check the tree it traverses
+// and counts it as open until it is released.
+func (it *Iterator) attach(t *FBPTree) {
+	it.t = t
+	it.version = t.storage.version
+	if it.HasNext() {
+		it.open = true
+		atomic.AddInt32(&t.iterators, 1)
+	}
+}
+
+// Close releases the iterator: HasNext returns false and Next returns
+// ErrClosed after it. It is safe to close the iterator more than once
+// and after the tree is closed.
+func (it *Iterator) Close() error {
+	it.closed = true
+	it.release()
+
+	return nil
+}
+
+// release drops the leaf held by the iterator and stops counting
+// it as open.
+func (it *Iterator) release() {
+	it.next = nil
+	if it.open {
+		it.open = false
+		atomic.AddInt32(&it.t.iterators, -1)
+	}
 }
 
 // HasNext returns true if there is a next element to retrive.
 func (it *Iterator) HasNext() bool {
-	return it.next != nil && it.i < it.next.keyNum
+	if it.next == nil || it.i >= it.next.keyNum {
+		return false
+	}
+
+	key := it.next.keys[it.i]
+	if it.prefix != nil && !bytes.HasPrefix(key, it.prefix) {
+		return false
+	}
+
+	return it.end == nil || it.less(key, it.end)
 }
 
 // Next returns a key and a value at the current position of the iteration
-// and advances the iterator.
-// Caution! Next panics if called on the nil element.
+// and advances the iterator. It returns ErrModified if the current leaf of
+// the iterator or the next one is modified after the previous call and
+// ErrClosed if the iterator or the tree is closed.
 func (it *Iterator) Next() ([]byte, []byte, error) {
+	if it.closed {
+		return nil, nil, ErrClosed
+	}
+
 	if !it.HasNext() {
 		// to sleep well
 		return nil, nil, fmt.Errorf("there is no next node")
 	}
 
-	key, value := it.next.keys[it.i], it.next.pointers[it.i].asValue()
+	if it.t != nil {
+		it.t.mu.RLock()
+		defer it.t.mu.RUnlock()
 
-	it.i++
-	if it.i == it.next.keyNum {
-		nextPointer := it.next.next()
-		if nextPointer != nil {
-			nodeID := nextPointer.asNodeID()
-			next, err := it.storage.loadNodeByID(nodeID)
-			if err != nil {
-				return nil, nil, fmt.Errorf("failed to load the next node: %w", err)
-			}
-
-			it.next = next
-		} else {
-			it.next = nil
+		if it.t.closed {
+			return nil, nil, ErrClosed
 		}
 
-		it.i = 0
+		if it.storage != it.t.storage || it.storage.changedSince(it.version, it.next.id, it.next.nextID()) {
+			return nil, nil, ErrModified
+		}
+	}
+
+	key := it.next.keys[it.i]
+	var value []byte
+	if !it.keysOnly {
+		var err error
+		value, err = it.storage.readValue(it.next.pointers[it.i])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	it.i++
+	if err := it.advance(); err != nil {
+		return nil, nil, err
+	}
+	if err := it.skip(); err != nil {
+		return nil, nil, err
+	}
+	if !it.HasNext() {
+		it.release()
+	}
+	if it.t != nil {
+		// the leaf loaded by the advance is up to date
+		it.version = it.storage.version
 	}
 
 	return key, value, nil
 }
+
+// skipExpired makes the iterator skip the expired entries, starting from
+// the current one.
+func (it *Iterator) skipExpired() error {
+	it.live = true
+
+	return it.skip()
+}
+
+// skip moves past the expired entries if the iterator skips them.
+func (it *Iterator) skip() error {
+	for it.live && it.next != nil && it.i < it.next.keyNum && it.next.pointers[it.i].expired() {
+		it.i++
+		if err := it.advance(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// advance moves to the next leaf if all the keys of the current one
+// are traversed.
+func (it *Iterator) advance() error {
+	if it.i < it.next.keyNum {
+		return nil
+	}
+
+	next, err := it.storage.nextLeaf(it.next)
+	if err != nil {
+		return err
+	}
+
+	it.next = next
+	it.i = 0
+
+	return nil
+}
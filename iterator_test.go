@@ -0,0 +1,358 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	it, err := tree.Scan(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	if it.HasNext() {
+		t.Fatalf("expected no keys in the empty tree")
+	}
+
+	// the even keys from 0 to 198
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i * 2))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	cases := []struct {
+		start, end []byte
+		from, to   int
+	}{
+		{nil, nil, 0, 200},
+		{encodeUint32(10), encodeUint32(20), 10, 20},
+		{encodeUint32(11), encodeUint32(21), 12, 22},
+		{nil, encodeUint32(7), 0, 8},
+		{encodeUint32(191), nil, 192, 200},
+		{encodeUint32(500), nil, 0, 0},
+		{encodeUint32(20), encodeUint32(20), 0, 0},
+		{encodeUint32(30), encodeUint32(10), 0, 0},
+	}
+
+	for _, c := range cases {
+		expected := make([]uint32, 0)
+		for i := c.from; i < c.to; i += 2 {
+			expected = append(expected, uint32(i))
+		}
+
+		it, err := tree.Scan(c.start, c.end)
+		if err != nil {
+			t.Fatalf("failed to scan: %s", err)
+		}
+
+		actual := make([]uint32, 0)
+		for it.HasNext() {
+			key, value, err := it.Next()
+			if err != nil {
+				t.Fatalf("failed to advance: %s", err)
+			}
+			if !reflect.DeepEqual(key, value) {
+				t.Fatalf("unexpected value %v for key %v", value, key)
+			}
+
+			actual = append(actual, decodeUint32(key))
+		}
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Fatalf("expected %v for [%v, %v), but got %v", expected, c.start, c.end, actual)
+		}
+	}
+}
+
+func TestScanPrefix(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	keys := []string{"a", "ab", "abc", "abd", "ac", "b", "ba", "bab", "c"}
+	for _, key := range keys {
+		if _, _, err := tree.Put([]byte(key), []byte(key)); err != nil {
+			t.Fatalf("failed to put key %s: %s", key, err)
+		}
+	}
+
+	cases := []struct {
+		prefix   string
+		expected []string
+	}{
+		{"", keys},
+		{"a", []string{"a", "ab", "abc", "abd", "ac"}},
+		{"ab", []string{"ab", "abc", "abd"}},
+		{"ba", []string{"ba", "bab"}},
+		{"bb", []string{}},
+		{"d", []string{}},
+	}
+
+	for _, c := range cases {
+		it, err := tree.ScanPrefix([]byte(c.prefix))
+		if err != nil {
+			t.Fatalf("failed to scan: %s", err)
+		}
+
+		actual := make([]string, 0)
+		for it.HasNext() {
+			key, _, err := it.Next()
+			if err != nil {
+				t.Fatalf("failed to advance: %s", err)
+			}
+
+			actual = append(actual, string(key))
+		}
+
+		if !reflect.DeepEqual(c.expected, actual) {
+			t.Fatalf("expected %v for prefix %q, but got %v", c.expected, c.prefix, actual)
+		}
+	}
+}
+
+func TestIteratorDetectsModification(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	it, err := tree.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create iterator: %s", err)
+	}
+	if _, _, err := it.Next(); err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+
+	// the reads do not invalidate the iterator
+	if _, _, err := tree.Get([]byte{5}); err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if _, _, err := it.Next(); err != nil {
+		t.Fatalf("failed to advance: %s", err)
+	}
+
+	// the writes to the other leaves do not invalidate the iterator
+	if _, _, err := tree.Put([]byte{9}, []byte{90}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	for i := 2; i < 10; i++ {
+		key, value, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to advance: %s", err)
+		}
+		if i == 9 && !bytes.Equal(value, []byte{90}) {
+			t.Fatalf("expected the written value, but got %v for %v", value, key)
+		}
+	}
+
+	// the write to the current leaf
+	it, err = tree.Scan([]byte{2}, nil)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	if _, _, err := tree.Put(it.next.keys[it.i], []byte{20}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, _, err := it.Next(); err != ErrModified {
+		t.Fatalf("expected ErrModified, but got %v", err)
+	}
+
+	// the write to the next leaf
+	it, err = tree.Scan([]byte{2}, nil)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	next, err := tree.storage.nextLeaf(it.next)
+	if err != nil {
+		t.Fatalf("failed to load the next leaf: %s", err)
+	}
+	if _, _, err := tree.Delete(next.keys[0]); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	if _, _, err := it.Next(); err != ErrModified {
+		t.Fatalf("expected ErrModified, but got %v", err)
+	}
+}
+
+func TestKeysIterator(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	large := make([]byte, 100000)
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, large); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	before := tree.storage.stats()
+	it, err := tree.KeysIterator()
+	if err != nil {
+		t.Fatalf("failed to create iterator: %s", err)
+	}
+
+	actual := make([]byte, 0)
+	for it.HasNext() {
+		key, value, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to advance: %s", err)
+		}
+		if value != nil {
+			t.Fatalf("expected the nil value, but got %d bytes", len(value))
+		}
+
+		actual = append(actual, key[0])
+	}
+
+	if !reflect.DeepEqual(actual, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Fatalf("unexpected keys %v", actual)
+	}
+	if reads := tree.storage.stats().reads - before.reads; reads > 10 {
+		t.Fatalf("expected the overflow records not to be read, but read %d pages", reads)
+	}
+
+	it, err = tree.ScanKeys([]byte{3}, []byte{6})
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+
+	actual = actual[:0]
+	for it.HasNext() {
+		key, value, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to advance: %s", err)
+		}
+		if value != nil {
+			t.Fatalf("expected the nil value, but got %d bytes", len(value))
+		}
+
+		actual = append(actual, key[0])
+	}
+
+	if !reflect.DeepEqual(actual, []byte{3, 4, 5}) {
+		t.Fatalf("unexpected keys %v", actual)
+	}
+}
+
+func TestIteratorClose(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	logger := &recordingLogger{}
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	closed, err := tree.Iterator()
+	if err != nil {
+		t.Fatalf("failed to create iterator: %s", err)
+	}
+	if _, _, err := closed.Next(); err != nil {
+		t.Fatalf("failed to get the next entry: %s", err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatalf("failed to close the iterator: %s", err)
+	}
+	if err := closed.Close(); err != nil {
+		t.Fatalf("failed to close the iterator twice: %s", err)
+	}
+	if closed.HasNext() {
+		t.Fatalf("expected the closed iterator to have no next element")
+	}
+	if _, _, err := closed.Next(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed from the closed iterator, but got %v", err)
+	}
+
+	// the exhausted iterator is released without Close
+	exhausted, err := tree.Scan(encodeUint32(8), nil)
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	for exhausted.HasNext() {
+		if _, _, err := exhausted.Next(); err != nil {
+			t.Fatalf("failed to get the next entry: %s", err)
+		}
+	}
+
+	if tree.iterators != 0 {
+		t.Fatalf("expected no open iterators, but got %d", tree.iterators)
+	}
+
+	if _, err := tree.Iterator(); err != nil {
+		t.Fatalf("failed to create iterator: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	if len(logger.warn) != 1 {
+		t.Fatalf("expected the warning about the open iterator, but got %v", logger.warn)
+	}
+}
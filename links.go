@@ -0,0 +1,147 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// nextID returns the identifier of the next leaf node, zero if there is
+// none. Only relevant for the leaf nodes.
+func (n *node) nextID() uint32 {
+	if next := n.next(); next != nil {
+		return next.asNodeID()
+	}
+
+	return 0
+}
+
+// linkedLeaf returns true if the encoded node is the leaf with the links
+// to its siblings in the header, the leaves written before the links were
+// introduced have only the link to the next leaf.
+func linkedLeaf(data []byte) bool {
+	return len(data) > 8 && data[8]&1 == 1 && data[8]&8 != 0
+}
+
+// nextLeaf loads the next leaf by the link in the header of the leaf,
+// nil if the leaf is the rightmost one.
+func (s *storage) nextLeaf(leaf *node) (*node, error) {
+	nextID := leaf.nextID()
+	if nextID == 0 {
+		return nil, nil
+	}
+
+	next, err := s.loadNodeByID(nextID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the next leaf %d: %w", nextID, err)
+	}
+
+	return next, nil
+}
+
+// prevLeaf loads the previous leaf by the link in the header of the leaf,
+// nil if the leaf is the leftmost one.
+func (s *storage) prevLeaf(leaf *node) (*node, error) {
+	if leaf.prevID == 0 {
+		return nil, nil
+	}
+
+	prev, err := s.loadNodeByID(leaf.prevID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the previous leaf %d: %w", leaf.prevID, err)
+	}
+
+	return prev, nil
+}
+
+// linkNext links the next leaf of the leaf back to it after the split
+// or the merge changed the next leaf.
+func (s *storage) linkNext(leaf *node) error {
+	next, err := s.nextLeaf(leaf)
+	if err != nil || next == nil || next.prevID == leaf.id {
+		return err
+	}
+
+	next.prevID = leaf.id
+	if err := s.updateNodeByID(next.id, next); err != nil {
+		return fmt.Errorf("failed to update the next leaf %d: %w", next.id, err)
+	}
+
+	return nil
+}
+
+// linkLeaves writes the links to the previous leaves into the leaves of the
+// tree created before the links were introduced. The leftmost leaf is written
+// last, so the interrupted linking starts over on the next open.
+func (t *FBPTree) linkLeaves() error {
+	if t.metadata == nil || t.storage.pager.readOnly {
+		return nil
+	}
+
+	// the leaf is read past the cache, so opening does not fill it
+	data, err := t.storage.readNode(t.metadata.leftmostID)
+	if err != nil {
+		return fmt.Errorf("failed to read the leftmost leaf %d: %w", t.metadata.leftmostID, err)
+	}
+
+	if linkedLeaf(data) {
+		return nil
+	}
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	return t.endWrite(w, t.linkLeavesFrom(t.metadata.leftmostID))
+}
+
+func (t *FBPTree) linkLeavesFrom(leftmostID uint32) error {
+	// the leaves are written as they are linked, not buffered all at once
+	if err := t.storage.flushNodes(); err != nil {
+		return err
+	}
+
+	leftmost, err := t.storage.loadNodeByID(leftmostID)
+	if err != nil {
+		return fmt.Errorf("failed to load the leftmost leaf %d: %w", leftmostID, err)
+	}
+
+	for leaf := leftmost; leaf != nil; {
+		next, err := t.storage.nextLeaf(leaf)
+		if err != nil {
+			return err
+		}
+
+		if next != nil {
+			next.prevID = leaf.id
+			if err := t.storage.updateNodeByID(next.id, next); err != nil {
+				return fmt.Errorf("failed to update the leaf %d: %w", next.id, err)
+			}
+		}
+
+		leaf = next
+	}
+
+	if err := t.storage.updateNodeByID(leftmost.id, leftmost); err != nil {
+		return fmt.Errorf("failed to update the leftmost leaf %d: %w", leftmost.id, err)
+	}
+
+	return nil
+}
+
+// rightmostLeaf descends along the right edge of the tree.
+func (t *FBPTree) rightmostLeaf() (*node, error) {
+	current, err := t.storage.loadNodeByID(t.metadata.rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root node: %w", err)
+	}
+
+	for !current.leaf {
+		childID := current.pointers[current.keyNum].asNodeID()
+		current, err = t.storage.loadNodeByID(childID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load node %d: %w", childID, err)
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,196 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLeafLinks(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		key := encodeUint32(uint32(r.Intn(500)))
+		if r.Intn(3) == 0 {
+			if _, _, err := tree.Delete(key); err != nil {
+				t.Fatalf("failed to delete: %s", err)
+			}
+		} else if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	expectLinkedLeaves(t, tree)
+
+	if err := tree.Compact(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	expectLinkedLeaves(t, tree)
+
+	loaded, err := Open(path.Join(dbDir, "loaded.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer loaded.Close()
+
+	i := 0
+	err = loaded.BulkLoad(100, func() ([]byte, []byte, error) {
+		i++
+
+		return encodeUint32(uint32(i)), nil, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	expectLinkedLeaves(t, loaded)
+}
+
+func TestLinkLeavesOnOpen(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	// the leaves written before the links to the previous leaves were
+	// introduced keep the next leaf after the pointers
+	for leafID := tree.metadata.leftmostID; leafID != 0; {
+		leaf, err := tree.storage.loadNodeByID(leafID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf: %s", err)
+		}
+
+		if err := tree.storage.records.write(leafID, unlinkedLeaf(encodeNode(leaf))); err != nil {
+			t.Fatalf("failed to write the leaf: %s", err)
+		}
+		leafID = leaf.nextID()
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	readOnly, err := Open(dbPath, Order(3), ReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	leftmost, err := readOnly.storage.loadNodeByID(readOnly.metadata.leftmostID)
+	if err != nil {
+		t.Fatalf("failed to load the leaf: %s", err)
+	}
+	if next, err := readOnly.storage.nextLeaf(leftmost); err != nil || next.prevID != 0 {
+		t.Fatalf("expected the unlinked leaves, but got %v", err)
+	}
+	expectReverseOrder(t, readOnly, 50)
+	if err := readOnly.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	expectLinkedLeaves(t, tree)
+	expectReverseOrder(t, tree, 50)
+}
+
+// unlinkedLeaf converts the encoded leaf without the long keys into the
+// encoding without the links in the header.
+func unlinkedLeaf(data []byte) []byte {
+	unlinked := copyBytes(data[:9])
+	copy(unlinked[4:8], encodeUint32(0))
+	unlinked[8] &^= 8
+	unlinked = append(unlinked, data[13:]...)
+
+	if nextID := decodeUint32(data[9:13]); nextID != 0 {
+		unlinked = append(unlinked, 1)
+		unlinked = append(unlinked, encodeUint32(nextID)...)
+	} else {
+		unlinked = append(unlinked, 0, 0)
+	}
+
+	return unlinked
+}
+
+// expectLinkedLeaves expects the previous leaves to be linked
+// in the reverse order of the next leaves.
+func expectLinkedLeaves(t *testing.T, tree *FBPTree) {
+	t.Helper()
+
+	var leaves []uint32
+	for leafID := tree.metadata.leftmostID; leafID != 0; {
+		leaf, err := tree.storage.loadNodeByID(leafID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf: %s", err)
+		}
+
+		var expectedPrev uint32
+		if len(leaves) > 0 {
+			expectedPrev = leaves[len(leaves)-1]
+		}
+		if leaf.prevID != expectedPrev {
+			t.Fatalf("expected the leaf %d to link to the previous leaf %d, but got %d", leafID, expectedPrev, leaf.prevID)
+		}
+
+		leaves = append(leaves, leafID)
+		leafID = leaf.nextID()
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
+
+// expectReverseOrder expects ForEachReverse to visit the keys
+// from size-1 down to 0.
+func expectReverseOrder(t *testing.T, tree *FBPTree, size int) {
+	t.Helper()
+
+	expected := size - 1
+	err := tree.ForEachReverse(func(key, value []byte) {
+		if !bytes.Equal(key, encodeUint32(uint32(expected))) {
+			t.Fatalf("expected the key %d, but got %v", expected, key)
+		}
+		expected--
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if expected != -1 {
+		t.Fatalf("expected all the keys to be visited, %d left", expected+1)
+	}
+}
@@ -0,0 +1,410 @@
+package fbptree
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Load consumes the dump stream and bulk-builds the tree from it. The tree
+// must be empty and the dump must be made with the same key order. The tree
+// is built bottom-up: the leaves are packed evenly and every node is written
+// once. If the load fails, the tree stays empty, but the file may keep the
+// unreachable pages written for the partially built tree.
+func (t *FBPTree) Load(r io.Reader) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the failed load does not poison the tree, since the partially built
+	// tree is not reachable until the metadata is committed, see buildExpiring
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+
+	op := t.beginOperation()
+	err := t.load(r)
+	t.endOperation(op, OperationLoad, 0, 0, err)
+
+	return err
+}
+
+// BulkLoad bulk-builds the empty tree bottom-up from the given number of the
+// entries returned by next in ascending key order, the same way as Load
+// does. It is much faster than Put for the initial ingestion: the leaves are
+// packed evenly, written sequentially and every node is written once. The
+// next function must return exactly count entries and the keys must be
+// unique. If the load fails, the tree stays empty, as with Load.
+func (t *FBPTree) BulkLoad(count int, next func() ([]byte, []byte, error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+
+	op := t.beginOperation()
+	err := t.bulkLoad(count, next)
+	t.endOperation(op, OperationLoad, 0, 0, err)
+
+	return err
+}
+
+// Import puts all the entries of the dump stream into the tree, overwriting
+// the existing keys, so unlike Load it merges the dump into the tree that is
+// not empty and migrates the entries between the key orders. Into the empty
+// tree with the same key order the dump is bulk-loaded as with Load,
+// otherwise every entry is put as the separate write and the entries put
+// before the failure stay in the tree.
+func (t *FBPTree) Import(r io.Reader) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(r)
+	header, err := readDumpHeader(br)
+	if err != nil {
+		return err
+	}
+
+	next := func() ([]byte, []byte, error) {
+		return readDumpEntry(br, header.version)
+	}
+
+	if t.metadata == nil && header.Ordering == t.ordering {
+		op := t.beginOperation()
+		err := t.build(header.Count, next)
+		t.endOperation(op, OperationLoad, 0, 0, err)
+
+		return err
+	}
+
+	for i := 0; i < header.Count; i++ {
+		key, value, err := next()
+		if err != nil {
+			return fmt.Errorf("failed to read the entry %d: %w", i, err)
+		}
+
+		if _, _, err := t.runPut(key, value); err != nil {
+			return fmt.Errorf("failed to put the entry %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func (t *FBPTree) bulkLoad(count int, next func() ([]byte, []byte, error)) error {
+	if t.metadata != nil {
+		return fmt.Errorf("the tree must be empty, but has %d entries", t.metadata.size)
+	}
+
+	if count < 0 || count > maxTreeSize {
+		return fmt.Errorf("the number of the entries must be between 0 and %d", maxTreeSize)
+	}
+
+	return t.build(count, func() ([]byte, []byte, error) {
+		key, value, err := next()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if value == nil {
+			// the empty values are stored as the presence markers
+			value = []byte{}
+		}
+
+		if err := t.checkPut(key, value); err != nil {
+			return nil, nil, err
+		}
+
+		// the entries are kept until the leaf is written
+		return copyBytes(key), copyBytes(value), nil
+	})
+}
+
+func (t *FBPTree) load(r io.Reader) error {
+	if t.metadata != nil {
+		return fmt.Errorf("the tree must be empty, but has %d entries", t.metadata.size)
+	}
+
+	br := bufio.NewReader(r)
+	header, err := readDumpHeader(br)
+	if err != nil {
+		return err
+	}
+
+	if header.Ordering != t.ordering {
+		return fmt.Errorf("the dump was made with %s key order, but the tree has %s key order", orderingName(header.Ordering), orderingName(t.ordering))
+	}
+
+	return t.build(header.Count, func() ([]byte, []byte, error) {
+		return readDumpEntry(br, header.version)
+	})
+}
+
+// build bulk-builds the empty tree from the given number of the entries
+// returned by next in the key order.
+func (t *FBPTree) build(count int, next func() ([]byte, []byte, error)) error {
+	return t.buildExpiring(count, func() ([]byte, []byte, int64, error) {
+		key, value, err := next()
+
+		return key, value, 0, err
+	})
+}
+
+// buildExpiring bulk-builds the empty tree as build does from the entries
+// with the expiration times of their values.
+func (t *FBPTree) buildExpiring(count int, next func() ([]byte, []byte, int64, error)) error {
+	if count == 0 {
+		return nil
+	}
+
+	// the pages of the new tree are not reachable until the metadata is
+	// committed, so they are written in place and the large load does not
+	// have to fit in memory, while with the write-ahead log the changes of
+	// the free page lists and of the metadata are committed together
+	t.storage.beginInPlace()
+	if err := t.buildNodes(count, next); err != nil {
+		t.metadata = nil
+		if t.storage.deferring() {
+			if err := t.storage.rollback(); err != nil {
+				t.poisoned = err
+			}
+		}
+
+		return err
+	}
+
+	if err := t.storage.commit(); err != nil {
+		// the logged changes are applied on the next open or by Recover
+		t.storage.cache.clear()
+		t.poisoned = err
+
+		return fmt.Errorf("failed to commit the load: %w", err)
+	}
+
+	return nil
+}
+
+// buildNodes writes the nodes of the tree built from the entries
+// and the metadata that refers to them.
+func (t *FBPTree) buildNodes(count int, next func() ([]byte, []byte, int64, error)) error {
+	b, err := t.newBulkBuilder(count)
+	if err != nil {
+		return err
+	}
+
+	// without the free pages the pages are allocated one after another,
+	// so the leaves are clustered: every leaf follows the previous one,
+	// unless the size of the compressed leaf is not known in advance
+	clustered := len(t.storage.pager.isFreePage) == 0 && t.storage.records.codec == nil
+
+	leafID, err := t.storage.newNode()
+	if err != nil {
+		return fmt.Errorf("failed to instantiate new node: %w", err)
+	}
+	leftmostID := leafID
+
+	var prev []byte
+	var prevID uint32
+	for i, size := range b.leafSizes {
+		leaf := &node{
+			id:       leafID,
+			leaf:     true,
+			keys:     make([][]byte, t.order-1),
+			pointers: make([]*pointer, t.order),
+			prevID:   prevID,
+		}
+
+		for leaf.keyNum < size {
+			key, value, expiresAt, err := next()
+			if err != nil {
+				return fmt.Errorf("failed to read the entry: %w", err)
+			}
+
+			if prev != nil && !t.less(prev, key) {
+				return fmt.Errorf("the keys are not sorted or not unique")
+			}
+			prev = key
+
+			p, err := t.storage.newValue(value)
+			if err != nil {
+				return fmt.Errorf("failed to store the value: %w", err)
+			}
+			p.expiresAt = expiresAt
+			if p.isOverflow() || isLongKey(key) {
+				// the overflow and the key records break the sequence of the leaves
+				clustered = false
+			}
+
+			leaf.keys[leaf.keyNum] = key
+			leaf.pointers[leaf.keyNum] = p
+			leaf.keyNum++
+		}
+
+		b.attach(0, leaf.id, leaf.keys[0], leaf.size())
+
+		last := i+1 == len(b.leafSizes)
+		var nextID uint32
+		if !last {
+			leaf.setNext(&pointer{value: uint32(0)})
+			if clustered {
+				// the next leaf starts right after the last page of this one
+				nextID = leaf.id + uint32(t.storage.pageCount(leaf))
+			} else {
+				nextID, err = t.storage.newNode()
+				if err != nil {
+					return fmt.Errorf("failed to instantiate new node: %w", err)
+				}
+			}
+			leaf.setNext(&pointer{value: nextID})
+		}
+
+		if err := t.storage.updateNodeByID(leaf.id, leaf); err != nil {
+			return fmt.Errorf("failed to write the leaf %d: %w", leaf.id, err)
+		}
+
+		if !last && clustered {
+			allocatedID, err := t.storage.newNode()
+			if err != nil {
+				return fmt.Errorf("failed to instantiate new node: %w", err)
+			}
+
+			if allocatedID != nextID {
+				return fmt.Errorf("expected the next leaf at page %d, but got page %d", nextID, allocatedID)
+			}
+		}
+
+		prevID = leaf.id
+		leafID = nextID
+	}
+
+	b.count()
+	for _, level := range b.levels {
+		for _, n := range level {
+			if err := t.storage.updateNodeByID(n.id, n); err != nil {
+				return fmt.Errorf("failed to write the node %d: %w", n.id, err)
+			}
+		}
+	}
+
+	rootID := leftmostID
+	if len(b.levels) > 0 {
+		rootID = b.levels[len(b.levels)-1][0].id
+	}
+
+	if err := t.updateMetadata(rootID, leftmostID, uint32(count)); err != nil {
+		return fmt.Errorf("failed to update metadata: %w", err)
+	}
+
+	return nil
+}
+
+// bulkBuilder knows the whole shape of the tree for the given number of the
+// entries in advance, so the nodes can be written once.
+type bulkBuilder struct {
+	storage *storage
+
+	// the number of the keys in every leaf
+	leafSizes []int
+	// the internal nodes from the bottom level to the root
+	levels [][]*node
+	// the number of the children of every internal node by level
+	childCounts [][]int
+	// the position of the node being filled at every level
+	current []int
+}
+
+func (t *FBPTree) newBulkBuilder(count int) (*bulkBuilder, error) {
+	b := &bulkBuilder{storage: t.storage, leafSizes: evenSizes(count, t.order-1)}
+
+	for children := len(b.leafSizes); children > 1; {
+		counts := evenSizes(children, t.order)
+		b.childCounts = append(b.childCounts, counts)
+		children = len(counts)
+	}
+
+	// the internal nodes are allocated before the leaves,
+	// so they do not break the sequence of the leaves
+	for _, counts := range b.childCounts {
+		level := make([]*node, len(counts))
+		for i := range counts {
+			id, err := t.storage.newNode()
+			if err != nil {
+				return nil, fmt.Errorf("failed to instantiate new node: %w", err)
+			}
+
+			level[i] = &node{
+				id:       id,
+				keys:     make([][]byte, t.order-1),
+				pointers: make([]*pointer, t.order),
+			}
+		}
+
+		b.levels = append(b.levels, level)
+		b.current = append(b.current, 0)
+	}
+
+	return b, nil
+}
+
+// attach adds the child with the given smallest key of its subtree and
+// the given number of the keys in it to the node at the level.
+func (b *bulkBuilder) attach(level int, childID uint32, firstKey []byte, count uint32) {
+	if level >= len(b.levels) {
+		return
+	}
+
+	position := b.current[level]
+	n := b.levels[level][position]
+	if n.pointers[0] != nil && n.keyNum+1 == b.childCounts[level][position] {
+		b.current[level]++
+		position++
+		n = b.levels[level][position]
+	}
+
+	if n.pointers[0] == nil {
+		// the first child, the smallest key of the subtree is the separator
+		// in one of the ancestors
+		// the count of the keys of the node is known once it is filled
+		b.attach(level+1, n.id, firstKey, 0)
+		n.pointers[0] = &pointer{value: childID, count: count}
+
+		return
+	}
+
+	n.keys[n.keyNum] = firstKey
+	n.keyNum++
+	n.pointers[n.keyNum] = &pointer{value: childID, count: count}
+}
+
+// count sets the counts of the keys of the internal nodes in the pointers
+// of their parents, the children of every level are in the key order.
+func (b *bulkBuilder) count() {
+	for l := 1; l < len(b.levels); l++ {
+		child := 0
+		for _, n := range b.levels[l] {
+			for i := 0; i <= n.keyNum; i++ {
+				n.pointers[i].count = b.levels[l-1][child].size()
+				child++
+			}
+		}
+	}
+}
+
+// evenSizes splits the total number into the minimum number of the parts
+// not greater than the capacity with the sizes as equal as possible.
+func evenSizes(total, capacity int) []int {
+	parts := ceil(total, capacity)
+	sizes := make([]int, parts)
+	for i := range sizes {
+		sizes[i] = total / parts
+		if i < total%parts {
+			sizes[i]++
+		}
+	}
+
+	return sizes
+}
@@ -0,0 +1,343 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for _, order := range []int{3, 4, 5, 7} {
+		for _, size := range []int{1, 2, 3, 4, 7, 10, 31, 100, 257} {
+			source, err := Open(path.Join(dbDir, fmt.Sprintf("source-%d-%d.data", order, size)), Order(order))
+			if err != nil {
+				t.Fatalf("failed to open tree: %s", err)
+			}
+
+			for i := 0; i < size; i++ {
+				key := encodeUint32(uint32(i * 3))
+				if _, _, err := source.Put(key, key[2:]); err != nil {
+					t.Fatalf("failed to put key %d: %s", i, err)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := source.Dump(&buf); err != nil {
+				t.Fatalf("failed to dump: %s", err)
+			}
+
+			dbPath := path.Join(dbDir, fmt.Sprintf("target-%d-%d.data", order, size))
+			target, err := Open(dbPath, Order(order), DebugChecks())
+			if err != nil {
+				t.Fatalf("failed to open tree: %s", err)
+			}
+
+			if err := target.Load(&buf); err != nil {
+				t.Fatalf("failed to load order %d size %d: %s", order, size, err)
+			}
+
+			if target.Size() != size {
+				t.Fatalf("expected size %d, but got %d", size, target.Size())
+			}
+
+			if err := target.Close(); err != nil {
+				t.Fatalf("failed to close: %s", err)
+			}
+
+			target, err = Open(dbPath, Order(order), DebugChecks())
+			if err != nil {
+				t.Fatalf("failed to open tree: %s", err)
+			}
+
+			expected, actual := make([][]byte, 0), make([][]byte, 0)
+			source.ForEach(func(key, value []byte) {
+				expected = append(expected, key, value)
+			})
+			target.ForEach(func(key, value []byte) {
+				actual = append(actual, key, value)
+			})
+			if !reflect.DeepEqual(expected, actual) {
+				t.Fatalf("order %d size %d: expected %v, but got %v", order, size, expected, actual)
+			}
+
+			for i := 0; i < size; i++ {
+				key := encodeUint32(uint32(i * 3))
+				value, ok, err := target.Get(key)
+				if err != nil || !ok || !bytes.Equal(value, key[2:]) {
+					t.Fatalf("order %d size %d: failed to get key %d: %v, %s", order, size, i, ok, err)
+				}
+			}
+
+			// the loaded tree must stay balanced on changes
+			for i := 0; i < size; i++ {
+				key := encodeUint32(uint32(i*3 + 1))
+				if _, _, err := target.Put(key, key); err != nil {
+					t.Fatalf("order %d size %d: failed to put: %s", order, size, err)
+				}
+			}
+			for i := 0; i < size; i++ {
+				for _, key := range [][]byte{encodeUint32(uint32(i * 3)), encodeUint32(uint32(i*3 + 1))} {
+					if _, ok, err := target.Delete(key); err != nil || !ok {
+						t.Fatalf("order %d size %d: failed to delete key %v: %v, %s", order, size, key, ok, err)
+					}
+				}
+			}
+
+			if target.Size() != 0 {
+				t.Fatalf("expected the empty tree, but got size %d", target.Size())
+			}
+
+			source.Close()
+			target.Close()
+		}
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	unsorted := &bytes.Buffer{}
+	unsorted.Write(dumpMagic)
+	unsorted.Write(encodeUint16(dumpVersion))
+	unsorted.Write(encodeUint16(0))
+	unsorted.Write(encodeUint32(2))
+	writeDumpEntry(unsorted, []byte{2}, []byte{2})
+	writeDumpEntry(unsorted, []byte{1}, []byte{1})
+
+	if err := tree.Load(unsorted); err == nil {
+		t.Fatalf("expected the error for the unsorted dump")
+	}
+
+	if tree.Size() != 0 {
+		t.Fatalf("the tree must stay empty after the failed load")
+	}
+
+	collated, err := Open(path.Join(dbDir, "collated.data"), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer collated.Close()
+
+	var buf bytes.Buffer
+	if err := collated.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	if err := tree.Load(&buf); err == nil {
+		t.Fatalf("expected the error for the key order mismatch")
+	}
+
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	buf.Reset()
+	if err := tree.Dump(&buf); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	if err := tree.Load(&buf); err == nil {
+		t.Fatalf("expected the error for the non-empty tree")
+	}
+}
+
+func TestBulkLoad(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(5), DebugChecks())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	size, i := 1000, 0
+	next := func() ([]byte, []byte, error) {
+		if i == size {
+			return nil, nil, io.EOF
+		}
+
+		key := encodeUint32(uint32(i))
+		i++
+
+		return key, key[3:], nil
+	}
+
+	if err := tree.BulkLoad(size+1, next); err == nil {
+		t.Fatalf("expected an error for the missing entry")
+	}
+	if tree.Size() != 0 {
+		t.Fatalf("expected the empty tree after the failed load, but got %d", tree.Size())
+	}
+
+	i = 0
+	if err := tree.BulkLoad(size, next); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if err := tree.BulkLoad(size, next); err == nil {
+		t.Fatalf("expected an error for the non-empty tree")
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(5), DebugChecks())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.Size() != size {
+		t.Fatalf("expected size %d, but got %d", size, tree.Size())
+	}
+	if err := tree.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+
+	for i := 0; i < size; i++ {
+		key := encodeUint32(uint32(i))
+		if value, ok, err := tree.Get(key); err != nil || !ok || !bytes.Equal(value, key[3:]) {
+			t.Fatalf("expected the value of key %d, but got %v, %v, %v", i, value, ok, err)
+		}
+	}
+}
+
+func TestBulkLoadValidation(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	unsorted := [][]byte{{2}, {1}}
+	i := 0
+	err = tree.BulkLoad(len(unsorted), func() ([]byte, []byte, error) {
+		i++
+
+		return unsorted[i-1], nil, nil
+	})
+	if err == nil {
+		t.Fatalf("expected an error for the unsorted keys")
+	}
+
+	err = tree.BulkLoad(1, func() ([]byte, []byte, error) {
+		return make([]byte, maxKeySize+1), nil, nil
+	})
+	if err == nil {
+		t.Fatalf("expected an error for the large key")
+	}
+
+	if tree.Size() != 0 {
+		t.Fatalf("expected the empty tree, but got %d", tree.Size())
+	}
+}
+
+func TestImport(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	source, err := Open(path.Join(dbDir, "source.data"), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer source.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i * 2))
+		if _, _, err := source.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	var dump bytes.Buffer
+	if err := source.Dump(&dump); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	empty, err := Open(path.Join(dbDir, "empty.data"), Order(7), PageSize(8192))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer empty.Close()
+
+	if err := empty.Import(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("failed to import into the empty tree: %s", err)
+	}
+	if size := empty.Size(); size != 100 {
+		t.Fatalf("expected 100 entries, but got %d", size)
+	}
+
+	target, err := Open(path.Join(dbDir, "target.data"), Order(3), DebugChecks())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer target.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i*2 + 1))
+		if _, _, err := target.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if _, _, err := target.Put(encodeUint32(0), []byte("overwritten")); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	if err := target.Import(bytes.NewReader(dump.Bytes())); err != nil {
+		t.Fatalf("failed to import into the tree: %s", err)
+	}
+	if size := target.Size(); size != 200 {
+		t.Fatalf("expected 200 entries, but got %d", size)
+	}
+
+	for i := 0; i < 200; i++ {
+		key := encodeUint32(uint32(i))
+		value, ok, err := target.Get(key)
+		if err != nil || !ok || !bytes.Equal(value, key) {
+			t.Fatalf("unexpected value %v for key %d: %v", value, i, err)
+		}
+	}
+
+	if err := target.Import(bytes.NewReader(dump.Bytes()[:dump.Len()-1])); err == nil {
+		t.Fatalf("expected the error for the truncated dump")
+	}
+}
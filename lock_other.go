@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package fbptree
+
+import (
+	"os"
+)
+
+// lockFile does not lock the file on the platform.
+func lockFile(file *os.File, shared bool) error {
+	return nil
+}
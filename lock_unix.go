@@ -0,0 +1,28 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package fbptree
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes the advisory lock of the file, which is released when the
+// file is closed: the shared lock for the readers and the exclusive one for
+// the writer. It returns ErrLocked if the file is locked by the other open
+// tree, the writer excludes the readers and the other writers.
+func lockFile(file *os.File, shared bool) error {
+	how := syscall.LOCK_EX
+	if shared {
+		how = syscall.LOCK_SH
+	}
+
+	err := syscall.Flock(int(file.Fd()), how|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return ErrLocked
+	}
+
+	return err
+}
@@ -0,0 +1,78 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestErrLocked(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(3)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, but got %v", err)
+	}
+
+	// the writer excludes the readers
+	if _, err := Open(dbPath, Order(3), ReadOnly()); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for the reader, but got %v", err)
+	}
+
+	// the compacted file replaces the file locked
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if _, err := Open(dbPath, Order(3)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked after the compaction, but got %v", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	// the readers share the file, but exclude the writer
+	readers := make([]*FBPTree, 0)
+	for i := 0; i < 2; i++ {
+		reader, err := Open(dbPath, Order(3), ReadOnly())
+		if err != nil {
+			t.Fatalf("failed to open the read-only tree: %s", err)
+		}
+		readers = append(readers, reader)
+	}
+	if _, err := Open(dbPath, Order(3)); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked for the writer, but got %v", err)
+	}
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			t.Fatalf("failed to close the read-only tree: %s", err)
+		}
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open the unlocked tree: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+}
@@ -0,0 +1,70 @@
+package fbptree
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Logger receives the diagnostic messages of the tree.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// WithLogger option specifies the logger for the diagnostic messages. The
+// splits and the merges of the nodes, the compactions and the new free page
+// lists are logged at the debug level and the slow operations and the
+// iterators left open on close at the warning level.
+func WithLogger(logger Logger) func(*config) error {
+	return func(c *config) error {
+		if logger == nil {
+			return fmt.Errorf("logger must not be nil")
+		}
+
+		c.logger = logger
+
+		return nil
+	}
+}
+
+// SlowOpThreshold option reports the operations that took longer
+// than the threshold to the logger with the breakdown of pages read, pages
+// written, cache misses and fsyncs. The breakdown of the concurrent reads is
+// approximate, since it includes the pages of the other readers, see
+// OperationInfo. Requires WithLogger.
+func SlowOpThreshold(threshold time.Duration) func(*config) error {
+	return func(c *config) error {
+		if threshold <= 0 {
+			return fmt.Errorf("slow operation threshold must be > 0")
+		}
+
+		c.slowOpThreshold = threshold
+
+		return nil
+	}
+}
+
+// debugf logs the debug message if the logger is given.
+func debugf(logger Logger, format string, args ...interface{}) {
+	if logger != nil {
+		logger.Debugf(format, args...)
+	}
+}
+
+// StdLogger adapts the standard library logger to the Logger interface.
+func StdLogger(l *log.Logger) Logger {
+	return &stdLogger{l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s *stdLogger) Debugf(format string, args ...interface{}) {
+	s.l.Printf("DEBUG "+format, args...)
+}
+
+func (s *stdLogger) Warnf(format string, args ...interface{}) {
+	s.l.Printf("WARN "+format, args...)
+}
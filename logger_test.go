@@ -0,0 +1,58 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDebugLogging(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	logger := &recordingLogger{}
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), PageSize(64), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 200; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	for i := 0; i < 200; i += 2 {
+		if _, _, err := tree.Delete([]byte{byte(i)}); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+	if err := tree.Compact(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	for _, prefix := range []string{"split the node", "merged the node", "allocated the free page list", "compacted the file"} {
+		found := false
+		for _, message := range logger.debug {
+			if strings.HasPrefix(message, prefix) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Fatalf("expected the debug message starting with %q", prefix)
+		}
+	}
+
+	if len(logger.warn) != 0 {
+		t.Fatalf("expected no warnings, but got %v", logger.warn)
+	}
+}
@@ -0,0 +1,127 @@
+package fbptree
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// InMemory is the path that opens the tree in memory instead of the file,
+// e.g. for the unit tests without the temporary directories or for the
+// ephemeral cache. The tree is lost on Close. Every Open of InMemory
+// opens the new empty tree, the WriteAheadLog option is ignored.
+const InMemory = ":memory:"
+
+// ErrInMemory is returned by the operations that replace or reopen
+// the tree file, if the tree is in memory.
+var ErrInMemory = errors.New("the tree is in memory")
+
+// memoryFile is the file kept in memory.
+type memoryFile struct {
+	mu   sync.RWMutex
+	data []byte
+}
+
+func (f *memoryFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (f *memoryFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.resize(end)
+	}
+
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memoryFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.resize(size)
+
+	return nil
+}
+
+// resize changes the size of the data, the new bytes are zeros.
+func (f *memoryFile) resize(size int64) {
+	if size <= int64(cap(f.data)) {
+		previous := len(f.data)
+		f.data = f.data[:size]
+		if int(size) > previous {
+			reset(f.data[previous:])
+		}
+
+		return
+	}
+
+	data := make([]byte, size, 2*size)
+	copy(data, f.data)
+	f.data = data
+}
+
+func (f *memoryFile) Sync() error {
+	return nil
+}
+
+func (f *memoryFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data = nil
+
+	return nil
+}
+
+func (f *memoryFile) Stat() (fs.FileInfo, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return memoryFileInfo{int64(len(f.data))}, nil
+}
+
+// memoryFileInfo describes the file kept in memory.
+type memoryFileInfo struct {
+	size int64
+}
+
+func (i memoryFileInfo) Name() string {
+	return InMemory
+}
+
+func (i memoryFileInfo) Size() int64 {
+	return i.size
+}
+
+func (i memoryFileInfo) Mode() fs.FileMode {
+	return 0600
+}
+
+func (i memoryFileInfo) ModTime() time.Time {
+	return time.Time{}
+}
+
+func (i memoryFileInfo) IsDir() bool {
+	return false
+}
+
+func (i memoryFileInfo) Sys() interface{} {
+	return nil
+}
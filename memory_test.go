@@ -0,0 +1,87 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestInMemory(t *testing.T) {
+	tree, err := Open(InMemory, Order(3), PageSize(128), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	other, err := Open(InMemory)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer other.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, bytes.Repeat(key, 10)); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 1000; i += 2 {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := encodeUint32(uint32(i))
+		value, ok, err := tree.Get(key)
+		if err != nil {
+			t.Fatalf("failed to get key %d: %s", i, err)
+		}
+		if ok != (i%2 == 1) || (ok && !bytes.Equal(value, bytes.Repeat(key, 10))) {
+			t.Fatalf("unexpected value %v for key %d", value, i)
+		}
+	}
+
+	if size := other.Size(); size != 0 {
+		t.Fatalf("expected the other tree to be empty, but got %d entries", size)
+	}
+	if _, err := os.Stat(InMemory + walSuffix); !os.IsNotExist(err) {
+		t.Fatalf("expected no log file, but got %v", err)
+	}
+
+	if err := tree.Compact(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if err := tree.CompactRewrite(); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("expected ErrInMemory, but got %v", err)
+	}
+	if _, err := tree.Snapshot(); !errors.Is(err, ErrInMemory) {
+		t.Fatalf("expected ErrInMemory, but got %v", err)
+	}
+
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	if err := tree.CloneTo(dbPath); err != nil {
+		t.Fatalf("failed to clone: %s", err)
+	}
+
+	saved, err := Open(dbPath, Order(3), PageSize(128))
+	if err != nil {
+		t.Fatalf("failed to open the clone: %s", err)
+	}
+	defer saved.Close()
+
+	if size := saved.Size(); size != 500 {
+		t.Fatalf("expected 500 entries, but got %d", size)
+	}
+}
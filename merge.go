@@ -0,0 +1,89 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Merge atomically replaces the value of the key with the result of the
+// merge function called with the current value and returns the new value.
+// The current value is nil if the key does not exist, the nil result is
+// stored as the empty value, as with Put. The value is read and written
+// within a single descent, so the counters and the append-style values
+// are updated without Get and Put round trips. The merge function is
+// called under the lock of the tree and must not use the tree.
+func (t *FBPTree) Merge(key []byte, merge func(old []byte) []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if merge == nil {
+		return nil, fmt.Errorf("merge function must not be nil")
+	}
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	op := t.beginOperation()
+	value, err := t.merge(key, merge)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationMerge, len(key), len(value), err)
+
+	return value, err
+}
+
+func (t *FBPTree) merge(key []byte, merge func(old []byte) []byte) ([]byte, error) {
+	if err := t.checkPut(key, nil); err != nil {
+		return nil, err
+	}
+
+	if t.metadata == nil {
+		value := mergedValue(merge(nil))
+		if err := t.checkPut(key, value); err != nil {
+			return nil, err
+		}
+
+		if err := t.initializeRoot(key, value); err != nil {
+			return nil, fmt.Errorf("failed to initialize root: %w", err)
+		}
+
+		return value, nil
+	}
+
+	leaf, err := t.descend(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	var old []byte
+	if position := leaf.livePosition(key, t.compare); position != -1 {
+		current, err := t.storage.readValue(leaf.pointers[position])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the value: %w", err)
+		}
+
+		// the merge function must not change the value kept in the node
+		old = copyBytes(current)
+	}
+
+	value := mergedValue(merge(old))
+	if err := t.checkPut(key, value); err != nil {
+		return nil, err
+	}
+
+	if _, _, err := t.putIntoLeaf(leaf, key, value); err != nil {
+		return nil, fmt.Errorf("failed to put into the leaf %d: %w", leaf.id, err)
+	}
+
+	return value, nil
+}
+
+// mergedValue returns the result of the merge function to store.
+func mergedValue(value []byte) []byte {
+	if value == nil {
+		// the empty values are stored as the presence markers
+		return []byte{}
+	}
+
+	return value
+}
@@ -0,0 +1,70 @@
+package fbptree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	tree, err := Open(InMemory, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	appendByte := func(b byte) func(old []byte) []byte {
+		return func(old []byte) []byte {
+			return append(old, b)
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		for key := 0; key < 20; key++ {
+			value, err := tree.Merge([]byte{byte(key)}, appendByte(byte(i)))
+			if err != nil {
+				t.Fatalf("failed to merge: %s", err)
+			}
+			if len(value) != i+1 {
+				t.Fatalf("expected the value of size %d, but got %v", i+1, value)
+			}
+		}
+	}
+
+	for key := 0; key < 20; key++ {
+		value, ok, err := tree.Get([]byte{byte(key)})
+		if err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+		if !ok || !bytes.Equal(value, []byte{0, 1, 2}) {
+			t.Fatalf("unexpected value %v for key %d", value, key)
+		}
+	}
+
+	var old []byte
+	value, err := tree.Merge([]byte{0}, func(v []byte) []byte {
+		old = v
+		v[0] = 9
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	if value == nil || len(value) != 0 {
+		t.Fatalf("expected the empty value, but got %v", value)
+	}
+	if !bytes.Equal(old, []byte{9, 1, 2}) {
+		t.Fatalf("unexpected old value %v", old)
+	}
+
+	if _, err := tree.Merge(make([]byte, maxKeySize+1), appendByte(0)); err == nil {
+		t.Fatalf("expected the error for the key larger than %d bytes", maxKeySize)
+	}
+	if _, err := tree.Merge([]byte{0}, nil); err == nil {
+		t.Fatalf("expected the error for the nil merge function")
+	}
+
+	if size := tree.Size(); size != 20 {
+		t.Fatalf("expected size 20, but got %d", size)
+	}
+}
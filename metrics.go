@@ -0,0 +1,102 @@
+package fbptree
+
+import (
+	"expvar"
+	"fmt"
+)
+
+// Metrics receives the events of the tree, e.g. to export them to
+// Prometheus or expvar. The methods are called synchronously by the
+// concurrent readers and the writer, so they must be safe for the
+// concurrent use and fast.
+type Metrics interface {
+	// PageRead is called after the page or the metadata block is read.
+	PageRead()
+	// PageWritten is called after the page or the metadata block is written.
+	PageWritten()
+	// Synced is called when the file is synced.
+	Synced()
+	// CacheHit is called when the node is found in the cache.
+	CacheHit()
+	// CacheMiss is called when the node is not found in the cache
+	// and is read from the file.
+	CacheMiss()
+	// Split is called after the node is split.
+	Split()
+	// Merge is called after the node is merged with its sibling.
+	Merge()
+}
+
+// WithMetrics option specifies the receiver of the events of the tree.
+func WithMetrics(metrics Metrics) func(*config) error {
+	return func(c *config) error {
+		if metrics == nil {
+			return fmt.Errorf("metrics must not be nil")
+		}
+
+		c.metrics = metrics
+
+		return nil
+	}
+}
+
+// ExpvarMetrics returns the metrics that count the events in the map,
+// e.g. published with expvar.NewMap, under the names "page_reads",
+// "page_writes", "syncs", "cache_hits", "cache_misses", "splits"
+// and "merges".
+func ExpvarMetrics(m *expvar.Map) Metrics {
+	return expvarMetrics{m}
+}
+
+type expvarMetrics struct {
+	m *expvar.Map
+}
+
+func (e expvarMetrics) PageRead() {
+	e.m.Add("page_reads", 1)
+}
+
+func (e expvarMetrics) PageWritten() {
+	e.m.Add("page_writes", 1)
+}
+
+func (e expvarMetrics) Synced() {
+	e.m.Add("syncs", 1)
+}
+
+func (e expvarMetrics) CacheHit() {
+	e.m.Add("cache_hits", 1)
+}
+
+func (e expvarMetrics) CacheMiss() {
+	e.m.Add("cache_misses", 1)
+}
+
+func (e expvarMetrics) Split() {
+	e.m.Add("splits", 1)
+}
+
+func (e expvarMetrics) Merge() {
+	e.m.Add("merges", 1)
+}
+
+// split counts the split of the left node that moved the half of the keys
+// into the new right node.
+func (s *storage) split(leftID, rightID uint32) {
+	s.lifetime.Splits++
+	debugf(s.logger, "split the node %d into the new node %d", leftID, rightID)
+
+	if s.metrics != nil {
+		s.metrics.Split()
+	}
+}
+
+// merge counts the merge of the right node into the left node.
+func (s *storage) merge(leftID, rightID uint32) {
+	s.lifetime.Merges++
+	debugf(s.logger, "merged the node %d into the node %d", rightID, leftID)
+
+	if s.metrics != nil {
+		s.metrics.Merge()
+	}
+}
@@ -0,0 +1,99 @@
+package fbptree
+
+import (
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+)
+
+type countingMetrics struct {
+	reads, writes, syncs, hits, misses, splits, merges uint64
+}
+
+func (m *countingMetrics) PageRead()    { atomic.AddUint64(&m.reads, 1) }
+func (m *countingMetrics) PageWritten() { atomic.AddUint64(&m.writes, 1) }
+func (m *countingMetrics) Synced()      { atomic.AddUint64(&m.syncs, 1) }
+func (m *countingMetrics) CacheHit()    { atomic.AddUint64(&m.hits, 1) }
+func (m *countingMetrics) CacheMiss()   { atomic.AddUint64(&m.misses, 1) }
+func (m *countingMetrics) Split()       { atomic.AddUint64(&m.splits, 1) }
+func (m *countingMetrics) Merge()       { atomic.AddUint64(&m.merges, 1) }
+
+func TestMetrics(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	metrics := &countingMetrics{}
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), WithMetrics(metrics))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Delete([]byte{byte(i)}); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+
+	stats := tree.Stats()
+	if metrics.splits != stats.Splits {
+		t.Fatalf("expected %d splits, but got %d", stats.Splits, metrics.splits)
+	}
+	if metrics.merges != stats.Merges {
+		t.Fatalf("expected %d merges, but got %d", stats.Merges, metrics.merges)
+	}
+	if metrics.splits == 0 || metrics.merges == 0 {
+		t.Fatalf("expected splits and merges, but got %d and %d", metrics.splits, metrics.merges)
+	}
+
+	treeStats, err := tree.TreeStats()
+	if err != nil {
+		t.Fatalf("failed to get tree stats: %s", err)
+	}
+	if metrics.hits != treeStats.CacheHits || metrics.misses != treeStats.CacheMisses {
+		t.Fatalf("expected %d hits and %d misses, but got %d and %d", treeStats.CacheHits, treeStats.CacheMisses, metrics.hits, metrics.misses)
+	}
+	if metrics.reads == 0 || metrics.writes == 0 || metrics.syncs == 0 {
+		t.Fatalf("expected reads, writes and syncs, but got %d, %d and %d", metrics.reads, metrics.writes, metrics.syncs)
+	}
+
+	if _, err := newConfig([]func(*config) error{WithMetrics(nil)}); err == nil {
+		t.Fatalf("expected the error for the nil metrics")
+	}
+}
+
+func TestExpvarMetrics(t *testing.T) {
+	m := new(expvar.Map).Init()
+	tree, err := Open(InMemory, Order(3), WithMetrics(ExpvarMetrics(m)))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	splits, ok := m.Get("splits").(*expvar.Int)
+	if !ok || uint64(splits.Value()) != tree.Stats().Splits {
+		t.Fatalf("expected %d splits in the map, but got %v", tree.Stats().Splits, m.Get("splits"))
+	}
+	if m.Get("page_writes") == nil {
+		t.Fatalf("expected the page writes in the map")
+	}
+}
@@ -0,0 +1,74 @@
+package fbptree
+
+import (
+	"fmt"
+	"os"
+)
+
+// Migrate rewrites the tree file by the path with the new options that can
+// not be changed for the existing file, e.g. the order, the page size, the
+// compression or the maximum node size. The entries are streamed from the
+// tree into the new file, as with CompactRewrite, which replaces the original
+// file once it is complete, so the failed migration leaves the original file
+// as it was. The options of the file are kept unless the given options change
+// them, but the key order can not be changed, since the entries are streamed
+// in it. The progress callback, if given, is called after every rewritten
+// entry.
+func Migrate(path string, progress func(done, total int), options ...func(*config) error) error {
+	if path == InMemory {
+		return ErrInMemory
+	}
+
+	detected, err := detectOptions(path)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := newConfig(append(detected, options...))
+	if err != nil {
+		return fmt.Errorf("failed to apply the options: %w", err)
+	}
+
+	tree, err := Open(path, detected...)
+	if err != nil {
+		return fmt.Errorf("failed to open the tree: %w", err)
+	}
+
+	if cfg.ordering != tree.ordering {
+		tree.Close()
+
+		return fmt.Errorf("the key order can not be migrated from %s to %s", orderingName(tree.ordering), orderingName(cfg.ordering))
+	}
+
+	dir, tmpPath, err := tempFileFor(path)
+	if err != nil {
+		tree.Close()
+
+		return err
+	}
+
+	if err := tree.rewriteTo(tmpPath, cfg, progress); err != nil {
+		tree.Close()
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to rewrite the tree: %w", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to close the tree: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to replace the file: %w", err)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync the directory %s: %w", dir, err)
+	}
+
+	return nil
+}
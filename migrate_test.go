@@ -0,0 +1,120 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(5), PageSize(128), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for _, c := range treeCases {
+		key := []byte(fmt.Sprintf("key %03d", c.key))
+		if _, _, err := tree.Put(key, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+	if err := tree.SetUserMetadata([]byte("user")); err != nil {
+		t.Fatalf("failed to set the user metadata: %s", err)
+	}
+
+	expected := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		expected = append(expected, key, value)
+	})
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	calls := 0
+	err = Migrate(dbPath, func(done, total int) {
+		calls++
+	}, Order(50), PageSize(4096), Compression(FlateCodec()))
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if calls != len(treeCases) {
+		t.Fatalf("expected the progress for every entry, but got %d calls", calls)
+	}
+
+	if _, err := Open(dbPath, Order(5), PageSize(128), Collation("en")); err == nil {
+		t.Fatalf("expected the error for the old order")
+	}
+
+	tree, err = Open(dbPath, Order(50), PageSize(4096), Collation("en"), Compression(FlateCodec()))
+	if err != nil {
+		t.Fatalf("failed to open the migrated tree: %s", err)
+	}
+	defer tree.Close()
+
+	actual := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		actual = append(actual, key, value)
+	})
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected the migrated entries to be the same")
+	}
+
+	if metadata := tree.GetUserMetadata(); string(metadata) != "user" {
+		t.Fatalf("expected the user metadata to be migrated, but got %q", metadata)
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
+
+func TestMigrateKeepsKeyOrder(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(5))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if err := Migrate(dbPath, nil, Collation("en")); err == nil {
+		t.Fatalf("expected the error for the changed key order")
+	}
+
+	tree, err = Open(dbPath, Order(5))
+	if err != nil {
+		t.Fatalf("failed to open the original tree: %s", err)
+	}
+	defer tree.Close()
+
+	if value, ok, err := tree.Get([]byte{1}); err != nil || !ok || value[0] != 1 {
+		t.Fatalf("expected the original tree to be kept: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/krasun/fbptree/fbptreetest"
+)
+
+// modelTree is the tree checked by fbptreetest, it verifies the invariants
+// of the tree and that the random range is scanned as it is iterated.
+type modelTree struct {
+	*FBPTree
+	r *rand.Rand
+}
+
+func (t *modelTree) Verify() error {
+	keys := make([][]byte, 0)
+	err := t.ForEach(func(key, value []byte) {
+		keys = append(keys, copyBytes(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate: %w", err)
+	}
+
+	if len(keys) > 0 {
+		from, to := t.r.Intn(len(keys)), t.r.Intn(len(keys))
+		if from > to {
+			from, to = to, from
+		}
+
+		it, err := t.Scan(keys[from], keys[to])
+		if err != nil {
+			return fmt.Errorf("failed to scan: %w", err)
+		}
+		defer it.Close()
+
+		for i := from; i < to; i++ {
+			if !it.HasNext() {
+				return fmt.Errorf("the scan ends at position %d, but expected %d", i, to)
+			}
+
+			key, _, err := it.Next()
+			if err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+			if string(key) != string(keys[i]) {
+				return fmt.Errorf("scanned %x at position %d, but expected %x", key, i, keys[i])
+			}
+		}
+		if it.HasNext() {
+			return fmt.Errorf("the scan does not end at position %d", to)
+		}
+	}
+
+	report, err := t.Check()
+	if err != nil {
+		return fmt.Errorf("failed to check tree: %w", err)
+	}
+	if !report.OK() {
+		return fmt.Errorf("the tree is inconsistent: %v", report.Problems)
+	}
+
+	return nil
+}
+
+func TestModelRandomized(t *testing.T) {
+	seed := time.Now().UnixNano()
+	t.Logf("seed %d", seed)
+
+	operations := 3000
+	if testing.Short() {
+		operations = 300
+	}
+
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	open := func(path string, config fbptreetest.Config) (fbptreetest.Tree, error) {
+		tree, err := Open(path, Order(config.Order), PageSize(config.PageSize))
+		if err != nil {
+			return nil, err
+		}
+
+		return &modelTree{tree, rand.New(rand.NewSource(seed))}, nil
+	}
+
+	ops := func(config fbptreetest.Config) []fbptreetest.Op {
+		g := fbptreetest.NewGenerator(seed + int64(config.Order*config.PageSize))
+		// the small key space makes the keys repeat, so the puts override
+		// the values and the deletes find the keys
+		g.KeySpace = 50 + g.Rand.Intn(250)
+		g.MaxValueSize = 40
+		// some of the values span several pages and the tails
+		// of some of the keys are stored in the separate records
+		g.LargeValueRate = 0.1
+		g.MaxLargeValueSize = 5500
+		g.LongKeyEvery = 17
+		g.LongKeySize = 300
+		g.ReopenRate = 0.02
+		g.CrashRate = 0.005
+		g.IterateRate = 0.03
+
+		return g.Ops(operations)
+	}
+
+	configs := fbptreetest.Configs([]int{3, 4, 5, 8, 32}, []int{64, 512, 4096})
+	if err := fbptreetest.CheckConfigs(dbDir, open, configs, ops); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,173 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// MaxNodeSize option splits the node once its encoded size exceeds the given
+// size in bytes, e.g. the page size, even if it has fewer keys than the order
+// allows, so the few large keys or values do not make the node span many
+// pages. The order still limits the number of the keys, so the large order
+// lets the nodes of the small entries fill the size. The nodes split by the
+// size may have fewer keys than the half of the order, and the nodes merged
+// by the deletes may exceed the size until the next put splits them. The
+// size is recorded in the file, so the tree must be opened with the same
+// option.
+func MaxNodeSize(size int) func(*config) error {
+	return func(c *config) error {
+		if size < minPageSize {
+			return fmt.Errorf("maximum node size must be greater than or equal to %d", minPageSize)
+		}
+
+		c.maxNodeSize = uint32(size)
+
+		return nil
+	}
+}
+
+// oversized returns true if the node exceeds the maximum node size and can
+// be split. The size is the one encoded by the last update of the node, so
+// the node must be updated before.
+func (t *FBPTree) oversized(n *node) bool {
+	if t.maxNodeSize == 0 {
+		return false
+	}
+
+	// the internal node keeps at least one key on each side
+	// of the key that moves to the parent
+	minKeyNum := 2
+	if !n.leaf {
+		minKeyNum = 3
+	}
+	if n.keyNum < minKeyNum {
+		return false
+	}
+
+	return recordHeaderSize+n.encoded > int(t.maxNodeSize)
+}
+
+// splitBySize splits the oversized node into two nodes of about the same
+// encoded size and puts them into the parent. The given node becomes the
+// left node. The middle key of the internal node moves to the parent.
+func (t *FBPTree) splitBySize(n *node) error {
+	var parent *node
+	if parentID := t.parentOf(n); parentID != 0 {
+		p, err := t.storage.loadNodeByID(parentID)
+		if err != nil {
+			return fmt.Errorf("failed to load parent node %d: %w", parentID, err)
+		}
+
+		parent = p
+	}
+
+	newNodeID, err := t.storage.newNode()
+	if err != nil {
+		return fmt.Errorf("failed to instantiate new node: %w", err)
+	}
+
+	right := &node{
+		id:       newNodeID,
+		leaf:     n.leaf,
+		keys:     make([][]byte, t.order-1),
+		pointers: make([]*pointer, t.order),
+	}
+
+	splitPos := n.sizeMiddle()
+	left := n
+	var middleKey []byte
+	if n.leaf {
+		copy(right.keys, n.keys[splitPos:n.keyNum])
+		copy(right.pointers, n.pointers[splitPos:n.keyNum])
+		right.keyNum = n.keyNum - splitPos
+		right.setNext(n.next())
+		right.prevID = n.id
+
+		for i := splitPos; i < left.keyNum; i++ {
+			left.keys[i] = nil
+			left.pointers[i] = nil
+		}
+		left.keyNum = splitPos
+		left.setNext(&pointer{value: right.id})
+		middleKey = right.keys[0]
+	} else {
+		middleKey = n.keys[splitPos]
+		copy(right.keys, n.keys[splitPos+1:n.keyNum])
+		copy(right.pointers, n.pointers[splitPos+1:n.keyNum+1])
+		right.keyNum = n.keyNum - splitPos - 1
+
+		for i := splitPos; i < left.keyNum; i++ {
+			left.keys[i] = nil
+			left.pointers[i+1] = nil
+		}
+		left.keyNum = splitPos
+
+		for i := 0; i <= right.keyNum; i++ {
+			t.parents[right.pointers[i].asNodeID()] = right.id
+		}
+	}
+
+	if err := t.storage.updateNodeByID(right.id, right); err != nil {
+		return fmt.Errorf("failed to update the right node %d: %w", right.id, err)
+	}
+
+	if err := t.storage.updateNodeByID(left.id, left); err != nil {
+		return fmt.Errorf("failed to update the left node %d: %w", left.id, err)
+	}
+	t.storage.split(left.id, right.id)
+
+	if right.leaf {
+		if err := t.storage.linkNext(right); err != nil {
+			return err
+		}
+	}
+
+	return t.putIntoParents(parent, middleKey, left, right)
+}
+
+// sizeMiddle returns the position of the first key of the right half of the
+// leaf or of the key of the internal node that moves to the parent, so both
+// halves have about the same encoded size.
+func (n *node) sizeMiddle() int {
+	sizes := make([]int, n.keyNum)
+	total := 0
+	for i := 0; i < n.keyNum; i++ {
+		if n.leaf {
+			sizes[i] = 2 + len(n.keys[i]) + pointerSize(n.pointers[i])
+		} else {
+			// the node identifier and the count of the keys in the subtree
+			sizes[i] = 2 + len(n.keys[i]) + 1 + 4 + 4
+		}
+		total += sizes[i]
+	}
+
+	// the right half of the internal node keeps at least one key
+	last := n.keyNum - 1
+	if !n.leaf {
+		last--
+	}
+
+	left := sizes[0]
+	position := 1
+	for position < last && left+sizes[position] <= total-left-sizes[position] {
+		left += sizes[position]
+		position++
+	}
+
+	return position
+}
+
+// pointerSize returns the encoded size of the leaf pointer.
+func pointerSize(p *pointer) int {
+	size := 1
+	if p.expiresAt != 0 {
+		size += 1 + 8
+	}
+
+	if p.isOverflow() {
+		size += 4 + 4
+	} else if value := p.asValue(); len(value) > 0 {
+		size += 2 + len(value)
+	}
+
+	return size
+}
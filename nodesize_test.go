@@ -0,0 +1,213 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestMaxNodeSize(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(100), PageSize(4096), MaxNodeSize(4096))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	// a few large keys among the small ones
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[string][]byte)
+	put := func(i int) {
+		key := []byte(fmt.Sprintf("key-%06d", r.Intn(1000)))
+		if i%50 == 0 {
+			key = append(key, bytes.Repeat([]byte{'k'}, 3000)...)
+		}
+
+		value := bytes.Repeat([]byte{byte(i)}, r.Intn(200))
+		if _, _, err := tree.Put(key, value); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+		expected[string(key)] = value
+	}
+
+	for i := 0; i < 1000; i++ {
+		put(i)
+	}
+
+	for nodeID := tree.metadata.leftmostID; nodeID != 0; {
+		leaf, err := tree.storage.loadNodeByID(nodeID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf %d: %s", nodeID, err)
+		}
+
+		leaf.encoded = len(encodeNode(leaf))
+		if tree.oversized(leaf) {
+			t.Fatalf("expected the leaf %d to be split by size", nodeID)
+		}
+
+		nodeID = 0
+		if next := leaf.next(); next != nil {
+			nodeID = next.asNodeID()
+		}
+	}
+
+	// the merges of the leaves split by size
+	for i := 1000; i < 3000; i++ {
+		if r.Intn(2) == 0 {
+			put(i)
+
+			continue
+		}
+
+		key := []byte(fmt.Sprintf("key-%06d", r.Intn(1000)))
+		if _, _, err := tree.Delete(key); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+		delete(expected, string(key))
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected no problems, but got %v", report.Problems)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	if _, err := Open(dbPath, Order(100), PageSize(4096)); err == nil {
+		t.Fatalf("expected the error for the tree opened without the maximum node size")
+	}
+
+	tree, err = Open(dbPath, Order(100), PageSize(4096), MaxNodeSize(4096))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if size := tree.Size(); size != len(expected) {
+		t.Fatalf("expected size %d, but got %d", len(expected), size)
+	}
+
+	for key, value := range expected {
+		actual, ok, err := tree.Get([]byte(key))
+		if err != nil || !ok || !bytes.Equal(actual, value) {
+			t.Fatalf("unexpected value for key %q: %v", key[:10], err)
+		}
+	}
+
+	for key := range expected {
+		if _, ok, err := tree.Delete([]byte(key)); err != nil || !ok {
+			t.Fatalf("failed to delete key %q: %v", key[:10], err)
+		}
+	}
+
+	if size := tree.Size(); size != 0 {
+		t.Fatalf("expected the empty tree, but got size %d", size)
+	}
+}
+
+func TestMaxNodeSizeSplitsInternalNodes(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(50), PageSize(1024), MaxNodeSize(1024))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	// the long keys make the internal nodes exceed the size
+	// long before they have as many keys as the order allows
+	r := rand.New(rand.NewSource(1))
+	keys := make([][]byte, 0)
+	for i := 0; i < 500; i++ {
+		key := append([]byte(fmt.Sprintf("key-%06d-", r.Intn(100000))), bytes.Repeat([]byte{'k'}, 200)...)
+		if _, _, err := tree.Put(key, []byte{1}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+		keys = append(keys, key)
+	}
+
+	internal := 0
+	level := []uint32{tree.metadata.rootID}
+	for len(level) > 0 {
+		var next []uint32
+		for _, nodeID := range level {
+			n, err := tree.storage.loadNodeByID(nodeID)
+			if err != nil {
+				t.Fatalf("failed to load the node %d: %s", nodeID, err)
+			}
+
+			n.encoded = len(encodeNode(n))
+			if tree.oversized(n) {
+				t.Fatalf("expected the node %d to be split by size", nodeID)
+			}
+
+			if !n.leaf {
+				internal++
+				for i := 0; i <= n.keyNum; i++ {
+					next = append(next, n.pointers[i].asNodeID())
+				}
+			}
+		}
+		level = next
+	}
+	if internal < 3 {
+		t.Fatalf("expected the internal nodes to be split by size, but got %d internal nodes", internal)
+	}
+
+	for _, key := range keys {
+		if _, ok, err := tree.Get(key); err != nil || !ok {
+			t.Fatalf("failed to get the key %q: %v", key[:10], err)
+		}
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected no problems, but got %v", report.Problems)
+	}
+}
+
+func TestSizeMiddle(t *testing.T) {
+	n := &node{leaf: true, keys: make([][]byte, 3), pointers: make([]*pointer, 4), keyNum: 3}
+	n.keys[0], n.keys[1], n.keys[2] = []byte{1}, bytes.Repeat([]byte{2}, 100), []byte{3}
+	for i := 0; i < 3; i++ {
+		n.pointers[i] = &pointer{value: []byte{}}
+	}
+
+	if position := n.sizeMiddle(); position != 1 {
+		t.Fatalf("expected the large key to start the right half, but got position %d", position)
+	}
+
+	n.keys[0], n.keys[1] = bytes.Repeat([]byte{1}, 100), []byte{2}
+	if position := n.sizeMiddle(); position != 1 {
+		t.Fatalf("expected the large key to stay in the left half, but got position %d", position)
+	}
+}
+
+func TestMaxNodeSizeErrors(t *testing.T) {
+	if _, err := newConfig([]func(*config) error{MaxNodeSize(0)}); err == nil {
+		t.Fatalf("expected the error for the zero maximum node size")
+	}
+}
@@ -0,0 +1,264 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/fs"
+	"sync/atomic"
+	"time"
+)
+
+// OperationType is the type of the public tree operation.
+type OperationType int
+
+const (
+	// OperationGet is Get.
+	OperationGet OperationType = iota
+	// OperationPut is Put.
+	OperationPut
+	// OperationDelete is Delete.
+	OperationDelete
+	// OperationForEach is ForEach.
+	OperationForEach
+	// OperationIncrement is Increment.
+	OperationIncrement
+	// OperationAppend is Append.
+	OperationAppend
+	// OperationWriteAt is WriteAt.
+	OperationWriteAt
+	// OperationDeleteMany is DeleteMany.
+	OperationDeleteMany
+	// OperationForEachReverse is ForEachReverse.
+	OperationForEachReverse
+	// OperationDump is Dump.
+	OperationDump
+	// OperationLoad is Load.
+	OperationLoad
+	// OperationCompareAndPut is CompareAndPut.
+	OperationCompareAndPut
+	// OperationMerge is Merge.
+	OperationMerge
+	// OperationGetMany is GetMany.
+	OperationGetMany
+)
+
+func (o OperationType) String() string {
+	switch o {
+	case OperationGet:
+		return "get"
+	case OperationPut:
+		return "put"
+	case OperationDelete:
+		return "delete"
+	case OperationForEach:
+		return "foreach"
+	case OperationIncrement:
+		return "increment"
+	case OperationAppend:
+		return "append"
+	case OperationWriteAt:
+		return "writeat"
+	case OperationDeleteMany:
+		return "deletemany"
+	case OperationForEachReverse:
+		return "foreachreverse"
+	case OperationDump:
+		return "dump"
+	case OperationLoad:
+		return "load"
+	case OperationCompareAndPut:
+		return "compareandput"
+	case OperationMerge:
+		return "merge"
+	case OperationGetMany:
+		return "getmany"
+	}
+
+	return fmt.Sprintf("operation(%d)", int(o))
+}
+
+// OperationInfo describes the completed public operation.
+type OperationInfo struct {
+	Type OperationType
+	// KeySize is the size of the key, 0 for the operations without a key
+	// and the total size of the keys for the bulk operations.
+	KeySize int
+	// ValueSize is the size of the written, read or deleted value.
+	ValueSize int
+	// PagesRead is the number of pages read from the file. It is the
+	// change of the counter of the whole tree during the operation, so
+	// it includes the pages read by the concurrent readers and is
+	// approximate for the reads that run in parallel.
+	PagesRead uint64
+	// PagesWritten is the number of pages written to the file, it is exact
+	// since the writes run exclusively.
+	PagesWritten uint64
+	Duration     time.Duration
+	// Err is the error returned by the operation.
+	Err error
+}
+
+// OnOperation option registers the callback that is invoked after
+// each public operation, so the operations can be fed into
+// any metrics pipeline. The page counts of the concurrent reads are
+// approximate, see OperationInfo.
+func OnOperation(callback func(info OperationInfo)) func(*config) error {
+	return func(c *config) error {
+		if callback == nil {
+			return fmt.Errorf("callback must not be nil")
+		}
+
+		c.onOperation = callback
+
+		return nil
+	}
+}
+
+// operation is the state of the running public operation.
+type operation struct {
+	start  time.Time
+	before ioStats
+}
+
+// beginOperation starts tracking the public operation.
+func (t *FBPTree) beginOperation() *operation {
+	if t.onOperation == nil && t.slowOpThreshold == 0 {
+		return nil
+	}
+
+	return &operation{time.Now(), t.storage.stats()}
+}
+
+// endOperation reports the finished public operation.
+func (t *FBPTree) endOperation(op *operation, operationType OperationType, keySize, valueSize int, err error) {
+	if op == nil {
+		return
+	}
+
+	duration := time.Since(op.start)
+	after := t.storage.stats()
+	if t.onOperation != nil {
+		t.onOperation(OperationInfo{
+			Type:         operationType,
+			KeySize:      keySize,
+			ValueSize:    valueSize,
+			PagesRead:    after.reads - op.before.reads,
+			PagesWritten: after.writes - op.before.writes,
+			Duration:     duration,
+			Err:          err,
+		})
+	}
+
+	if t.slowOpThreshold > 0 && duration >= t.slowOpThreshold {
+		t.logger.Warnf(
+			"slow %s operation took %s (key %d bytes, value %d bytes): pages read %d, pages written %d, cache misses %d, fsyncs %d",
+			operationType,
+			duration,
+			keySize,
+			valueSize,
+			after.reads-op.before.reads,
+			after.writes-op.before.writes,
+			after.misses-op.before.misses,
+			after.syncs-op.before.syncs,
+		)
+	}
+}
+
+// ioStats are the counters of the file operations.
+type ioStats struct {
+	reads  uint64
+	writes uint64
+	syncs  uint64
+	// the number of nodes that were not found
+	// in the memory and were loaded from the file
+	misses uint64
+	// the number of nodes that were found in the memory
+	hits uint64
+	// the number of the read and the written bytes
+	readBytes    uint64
+	writtenBytes uint64
+}
+
+// countingFile counts the reads, writes and syncs of the underlying file.
+// The counters are updated atomically by the concurrent readers.
+type countingFile struct {
+	// the first field is 64-bit aligned for the atomic operations
+	stats ioStats
+	file  randomAccessFile
+	// receives the reads, writes and syncs, nil if not given
+	metrics Metrics
+}
+
+func newCountingFile(file randomAccessFile) *countingFile {
+	return &countingFile{file: file}
+}
+
+// counts returns the current counters.
+func (f *countingFile) counts() ioStats {
+	return ioStats{
+		reads:  atomic.LoadUint64(&f.stats.reads),
+		writes: atomic.LoadUint64(&f.stats.writes),
+		syncs:  atomic.LoadUint64(&f.stats.syncs),
+		misses: atomic.LoadUint64(&f.stats.misses),
+
+		hits:         atomic.LoadUint64(&f.stats.hits),
+		readBytes:    atomic.LoadUint64(&f.stats.readBytes),
+		writtenBytes: atomic.LoadUint64(&f.stats.writtenBytes),
+	}
+}
+
+// set sets the counters, e.g. to discard the counts of the write
+// that is not committed.
+func (f *countingFile) set(stats ioStats) {
+	atomic.StoreUint64(&f.stats.reads, stats.reads)
+	atomic.StoreUint64(&f.stats.writes, stats.writes)
+	atomic.StoreUint64(&f.stats.syncs, stats.syncs)
+	atomic.StoreUint64(&f.stats.misses, stats.misses)
+	atomic.StoreUint64(&f.stats.hits, stats.hits)
+	atomic.StoreUint64(&f.stats.readBytes, stats.readBytes)
+	atomic.StoreUint64(&f.stats.writtenBytes, stats.writtenBytes)
+}
+
+func (f *countingFile) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddUint64(&f.stats.reads, 1)
+
+	n, err := f.file.ReadAt(p, off)
+	atomic.AddUint64(&f.stats.readBytes, uint64(n))
+	if f.metrics != nil {
+		f.metrics.PageRead()
+	}
+
+	return n, err
+}
+
+func (f *countingFile) WriteAt(p []byte, off int64) (int, error) {
+	atomic.AddUint64(&f.stats.writes, 1)
+
+	n, err := f.file.WriteAt(p, off)
+	atomic.AddUint64(&f.stats.writtenBytes, uint64(n))
+	if f.metrics != nil {
+		f.metrics.PageWritten()
+	}
+
+	return n, err
+}
+
+func (f *countingFile) Sync() error {
+	atomic.AddUint64(&f.stats.syncs, 1)
+	if f.metrics != nil {
+		f.metrics.Synced()
+	}
+
+	return f.file.Sync()
+}
+
+func (f *countingFile) Stat() (fs.FileInfo, error) {
+	return f.file.Stat()
+}
+
+func (f *countingFile) Truncate(size int64) error {
+	return f.file.Truncate(size)
+}
+
+func (f *countingFile) Close() error {
+	return f.file.Close()
+}
@@ -0,0 +1,134 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOnOperation(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	operations := make([]OperationInfo, 0)
+	onOperation := OnOperation(func(info OperationInfo) {
+		operations = append(operations, info)
+	})
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, onOperation)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	tree.Put([]byte{1, 2}, []byte{1, 2, 3})
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// reopen with the cold cache
+	tree, err = Open(dbPath, onOperation)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	tree.Get([]byte{1, 2})
+	tree.ForEach(func(key, value []byte) {})
+	tree.Delete([]byte{1, 2})
+
+	if len(operations) != 4 {
+		t.Fatalf("expected 4 operations, but got %d", len(operations))
+	}
+
+	expected := []OperationType{OperationPut, OperationGet, OperationForEach, OperationDelete}
+	for i, operationType := range expected {
+		if operations[i].Type != operationType {
+			t.Fatalf("expected operation %s, but got %s", operationType, operations[i].Type)
+		}
+	}
+
+	put := operations[0]
+	if put.KeySize != 2 || put.ValueSize != 3 {
+		t.Fatalf("unexpected key and value sizes for put: %d, %d", put.KeySize, put.ValueSize)
+	}
+	if put.PagesWritten == 0 {
+		t.Fatal("put must write pages")
+	}
+
+	get := operations[1]
+	if get.PagesRead == 0 {
+		t.Fatal("get must read pages")
+	}
+	if get.ValueSize != 3 {
+		t.Fatalf("expected value size 3 for get, but got %d", get.ValueSize)
+	}
+
+	if operations[3].ValueSize != 3 {
+		t.Fatalf("expected value size 3 for delete, but got %d", operations[3].ValueSize)
+	}
+}
+
+type recordingLogger struct {
+	debug []string
+	warn  []string
+}
+
+func (l *recordingLogger) Debugf(format string, args ...interface{}) {
+	l.debug = append(l.debug, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...interface{}) {
+	l.warn = append(l.warn, fmt.Sprintf(format, args...))
+}
+
+func TestSlowOpThreshold(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	logger := &recordingLogger{}
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, WithLogger(logger), SlowOpThreshold(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	tree.Put([]byte{1}, []byte{1})
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// reopen with the cold cache
+	tree, err = Open(dbPath, WithLogger(logger), SlowOpThreshold(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	tree.Get([]byte{1})
+
+	if len(logger.warn) != 2 {
+		t.Fatalf("expected 2 slow operations to be logged, but got %d", len(logger.warn))
+	}
+	if !strings.HasPrefix(logger.warn[1], "slow get operation") || !strings.Contains(logger.warn[1], "cache misses 1") {
+		t.Fatalf("unexpected slow operation message: %s", logger.warn[1])
+	}
+}
+
+func TestSlowOpThresholdRequiresLogger(t *testing.T) {
+	_, err := Open("somepath", SlowOpThreshold(time.Second))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
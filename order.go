@@ -0,0 +1,63 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// the size of the node fields besides the keys and the pointers: the
+// identifiers of the node and its previous leaf, the flags, the number of the
+// keys and the pointers with their capacities and the next leaf
+const nodeHeaderSize = 4 + 4 + 1 + 2 + 2 + 2 + 2 + 1 + 4
+
+// the size of the header of the first page of the record
+const recordHeaderSize = 16
+
+// AutoOrder option derives the order of the B+ tree from the page size
+// instead of the Order option: the order is the largest one that fits the
+// full leaf with the keys and the values of the given sizes in bytes and the
+// full internal node into one page, so the node is read and written with one
+// page access. The larger keys and values are stored as well, but their nodes
+// span several pages. The order of the existing tree is kept.
+func AutoOrder(keySize, valueSize int) func(*config) error {
+	return func(c *config) error {
+		if keySize <= 0 {
+			return fmt.Errorf("key size must be positive")
+		}
+
+		if valueSize < 0 {
+			return fmt.Errorf("value size must not be negative")
+		}
+
+		c.autoOrder = true
+		c.autoKeySize = keySize
+		c.autoValueSize = valueSize
+
+		return nil
+	}
+}
+
+// pageOrder returns the largest order between 3 and the maximum order
+// of the nodes that fit into the page with the keys and the values
+// of the given sizes.
+func pageOrder(pageSize, keySize, valueSize int) int {
+	// the empty value is stored as the presence marker
+	leafPointerSize := 1
+	if valueSize > 0 {
+		leafPointerSize = 1 + 2 + valueSize
+	}
+	internalPointerSize := 1 + 4 + 4
+
+	order := 3
+	for order < maxOrder {
+		next := order + 1
+		leafSize := nodeHeaderSize + (next-1)*(2+keySize+leafPointerSize)
+		internalSize := nodeHeaderSize + (next-1)*(2+keySize) + next*internalPointerSize
+		if recordHeaderSize+leafSize > pageSize || recordHeaderSize+internalSize > pageSize {
+			break
+		}
+
+		order = next
+	}
+
+	return order
+}
@@ -0,0 +1,130 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPageOrder(t *testing.T) {
+	for _, pageSize := range []int{512, 4096, 16384} {
+		for _, sizes := range [][2]int{{8, 0}, {16, 100}, {100, 1000}} {
+			keySize, valueSize := sizes[0], sizes[1]
+			order := pageOrder(pageSize, keySize, valueSize)
+
+			for _, o := range []int{order, order + 1} {
+				leaf := &node{id: 1, leaf: true, keys: make([][]byte, o-1), pointers: make([]*pointer, o)}
+				internal := &node{id: 1, keys: make([][]byte, o-1), pointers: make([]*pointer, o)}
+				for i := 0; i < o-1; i++ {
+					// the keys do not share the prefixes
+					key := bytes.Repeat([]byte{byte(i)}, keySize)
+					leaf.keys[i], internal.keys[i] = key, key
+					leaf.pointers[i] = &pointer{value: make([]byte, valueSize)}
+					internal.pointers[i] = &pointer{value: uint32(i + 3), count: 1}
+				}
+				leaf.keyNum, internal.keyNum = o-1, o-1
+				leaf.setNext(&pointer{value: uint32(3)})
+				internal.pointers[o-1] = &pointer{value: uint32(o + 3), count: 1}
+
+				size := recordHeaderSize + len(encodeNode(leaf))
+				if internalSize := recordHeaderSize + len(encodeNode(internal)); internalSize > size {
+					size = internalSize
+				}
+
+				if o == order && size > pageSize && order > 3 {
+					t.Fatalf("expected the nodes of order %d to fit %d page size, but got %d bytes", o, pageSize, size)
+				}
+				if o == order+1 && size <= pageSize && order < maxOrder {
+					t.Fatalf("expected order %d to be the largest for %d page size, but order %d fits %d bytes", order, pageSize, o, size)
+				}
+			}
+		}
+	}
+}
+
+func TestAutoOrder(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, PageSize(4096), AutoOrder(16, 100))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	expected := pageOrder(4096, 16, 100)
+	if tree.order != expected {
+		t.Fatalf("expected order %d, but got %d", expected, tree.order)
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%012d", i))
+		if _, _, err := tree.Put(key, bytes.Repeat([]byte{byte(i)}, 100)); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	for nodeID := tree.metadata.leftmostID; nodeID != 0; {
+		pages, err := tree.storage.records.pages(nodeID)
+		if err != nil {
+			t.Fatalf("failed to read the pages of the leaf %d: %s", nodeID, err)
+		}
+		if len(pages) != 1 {
+			t.Fatalf("expected the leaf %d to fit one page, but got %d pages", nodeID, len(pages))
+		}
+
+		leaf, err := tree.storage.loadNodeByID(nodeID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf %d: %s", nodeID, err)
+		}
+
+		nodeID = 0
+		if next := leaf.next(); next != nil {
+			nodeID = next.asNodeID()
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	// the order of the existing tree is kept
+	tree, err = Open(dbPath, PageSize(4096), AutoOrder(8, 8))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.order != expected {
+		t.Fatalf("expected order %d, but got %d", expected, tree.order)
+	}
+
+	if size := tree.Size(); size != 1000 {
+		t.Fatalf("expected size 1000, but got %d", size)
+	}
+}
+
+func TestAutoOrderErrors(t *testing.T) {
+	if _, err := newConfig([]func(*config) error{AutoOrder(0, 10)}); err == nil {
+		t.Fatalf("expected the error for the zero key size")
+	}
+
+	if _, err := newConfig([]func(*config) error{AutoOrder(10, -1)}); err == nil {
+		t.Fatalf("expected the error for the negative value size")
+	}
+
+	cfg, err := newConfig([]func(*config) error{AutoOrder(10, 10), Order(10)})
+	if err != nil {
+		t.Fatalf("failed to apply the options: %s", err)
+	}
+	if cfg.order != 10 {
+		t.Fatalf("expected the last option to set order 10, but got %d", cfg.order)
+	}
+}
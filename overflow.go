@@ -0,0 +1,128 @@
+package fbptree
+
+import (
+	"fmt"
+	"math"
+)
+
+// the values larger than this size are stored in the overflow records,
+// so the leaves stay small and the length of the inline value fits uint16
+const maxInlineValueSize = math.MaxUint16
+
+// the keys larger than this size are long: only their prefixes are stored
+// in the nodes and the tails are in the key record of the node
+const maxInlineKeySize = math.MaxUint16
+
+// the size of the prefix of the long key stored in the node
+const keyPrefixSize = 64
+
+// overflow refers to the record that holds the value too large to be
+// stored in the leaf.
+type overflow struct {
+	recordID uint32
+	size     uint32
+}
+
+func (p *pointer) isOverflow() bool {
+	_, ok := p.value.(*overflow)
+
+	return ok
+}
+
+// asOverflow returns the reference to the overflow record.
+func (p *pointer) asOverflow() *overflow {
+	return p.value.(*overflow)
+}
+
+// newValue returns the leaf pointer to the value, the large value is written
+// into the new overflow record.
+func (s *storage) newValue(value []byte) (*pointer, error) {
+	if len(value) <= maxInlineValueSize {
+		return &pointer{value: value}, nil
+	}
+
+	recordID, err := s.records.new()
+	if err != nil {
+		return nil, fmt.Errorf("failed to instantiate new record: %w", err)
+	}
+
+	if err := s.records.write(recordID, value); err != nil {
+		return nil, fmt.Errorf("failed to write the overflow record %d: %w", recordID, err)
+	}
+
+	return &pointer{value: &overflow{recordID, uint32(len(value))}}, nil
+}
+
+// replaceValue returns the leaf pointer to the new value that replaces the
+// value of the given pointer. The overflow record is rewritten in place, so
+// only the changed pages are written, or freed if the value becomes small.
+func (s *storage) replaceValue(p *pointer, value []byte) (*pointer, error) {
+	if !p.isOverflow() {
+		return s.newValue(value)
+	}
+
+	recordID := p.asOverflow().recordID
+	if len(value) <= maxInlineValueSize {
+		if err := s.records.free(recordID); err != nil {
+			return nil, fmt.Errorf("failed to free the overflow record %d: %w", recordID, err)
+		}
+
+		return &pointer{value: value}, nil
+	}
+
+	if err := s.records.write(recordID, value); err != nil {
+		return nil, fmt.Errorf("failed to write the overflow record %d: %w", recordID, err)
+	}
+
+	return &pointer{value: &overflow{recordID, uint32(len(value))}}, nil
+}
+
+// readValue returns the value of the leaf pointer, reading the overflow
+// record if the value is stored there.
+func (s *storage) readValue(p *pointer) ([]byte, error) {
+	if !p.isOverflow() {
+		return p.asValue(), nil
+	}
+
+	o := p.asOverflow()
+	data, err := s.records.read(o.recordID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the overflow record %d: %w", o.recordID, err)
+	}
+
+	if len(data) != int(o.size) {
+		return nil, &CorruptionError{o.recordID, 8, fmt.Sprintf("the overflow record size %d does not match the value size %d", len(data), o.size)}
+	}
+
+	return data, nil
+}
+
+// freeValue frees the overflow record of the leaf pointer if there is one.
+func (s *storage) freeValue(p *pointer) error {
+	if !p.isOverflow() {
+		return nil
+	}
+
+	recordID := p.asOverflow().recordID
+	if err := s.records.free(recordID); err != nil {
+		return fmt.Errorf("failed to free the overflow record %d: %w", recordID, err)
+	}
+
+	return nil
+}
+
+func isLongKey(key []byte) bool {
+	return len(key) > maxInlineKeySize
+}
+
+// keyTailSize returns the total size of the tails of the long keys.
+func (n *node) keyTailSize() int {
+	size := 0
+	for i := 0; i < n.keyNum; i++ {
+		if isLongKey(n.keys[i]) {
+			size += len(n.keys[i]) - keyPrefixSize
+		}
+	}
+
+	return size
+}
@@ -0,0 +1,331 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLargeValues(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	large := bytes.Repeat([]byte{1, 2, 3}, 100000)
+	for i := 0; i < 10; i++ {
+		value := []byte{byte(i)}
+		if i%2 == 0 {
+			value = append(large[:len(large):len(large)], byte(i))
+		}
+
+		if _, _, err := tree.Put([]byte{byte(i)}, value); err != nil {
+			t.Fatalf("failed to put value of size %d: %s", len(value), err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		expected := []byte{byte(i)}
+		if i%2 == 0 {
+			expected = append(large[:len(large):len(large)], byte(i))
+		}
+
+		value, ok, err := tree.Get([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("failed to get value: %s", err)
+		}
+		if !ok || !bytes.Equal(value, expected) {
+			t.Fatalf("unexpected value of size %d for key %d", len(value), i)
+		}
+	}
+
+	count := 0
+	err = tree.ForEach(func(key, value []byte) {
+		if key[0]%2 == 0 && len(value) != len(large)+1 {
+			t.Fatalf("unexpected value of size %d for key %d", len(value), key[0])
+		}
+		count++
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if count != 10 {
+		t.Fatalf("expected 10 entries, but got %d", count)
+	}
+
+	prev, exists, err := tree.Put([]byte{0}, []byte{0})
+	if err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if !exists || !bytes.Equal(prev, append(large[:len(large):len(large)], 0)) {
+		t.Fatalf("unexpected previous value of size %d", len(prev))
+	}
+
+	prev, exists, err = tree.Delete([]byte{2})
+	if err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	if !exists || !bytes.Equal(prev, append(large[:len(large):len(large)], 2)) {
+		t.Fatalf("unexpected deleted value of size %d", len(prev))
+	}
+
+	size, err := tree.Append([]byte{4}, []byte{5})
+	if err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	if size != len(large)+2 {
+		t.Fatalf("expected size %d, but got %d", len(large)+2, size)
+	}
+}
+
+func TestLargeValuesAreFreed(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	large := bytes.Repeat([]byte{1}, 200000)
+	if _, _, err := tree.Put([]byte{1}, large); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, _, err := tree.Delete([]byte{1}); err != nil {
+		t.Fatalf("failed to delete: %s", err)
+	}
+	lastPageId := tree.storage.pager.lastPageId
+
+	for i := 0; i < 5; i++ {
+		if _, _, err := tree.Put([]byte{1}, large); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+		if _, _, err := tree.Put([]byte{1}, large[:100000]); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+		if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+		if _, _, err := tree.Delete([]byte{1}); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+
+	if tree.storage.pager.lastPageId != lastPageId {
+		t.Fatalf("expected the last page %d, but got %d", lastPageId, tree.storage.pager.lastPageId)
+	}
+}
+
+func TestLargeValuesAreFreedByDeleteMany(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(4096), Order(32))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	large := bytes.Repeat([]byte{1}, 200000)
+	keys := make([][]byte, 0)
+	for i := 0; i < 20; i++ {
+		keys = append(keys, []byte{byte(i)})
+	}
+
+	for i := 0; i < 5; i++ {
+		for _, key := range keys {
+			if _, _, err := tree.Put(key, large); err != nil {
+				t.Fatalf("failed to put: %s", err)
+			}
+		}
+
+		// the keys of the root leaf are deleted in bulk
+		// except the last one that underflows it
+		if deleted, err := tree.DeleteMany(keys); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		} else if deleted != len(keys) {
+			t.Fatalf("expected %d deleted keys, but got %d", len(keys), deleted)
+		}
+
+		// the pages of the values are either free or in use
+		pager := tree.storage.pager
+		used := tree.check().used
+		for pageId := uint32(1); pageId <= pager.lastPageId; pageId++ {
+			if _, ok := used[pageId]; !ok && !pager.isFree(pageId) && pager.freePages[pageId] == nil {
+				t.Fatalf("the page %d is leaked after %d deletes", pageId, i+1)
+			}
+		}
+	}
+}
+
+func TestLargeValuesDumpAndLoad(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	large := bytes.Repeat([]byte{7}, 100000)
+	for i := 0; i < 20; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, append(large[:len(large):len(large)], byte(i))); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	var dump bytes.Buffer
+	if err := tree.Dump(&dump); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	loaded, err := Open(path.Join(dbDir, "loaded.data"), PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer loaded.Close()
+
+	if err := loaded.Load(&dump); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		value, ok, err := loaded.Get([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+		if !ok || !bytes.Equal(value, append(large[:len(large):len(large)], byte(i))) {
+			t.Fatalf("unexpected value of size %d for key %d", len(value), i)
+		}
+	}
+}
+
+func TestLongKeys(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	// the long keys differ only after the prefix stored in the nodes
+	keyOf := func(i int) []byte {
+		return append(bytes.Repeat([]byte{1}, 70000), byte(i))
+	}
+
+	for i := 0; i < 30; i++ {
+		if _, _, err := tree.Put(keyOf(i), []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 30; i++ {
+		value, ok, err := tree.Get(keyOf(i))
+		if err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+		if !ok || !bytes.Equal(value, []byte{byte(i)}) {
+			t.Fatalf("unexpected value %v for key %d", value, i)
+		}
+	}
+
+	i := 0
+	err = tree.ForEach(func(key, value []byte) {
+		if !bytes.Equal(key, keyOf(i)) {
+			t.Fatalf("unexpected key at position %d", i)
+		}
+		i++
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	for i := 0; i < 30; i += 2 {
+		if _, ok, err := tree.Delete(keyOf(i)); err != nil || !ok {
+			t.Fatalf("failed to delete key %d: %v", i, err)
+		}
+	}
+
+	if err := tree.HealthCheck(); err != nil {
+		t.Fatalf("failed health check: %s", err)
+	}
+
+	if size := tree.Size(); size != 15 {
+		t.Fatalf("expected size 15, but got %d", size)
+	}
+
+	var dump bytes.Buffer
+	if err := tree.Dump(&dump); err != nil {
+		t.Fatalf("failed to dump: %s", err)
+	}
+
+	loaded, err := Open(path.Join(dbDir, "loaded.data"), PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer loaded.Close()
+
+	if err := loaded.Load(&dump); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	for i := 1; i < 30; i += 2 {
+		if _, ok, err := loaded.Get(keyOf(i)); err != nil || !ok {
+			t.Fatalf("failed to get key %d: %v", i, err)
+		}
+	}
+
+	if _, _, err := tree.Put(make([]byte, maxKeySize+1), nil); err == nil {
+		t.Fatalf("expected the error for the key larger than %d bytes", maxKeySize)
+	}
+}
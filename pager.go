@@ -2,21 +2,39 @@ package fbptree
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/fs"
 	"math"
 	"os"
+	"sort"
 )
 
 // for mocking the filesystem
 var openFile = os.OpenFile
 
+// wraps the opened tree and log files, for injecting the faults
+var wrapFile = func(path string, file randomAccessFile) randomAccessFile {
+	return file
+}
+
 const minPageSize = 32
 const maxPageSize = math.MaxUint16
 
 // the size of the first metadata block in the file,
 // reserved for different needs
 const metadataSize = 1000
+const metadataChecksumPosition = 16
+const hotLeavesMetadataPosition = 20
+const hotLeavesMetadataSize = 80
+const statsMetadataPosition = 100
+const statsMetadataSize = 192
+
+// the sequence is stored as uint64 at the end of the statistics region,
+// the files created before the sequence was introduced have zero
+const sequenceMetadataPosition = 292
+const userMetadataPosition = 300
+const userMetadataSize = 200
 const customMetadataPosition = 500
 
 // the id of the first free page
@@ -40,16 +58,58 @@ type pager struct {
 	// it can be free or used - it does not matter
 	lastPageId uint32
 
+	// the number of the pages in the file, the pages after the last page
+	// are allocated in advance according to the growth policy
+	filePages uint32
+	growth    GrowthPolicy
+
 	freePages map[uint32]*freePage
 	// key is the id of the page and the value is the id of the previous page
 	prevPageIds map[uint32]uint32
 
 	metadata *metadata
+
+	// if true, the file is synced after allocating
+	// a new free page list container
+	strictSync bool
+
+	// if true, the freed pages are zeroed
+	secureDelete bool
+
+	// if true, the file is opened from the read-only file system
+	readOnly bool
+
+	// defers the changes of the file, the changes of the free page lists
+	// are deferred even if the pages are written in place, see walKind,
+	// nil if read-only
+	wal *walFile
+
+	// the free pages in ascending order while the lowest
+	// free pages are allocated first, nil otherwise
+	lowestFree []uint32
+
+	// receives the debug messages, nil if not given
+	logger Logger
 }
 
 type metadata struct {
 	pageSize uint16
 
+	// the version of the file format
+	version uint16
+
+	// the most accessed leaves of the previous sessions
+	hotLeaves []byte
+
+	// the lifetime statistics of the file
+	stats []byte
+
+	// the application-defined metadata
+	user []byte
+
+	// the last value returned by NextSequence
+	sequence uint64
+
 	custom []byte
 }
 
@@ -60,19 +120,6 @@ type freePage struct {
 	nextPageId uint32
 }
 
-func (p *freePage) copy() *freePage {
-	newIds := make(map[uint32]struct{})
-	for key, value := range p.ids {
-		newIds[key] = value
-	}
-
-	return &freePage{
-		p.pageId,
-		newIds,
-		p.nextPageId,
-	}
-}
-
 type randomAccessFile interface {
 	io.ReaderAt
 	io.WriterAt
@@ -116,7 +163,14 @@ func newPager(file randomAccessFile, pageSize uint16) (*pager, error) {
 	size := info.Size()
 	if size == 0 {
 		// initialize free pages block and metadata block
-		p := &pager{file, pageSize, make(map[uint32]*freePage), nil, 0, make(map[uint32]*freePage), make(map[uint32]uint32), &metadata{pageSize, nil}}
+		p := &pager{
+			file:        file,
+			pageSize:    pageSize,
+			isFreePage:  make(map[uint32]*freePage),
+			freePages:   make(map[uint32]*freePage),
+			prevPageIds: make(map[uint32]uint32),
+			metadata:    &metadata{pageSize: pageSize, version: formatVersion},
+		}
 		if err := writeMetadata(p.file, p.metadata); err != nil {
 			return nil, fmt.Errorf("failed to initialize metadata: %w", err)
 		}
@@ -152,7 +206,23 @@ func newPager(file randomAccessFile, pageSize uint16) (*pager, error) {
 		lastPageId = uint32(used / int64(pageSize))
 	}
 
-	return &pager{file, pageSize, isFreePage, lastFreePage, lastPageId, freePages, prevPageIds, metadata}, nil
+	p := &pager{
+		file:         file,
+		pageSize:     pageSize,
+		isFreePage:   isFreePage,
+		lastFreePage: lastFreePage,
+		lastPageId:   lastPageId,
+		filePages:    lastPageId,
+		freePages:    freePages,
+		prevPageIds:  prevPageIds,
+		metadata:     metadata,
+	}
+
+	if err := migrate(p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
 }
 
 func writeMetadata(w io.WriterAt, metadata *metadata) error {
@@ -231,6 +301,10 @@ func readFreePage(r io.ReaderAt, pageId uint32, pageSize uint16) (*freePage, err
 }
 
 func decodeFreePage(pageId uint32, data []byte) (*freePage, error) {
+	if len(data) < pageIdSize {
+		return nil, &CorruptionError{Record: pageId, Reason: fmt.Sprintf("the free page must be at least %d bytes, but got %d", pageIdSize, len(data))}
+	}
+
 	pageIdNum := (len(data) - pageIdSize) / pageIdSize
 	freePages := make(map[uint32]struct{})
 	for i := 0; i < pageIdNum; i++ {
@@ -270,6 +344,27 @@ func encodeMetadata(m *metadata) []byte {
 
 	d := encodeUint16(m.pageSize)
 	copy(data[0:len(d)], d)
+	encodeFormat(data)
+
+	if len(m.hotLeaves) != 0 {
+		s := encodeUint16(uint16(len(m.hotLeaves)))
+		copy(data[hotLeavesMetadataPosition:hotLeavesMetadataPosition+len(s)], s)
+		copy(data[hotLeavesMetadataPosition+len(s):], m.hotLeaves)
+	}
+
+	if len(m.stats) != 0 {
+		s := encodeUint16(uint16(len(m.stats)))
+		copy(data[statsMetadataPosition:statsMetadataPosition+len(s)], s)
+		copy(data[statsMetadataPosition+len(s):], m.stats)
+	}
+
+	copy(data[sequenceMetadataPosition:sequenceMetadataPosition+8], encodeUint64(m.sequence))
+
+	if len(m.user) != 0 {
+		s := encodeUint16(uint16(len(m.user)))
+		copy(data[userMetadataPosition:userMetadataPosition+len(s)], s)
+		copy(data[userMetadataPosition+len(s):], m.user)
+	}
 
 	if len(m.custom) != 0 {
 		s := encodeUint16(uint16(len(m.custom)))
@@ -277,49 +372,103 @@ func encodeMetadata(m *metadata) []byte {
 		copy(data[customMetadataPosition+len(s):], m.custom)
 	}
 
+	copy(data[metadataChecksumPosition:metadataChecksumPosition+4], encodeUint32(metadataChecksum(data)))
+
 	return data
 }
 
+// metadataChecksum returns the checksum of the metadata block
+// without the checksum itself.
+func metadataChecksum(data []byte) uint32 {
+	checksum := crc32.NewIEEE()
+	checksum.Write(data[:metadataChecksumPosition])
+	checksum.Write(data[metadataChecksumPosition+4:])
+
+	return checksum.Sum32()
+}
+
 // decodes and returns metadata from the given byte slice.
 func decodeMetadata(data []byte) (*metadata, error) {
+	if len(data) != metadataSize {
+		return nil, &CorruptionError{Reason: fmt.Sprintf("the metadata must be %d bytes, but got %d", metadataSize, len(data))}
+	}
+
+	// the signature is checked first, so the foreign file is reported as such
+	version, err := decodeFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// the files written before the checksum was introduced have zero
+	if checksum := decodeUint32(data[metadataChecksumPosition : metadataChecksumPosition+4]); checksum != 0 {
+		if actual := metadataChecksum(data); actual != checksum {
+			return nil, fmt.Errorf("%w: metadata checksum mismatch: stored %x, actual %x", ErrCorrupted, checksum, actual)
+		}
+	}
+
 	// the first block is the page size, encoded as uint16
 	pageSize := decodeUint16(data[0:2])
 
-	customMetadataSize := decodeUint16(data[customMetadataPosition : customMetadataPosition+2])
-	var customMetadata []byte = nil
-	if customMetadataSize != 0 {
-		customMetadata = data[customMetadataPosition+2 : customMetadataPosition+2+customMetadataSize]
+	hotLeavesMetadata, err := decodeMetadataRegion(data, hotLeavesMetadataPosition, hotLeavesMetadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	statsMetadata, err := decodeMetadataRegion(data, statsMetadataPosition, statsMetadataSize)
+	if err != nil {
+		return nil, err
+	}
+
+	userMetadata, err := decodeMetadataRegion(data, userMetadataPosition, userMetadataSize)
+	if err != nil {
+		return nil, err
 	}
 
-	return &metadata{pageSize: pageSize, custom: customMetadata}, nil
+	customMetadata, err := decodeMetadataRegion(data, customMetadataPosition, metadataSize-customMetadataPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence := decodeUint64(data[sequenceMetadataPosition : sequenceMetadataPosition+8])
+
+	return &metadata{pageSize: pageSize, version: version, hotLeaves: hotLeavesMetadata, stats: statsMetadata, user: userMetadata, sequence: sequence, custom: customMetadata}, nil
+}
+
+// decodeMetadataRegion returns the data of the region of the metadata
+// prefixed with uint16 length or nil if the region is empty.
+func decodeMetadataRegion(data []byte, position, size int) ([]byte, error) {
+	length := int(decodeUint16(data[position : position+2]))
+	if length == 0 {
+		return nil, nil
+	}
+
+	if length > size-2 {
+		return nil, &CorruptionError{Offset: position, Reason: fmt.Sprintf("the region length %d exceeds %d bytes", length, size-2)}
+	}
+
+	return data[position+2 : position+2+length], nil
 }
 
 // newPage returns an identifier of the page that is free
 // and can be used for write.
 func (p *pager) new() (uint32, error) {
-	if len(p.isFreePage) > 0 {
-		for freePageId := range p.isFreePage {
-			freePage := p.isFreePage[freePageId]
-			delete(freePage.ids, freePageId)
-
-			data := encodeFreePage(freePage, p.pageSize)
-			if err := writePage(p.file, freePage.pageId, data, p.pageSize); err != nil {
-				freePage.ids[freePageId] = struct{}{}
-				return 0, fmt.Errorf("failed to update the free page: %w", err)
-			}
+	for len(p.lowestFree) > 0 {
+		freePageId := p.lowestFree[0]
+		p.lowestFree = p.lowestFree[1:]
 
-			delete(p.isFreePage, freePageId)
-
-			return freePageId, nil
+		if p.isFree(freePageId) {
+			return p.reuse(freePageId)
 		}
 	}
 
-	offset := int64((p.lastPageId)*uint32(p.pageSize)) + metadataSize
-	data := make([]byte, p.pageSize)
-	if n, err := p.file.WriteAt(data, offset); err != nil {
-		return 0, fmt.Errorf("failed to write empty block: %w", err)
-	} else if n < int(p.pageSize) {
-		return 0, fmt.Errorf("failed to write all bytes of the empty block, wrote only %d bytes", n)
+	for freePageId := range p.isFreePage {
+		return p.reuse(freePageId)
+	}
+
+	if p.lastPageId == p.filePages {
+		if err := p.grow(); err != nil {
+			return 0, err
+		}
 	}
 
 	p.lastPageId++
@@ -327,6 +476,74 @@ func (p *pager) new() (uint32, error) {
 	return p.lastPageId, nil
 }
 
+// grow adds the empty pages to the end of the file according
+// to the growth policy.
+func (p *pager) grow() error {
+	pages := p.growth.pages(p.filePages, p.pageSize)
+	offset := int64(p.filePages)*int64(p.pageSize) + metadataSize
+	data := make([]byte, int(pages)*int(p.pageSize))
+	if n, err := p.file.WriteAt(data, offset); err != nil {
+		return fmt.Errorf("failed to write empty block: %w", err)
+	} else if n < len(data) {
+		return fmt.Errorf("failed to write all bytes of the empty block, wrote only %d bytes", n)
+	}
+
+	p.filePages += pages
+
+	return nil
+}
+
+// trim truncates the pages allocated in advance after the last page.
+func (p *pager) trim() error {
+	if p.filePages == p.lastPageId {
+		return nil
+	}
+
+	if err := p.file.Truncate(int64(p.lastPageId)*int64(p.pageSize) + metadataSize); err != nil {
+		return fmt.Errorf("failed to truncate the file: %w", err)
+	}
+	p.filePages = p.lastPageId
+
+	return nil
+}
+
+// reuse allocates the free page.
+func (p *pager) reuse(freePageId uint32) (uint32, error) {
+	// the reused page must not keep the stale data, otherwise
+	// the records may follow its link to the next page
+	if err := writePage(p.file, freePageId, make([]byte, p.pageSize), p.pageSize); err != nil {
+		return 0, fmt.Errorf("failed to clear the free page: %w", err)
+	}
+
+	freePage := p.isFreePage[freePageId]
+	delete(freePage.ids, freePageId)
+
+	data := encodeFreePage(freePage, p.pageSize)
+	if err := p.writeFreePage(freePage.pageId, data); err != nil {
+		freePage.ids[freePageId] = struct{}{}
+		return 0, fmt.Errorf("failed to update the free page: %w", err)
+	}
+
+	delete(p.isFreePage, freePageId)
+
+	return freePageId, nil
+}
+
+// allocateLowest makes new allocate the lowest free pages first,
+// including the pages freed later, until allocateAny is called.
+func (p *pager) allocateLowest() {
+	p.lowestFree = make([]uint32, 0, len(p.isFreePage))
+	for pageId := range p.isFreePage {
+		p.lowestFree = append(p.lowestFree, pageId)
+	}
+	sort.Slice(p.lowestFree, func(i, j int) bool { return p.lowestFree[i] < p.lowestFree[j] })
+}
+
+// allocateAny makes new allocate any free page.
+func (p *pager) allocateAny() {
+	p.lowestFree = nil
+}
+
 // writeCustomMetadata writes custom metadata into the metadata section of the file.
 func (p *pager) writeCustomMetadata(data []byte) error {
 	maxCustomMetadataLen := (metadataSize - customMetadataPosition)
@@ -336,7 +553,7 @@ func (p *pager) writeCustomMetadata(data []byte) error {
 
 	p.metadata.custom = data
 
-	err := writeMetadata(p.file, p.metadata)
+	err := p.storeMetadata()
 	if err != nil {
 		return fmt.Errorf("failed to write metadata: %w", err)
 	}
@@ -344,6 +561,73 @@ func (p *pager) writeCustomMetadata(data []byte) error {
 	return nil
 }
 
+// setHotLeavesMetadata updates the hot leaves section of the metadata in
+// memory, it is written to the file with the next metadata write.
+func (p *pager) setHotLeavesMetadata(data []byte) error {
+	if len(data) > hotLeavesMetadataSize-2 {
+		return fmt.Errorf("hot leaves metadata must be less than %d bytes", hotLeavesMetadataSize-2)
+	}
+
+	p.metadata.hotLeaves = data
+
+	return nil
+}
+
+// setStatsMetadata updates the statistics section of the metadata in memory,
+// it is written to the file with the next metadata write.
+func (p *pager) setStatsMetadata(data []byte) error {
+	if len(data) > statsMetadataSize-2 {
+		return fmt.Errorf("statistics metadata must be less than %d bytes", statsMetadataSize-2)
+	}
+
+	p.metadata.stats = data
+
+	return nil
+}
+
+// writeStatsMetadata writes the statistics section of the metadata.
+func (p *pager) writeStatsMetadata(data []byte) error {
+	if err := p.setStatsMetadata(data); err != nil {
+		return err
+	}
+
+	if err := p.storeMetadata(); err != nil {
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// writeUserMetadata writes the application-defined section of the metadata.
+func (p *pager) writeUserMetadata(data []byte) error {
+	if len(data) > userMetadataSize-2 {
+		return fmt.Errorf("user metadata must be less than or equal to %d bytes", userMetadataSize-2)
+	}
+
+	previous := p.metadata.user
+	p.metadata.user = data
+	if err := p.storeMetadata(); err != nil {
+		p.metadata.user = previous
+
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
+// writeSequence writes the last value of the sequence.
+func (p *pager) writeSequence(sequence uint64) error {
+	previous := p.metadata.sequence
+	p.metadata.sequence = sequence
+	if err := p.storeMetadata(); err != nil {
+		p.metadata.sequence = previous
+
+		return fmt.Errorf("failed to write metadata: %w", err)
+	}
+
+	return nil
+}
+
 // writeMetadata reads custom metadata from the metadata section of the file.
 func (p *pager) readCustomMetadata() ([]byte, error) {
 	metadata, err := readMetadata(p.file)
@@ -366,18 +650,24 @@ func (p *pager) free(pageId uint32) error {
 		return fmt.Errorf("the page is already free")
 	}
 
-	if (len(p.lastFreePage.ids)*pageIdSize + pageIdSize) < int(p.pageSize) {
+	if p.secureDelete {
+		if err := writePage(p.file, pageId, make([]byte, p.pageSize), p.pageSize); err != nil {
+			return fmt.Errorf("failed to zero the page: %w", err)
+		}
+	}
+
+	if container := p.freePageWithRoom(); container != nil {
 		// update the page that contains the free pages
-		p.lastFreePage.ids[pageId] = struct{}{}
-		data := encodeFreePage(p.lastFreePage, p.pageSize)
-		if err := writePage(p.file, p.lastFreePage.pageId, data, p.pageSize); err != nil {
+		container.ids[pageId] = struct{}{}
+		data := encodeFreePage(container, p.pageSize)
+		if err := p.writeFreePage(container.pageId, data); err != nil {
 			// revert the changes
-			delete(p.lastFreePage.ids, pageId)
+			delete(container.ids, pageId)
 
-			return fmt.Errorf("failed to update the last free page: %w", err)
+			return fmt.Errorf("failed to update the free page: %w", err)
 		}
 
-		p.isFreePage[pageId] = p.lastFreePage
+		p.isFreePage[pageId] = container
 	} else {
 		// if there is not enough space for the free page list
 		newPageId, err := p.new()
@@ -390,13 +680,13 @@ func (p *pager) free(pageId uint32) error {
 		newFreePage := &freePage{newPageId, newIds, 0}
 
 		data := encodeFreePage(newFreePage, p.pageSize)
-		if err := writePage(p.file, newPageId, data, p.pageSize); err != nil {
+		if err := p.writeFreePage(newPageId, data); err != nil {
 			return fmt.Errorf("failed to write the new free page: %w", err)
 		}
 
 		p.lastFreePage.nextPageId = newPageId
 		data = encodeFreePage(p.lastFreePage, p.pageSize)
-		if err := writePage(p.file, p.lastFreePage.pageId, data, p.pageSize); err != nil {
+		if err := p.writeFreePage(p.lastFreePage.pageId, data); err != nil {
 			// revert the changes
 			p.lastFreePage.nextPageId = 0
 
@@ -407,11 +697,69 @@ func (p *pager) free(pageId uint32) error {
 		p.lastFreePage = newFreePage
 		p.isFreePage[pageId] = newFreePage
 		p.freePages[newPageId] = newFreePage
+		debugf(p.logger, "allocated the free page list %d for %d free pages", newPageId, len(p.isFreePage))
+
+		if p.strictSync {
+			if err := p.flush(); err != nil {
+				return fmt.Errorf("failed to flush the new free page: %w", err)
+			}
+		}
+	}
+
+	if p.lowestFree != nil {
+		i := sort.Search(len(p.lowestFree), func(i int) bool { return p.lowestFree[i] >= pageId })
+		p.lowestFree = append(p.lowestFree, 0)
+		copy(p.lowestFree[i+1:], p.lowestFree[i:])
+		p.lowestFree[i] = pageId
 	}
 
 	return nil
 }
 
+// freePageWithRoom returns the free page list that has the room for one
+// more free page, the last one is preferred, so the lists emptied by the
+// reused pages are filled again instead of allocating the new ones.
+func (p *pager) freePageWithRoom() *freePage {
+	hasRoom := func(freePage *freePage) bool {
+		return len(freePage.ids)*pageIdSize+pageIdSize < int(p.pageSize)
+	}
+
+	if hasRoom(p.lastFreePage) {
+		return p.lastFreePage
+	}
+
+	for pageId := firstFreePageId; pageId != 0; pageId = p.freePages[pageId].nextPageId {
+		if hasRoom(p.freePages[pageId]) {
+			return p.freePages[pageId]
+		}
+	}
+
+	return nil
+}
+
+// writeFreePage writes the page of the free page list.
+func (p *pager) writeFreePage(pageId uint32, data []byte) error {
+	return p.logged(walStructure, func() error {
+		return writePage(p.file, pageId, data, p.pageSize)
+	})
+}
+
+// storeMetadata writes the metadata to the file.
+func (p *pager) storeMetadata() error {
+	return p.logged(walStructure, func() error {
+		return writeMetadata(p.file, p.metadata)
+	})
+}
+
+// logged makes the changes of fn the changes of the kind, see walKind.
+func (p *pager) logged(kind walKind, fn func() error) error {
+	if p.wal == nil {
+		return fn()
+	}
+
+	return p.wal.as(kind, fn)
+}
+
 // encodeFreePage encodes free page identifiers into the chunks of byte slices.
 func encodeFreePage(page *freePage, pageSize uint16) []byte {
 	data := make([]byte, pageSize)
@@ -474,115 +822,101 @@ func (p *pager) write(pageId uint32, data []byte) error {
 }
 
 // compact removes the free pages that are placed at the end of file and
-// if the free page lists does not contains any free page, it frees the free page list.
+// rebuilds the free page lists in the lowest of the remaining free pages,
+// so the free page lists do not keep the end of the file.
 func (p *pager) compact() error {
-	newLastPageId := p.lastPageId
-	removeFreePageIds := make([]uint32, 0)
-	removeFreePages := make(map[uint32]*freePage)
-	// the copy of free pages to be updated
-	updateFreePages := make(map[uint32]*freePage)
-	for pageId := p.lastPageId; pageId > firstFreePageId; pageId-- {
-		if p.isFree(pageId) {
-			removeFreePageIds = append(removeFreePageIds, pageId)
-
-			freePage := p.isFreePage[pageId]
-			updatePage, ok := updateFreePages[freePage.pageId]
-			if !ok {
-				updatePage = freePage.copy()
-				updateFreePages[updatePage.pageId] = updatePage
-			}
-			delete(updatePage.ids, pageId)
-
-			newLastPageId = pageId - 1
-		} else if p.canDeleteFreePage(pageId) {
-			freePage := p.freePages[pageId]
-			removeFreePages[pageId] = freePage
-
-			if prevPageId, ok := p.prevPageIds[pageId]; ok {
-				prevPage := p.freePages[prevPageId]
-				updatePage, ok := updateFreePages[prevPageId]
-				if !ok {
-					updatePage = prevPage.copy()
-					updateFreePages[prevPageId] = updatePage
-				}
-				updatePage.nextPageId = freePage.nextPageId
-			}
+	// the free page lists except the first one are free pages too
+	pool := make(map[uint32]struct{}, len(p.isFreePage)+len(p.freePages))
+	for pageId := range p.isFreePage {
+		pool[pageId] = struct{}{}
+	}
+	for pageId := range p.freePages {
+		if pageId != firstFreePageId {
+			pool[pageId] = struct{}{}
+		}
+	}
 
-			newLastPageId = pageId - 1
-		} else {
+	newLastPageId := p.lastPageId
+	for newLastPageId > firstFreePageId {
+		if _, ok := pool[newLastPageId]; !ok {
 			break
 		}
+		newLastPageId--
 	}
-
-	// update free pages and last free page id
-	freeBytes := int64(len(removeFreePages)+len(removeFreePageIds)) * int64(p.pageSize)
-	if freeBytes == 0 {
+	if newLastPageId == p.lastPageId {
 		return nil
 	}
 
-	stat, err := p.file.Stat()
-	if err != nil {
-		return fmt.Errorf("failed to get the file size: %w", err)
+	pageIds := make([]uint32, 0, len(pool))
+	for pageId := range pool {
+		if pageId <= newLastPageId {
+			pageIds = append(pageIds, pageId)
+		}
 	}
-
-	newSize := stat.Size() - freeBytes
-	err = p.file.Truncate(newSize)
-	if err != nil {
-		return fmt.Errorf("failed to truncate the file: %w", err)
+	sort.Slice(pageIds, func(i, j int) bool { return pageIds[i] < pageIds[j] })
+
+	// the ids and the link to the next list fit into the page,
+	// the lowest pages become the free page lists
+	capacity := (int(p.pageSize) - pageIdSize) / pageIdSize
+	lists := len(pageIds) / (capacity + 1)
+	containerIds := append([]uint32{firstFreePageId}, pageIds[:lists]...)
+	pageIds = pageIds[lists:]
+
+	freePages := make([]*freePage, len(containerIds))
+	for i, containerId := range containerIds {
+		ids := make(map[uint32]struct{})
+		for len(pageIds) > 0 && len(ids) < capacity {
+			ids[pageIds[0]] = struct{}{}
+			pageIds = pageIds[1:]
+		}
+		freePages[i] = &freePage{containerId, ids, 0}
+		if i > 0 {
+			freePages[i-1].nextPageId = containerId
+		}
 	}
 
-	for pageId := range removeFreePages {
-		delete(updateFreePages, pageId)
-	}
-	for pageId, updatePage := range updateFreePages {
-		data := encodeFreePage(updatePage, p.pageSize)
-		if err := writePage(p.file, pageId, data, p.pageSize); err != nil {
+	for _, freePage := range freePages {
+		data := encodeFreePage(freePage, p.pageSize)
+		if err := p.writeFreePage(freePage.pageId, data); err != nil {
 			return fmt.Errorf("failed to update the free page: %w", err)
 		}
 	}
 
-	for pageId, updateFreePage := range updateFreePages {
-		freePage := p.freePages[pageId]
-		freePage.pageId = updateFreePage.pageId
-		freePage.ids = updateFreePage.ids
-		freePage.nextPageId = updateFreePage.nextPageId
-	}
-	for _, removeId := range removeFreePageIds {
-		delete(p.isFreePage, removeId)
+	// the pages allocated in advance are truncated too
+	newSize := int64(newLastPageId)*int64(p.pageSize) + metadataSize
+	if err := p.file.Truncate(newSize); err != nil {
+		return fmt.Errorf("failed to truncate the file: %w", err)
 	}
-	for pageId, removePage := range removeFreePages {
-		if p.lastFreePage == removePage {
-			p.lastFreePage = p.freePages[p.prevPageIds[removePage.pageId]]
-		}
 
-		delete(p.prevPageIds, pageId)
-		delete(p.freePages, pageId)
+	p.isFreePage = make(map[uint32]*freePage)
+	p.freePages = make(map[uint32]*freePage)
+	p.prevPageIds = make(map[uint32]uint32)
+	for i, freePage := range freePages {
+		for pageId := range freePage.ids {
+			p.isFreePage[pageId] = freePage
+		}
+		p.freePages[freePage.pageId] = freePage
+		if i > 0 {
+			p.prevPageIds[freePage.pageId] = freePages[i-1].pageId
+		}
+	}
+	p.lastFreePage = freePages[len(freePages)-1]
+	if p.lowestFree != nil {
+		p.allocateLowest()
 	}
 
 	p.lastPageId = newLastPageId
+	p.filePages = newLastPageId
 
 	return nil
 }
 
-// canDeleteFreePage checks if the page is a free page list container
-// and if all the pages in the container are free.
-func (p *pager) canDeleteFreePage(pageId uint32) bool {
-	freePage, isFreePage := p.freePages[pageId]
-	if !isFreePage {
-		return false
-	}
-
-	for id := range freePage.ids {
-		if _, isFree := p.isFreePage[id]; !isFree {
-			return false
-		}
-	}
-
-	return true
-}
-
 // flush flushes all the changes of the file to the persistent disk.
 func (p *pager) flush() error {
+	if p.readOnly {
+		return nil
+	}
+
 	if err := p.file.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
@@ -592,7 +926,20 @@ func (p *pager) flush() error {
 
 // close flushes the changes and closes all underlying resources.
 func (p *pager) close() error {
+	if p.readOnly {
+		return p.file.Close()
+	}
+
+	// the file is closed anyway, so it is unlocked and can be opened again
+	if err := p.trim(); err != nil {
+		p.file.Close()
+
+		return err
+	}
+
 	if err := p.file.Sync(); err != nil {
+		p.file.Close()
+
 		return fmt.Errorf("failed to sync file: %w", err)
 	}
 
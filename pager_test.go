@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"os"
 	"path"
 	"testing"
@@ -232,6 +233,52 @@ func TestNewAfterFreeUsesFreePage(t *testing.T) {
 	}
 }
 
+func TestNewClearsReusedPage(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	p, err := openPager(path.Join(dbDir, "test.db"), 4096)
+	if err != nil {
+		t.Fatalf("failed to initialize the pager: %s", err)
+	}
+	defer p.close()
+
+	pageId, err := p.new()
+	if err != nil {
+		t.Fatalf("failed to new page: %s", err)
+	}
+
+	data := make([]byte, 4096)
+	for i := range data {
+		data[i] = 42
+	}
+	if err := p.write(pageId, data); err != nil {
+		t.Fatalf("failed to write page: %s", err)
+	}
+
+	if err := p.free(pageId); err != nil {
+		t.Fatalf("failed to free page: %s", err)
+	}
+
+	newPageId, err := p.new()
+	if err != nil {
+		t.Fatalf("failed to new page: %s", err)
+	}
+
+	read, err := p.read(newPageId)
+	if err != nil {
+		t.Fatalf("failed to read page: %s", err)
+	}
+
+	if !bytes.Equal(read, make([]byte, 4096)) {
+		t.Fatalf("the reused page must be empty")
+	}
+}
+
 func TestFreePageSplitting(t *testing.T) {
 	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
 	defer func() {
@@ -793,3 +840,68 @@ func (f *mockedFile) setErrorOnStat(errorOnStat error) {
 func (f *mockedFile) Stat() (os.FileInfo, error) {
 	return nil, f.errorOnStat
 }
+
+func TestCompactKeepsFreePageListsConsistent(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	var pageSize uint16 = 32
+	for seed := int64(0); seed < 20; seed++ {
+		dbPath := path.Join(dbDir, fmt.Sprintf("test_%d.db", seed))
+		p, err := openPager(dbPath, pageSize)
+		if err != nil {
+			t.Fatalf("failed to initialize the pager: %s", err)
+		}
+
+		for i := 0; i < 200; i++ {
+			if _, err := p.new(); err != nil {
+				t.Fatalf("failed to new page: %s", err)
+			}
+		}
+
+		// the free page lists are spread over the file
+		r := rand.New(rand.NewSource(seed))
+		for _, i := range r.Perm(200)[:150] {
+			if err := p.free(uint32(i + 2)); err != nil {
+				t.Fatalf("failed to free page: %s", err)
+			}
+		}
+
+		if err := p.compact(); err != nil {
+			t.Fatalf("failed to compact: %s", err)
+		}
+		lastPageId, freeCount := p.lastPageId, len(p.isFreePage)
+
+		if err := p.close(); err != nil {
+			t.Fatalf("failed to close: %s", err)
+		}
+
+		p, err = openPager(dbPath, pageSize)
+		if err != nil {
+			t.Fatalf("failed to reopen the pager for seed %d: %s", seed, err)
+		}
+
+		if p.lastPageId != lastPageId || len(p.isFreePage) != freeCount {
+			t.Fatalf("expected %d pages and %d free pages, but got %d and %d", lastPageId, freeCount, p.lastPageId, len(p.isFreePage))
+		}
+		for pageId := range p.isFreePage {
+			if pageId > p.lastPageId {
+				t.Fatalf("free page %d is beyond the last page %d", pageId, p.lastPageId)
+			}
+		}
+
+		for i := 0; i < freeCount; i++ {
+			if pageId, err := p.new(); err != nil || pageId > lastPageId {
+				t.Fatalf("expected the free page, but got page %d: %v", pageId, err)
+			}
+		}
+
+		if err := p.close(); err != nil {
+			t.Fatalf("failed to close: %s", err)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// GetN returns up to n keys that are greater than the given key and their
+// values in ascending key order. The nil key starts from the first key of
+// the tree. The next page starts after the last returned key, so the pages
+// are read without keeping the iterator between the calls.
+func (t *FBPTree) GetN(afterKey []byte, n int) ([][]byte, [][]byte, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, nil, ErrClosed
+	}
+
+	op := t.beginOperation()
+	keys, values, err := t.getN(afterKey, n)
+	t.endOperation(op, OperationForEach, 0, 0, err)
+
+	return keys, values, err
+}
+
+func (t *FBPTree) getN(afterKey []byte, n int) ([][]byte, [][]byte, error) {
+	if n < 0 {
+		return nil, nil, fmt.Errorf("the number of the keys must not be negative, but got %d", n)
+	}
+
+	keys := make([][]byte, 0)
+	values := make([][]byte, 0)
+	if n == 0 {
+		return keys, values, nil
+	}
+
+	err := t.scan(afterKey, nil, func(key, value []byte) bool {
+		if afterKey != nil && !t.less(afterKey, key) {
+			// the page starts after the key
+			return true
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+
+		return len(keys) < n
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return keys, values, nil
+}
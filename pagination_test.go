@@ -0,0 +1,66 @@
+package fbptree
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGetN(t *testing.T) {
+	tree, err := Open(InMemory, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i += 2 {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i + 1)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	var after []byte
+	pages, count := 0, 0
+	for {
+		keys, values, err := tree.GetN(after, 7)
+		if err != nil {
+			t.Fatalf("failed to get the page: %s", err)
+		}
+		if len(keys) != len(values) {
+			t.Fatalf("expected %d values, but got %d", len(keys), len(values))
+		}
+		if len(keys) == 0 {
+			break
+		}
+
+		for i := range keys {
+			if !bytes.Equal(keys[i], []byte{byte(count * 2)}) || !bytes.Equal(values[i], []byte{byte(count*2 + 1)}) {
+				t.Fatalf("unexpected entry %v: %v at position %d", keys[i], values[i], count)
+			}
+			count++
+		}
+
+		pages++
+		after = keys[len(keys)-1]
+	}
+
+	if count != 50 || pages != 8 {
+		t.Fatalf("expected 50 keys in 8 pages, but got %d keys in %d pages", count, pages)
+	}
+
+	// the key does not have to exist
+	keys, _, err := tree.GetN([]byte{11}, 2)
+	if err != nil {
+		t.Fatalf("failed to get the page: %s", err)
+	}
+	if len(keys) != 2 || keys[0][0] != 12 || keys[1][0] != 14 {
+		t.Fatalf("expected keys 12 and 14, but got %v", keys)
+	}
+
+	if keys, _, err := tree.GetN(nil, 0); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no keys, but got %v, %v", keys, err)
+	}
+
+	if _, _, err := tree.GetN(nil, -1); err == nil {
+		t.Fatalf("expected the error for the negative number of the keys")
+	}
+}
@@ -0,0 +1,240 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrPoisoned is returned by the writes after a write failed midway, e.g.
+// because of the IO error during a split, and left the file in the unknown
+// state. The writes are rejected until Recover succeeds.
+var ErrPoisoned = errors.New("the tree is poisoned by the failed write")
+
+// write is the in-memory state of the tree before the running write.
+type write struct {
+	metadata *treeMetadata
+	lifetime Stats
+	// the number of the file writes before the write
+	writes uint64
+}
+
+// beginWrite starts the write or rejects it if the tree is poisoned.
+func (t *FBPTree) beginWrite() (*write, error) {
+	if err := t.checkWritable(); err != nil {
+		return nil, err
+	}
+
+	w := &write{lifetime: t.storage.lifetime, writes: t.storage.stats().writes}
+	if t.metadata != nil {
+		metadata := *t.metadata
+		w.metadata = &metadata
+	}
+
+	if t.storage.logged() {
+		t.storage.begin()
+	}
+	t.storage.bufferNodes()
+	if atomic.LoadInt32(&t.iterators) == 0 {
+		t.storage.forgetChanges()
+	}
+
+	return w, nil
+}
+
+// checkWritable returns an error if the tree does not accept the writes.
+func (t *FBPTree) checkWritable() error {
+	if t.closed {
+		return ErrClosed
+	}
+
+	if t.storage.pager.readOnly {
+		return ErrReadOnly
+	}
+
+	if t.tx != nil || t.readers > 0 {
+		return ErrTxOpen
+	}
+
+	if t.poisoned != nil {
+		return fmt.Errorf("%w: %v", ErrPoisoned, t.poisoned)
+	}
+
+	return nil
+}
+
+// endWrite commits the write or rolls back the in-memory state if the write
+// failed. It returns the error of the write or the error of the commit.
+func (t *FBPTree) endWrite(w *write, err error) error {
+	if err == nil && t.storage.debugChecks {
+		err = t.validateWrite()
+	}
+
+	if err == nil {
+		err = t.storage.flushNodes()
+	}
+
+	if err == nil {
+		if err := t.storage.commit(); err != nil {
+			// the logged changes are applied on the next open or by Recover
+			t.metadata = w.metadata
+			t.storage.lifetime = w.lifetime
+			t.storage.cache.clear()
+			t.poisoned = err
+
+			return fmt.Errorf("failed to commit the write: %w", err)
+		}
+
+		if err := t.syncWrite(); err != nil {
+			return err
+		}
+
+		t.autoCompact()
+
+		return nil
+	}
+
+	t.rollbackWrite(w, err)
+
+	return err
+}
+
+// rollbackWrite rolls back the in-memory state of the failed write. The
+// deferred changes are discarded, otherwise the tree is poisoned if the
+// failed write has changed or tried to change the file.
+func (t *FBPTree) rollbackWrite(w *write, err error) error {
+	t.metadata = w.metadata
+	t.storage.lifetime = w.lifetime
+	t.storage.discardNodes()
+
+	if t.storage.deferring() {
+		if err := t.storage.rollback(); err != nil {
+			t.storage.cache.clear()
+			t.poisoned = err
+
+			return err
+		}
+
+		return nil
+	}
+
+	if t.storage.stats().writes != w.writes {
+		// the cached nodes may not match the file anymore
+		t.storage.cache.clear()
+		t.poisoned = err
+	}
+
+	return nil
+}
+
+// Poisoned returns the error of the write that poisoned the tree
+// or nil if the tree is not poisoned.
+func (t *FBPTree) Poisoned() error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.poisoned
+}
+
+// Recover reloads the state of the tree from the file and verifies the
+// whole tree: the node invariants, the child and the sibling links and
+// the size. The tree accepts the writes again only if it is valid.
+func (t *FBPTree) Recover() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	t.storage.cache.clear()
+
+	if t.storage.logged() {
+		if err := t.storage.reload(); err != nil {
+			return fmt.Errorf("failed to reload the storage: %w", err)
+		}
+	}
+
+	metadata, err := t.storage.loadMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to load the tree metadata: %w", err)
+	}
+	t.metadata = metadata
+
+	if err := t.verify(); err != nil {
+		return fmt.Errorf("the tree is not valid: %w", err)
+	}
+
+	t.poisoned = nil
+
+	return nil
+}
+
+// verify reads every node of the tree from the file and checks the whole
+// tree structure.
+func (t *FBPTree) verify() error {
+	if t.metadata == nil {
+		return nil
+	}
+
+	root, err := t.checkNode(t.metadata.rootID, true)
+	if err != nil {
+		return fmt.Errorf("the root is not valid: %w", err)
+	}
+	size := 0
+	var prev *node
+	level := []*node{root}
+	for len(level) > 0 {
+		var next []*node
+		for _, n := range level {
+			if n.leaf {
+				if prev == nil && n.id != t.metadata.leftmostID {
+					return fmt.Errorf("the leftmost leaf is %d, but the metadata refers to %d", n.id, t.metadata.leftmostID)
+				}
+				if prev != nil {
+					if link := prev.next(); link == nil || link.asNodeID() != n.id {
+						return fmt.Errorf("leaf %d does not link to the next leaf %d", prev.id, n.id)
+					}
+					// the leaves of the read-only tree created before the links
+					// to the previous leaves were introduced have none
+					if n.prevID != 0 && n.prevID != prev.id {
+						return fmt.Errorf("leaf %d does not link to the previous leaf %d", n.id, prev.id)
+					}
+					if !t.less(prev.keys[prev.keyNum-1], n.keys[0]) {
+						return fmt.Errorf("the keys of leaf %d are not less than the keys of leaf %d", prev.id, n.id)
+					}
+				}
+
+				size += n.keyNum
+				prev = n
+
+				continue
+			}
+
+			for i := 0; i <= n.keyNum; i++ {
+				child, err := t.checkNode(n.pointers[i].asNodeID(), false)
+				if err != nil {
+					return err
+				}
+
+				if child.keyNum == 0 {
+					return fmt.Errorf("node %d has no keys", child.id)
+				}
+
+				next = append(next, child)
+			}
+		}
+
+		level = next
+	}
+
+	if link := prev.next(); link != nil {
+		return fmt.Errorf("the last leaf %d links to %d", prev.id, link.asNodeID())
+	}
+
+	if size != int(t.metadata.size) {
+		return fmt.Errorf("the tree has %d keys, but the metadata refers to %d", size, t.metadata.size)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+// brokenFile fails the writes after the given number of the writes.
+type brokenFile struct {
+	randomAccessFile
+
+	writes int
+}
+
+func (f *brokenFile) WriteAt(p []byte, off int64) (int, error) {
+	if f.writes <= 0 {
+		return 0, syscall.EIO
+	}
+	f.writes--
+
+	return f.randomAccessFile.WriteAt(p, off)
+}
+
+func TestFailedWritePoisonsTree(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the rejected write does not poison the tree
+	if _, _, err := tree.Put(make([]byte, maxKeySize+1), nil); err == nil {
+		t.Fatalf("expected an error for the large key")
+	}
+	if tree.Poisoned() != nil {
+		t.Fatalf("expected the tree not to be poisoned, but got %s", tree.Poisoned())
+	}
+
+	file := tree.storage.counter.file
+	tree.storage.counter.file = &brokenFile{randomAccessFile: file}
+	if _, _, err := tree.Put(encodeUint32(10), nil); err == nil {
+		t.Fatalf("expected the write error")
+	}
+
+	if !errors.Is(tree.Poisoned(), syscall.EIO) {
+		t.Fatalf("expected the tree to be poisoned by EIO, but got %v", tree.Poisoned())
+	}
+	if tree.Size() != 10 {
+		t.Fatalf("expected the size to be rolled back to 10, but got %d", tree.Size())
+	}
+
+	tree.storage.counter.file = file
+	if _, _, err := tree.Put(encodeUint32(10), nil); !errors.Is(err, ErrPoisoned) {
+		t.Fatalf("expected ErrPoisoned, but got %v", err)
+	}
+	if _, _, err := tree.Delete(encodeUint32(0)); !errors.Is(err, ErrPoisoned) {
+		t.Fatalf("expected ErrPoisoned, but got %v", err)
+	}
+
+	// the reads are allowed
+	if _, ok, err := tree.Get(encodeUint32(0)); err != nil || !ok {
+		t.Fatalf("expected the key, but got %v, %v", ok, err)
+	}
+
+	if err := tree.Recover(); err != nil {
+		t.Fatalf("failed to recover: %s", err)
+	}
+	if tree.Poisoned() != nil {
+		t.Fatalf("expected the tree not to be poisoned after the recovery")
+	}
+
+	if _, _, err := tree.Put(encodeUint32(10), nil); err != nil {
+		t.Fatalf("failed to put after the recovery: %s", err)
+	}
+	if tree.Size() != 11 {
+		t.Fatalf("expected the size 11, but got %d", tree.Size())
+	}
+}
+
+func TestRecoverDetectsInconsistentTree(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(10))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 5; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the root leaf is updated, but the size is not
+	tree.storage.counter.file = &brokenFile{randomAccessFile: tree.storage.counter.file, writes: 1}
+	if _, _, err := tree.Put(encodeUint32(100), nil); err == nil {
+		t.Fatalf("expected the write error")
+	}
+	tree.storage.counter.file = tree.storage.counter.file.(*brokenFile).randomAccessFile
+
+	if err := tree.Recover(); err == nil {
+		t.Fatalf("expected the inconsistent tree to be detected")
+	}
+	if tree.Poisoned() == nil {
+		t.Fatalf("expected the tree to stay poisoned")
+	}
+}
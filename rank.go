@@ -0,0 +1,115 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Rank returns the number of the keys that are less than the given key,
+// which is the position of the key in the tree if it exists. The rank is
+// found by descending the tree once using the counts of the keys in the
+// subtrees.
+func (t *FBPTree) Rank(key []byte) (int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return 0, ErrClosed
+	}
+
+	if t.metadata == nil {
+		return 0, nil
+	}
+
+	root, err := t.storage.loadNodeByID(t.metadata.rootID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load the root node %d: %w", t.metadata.rootID, err)
+	}
+
+	if !root.counted() {
+		return t.scanCount(nil, key)
+	}
+
+	return t.rank(root, key)
+}
+
+// SelectKth returns the key at the given zero-based position in the key
+// order and its value. It returns false if the position is out of the tree.
+// The key is found by descending the tree once using the counts of the keys
+// in the subtrees.
+func (t *FBPTree) SelectKth(n int) ([]byte, []byte, bool, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, nil, false, ErrClosed
+	}
+
+	if t.metadata == nil || n < 0 || n >= int(t.metadata.size) {
+		return nil, nil, false, nil
+	}
+
+	root, err := t.storage.loadNodeByID(t.metadata.rootID)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to load the root node %d: %w", t.metadata.rootID, err)
+	}
+
+	if !root.counted() {
+		return t.scanKth(n)
+	}
+
+	current := root
+	for !current.leaf {
+		position := 0
+		for position < current.keyNum && n >= int(current.pointers[position].count) {
+			n -= int(current.pointers[position].count)
+			position++
+		}
+
+		nextID := current.pointers[position].asNodeID()
+		next, err := t.storage.loadNodeByID(nextID)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to load the node %d: %w", nextID, err)
+		}
+
+		current = next
+	}
+
+	if n >= current.keyNum {
+		return nil, nil, false, fmt.Errorf("the counts of the keys do not match the leaf %d with %d keys", current.id, current.keyNum)
+	}
+
+	value, err := t.storage.readValue(current.pointers[n])
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	return current.keys[n], value, true, nil
+}
+
+// scanKth returns the key at the given position by traversing the keys
+// before it.
+func (t *FBPTree) scanKth(n int) ([]byte, []byte, bool, error) {
+	it, err := t.newScan(nil, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	it.keysOnly = true
+
+	for i := 0; it.HasNext(); i++ {
+		key, _, err := it.Next()
+		if err != nil {
+			return nil, nil, false, err
+		}
+
+		if i == n {
+			value, _, err := t.get(key)
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("failed to read the value: %w", err)
+			}
+
+			return key, value, true, nil
+		}
+	}
+
+	return nil, nil, false, nil
+}
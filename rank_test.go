@@ -0,0 +1,114 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRankAndSelectKth(t *testing.T) {
+	tree, err := Open(InMemory, Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if key, _, ok, err := tree.SelectKth(0); err != nil || ok {
+		t.Fatalf("expected no key in the empty tree, but got %v, %v", key, err)
+	}
+
+	// the keys are 0, 3, 6, ..., 297
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put([]byte{byte(i * 3 / 256), byte(i * 3 % 256)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	for i := 0; i < 100; i += 4 {
+		if _, _, err := tree.Delete([]byte{byte(i * 3 / 256), byte(i * 3 % 256)}); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+
+	position := 0
+	for i := 0; i < 100; i++ {
+		key := []byte{byte(i * 3 / 256), byte(i * 3 % 256)}
+		rank, err := tree.Rank(key)
+		if err != nil {
+			t.Fatalf("failed to rank: %s", err)
+		}
+		if rank != position {
+			t.Fatalf("expected rank %d for key %v, but got %d", position, key, rank)
+		}
+
+		if i%4 == 0 {
+			continue
+		}
+
+		selected, value, ok, err := tree.SelectKth(position)
+		if err != nil {
+			t.Fatalf("failed to select: %s", err)
+		}
+		if !ok || !bytes.Equal(selected, key) || !bytes.Equal(value, []byte{byte(i)}) {
+			t.Fatalf("expected key %v at position %d, but got %v", key, position, selected)
+		}
+
+		position++
+	}
+
+	if rank, err := tree.Rank([]byte{255}); err != nil || rank != 75 {
+		t.Fatalf("expected rank 75, but got %d, %v", rank, err)
+	}
+	if _, _, ok, err := tree.SelectKth(75); err != nil || ok {
+		t.Fatalf("expected no key at position 75, but got %v", err)
+	}
+	if _, _, ok, err := tree.SelectKth(-1); err != nil || ok {
+		t.Fatalf("expected no key at position -1, but got %v", err)
+	}
+}
+
+func TestRankAndSelectKthWithoutCounts(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 50; i++ {
+		if _, _, err := tree.Put([]byte{byte(i * 2)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	uncount(t, tree, tree.metadata.rootID)
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3), ReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if rank, err := tree.Rank([]byte{21}); err != nil || rank != 11 {
+		t.Fatalf("expected rank 11, but got %d, %v", rank, err)
+	}
+
+	key, value, ok, err := tree.SelectKth(11)
+	if err != nil {
+		t.Fatalf("failed to select: %s", err)
+	}
+	if !ok || !bytes.Equal(key, []byte{22}) || !bytes.Equal(value, []byte{11}) {
+		t.Fatalf("expected key 22 at position 11, but got %v", key)
+	}
+}
@@ -0,0 +1,199 @@
+package fbptree
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+)
+
+// Reader reads the entries of the tree file, e.g. a backup copy, without
+// opening the tree: it does not parse the free page lists, does not allocate
+// the write structures and never writes to the file. It is intended for the
+// restore validation and the offline analysis tools.
+type Reader struct {
+	storage  *storage
+	metadata *treeMetadata
+	closer   io.Closer
+
+	// the roles of the pages, read by the first Page call
+	layout *pageLayout
+}
+
+// OpenReader opens the tree file by the path for reading only. The codecs
+// are required only to read the trees compressed with the custom codecs.
+func OpenReader(path string, codecs ...Codec) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	r, err := NewReader(file, codecs...)
+	if err != nil {
+		file.Close()
+
+		return nil, err
+	}
+	r.closer = file
+
+	return r, nil
+}
+
+// NewReader instantiates the reader over the tree file contents. The
+// codecs are required only to read the trees compressed with the custom
+// codecs, the entries of such a tree can not be read without its codec.
+func NewReader(r io.ReaderAt, codecs ...Codec) (*Reader, error) {
+	metadata, err := readMetadata(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+
+	if metadata.pageSize < minPageSize {
+		return nil, fmt.Errorf("the page size %d is less than %d, the file is not a tree", metadata.pageSize, minPageSize)
+	}
+
+	return newReader(r, metadata, codecs)
+}
+
+// newReader instantiates the reader over the tree file contents
+// with the given file metadata.
+func newReader(r io.ReaderAt, metadata *metadata, codecs []Codec) (*Reader, error) {
+	storage := newReadStorage(r, metadata)
+	treeMetadata, err := storage.loadMetadata()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the tree metadata: %w", err)
+	}
+	if treeMetadata != nil {
+		storage.records.codec = resolveCodec(treeMetadata.codec, codecs)
+	}
+
+	return &Reader{storage: storage, metadata: treeMetadata}, nil
+}
+
+// newReadStorage returns the storage that reads the tree file contents
+// with the given file metadata.
+func newReadStorage(r io.ReaderAt, metadata *metadata) *storage {
+	counter := newCountingFile(readOnlyFile{r})
+	pager := &pager{
+		file:     counter,
+		pageSize: metadata.pageSize,
+		// the free pages are never referenced from the tree
+		isFreePage: make(map[uint32]*freePage),
+		lastPageId: lastPageIdOf(r, metadata.pageSize),
+		metadata:   metadata,
+	}
+
+	return &storage{pager: pager, records: newRecords(pager), counter: counter, cache: newNodeCache(0)}
+}
+
+// Size returns the number of the entries in the tree.
+func (r *Reader) Size() int {
+	if r.metadata != nil {
+		return int(r.metadata.size)
+	}
+
+	return 0
+}
+
+// ForEach traverses the leaves in the key order of the tree.
+func (r *Reader) ForEach(action func(key []byte, value []byte)) error {
+	if r.metadata == nil {
+		return nil
+	}
+
+	for nodeID, leaves := r.metadata.leftmostID, uint32(0); nodeID != 0; leaves++ {
+		if leaves > r.storage.pager.lastPageId {
+			return &CorruptionError{Record: nodeID, Reason: "the leaves link to each other in a cycle"}
+		}
+
+		leaf, err := r.storage.loadNodeByID(nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to load the leaf %d: %w", nodeID, err)
+		}
+
+		if !leaf.leaf {
+			return fmt.Errorf("node %d is not a leaf", nodeID)
+		}
+
+		for i := 0; i < leaf.keyNum; i++ {
+			if leaf.pointers[i].expired() {
+				continue
+			}
+
+			value, err := r.storage.readValue(leaf.pointers[i])
+			if err != nil {
+				return err
+			}
+
+			action(leaf.keys[i], value)
+		}
+
+		nodeID = leaf.nextID()
+	}
+
+	return nil
+}
+
+// Close closes the file if the reader was opened by the path.
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+
+	if err := r.closer.Close(); err != nil {
+		return fmt.Errorf("failed to close the file: %w", err)
+	}
+
+	return nil
+}
+
+// lastPageIdOf returns the identifier of the last page of the contents if
+// their size is known, otherwise it returns the maximum identifier.
+func lastPageIdOf(r io.ReaderAt, pageSize uint16) uint32 {
+	size := int64(-1)
+	switch contents := r.(type) {
+	case interface{ Size() int64 }:
+		size = contents.Size()
+	case interface{ Stat() (fs.FileInfo, error) }:
+		if info, err := contents.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+
+	if size < 0 {
+		return math.MaxUint32
+	}
+
+	if size <= metadataSize {
+		return 0
+	}
+
+	return uint32((size - metadataSize) / int64(pageSize))
+}
+
+// readOnlyFile adapts the reader to the file interface of the pager
+// and fails all the changes.
+type readOnlyFile struct {
+	io.ReaderAt
+}
+
+func (f readOnlyFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, fmt.Errorf("the file is read-only")
+}
+
+func (f readOnlyFile) Close() error {
+	return nil
+}
+
+func (f readOnlyFile) Sync() error {
+	return nil
+}
+
+func (f readOnlyFile) Stat() (fs.FileInfo, error) {
+	return nil, fmt.Errorf("the file is read-only")
+}
+
+func (f readOnlyFile) Truncate(size int64) error {
+	return fmt.Errorf("the file is read-only")
+}
@@ -0,0 +1,121 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), PageSize(64))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for _, c := range treeCases {
+		if _, _, err := tree.Put([]byte{c.key}, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+	// free pages must not disturb the reader
+	for _, c := range treeCases[:10] {
+		if _, _, err := tree.Delete([]byte{c.key}); err != nil {
+			t.Fatalf("failed to delete key %d: %s", c.key, err)
+		}
+	}
+
+	expected := make(map[string]string)
+	err = tree.ForEach(func(key, value []byte) {
+		expected[string(key)] = string(value)
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	reader, err := OpenReader(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open the reader: %s", err)
+	}
+	defer reader.Close()
+
+	if reader.Size() != len(expected) {
+		t.Fatalf("expected size %d, but got %d", len(expected), reader.Size())
+	}
+
+	actual := make(map[string]string)
+	var prev []byte
+	err = reader.ForEach(func(key, value []byte) {
+		if prev != nil && bytes.Compare(prev, key) >= 0 {
+			t.Fatalf("keys are not in order: %v, %v", prev, key)
+		}
+		prev = key
+
+		actual[string(key)] = string(value)
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+}
+
+func TestReaderForEmptyTree(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	reader, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to instantiate the reader: %s", err)
+	}
+
+	if reader.Size() != 0 {
+		t.Fatalf("expected the empty tree, but got size %d", reader.Size())
+	}
+
+	err = reader.ForEach(func(key, value []byte) {
+		t.Fatal("call is not expected")
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(data[:10])); err == nil {
+		t.Fatalf("expected the error for the truncated file")
+	}
+}
@@ -0,0 +1,34 @@
+package fbptree
+
+import (
+	"errors"
+)
+
+// ErrReadOnly is returned by the writes to the tree opened with the ReadOnly
+// option or from the read-only file system. Such a tree serves the reads as
+// usual.
+var ErrReadOnly = errors.New("the tree is read-only")
+
+// ReadOnly option opens the existing file for reading only. The writes are
+// rejected with ErrReadOnly and nothing is written to the file, not even the
+// free pages or the statistics on close, so many processes can read the same
+// file at once. The readers share the lock of the file, so the file opened
+// for writing can not be opened for reading and the other way around, Open
+// returns ErrLocked for both. With the WriteAheadLog option the file with
+// the pending log is rejected, since the log can not be replayed.
+func ReadOnly() func(*config) error {
+	return func(c *config) error {
+		c.readOnly = true
+
+		return nil
+	}
+}
+
+// ReadOnly returns true if the tree is opened with the ReadOnly option
+// or from the read-only file system.
+func (t *FBPTree) ReadOnly() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.storage.pager.readOnly
+}
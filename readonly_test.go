@@ -0,0 +1,178 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestOpenOnReadOnlyFileSystem(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close the tree: %s", err)
+	}
+
+	before, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	prevOpenFileFunc := openFile
+	defer func() {
+		openFile = prevOpenFileFunc
+	}()
+	openFile = func(name string, flag int, perm os.FileMode) (*os.File, error) {
+		if flag&(os.O_RDWR|os.O_WRONLY) != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EROFS}
+		}
+
+		return prevOpenFileFunc(name, flag, perm)
+	}
+
+	if _, err := Open(path.Join(dbDir, "new.data")); err == nil {
+		t.Fatalf("expected an error for the new file")
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if !tree.ReadOnly() {
+		t.Fatalf("expected the tree to be read-only")
+	}
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if value, ok, err := tree.Get(key); err != nil || !ok || string(value) != string(key) {
+			t.Fatalf("failed to get key %d: %v, %v", i, ok, err)
+		}
+	}
+
+	if _, _, err := tree.Put([]byte{1}, nil); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, but got %v", err)
+	}
+	if _, _, err := tree.Delete(encodeUint32(0)); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, but got %v", err)
+	}
+	if err := tree.SetUserMetadata([]byte{1}); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, but got %v", err)
+	}
+	if err := tree.CompactRewrite(); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("expected ErrReadOnly, but got %v", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close the tree: %s", err)
+	}
+
+	after, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if string(before) != string(after) {
+		t.Fatalf("expected the file not to change")
+	}
+}
+
+func TestReadOnlyOption(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if _, err := Open(path.Join(dbDir, "new.data"), ReadOnly()); err == nil {
+		t.Fatalf("expected an error for the new file")
+	}
+	if _, err := os.Stat(path.Join(dbDir, "new.data")); !os.IsNotExist(err) {
+		t.Fatalf("expected the new file not to be created, but got %v", err)
+	}
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close the tree: %s", err)
+	}
+
+	before, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	trees := make([]*FBPTree, 2)
+	for i := range trees {
+		trees[i], err = Open(dbPath, Order(3), ReadOnly())
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+	}
+
+	for _, tree := range trees {
+		if !tree.ReadOnly() {
+			t.Fatalf("expected the tree to be read-only")
+		}
+
+		for i := 50; i < 100; i++ {
+			key := encodeUint32(uint32(i))
+			if value, ok, err := tree.Get(key); err != nil || !ok || string(value) != string(key) {
+				t.Fatalf("failed to get key %d: %v, %v", i, ok, err)
+			}
+		}
+
+		if _, _, err := tree.Put([]byte{1}, nil); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("expected ErrReadOnly, but got %v", err)
+		}
+		if _, _, err := tree.Delete(encodeUint32(50)); !errors.Is(err, ErrReadOnly) {
+			t.Fatalf("expected ErrReadOnly, but got %v", err)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close the tree: %s", err)
+		}
+	}
+
+	after, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if string(before) != string(after) {
+		t.Fatalf("expected the file not to change")
+	}
+}
@@ -1,21 +1,32 @@
 package fbptree
 
 import (
+	"bytes"
 	"fmt"
+	"hash/crc32"
 	"math"
 )
 
 const maxRecordSize = math.MaxUint32
 
+// The first page of the record starts with the identifier of the next page,
+// the record size and the CRC32 checksum of the record data, the next pages
+// start with the identifier of the next page. The zero checksum is not
+// verified, the records written before the checksums were introduced have it.
+const recordChecksumPosition = 12
+
 // records is an abstraction over the pages that
 // allows to gather pages into the records of the variable size.
 type records struct {
 	pager *pager
+
+	// the codec of the records, nil if they are not compressed
+	codec Codec
 }
 
 // newRecords instantiates new instance of the records.
 func newRecords(pager *pager) *records {
-	return &records{pager}
+	return &records{pager: pager}
 }
 
 // new instantiates new record and returns its identifier or error.
@@ -30,7 +41,17 @@ func (r *records) new() (uint32, error) {
 
 // write writes record and accepts variable data length, in case if data
 // length is larger than page size, it will require more pages and update them.
+// The existing pages which content is not changed are not rewritten.
 func (r *records) write(recordId uint32, data []byte) error {
+	if r.codec != nil {
+		encoded, err := r.codec.Encode(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode the record %d: %w", recordId, err)
+		}
+
+		data = encoded
+	}
+
 	recordSize := len(data)
 	if recordSize >= maxRecordSize {
 		return fmt.Errorf("the record size must be less than %d", maxRecordSize)
@@ -40,6 +61,7 @@ func (r *records) write(recordId uint32, data []byte) error {
 	if err != nil {
 		return fmt.Errorf("failed to read the initial record page %d: %w", recordId, err)
 	}
+	original := copyBytes(pageData)
 	nextId := nextRecordId(pageData)
 
 	freeNextPage := true
@@ -54,8 +76,13 @@ func (r *records) write(recordId uint32, data []byte) error {
 		clearNextRecordId(pageData)
 	}
 
-	copy(pageData[8:16], encodeUint32(uint32(recordSize)))
+	copy(pageData[8:12], encodeUint32(uint32(recordSize)))
+	copy(pageData[recordChecksumPosition:16], encodeUint32(crc32.ChecksumIEEE(data)))
 	copy(pageData[16:], data[0:writeSize])
+	if r.pager.secureDelete {
+		// the previous longer record must not leave its tail
+		reset(pageData[16+writeSize:])
+	}
 
 	var newPageId uint32
 	if nextId == 0 && written < recordSize {
@@ -67,7 +94,7 @@ func (r *records) write(recordId uint32, data []byte) error {
 		setNextRecordId(pageData, newPageId)
 	}
 
-	if err := r.pager.write(recordId, pageData); err != nil {
+	if err := r.writeChanged(recordId, original, pageData); err != nil {
 		return fmt.Errorf("failed to write the page data for page %d: %w", recordId, err)
 	}
 
@@ -77,6 +104,7 @@ func (r *records) write(recordId uint32, data []byte) error {
 		if err != nil {
 			return fmt.Errorf("failed to read page %d: %w", nextId, err)
 		}
+		original := copyBytes(pageData)
 
 		nextId = nextRecordId(pageData)
 		if freeNextPage {
@@ -95,6 +123,10 @@ func (r *records) write(recordId uint32, data []byte) error {
 
 			copy(pageData[8:], data[written:written+toWrite])
 			written += toWrite
+
+			if r.pager.secureDelete {
+				reset(pageData[8+toWrite:])
+			}
 		}
 
 		freeNextPage = written >= recordSize
@@ -111,7 +143,7 @@ func (r *records) write(recordId uint32, data []byte) error {
 			setNextRecordId(pageData, newPageId)
 		}
 
-		if err := r.pager.write(pageId, pageData); err != nil {
+		if err := r.writeChanged(pageId, original, pageData); err != nil {
 			return fmt.Errorf("failed to write page %d: %w", pageId, err)
 		}
 	}
@@ -145,6 +177,28 @@ func (r *records) write(recordId uint32, data []byte) error {
 	return nil
 }
 
+// pagesFor returns the number of the pages required
+// for the record of the given size.
+func (r *records) pagesFor(recordSize int) int {
+	firstPageSize := int(r.pager.pageSize) - 16
+	if recordSize <= firstPageSize {
+		return 1
+	}
+
+	nextPageSize := int(r.pager.pageSize) - 8
+
+	return 1 + ceil(recordSize-firstPageSize, nextPageSize)
+}
+
+// writeChanged writes the page only if its content differs from the original.
+func (r *records) writeChanged(pageId uint32, original, pageData []byte) error {
+	if bytes.Equal(original, pageData) {
+		return nil
+	}
+
+	return r.pager.write(pageId, pageData)
+}
+
 func reset(data []byte) {
 	for i := 0; i < len(data); i++ {
 		data[i] = 0
@@ -179,21 +233,75 @@ func (r *records) read(recordId uint32) ([]byte, error) {
 		return nil, fmt.Errorf("failed to read initial record page: %w", err)
 	}
 
-	recordData := make([]byte, recordSize(data))
+	// the record can not be larger than the file
+	size := recordSize(data)
+	checksum := recordChecksum(data)
+	pageCount := r.pagesFor(int(size))
+	if uint64(pageCount) > uint64(r.pager.lastPageId) {
+		return nil, &CorruptionError{recordId, 8, fmt.Sprintf("the record size %d exceeds the file", size)}
+	}
+
+	recordData := make([]byte, size)
 	copy(recordData, data[16:])
-	for nextId, pageCount := nextRecordId(data), 1; nextId != 0; nextId, pageCount = nextRecordId(data), pageCount+1 {
+	for nextId, page := nextRecordId(data), 1; nextId != 0; nextId, page = nextRecordId(data), page+1 {
+		// the longer chain of the pages is the broken or cyclic link
+		if page >= pageCount {
+			return nil, &CorruptionError{recordId, 0, fmt.Sprintf("the record of %d pages links to page %d", pageCount, nextId)}
+		}
+
 		data, err = r.pager.read(nextId)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read page %d: %w", nextId, err)
 		}
 
-		from := pageCount*(int(r.pager.pageSize)-8) - 8
+		from := page*(int(r.pager.pageSize)-8) - 8
 		copy(recordData[from:], data[8:])
 	}
 
+	if checksum != 0 && checksum != crc32.ChecksumIEEE(recordData) {
+		return nil, &CorruptionError{recordId, recordChecksumPosition, "the record checksum mismatch"}
+	}
+
+	if r.codec != nil {
+		decoded, err := r.codec.Decode(recordData)
+		if err != nil {
+			return nil, &CorruptionError{recordId, 16, fmt.Sprintf("failed to decode the record: %s", err)}
+		}
+
+		return decoded, nil
+	}
+
 	return recordData, nil
 }
 
+// pages returns the identifiers of the pages of the record in order.
+func (r *records) pages(recordId uint32) ([]uint32, error) {
+	data, err := r.pager.read(recordId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read initial record page: %w", err)
+	}
+
+	pageCount := r.pagesFor(int(recordSize(data)))
+	if uint64(pageCount) > uint64(r.pager.lastPageId) {
+		return nil, &CorruptionError{recordId, 8, fmt.Sprintf("the record size %d exceeds the file", recordSize(data))}
+	}
+
+	pages := []uint32{recordId}
+	for nextId := nextRecordId(data); nextId != 0; nextId = nextRecordId(data) {
+		if len(pages) >= pageCount {
+			return nil, &CorruptionError{recordId, 0, fmt.Sprintf("the record of %d pages links to page %d", pageCount, nextId)}
+		}
+		pages = append(pages, nextId)
+
+		data, err = r.pager.read(nextId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read page %d: %w", nextId, err)
+		}
+	}
+
+	return pages, nil
+}
+
 func setNextRecordId(pageData []byte, nextId uint32) {
 	copy(pageData[0:8], encodeUint32(nextId))
 }
@@ -203,7 +311,11 @@ func clearNextRecordId(pageData []byte) {
 }
 
 func recordSize(pageData []byte) uint32 {
-	return decodeUint32(pageData[8:16])
+	return decodeUint32(pageData[8:12])
+}
+
+func recordChecksum(pageData []byte) uint32 {
+	return decodeUint32(pageData[recordChecksumPosition:16])
 }
 
 func nextRecordId(pageData []byte) uint32 {
@@ -0,0 +1,22 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !ppc64 && !ppc64le && !sparc64
+// +build linux,!mips,!mipsle,!mips64,!mips64le,!ppc64,!ppc64le,!sparc64
+
+package fbptree
+
+import (
+	"os"
+	"syscall"
+)
+
+// the FICLONE ioctl request, _IOW(0x94, 9, int)
+const ficlone = 0x40049409
+
+// reflink makes the destination file share the data blocks of the source.
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
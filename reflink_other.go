@@ -0,0 +1,14 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le || ppc64 || ppc64le || sparc64
+// +build !linux mips mipsle mips64 mips64le ppc64 ppc64le sparc64
+
+package fbptree
+
+import (
+	"fmt"
+	"os"
+)
+
+// reflink is not supported on the platform.
+func reflink(dst, src *os.File) error {
+	return fmt.Errorf("reflinks are not supported")
+}
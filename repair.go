@@ -0,0 +1,225 @@
+package fbptree
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// RepairReport describes the tree rebuilt by Repair.
+type RepairReport struct {
+	// Keys is the number of the keys in the repaired tree.
+	Keys int
+	// Salvaged is the number of the keys recovered from the leaves that are
+	// not reachable from the root, e.g. under the damaged internal node.
+	Salvaged int
+	// LostValues is the number of the keys dropped since their values
+	// can not be read.
+	LostValues int
+	// DamagedPages are the nodes referenced by the tree that can not be read.
+	DamagedPages []uint32
+	// MetadataDamaged is true if the metadata of the file can not be read,
+	// then all the keys are salvaged.
+	MetadataDamaged bool
+}
+
+// repairEntry is the recovered leaf entry.
+type repairEntry struct {
+	key      []byte
+	pointer  *pointer
+	salvaged bool
+}
+
+// Repair rebuilds the damaged tree file by the path into the new file by
+// the destination path and reports what is recovered. The entries of the
+// leaves reachable from the root are recovered, and if any node of the tree
+// or the metadata of the file can not be read, the leaves are also salvaged
+// from the pages that are not referenced by the tree, so the keys under the
+// damaged internal nodes are not lost. The pages are salvaged only from the
+// records with the checksums and the keys already recovered are skipped,
+// but the salvaged leaves may be the stale copies left by the merges, so the
+// deleted keys or the previous values may come back. The options of the
+// file are kept unless the given options change them, and if the metadata
+// is damaged, the options must give the page size, the key order and the
+// compression of the file. The recovered keys are kept in memory until the
+// new tree is built. The original file is not modified.
+func Repair(path, dstPath string, options ...func(*config) error) (*RepairReport, error) {
+	if path == InMemory || dstPath == InMemory {
+		return nil, ErrInMemory
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the options: %w", err)
+	}
+
+	report := &RepairReport{}
+	var r *Reader
+	m, err := readMetadata(file)
+	if err == nil && m.pageSize >= minPageSize {
+		r, err = newReader(file, m, []Codec{cfg.codec})
+	} else {
+		m = &metadata{pageSize: cfg.pageSize}
+	}
+
+	if r == nil {
+		// the tree is salvaged from the pages with the given options
+		report.MetadataDamaged = true
+		r = &Reader{storage: newReadStorage(file, m)}
+		r.storage.records.codec = cfg.codec
+	}
+
+	// the options of the file go first, so the given ones override them
+	cfg, err = newConfig(append(optionsOf(m.pageSize, r.metadata), options...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply the options: %w", err)
+	}
+
+	entries := r.recoverEntries(report)
+	sort.Slice(entries, func(i, j int) bool {
+		return cfg.compare(entries[i].key, entries[j].key) < 0
+	})
+
+	if err := r.rebuild(dstPath, cfg, entries, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// recoverEntries returns the entries of the reachable leaves and, if the
+// tree is damaged, of the unreachable ones.
+func (r *Reader) recoverEntries(report *RepairReport) []*repairEntry {
+	layout := r.readLayout()
+	report.DamagedPages = layout.damaged
+
+	entries := make([]*repairEntry, 0)
+	recovered := make(map[string]bool)
+	add := func(n *node, salvaged bool) {
+		for i := 0; i < n.keyNum; i++ {
+			if recovered[string(n.keys[i])] {
+				continue
+			}
+			recovered[string(n.keys[i])] = true
+
+			entries = append(entries, &repairEntry{key: n.keys[i], pointer: n.pointers[i], salvaged: salvaged})
+		}
+	}
+
+	for pageID, kind := range layout.kinds {
+		if kind != PageNode {
+			continue
+		}
+
+		n, err := r.storage.loadNodeByID(pageID)
+		if err == nil && n.leaf {
+			add(n, false)
+		}
+	}
+
+	if len(layout.damaged) == 0 && r.metadata != nil {
+		return entries
+	}
+
+	for pageID := uint32(1); pageID <= uint32(r.Pages()); pageID++ {
+		if layout.kinds[pageID] != PageUnknown {
+			continue
+		}
+
+		if n := r.salvageLeaf(pageID); n != nil {
+			add(n, true)
+		}
+	}
+
+	return entries
+}
+
+// salvageLeaf returns the leaf stored in the record of the page
+// or nil if the page is not the first page of the leaf record.
+func (r *Reader) salvageLeaf(pageID uint32) *node {
+	data, err := readPage(r.storage.pager.file, pageID, r.storage.pager.pageSize)
+	if err != nil || recordChecksum(data) == 0 {
+		return nil
+	}
+
+	// the record with the valid checksum may be the value record,
+	// it fails to decode as the node
+	n, err := r.storage.loadNodeByID(pageID)
+	if err != nil || !n.leaf {
+		return nil
+	}
+
+	return n
+}
+
+// rebuild builds the tree with the recovered entries in the temporary file
+// and renames it to the destination path.
+func (r *Reader) rebuild(dstPath string, cfg *config, entries []*repairEntry, report *RepairReport) error {
+	dir, tmpPath, err := tempFileFor(dstPath)
+	if err != nil {
+		return err
+	}
+
+	tree, err := open(tmpPath, cfg)
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to open the repaired tree: %w", err)
+	}
+
+	values := make([][]byte, 0, len(entries))
+	readable := entries[:0]
+	for _, entry := range entries {
+		value, err := r.storage.readValue(entry.pointer)
+		if err != nil {
+			report.LostValues++
+
+			continue
+		}
+
+		readable = append(readable, entry)
+		values = append(values, value)
+		if entry.salvaged {
+			report.Salvaged++
+		}
+	}
+	report.Keys = len(readable)
+
+	i := 0
+	err = tree.buildExpiring(len(readable), func() ([]byte, []byte, int64, error) {
+		entry, value := readable[i], values[i]
+		i++
+
+		return entry.key, value, entry.pointer.expiresAt, nil
+	})
+	if err != nil {
+		tree.Close()
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to build the repaired tree: %w", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to close the repaired tree: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("failed to rename the repaired file: %w", err)
+	}
+
+	if err := syncDir(dir); err != nil {
+		return fmt.Errorf("failed to sync the directory %s: %w", dir, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// createRepairTree creates the tree with the keys from 0 to n-1 and returns
+// its root node.
+func createRepairTree(t *testing.T, dbPath string, n int) uint32 {
+	tree, err := Open(dbPath, Order(5), PageSize(512))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < n; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, bytes.Repeat(key, 10)); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	rootID := tree.metadata.rootID
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	return rootID
+}
+
+// corruptFile flips the byte of the file at the offset.
+func corruptFile(t *testing.T, dbPath string, offset int64) {
+	file, err := os.OpenFile(dbPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("failed to open the file: %s", err)
+	}
+	defer file.Close()
+
+	b := make([]byte, 1)
+	if _, err := file.ReadAt(b, offset); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	b[0] ^= 0xff
+	if _, err := file.WriteAt(b, offset); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+}
+
+// expectRepairedKeys expects the keys from 0 to n-1 in the repaired tree.
+func expectRepairedKeys(t *testing.T, dbPath string, n int) {
+	tree, err := Open(dbPath, Order(5), PageSize(512))
+	if err != nil {
+		t.Fatalf("failed to open the repaired tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.Size() != n {
+		t.Fatalf("expected %d keys, but got %d", n, tree.Size())
+	}
+
+	for i := 0; i < n; i++ {
+		key := encodeUint32(uint32(i))
+		value, ok, err := tree.Get(key)
+		if err != nil || !ok || !bytes.Equal(value, bytes.Repeat(key, 10)) {
+			t.Fatalf("expected the value of the key %d, but got %v, %v, %v", i, value, ok, err)
+		}
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("unexpected problems %v", report.Problems)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	repairedPath := path.Join(dbDir, "repaired.data")
+	rootID := createRepairTree(t, dbPath, 500)
+
+	report, err := Repair(dbPath, repairedPath)
+	if err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+	if report.Keys != 500 || report.Salvaged != 0 || len(report.DamagedPages) != 0 || report.MetadataDamaged {
+		t.Fatalf("unexpected report of the healthy tree %+v", report)
+	}
+	expectRepairedKeys(t, repairedPath, 500)
+
+	// the keys under the damaged root are salvaged from the leaves
+	corruptFile(t, dbPath, int64(metadataSize+(rootID-1)*512+20))
+	if _, err := Open(dbPath, PageSize(512)); err == nil {
+		t.Fatalf("expected the damaged tree to fail to open")
+	}
+
+	report, err = Repair(dbPath, repairedPath)
+	if err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+	if report.Keys != 500 || report.Salvaged != 500 || len(report.DamagedPages) != 1 || report.DamagedPages[0] != rootID {
+		t.Fatalf("unexpected report of the damaged tree %+v", report)
+	}
+	expectRepairedKeys(t, repairedPath, 500)
+}
+
+func TestRepairDamagedMetadata(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	repairedPath := path.Join(dbDir, "repaired.data")
+	createRepairTree(t, dbPath, 200)
+
+	corruptFile(t, dbPath, metadataChecksumPosition)
+
+	report, err := Repair(dbPath, repairedPath, PageSize(512), Order(5))
+	if err != nil {
+		t.Fatalf("failed to repair: %s", err)
+	}
+	if !report.MetadataDamaged || report.Keys != 200 || report.Salvaged != 200 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	expectRepairedKeys(t, repairedPath, 200)
+}
@@ -0,0 +1,135 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// retryPolicy describes how transient IO errors are retried.
+type retryPolicy struct {
+	attempts  int
+	backoff   time.Duration
+	retryable func(error) bool
+}
+
+// RetryPolicy option retries page reads and writes that failed with
+// a transient error. The operation is tried at most attempts times, the pause
+// between the tries starts from backoff and doubles after every try. If retryable
+// is nil, EINTR, EAGAIN, EIO, ETIMEDOUT and ESTALE errors are retried.
+func RetryPolicy(attempts int, backoff time.Duration, retryable func(error) bool) func(*config) error {
+	return func(c *config) error {
+		if attempts < 1 {
+			return fmt.Errorf("attempts must be >= 1")
+		}
+
+		if backoff < 0 {
+			return fmt.Errorf("backoff must be >= 0")
+		}
+
+		if retryable == nil {
+			retryable = isTransientError
+		}
+
+		c.retryPolicy = &retryPolicy{attempts, backoff, retryable}
+
+		return nil
+	}
+}
+
+// isTransientError returns true for the errors that usually
+// disappear after some time on the network filesystems.
+func isTransientError(err error) bool {
+	return errors.Is(err, syscall.EINTR) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EIO) ||
+		errors.Is(err, syscall.ETIMEDOUT) ||
+		errors.Is(err, syscall.ESTALE)
+}
+
+// retryFile retries reads and writes of the underlying file
+// according to the policy.
+type retryFile struct {
+	file   randomAccessFile
+	policy *retryPolicy
+
+	// for mocking the time
+	sleep func(time.Duration)
+}
+
+func newRetryFile(file randomAccessFile, policy *retryPolicy) *retryFile {
+	return &retryFile{file, policy, time.Sleep}
+}
+
+func (f *retryFile) retry(operation func() error) error {
+	backoff := f.policy.backoff
+
+	var err error
+	for attempt := 1; attempt <= f.policy.attempts; attempt++ {
+		err = operation()
+		if err == nil || !f.policy.retryable(err) {
+			return err
+		}
+
+		if attempt < f.policy.attempts {
+			f.sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("gave up after %d attempts: %w", f.policy.attempts, err)
+}
+
+func (f *retryFile) ReadAt(p []byte, off int64) (int, error) {
+	var n int
+	err := f.retry(func() error {
+		var err error
+		n, err = f.file.ReadAt(p, off)
+
+		return err
+	})
+
+	return n, err
+}
+
+func (f *retryFile) WriteAt(p []byte, off int64) (int, error) {
+	var n int
+	err := f.retry(func() error {
+		var err error
+		n, err = f.file.WriteAt(p, off)
+
+		return err
+	})
+
+	return n, err
+}
+
+// Sync is not retried, because after the failed fsync the kernel
+// might have already dropped the dirty pages.
+func (f *retryFile) Sync() error {
+	return f.file.Sync()
+}
+
+func (f *retryFile) Stat() (fs.FileInfo, error) {
+	var info fs.FileInfo
+	err := f.retry(func() error {
+		var err error
+		info, err = f.file.Stat()
+
+		return err
+	})
+
+	return info, err
+}
+
+func (f *retryFile) Truncate(size int64) error {
+	return f.retry(func() error {
+		return f.file.Truncate(size)
+	})
+}
+
+func (f *retryFile) Close() error {
+	return f.file.Close()
+}
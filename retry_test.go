@@ -0,0 +1,120 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type flakyFile struct {
+	randomAccessFile
+
+	failures int
+	err      error
+	calls    int
+}
+
+func (f *flakyFile) ReadAt(p []byte, off int64) (int, error) {
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return 0, f.err
+	}
+
+	return f.randomAccessFile.ReadAt(p, off)
+}
+
+func (f *flakyFile) WriteAt(p []byte, off int64) (int, error) {
+	f.calls++
+	if f.failures > 0 {
+		f.failures--
+		return 0, f.err
+	}
+
+	return f.randomAccessFile.WriteAt(p, off)
+}
+
+func TestRetryFileRetriesTransientErrors(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	file, err := os.OpenFile(path.Join(dbDir, "test.db"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatalf("failed to open the file: %s", err)
+	}
+	defer file.Close()
+
+	flaky := &flakyFile{file, 2, &os.PathError{Op: "write", Path: "test.db", Err: syscall.EIO}, 0}
+	f := newRetryFile(flaky, &retryPolicy{3, time.Millisecond, isTransientError})
+	sleeps := make([]time.Duration, 0)
+	f.sleep = func(d time.Duration) {
+		sleeps = append(sleeps, d)
+	}
+
+	if _, err := f.WriteAt([]byte{1, 2, 3}, 0); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if flaky.calls != 3 {
+		t.Fatalf("expected 3 calls, but got %d", flaky.calls)
+	}
+	if len(sleeps) != 2 || sleeps[0] != time.Millisecond || sleeps[1] != 2*time.Millisecond {
+		t.Fatalf("unexpected backoff %v", sleeps)
+	}
+
+	flaky.failures, flaky.calls = 3, 0
+	data := make([]byte, 3)
+	if _, err := f.ReadAt(data, 0); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected to give up with EIO, but got %v", err)
+	}
+	if flaky.calls != 3 {
+		t.Fatalf("expected 3 calls, but got %d", flaky.calls)
+	}
+
+	flaky.failures, flaky.calls, flaky.err = 1, 0, fmt.Errorf("permanent error")
+	if _, err := f.ReadAt(data, 0); err == nil {
+		t.Fatal("must return the non-retryable error")
+	}
+	if flaky.calls != 1 {
+		t.Fatalf("expected 1 call for non-retryable error, but got %d", flaky.calls)
+	}
+}
+
+func TestRetryPolicyError(t *testing.T) {
+	_, err := Open("somepath", RetryPolicy(0, time.Millisecond, nil))
+	if err == nil {
+		t.Fatal("must return an error, but it does not")
+	}
+}
+
+func TestOpenWithRetryPolicy(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), RetryPolicy(3, time.Millisecond, nil))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put([]byte{1}, []byte{2}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	value, ok, err := tree.Get([]byte{1})
+	if err != nil || !ok || value[0] != 2 {
+		t.Fatalf("failed to get the value: %v %v %s", value, ok, err)
+	}
+}
@@ -0,0 +1,15 @@
+package fbptree
+
+// SecureDelete option zeroes the pages when they are freed and the unused
+// tails of the pages when the records shrink, so the deleted keys and values
+// are not recoverable from the file, including the nodes removed by the
+// merges. With Encryption the zeroed page is sealed with the fresh nonce, so
+// the previous ciphertext is overwritten as well. It costs an extra page
+// write for every freed page.
+func SecureDelete() func(*config) error {
+	return func(c *config) error {
+		c.secureDelete = true
+
+		return nil
+	}
+}
@@ -0,0 +1,182 @@
+package fbptree
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSecureDelete(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	secret := bytes.Repeat([]byte("secret"), 30)
+	for _, secure := range []bool{false, true} {
+		dbPath := path.Join(dbDir, fmt.Sprintf("sample-%v.data", secure))
+		options := []func(*config) error{Order(3), PageSize(64)}
+		if secure {
+			options = append(options, SecureDelete())
+		}
+
+		tree, err := Open(dbPath, options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for i := 0; i < 20; i++ {
+			key := encodeUint32(uint32(i))
+			value := key
+			if i%5 == 0 {
+				value = secret
+			}
+
+			if _, _, err := tree.Put(key, value); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+
+		for i := 0; i < 20; i += 5 {
+			if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+				t.Fatalf("failed to delete key %d: %s", i, err)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close the tree: %s", err)
+		}
+
+		data, err := ioutil.ReadFile(dbPath)
+		if err != nil {
+			t.Fatalf("failed to read the file: %s", err)
+		}
+
+		found := bytes.Contains(data, []byte("secret"))
+		if secure && found {
+			t.Fatalf("expected the deleted values to be zeroed")
+		}
+		if !secure && !found {
+			t.Fatalf("expected the deleted values to stay in the file without the option")
+		}
+	}
+}
+
+func TestSecureDeleteMergedNodes(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	var pageSize uint16 = 512
+	aead := newTestCipher(t, 1)
+	for _, encrypted := range []bool{false, true} {
+		for _, secure := range []bool{false, true} {
+			dbPath := path.Join(dbDir, fmt.Sprintf("sample-%v-%v.data", encrypted, secure))
+			options := []func(*config) error{Order(4), PageSize(int(pageSize))}
+			if encrypted {
+				options = append(options, Encryption(aead))
+			}
+			if secure {
+				options = append(options, SecureDelete())
+			}
+
+			tree, err := Open(dbPath, options...)
+			if err != nil {
+				t.Fatalf("failed to open tree: %s", err)
+			}
+
+			// the keys are in the nodes too, so the merged nodes keep them
+			for i := 0; i < 50; i++ {
+				key := append([]byte("secret"), encodeUint32(uint32(i))...)
+				if _, _, err := tree.Put(key, bytes.Repeat([]byte("secret"), 10)); err != nil {
+					t.Fatalf("failed to put key %d: %s", i, err)
+				}
+			}
+
+			if err := tree.Close(); err != nil {
+				t.Fatalf("failed to close the tree: %s", err)
+			}
+
+			before, err := ioutil.ReadFile(dbPath)
+			if err != nil {
+				t.Fatalf("failed to read the file: %s", err)
+			}
+
+			tree, err = Open(dbPath, options...)
+			if err != nil {
+				t.Fatalf("failed to open tree: %s", err)
+			}
+
+			// the deletes merge the nodes until the root is the only leaf
+			for i := 0; i < 50; i++ {
+				key := append([]byte("secret"), encodeUint32(uint32(i))...)
+				if _, _, err := tree.Delete(key); err != nil {
+					t.Fatalf("failed to delete key %d: %s", i, err)
+				}
+			}
+
+			if err := tree.Close(); err != nil {
+				t.Fatalf("failed to close the tree: %s", err)
+			}
+
+			data, err := ioutil.ReadFile(dbPath)
+			if err != nil {
+				t.Fatalf("failed to read the file: %s", err)
+			}
+
+			var found bool
+			if encrypted {
+				// the pages are sealed again when they are zeroed, so the
+				// ciphertext of the deleted keys and values is overwritten
+				for _, sealed := range sealedSecrets(t, before, aead, pageSize) {
+					if bytes.Contains(data, sealed) {
+						found = true
+					}
+				}
+			} else {
+				found = bytes.Contains(data, []byte("secret"))
+			}
+
+			if secure && found {
+				t.Fatalf("expected the deleted keys and values to be zeroed, encrypted %v", encrypted)
+			}
+			if !secure && !found {
+				t.Fatalf("expected the deleted keys and values to stay in the file without the option, encrypted %v", encrypted)
+			}
+		}
+	}
+}
+
+// sealedSecrets returns the encrypted pages of the file that contain the secret.
+func sealedSecrets(t *testing.T, data []byte, aead cipher.AEAD, pageSize uint16) [][]byte {
+	t.Helper()
+
+	f := newCipherFile(nil, aead, pageSize)
+	nonceSize := aead.NonceSize()
+	secrets := make([][]byte, 0)
+	for block := int64(1); f.physical(block+1) <= int64(len(data)); block++ {
+		sealed := data[f.physical(block):f.physical(block+1)]
+		page, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], encodeUint64(uint64(block)))
+		if err != nil {
+			t.Fatalf("failed to decrypt block %d: %s", block, err)
+		}
+
+		if bytes.Contains(page, []byte("secret")) {
+			secrets = append(secrets, sealed)
+		}
+	}
+	if len(secrets) == 0 {
+		t.Fatalf("expected the pages with the secret")
+	}
+
+	return secrets
+}
@@ -0,0 +1,47 @@
+package fbptree
+
+import (
+	"fmt"
+	"math"
+)
+
+// NextSequence atomically increments the sequence of the tree and returns
+// its new value, starting from 1. The sequence is stored in the metadata
+// of the file, so the unique keys, e.g. the primary keys, are generated
+// without the separate counter entry. It is not reset when the tree becomes
+// empty and moves to the new file with the compaction.
+func (t *FBPTree) NextSequence() (uint64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritable(); err != nil {
+		return 0, err
+	}
+
+	sequence := t.storage.pager.metadata.sequence
+	if sequence == math.MaxUint64 {
+		return 0, fmt.Errorf("the sequence is exhausted")
+	}
+	sequence++
+
+	if err := t.storage.pager.writeSequence(sequence); err != nil {
+		return 0, fmt.Errorf("failed to write the sequence: %w", err)
+	}
+
+	if t.strictMetadataSync {
+		if err := t.storage.flush(); err != nil {
+			return 0, fmt.Errorf("failed to flush metadata: %w", err)
+		}
+	}
+
+	return sequence, nil
+}
+
+// Sequence returns the last value returned by NextSequence or zero
+// if it has not been called.
+func (t *FBPTree) Sequence() uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.storage.pager.metadata.sequence
+}
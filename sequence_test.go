@@ -0,0 +1,89 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNextSequence(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if sequence := tree.Sequence(); sequence != 0 {
+		t.Fatalf("expected sequence 0, but got %d", sequence)
+	}
+
+	for i := uint64(1); i <= 10; i++ {
+		sequence, err := tree.NextSequence()
+		if err != nil {
+			t.Fatalf("failed to get the next sequence: %s", err)
+		}
+		if sequence != i {
+			t.Fatalf("expected sequence %d, but got %d", i, sequence)
+		}
+
+		if _, _, err := tree.Put(encodeUint64(sequence), []byte{1}); err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+
+	// the sequence is not reset with the tree
+	for i := uint64(1); i <= 10; i++ {
+		if _, _, err := tree.Delete(encodeUint64(i)); err != nil {
+			t.Fatalf("failed to delete: %s", err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if sequence := tree.Sequence(); sequence != 10 {
+		t.Fatalf("expected sequence 10, but got %d", sequence)
+	}
+	if sequence, err := tree.NextSequence(); err != nil || sequence != 11 {
+		t.Fatalf("expected sequence 11, but got %d, %v", sequence, err)
+	}
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if sequence, err := tree.NextSequence(); err != nil || sequence != 12 {
+		t.Fatalf("expected sequence 12 after the compaction, but got %d, %v", sequence, err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	readOnly, err := Open(dbPath, Order(3), ReadOnly())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer readOnly.Close()
+
+	if sequence := readOnly.Sequence(); sequence != 12 {
+		t.Fatalf("expected sequence 12, but got %d", sequence)
+	}
+	if _, err := readOnly.NextSequence(); err == nil {
+		t.Fatalf("expected the error for the read-only tree")
+	}
+}
@@ -0,0 +1,231 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const shardIndexName = "shards.index"
+
+// ShardSet is a set of the tree files in the directory sharded by the key
+// range. The routing index holds the smallest key of every shard except the
+// first one, so the shard i holds the keys in [bounds[i-1], bounds[i]) range.
+type ShardSet struct {
+	bounds  [][]byte
+	shards  []*FBPTree
+	compare func(x, y []byte) int
+}
+
+// OpenShardSet opens the set of the trees in the directory or creates a new
+// one with the given shard bounds. The bounds can be nil for the existent set,
+// otherwise they must be the same as the bounds the set was created with.
+// The options are applied to every shard.
+func OpenShardSet(dir string, bounds [][]byte, options ...func(*config) error) (*ShardSet, error) {
+	cfg, err := newConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	indexPath := filepath.Join(dir, shardIndexName)
+	stored, err := readShardIndex(indexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read the routing index: %w", err)
+	}
+
+	if err == nil {
+		if bounds != nil && !equalBounds(bounds, stored) {
+			return nil, fmt.Errorf("the shard set was created with the other bounds")
+		}
+
+		bounds = stored
+	}
+
+	for i := 1; i < len(bounds); i++ {
+		if cfg.compare(bounds[i-1], bounds[i]) >= 0 {
+			return nil, fmt.Errorf("the bounds must be sorted and unique in the key order")
+		}
+	}
+
+	s := &ShardSet{bounds: bounds, compare: cfg.compare}
+	for i := 0; i <= len(bounds); i++ {
+		shard, err := Open(filepath.Join(dir, fmt.Sprintf("shard-%04d.data", i)), options...)
+		if err != nil {
+			s.Close()
+
+			return nil, fmt.Errorf("failed to open the shard %d: %w", i, err)
+		}
+
+		s.shards = append(s.shards, shard)
+	}
+
+	if stored == nil {
+		if err := writeShardIndex(indexPath, bounds); err != nil {
+			s.Close()
+
+			return nil, fmt.Errorf("failed to write the routing index: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// shard returns the shard for the key.
+func (s *ShardSet) shard(key []byte) *FBPTree {
+	i := sort.Search(len(s.bounds), func(i int) bool {
+		return s.compare(key, s.bounds[i]) < 0
+	})
+
+	return s.shards[i]
+}
+
+// Get returns the value by the key from its shard.
+func (s *ShardSet) Get(key []byte) ([]byte, bool, error) {
+	return s.shard(key).Get(key)
+}
+
+// Put puts the key and the value into its shard.
+func (s *ShardSet) Put(key, value []byte) ([]byte, bool, error) {
+	return s.shard(key).Put(key, value)
+}
+
+// Delete deletes the key from its shard.
+func (s *ShardSet) Delete(key []byte) ([]byte, bool, error) {
+	return s.shard(key).Delete(key)
+}
+
+// Scan calls the action for the keys in [start, end) range across the
+// shards in ascending key order until the action returns false. The nil
+// start and end are the bounds of the set.
+func (s *ShardSet) Scan(start, end []byte, action func(key []byte, value []byte) bool) error {
+	first := 0
+	if start != nil {
+		first = sort.Search(len(s.bounds), func(i int) bool {
+			return s.compare(start, s.bounds[i]) < 0
+		})
+	}
+
+	stopped := false
+	for i := first; i < len(s.shards) && !stopped; i++ {
+		if end != nil && i > 0 && s.compare(s.bounds[i-1], end) >= 0 {
+			break
+		}
+
+		shard := s.shards[i]
+		shard.mu.RLock()
+		err := shard.scan(start, end, func(key, value []byte) bool {
+			if !action(key, value) {
+				stopped = true
+			}
+
+			return !stopped
+		})
+		shard.mu.RUnlock()
+		if err != nil {
+			return fmt.Errorf("failed to scan the shard %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Size returns the total number of the keys in the shards.
+func (s *ShardSet) Size() int {
+	size := 0
+	for _, shard := range s.shards {
+		size += shard.Size()
+	}
+
+	return size
+}
+
+// Close closes all the shards.
+func (s *ShardSet) Close() error {
+	var closeErr error
+	for i, shard := range s.shards {
+		if err := shard.Close(); err != nil && closeErr == nil {
+			closeErr = fmt.Errorf("failed to close the shard %d: %w", i, err)
+		}
+	}
+
+	return closeErr
+}
+
+// readShardIndex reads the routing index: the number of the bounds
+// as uint32 followed by the bounds prefixed with uint16 length.
+func readShardIndex(path string) ([][]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < 4 {
+		return nil, fmt.Errorf("the routing index is truncated")
+	}
+
+	count := int(decodeUint32(data[0:4]))
+	bounds := make([][]byte, 0, count)
+	position := 4
+	for i := 0; i < count; i++ {
+		if len(data) < position+2 {
+			return nil, fmt.Errorf("the routing index is truncated")
+		}
+
+		size := int(decodeUint16(data[position : position+2]))
+		position += 2
+		if len(data) < position+size {
+			return nil, fmt.Errorf("the routing index is truncated")
+		}
+
+		bounds = append(bounds, copyBytes(data[position:position+size]))
+		position += size
+	}
+
+	return bounds, nil
+}
+
+// writeShardIndex atomically writes the routing index.
+func writeShardIndex(path string, bounds [][]byte) error {
+	data := encodeUint32(uint32(len(bounds)))
+	for _, bound := range bounds {
+		if len(bound) > math.MaxUint16 {
+			return fmt.Errorf("the bound must be less than or equal to %d bytes", math.MaxUint16)
+		}
+
+		data = append(data, encodeUint16(uint16(len(bound)))...)
+		data = append(data, bound...)
+	}
+
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func equalBounds(x, y [][]byte) bool {
+	if len(x) != len(y) {
+		return false
+	}
+
+	for i := range x {
+		if !bytes.Equal(x[i], y[i]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,112 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestShardSet(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	setDir := path.Join(dbDir, "set")
+	bounds := [][]byte{{50}, {100}, {150}}
+	set, err := OpenShardSet(setDir, bounds, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open the shard set: %s", err)
+	}
+
+	for i := 0; i < 200; i++ {
+		if _, _, err := set.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	for i, shard := range set.shards {
+		if shard.Size() != 50 {
+			t.Fatalf("expected 50 keys in the shard %d, but got %d", i, shard.Size())
+		}
+	}
+
+	if err := set.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	if _, err := OpenShardSet(setDir, [][]byte{{10}}, Order(3)); err == nil {
+		t.Fatalf("expected the error for the other bounds")
+	}
+
+	set, err = OpenShardSet(setDir, nil, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open the shard set: %s", err)
+	}
+	defer set.Close()
+
+	if set.Size() != 200 {
+		t.Fatalf("expected size 200, but got %d", set.Size())
+	}
+
+	value, ok, err := set.Get([]byte{120})
+	if err != nil || !ok || !bytes.Equal(value, []byte{120}) {
+		t.Fatalf("failed to get: %v, %v, %s", value, ok, err)
+	}
+
+	if _, ok, err := set.Delete([]byte{120}); err != nil || !ok {
+		t.Fatalf("failed to delete: %v, %s", ok, err)
+	}
+
+	actual := make([]byte, 0)
+	err = set.Scan([]byte{45}, []byte{155}, func(key, value []byte) bool {
+		actual = append(actual, key...)
+
+		return true
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+
+	expected := make([]byte, 0)
+	for i := 45; i < 155; i++ {
+		if i != 120 {
+			expected = append(expected, byte(i))
+		}
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+
+	actual = actual[:0]
+	err = set.Scan(nil, nil, func(key, value []byte) bool {
+		actual = append(actual, key...)
+
+		return len(actual) < 60
+	})
+	if err != nil {
+		t.Fatalf("failed to scan: %s", err)
+	}
+	if len(actual) != 60 || actual[59] != 59 {
+		t.Fatalf("expected the scan to stop at key 59, but got %v", actual)
+	}
+}
+
+func TestShardSetUnsortedBounds(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if _, err := OpenShardSet(dbDir, [][]byte{{2}, {1}}); err == nil {
+		t.Fatalf("expected the error for the unsorted bounds")
+	}
+}
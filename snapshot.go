@@ -0,0 +1,109 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Snapshot is the immutable view of the tree as of the moment it was taken.
+// It is the clone of the tree file in the same directory, see CloneTo, so
+// the tree can be modified while the snapshot is read or iterated. On the
+// file systems with reflinks taking the snapshot is instant, otherwise the
+// file is copied while the writes wait, but the reads do not. The snapshot
+// must be closed to remove its file.
+type Snapshot struct {
+	tree *FBPTree
+	path string
+}
+
+// Snapshot takes the snapshot of the tree. The changes of the open writable
+// transaction are not visible in the snapshot.
+func (t *FBPTree) Snapshot() (*Snapshot, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	if t.tx != nil {
+		return nil, ErrTxOpen
+	}
+
+	if t.path == InMemory {
+		return nil, ErrInMemory
+	}
+
+	dir, base := filepath.Split(t.path)
+	if dir == "" {
+		dir = "."
+	}
+
+	tmp, err := ioutil.TempFile(dir, base+".snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the snapshot file: %w", err)
+	}
+	path := tmp.Name()
+	tmp.Close()
+	// the clone is created exclusively
+	if err := os.Remove(path); err != nil {
+		return nil, fmt.Errorf("failed to remove the snapshot file: %w", err)
+	}
+
+	// every write is complete in the file once it returns, so the file is
+	// copied without the checkpoint, which would have to write it, and the
+	// statistics of the snapshot are the ones written last
+	if err := cloneFile(t.path, path); err != nil {
+		return nil, fmt.Errorf("failed to clone %s to %s: %w", t.path, path, err)
+	}
+
+	cfg := *t.cfg
+	// the snapshot is not modified
+	cfg.wal = false
+	tree, err := open(path, &cfg)
+	if err != nil {
+		os.Remove(path)
+
+		return nil, fmt.Errorf("failed to open the snapshot: %w", err)
+	}
+
+	return &Snapshot{tree, path}, nil
+}
+
+// Get returns the value by the key.
+func (s *Snapshot) Get(key []byte) ([]byte, bool, error) {
+	return s.tree.Get(key)
+}
+
+// ForEach calls the action for every key and value in the key order.
+func (s *Snapshot) ForEach(action func(key []byte, value []byte)) error {
+	return s.tree.ForEach(action)
+}
+
+// Scan returns the iterator over the keys in [start, end) range,
+// see FBPTree.Scan.
+func (s *Snapshot) Scan(start, end []byte) (*Iterator, error) {
+	return s.tree.Scan(start, end)
+}
+
+// Size returns the number of the keys.
+func (s *Snapshot) Size() int {
+	return s.tree.Size()
+}
+
+// Close closes the snapshot and removes its file.
+func (s *Snapshot) Close() error {
+	if err := s.tree.Close(); err != nil {
+		os.Remove(s.path)
+
+		return fmt.Errorf("failed to close the snapshot: %w", err)
+	}
+
+	if err := os.Remove(s.path); err != nil {
+		return fmt.Errorf("failed to remove the snapshot file: %w", err)
+	}
+
+	return nil
+}
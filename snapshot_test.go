@@ -0,0 +1,147 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	snapshot, err := tree.Snapshot()
+	if err != nil {
+		t.Fatalf("failed to take the snapshot: %s", err)
+	}
+
+	it, err := snapshot.Scan(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to scan the snapshot: %s", err)
+	}
+
+	// the tree is modified while the snapshot is iterated
+	i := 0
+	for it.HasNext() {
+		key, value, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to get the next key: %s", err)
+		}
+
+		expected := encodeUint32(uint32(i))
+		if !bytes.Equal(key, expected) || !bytes.Equal(value, expected) {
+			t.Fatalf("expected key %v, but got %v", expected, key)
+		}
+
+		if _, _, err := tree.Delete(key); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+		if _, _, err := tree.Put(encodeUint32(uint32(1000+i)), nil); err != nil {
+			t.Fatalf("failed to put key %d: %s", 1000+i, err)
+		}
+
+		i++
+	}
+	if i != 100 {
+		t.Fatalf("expected 100 keys in the snapshot, but got %d", i)
+	}
+
+	if snapshot.Size() != 100 {
+		t.Fatalf("expected the snapshot size 100, but got %d", snapshot.Size())
+	}
+	if _, ok, err := snapshot.Get(encodeUint32(1000)); err != nil || ok {
+		t.Fatalf("expected no key 1000 in the snapshot, but got %v, %v", ok, err)
+	}
+	if _, ok, err := tree.Get(encodeUint32(0)); err != nil || ok {
+		t.Fatalf("expected no key 0 in the tree, but got %v, %v", ok, err)
+	}
+
+	if err := snapshot.Close(); err != nil {
+		t.Fatalf("failed to close the snapshot: %s", err)
+	}
+
+	files, err := ioutil.ReadDir(dbDir)
+	if err != nil {
+		t.Fatalf("failed to read the directory: %s", err)
+	}
+	for _, file := range files {
+		if file.Name() != "sample.data" && file.Name() != "sample.data"+walSuffix {
+			t.Fatalf("expected the snapshot file to be removed, but found %s", file.Name())
+		}
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tree.Snapshot(); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+}
+
+func TestSnapshotDoesNotBlockReads(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the long read holds the tree while the snapshot is taken
+	tree.mu.RLock()
+	taken := make(chan error, 1)
+	go func() {
+		snapshot, err := tree.Snapshot()
+		if err == nil {
+			err = snapshot.Close()
+		}
+		taken <- err
+	}()
+
+	select {
+	case err := <-taken:
+		if err != nil {
+			t.Fatalf("failed to take the snapshot: %s", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected the snapshot not to wait for the read")
+	}
+	tree.mu.RUnlock()
+}
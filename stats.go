@@ -0,0 +1,174 @@
+package fbptree
+
+import (
+	"fmt"
+	"time"
+)
+
+// Stats is the lifetime statistics of the tree file. They are persisted with
+// the tree metadata and on close, so they survive the restarts, but the
+// changes since the last metadata write are lost on the crash.
+type Stats struct {
+	// Puts is the number of the written values.
+	Puts uint64
+	// Deletes is the number of the deleted keys.
+	Deletes uint64
+	// Splits is the number of the node splits.
+	Splits uint64
+	// Merges is the number of the node merges.
+	Merges uint64
+	// Compactions is the number of the compacting rewrites.
+	Compactions uint64
+	// LastCheck is the time of the last check, zero if the file was never checked.
+	LastCheck time.Time
+}
+
+const statsSize = 48
+
+// Stats returns the lifetime statistics of the tree file.
+func (t *FBPTree) Stats() Stats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.storage.lifetime
+}
+
+// TreeStats describes the shape of the tree and the use of the file,
+// e.g. for the capacity planning and the debugging of the node fill.
+type TreeStats struct {
+	// Keys is the number of the keys.
+	Keys int
+	// Height is the number of the levels, zero for the empty tree.
+	Height int
+	// InternalNodes is the number of the internal nodes.
+	InternalNodes int
+	// Leaves is the number of the leaves.
+	Leaves int
+	// FillFactor is the share of the key slots of the nodes in use.
+	FillFactor float64
+	// Pages is the number of the pages in the file, including the free ones.
+	Pages int
+	// FreePages is the number of the free pages.
+	FreePages int
+	// FileSize is the size of the file in bytes.
+	FileSize int64
+	// CacheHits is the number of the nodes found in the cache
+	// since the tree was opened.
+	CacheHits uint64
+	// CacheMisses is the number of the nodes read from the file
+	// since the tree was opened.
+	CacheMisses uint64
+	// BytesRead is the number of the bytes read since the tree was opened.
+	BytesRead uint64
+	// BytesWritten is the number of the bytes written since the tree was opened.
+	BytesWritten uint64
+}
+
+// CacheHitRatio returns the share of the nodes found in the cache,
+// zero if no node was looked up.
+func (s *TreeStats) CacheHitRatio() float64 {
+	if s.CacheHits+s.CacheMisses == 0 {
+		return 0
+	}
+
+	return float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+}
+
+// TreeStats reads every node of the tree, bypassing the cache, and returns
+// the statistics of the tree. The counters of the file use do not include
+// the reads of the call itself.
+func (t *FBPTree) TreeStats() (*TreeStats, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	counts := t.storage.stats()
+	info, err := t.storage.storedFile().Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat the file: %w", err)
+	}
+
+	pager := t.storage.pager
+	stats := &TreeStats{
+		Keys:         t.size(),
+		Pages:        int(pager.lastPageId),
+		FreePages:    len(pager.isFreePage),
+		FileSize:     info.Size(),
+		CacheHits:    counts.hits,
+		CacheMisses:  counts.misses,
+		BytesRead:    counts.readBytes,
+		BytesWritten: counts.writtenBytes,
+	}
+
+	if t.metadata == nil {
+		return stats, nil
+	}
+
+	keys := 0
+	level := []uint32{t.metadata.rootID}
+	for len(level) > 0 {
+		stats.Height++
+
+		var next []uint32
+		for _, nodeID := range level {
+			n, err := t.checkNode(nodeID, nodeID == t.metadata.rootID)
+			if err != nil {
+				return nil, err
+			}
+			keys += n.keyNum
+
+			if n.leaf {
+				stats.Leaves++
+
+				continue
+			}
+
+			stats.InternalNodes++
+			for i := 0; i <= n.keyNum; i++ {
+				next = append(next, n.pointers[i].asNodeID())
+			}
+		}
+
+		level = next
+	}
+	stats.FillFactor = float64(keys) / float64((stats.InternalNodes+stats.Leaves)*(t.order-1))
+
+	return stats, nil
+}
+
+func encodeStats(stats *Stats) []byte {
+	data := make([]byte, statsSize)
+
+	copy(data[0:8], encodeUint64(stats.Puts))
+	copy(data[8:16], encodeUint64(stats.Deletes))
+	copy(data[16:24], encodeUint64(stats.Splits))
+	copy(data[24:32], encodeUint64(stats.Merges))
+	copy(data[32:40], encodeUint64(stats.Compactions))
+	if !stats.LastCheck.IsZero() {
+		copy(data[40:48], encodeUint64(uint64(stats.LastCheck.UnixNano())))
+	}
+
+	return data
+}
+
+// decodeStats decodes the statistics, the missing ones are zero.
+func decodeStats(data []byte) Stats {
+	var fields [statsSize]byte
+	copy(fields[:], data)
+
+	stats := Stats{
+		Puts:        decodeUint64(fields[0:8]),
+		Deletes:     decodeUint64(fields[8:16]),
+		Splits:      decodeUint64(fields[16:24]),
+		Merges:      decodeUint64(fields[24:32]),
+		Compactions: decodeUint64(fields[32:40]),
+	}
+	if lastCheck := decodeUint64(fields[40:48]); lastCheck != 0 {
+		stats.LastCheck = time.Unix(0, int64(lastCheck))
+	}
+
+	return stats
+}
@@ -0,0 +1,149 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsPersistAcrossSessions(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if _, _, err := tree.Put([]byte{1}, []byte{2}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Delete([]byte{byte(i)}); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	stats := tree.Stats()
+	if stats.Puts != 101 || stats.Deletes != 100 {
+		t.Fatalf("expected 101 puts and 100 deletes, but got %+v", stats)
+	}
+	if stats.Splits == 0 || stats.Merges == 0 {
+		t.Fatalf("expected splits and merges, but got %+v", stats)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if !reflect.DeepEqual(stats, tree.Stats()) {
+		t.Fatalf("expected %+v, but got %+v", stats, tree.Stats())
+	}
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if tree.Stats().Compactions != 1 || tree.Stats().Puts != stats.Puts {
+		t.Fatalf("expected the statistics to survive the compaction, but got %+v", tree.Stats())
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+}
+
+func TestEncodeDecodeStats(t *testing.T) {
+	stats := Stats{
+		Puts:        1,
+		Deletes:     2,
+		Splits:      3,
+		Merges:      4,
+		Compactions: 5,
+		LastCheck:   time.Unix(0, 1234567890),
+	}
+
+	if decoded := decodeStats(encodeStats(&stats)); !reflect.DeepEqual(stats, decoded) {
+		t.Fatalf("stats %+v != decoded stats %+v", stats, decoded)
+	}
+
+	if decoded := decodeStats(nil); !reflect.DeepEqual(Stats{}, decoded) {
+		t.Fatalf("expected the empty stats, but got %+v", decoded)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3), PageSize(128))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	stats, err := tree.TreeStats()
+	if err != nil {
+		t.Fatalf("failed to get statistics: %s", err)
+	}
+	if stats.Keys != 0 || stats.Height != 0 || stats.Leaves != 0 || stats.CacheHitRatio() != 0 {
+		t.Fatalf("unexpected statistics of the empty tree %+v", stats)
+	}
+
+	// the keys in ascending order leave the split leaves half full
+	for i := 0; i < 16; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 16; i++ {
+		if _, _, err := tree.Get(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to get key %d: %s", i, err)
+		}
+	}
+
+	stats, err = tree.TreeStats()
+	if err != nil {
+		t.Fatalf("failed to get statistics: %s", err)
+	}
+
+	if stats.Keys != 16 || stats.Height != 4 || stats.Leaves != 15 || stats.InternalNodes != 11 {
+		t.Fatalf("unexpected shape of the tree %+v", stats)
+	}
+	// the internal nodes have one key less than the children
+	if expected := float64(16+15-1) / float64(26*2); stats.FillFactor != expected {
+		t.Fatalf("expected fill factor %f, but got %f", expected, stats.FillFactor)
+	}
+	if stats.Pages == 0 || stats.FileSize != int64(stats.Pages)*128+metadataSize {
+		t.Fatalf("unexpected pages %d and file size %d", stats.Pages, stats.FileSize)
+	}
+	if stats.CacheHits == 0 || stats.CacheHitRatio() <= 0 || stats.CacheHitRatio() > 1 {
+		t.Fatalf("unexpected cache hits %d and misses %d", stats.CacheHits, stats.CacheMisses)
+	}
+	if stats.BytesWritten == 0 {
+		t.Fatalf("expected the written bytes")
+	}
+}
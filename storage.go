@@ -1,20 +1,179 @@
 package fbptree
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
 
 // storage an abstraction over the storing mechanism.
 type storage struct {
 	pager   *pager
 	records *records
+
+	counter *countingFile
+	// receives the events of the tree, nil if not given
+	metrics Metrics
+	// receives the debug messages, nil if not given
+	logger Logger
+
+	// defers the changes of the transaction, nil if the file is read-only
+	wal *walFile
+
+	cache *nodeCache
+	// the nodes written by the running write, nil if the nodes
+	// are written to the file immediately, see bufferNodes
+	dirty map[uint32]*dirtyNode
+	// the number of the leaf accesses in the session and the hot
+	// leaves recorded in the file by the previous sessions
+	leafAccess map[uint32]uint64
+	hotLeaves  []uint32
+	// guards the leaf accesses recorded by the concurrent readers
+	accessMu sync.Mutex
+
+	// the lifetime statistics persisted in the file
+	lifetime Stats
+
+	// the number of the changes of the nodes and the metadata, so the
+	// iterators detect the changes of the tree, guarded by the tree lock
+	version uint64
+	// the versions of the last changes of the nodes, so the iterators
+	// detect the changes of their leaves, see forgetChanges
+	changed map[uint32]uint64
+	// the version of the last change that invalidates all the iterators,
+	// e.g. the reload of the file
+	invalidated uint64
+
+	// validate nodes before writing them
+	debugChecks bool
+	// the key order used by the validation
+	compare func(x, y []byte) int
 }
 
-func newStorage(path string, pageSize uint16) (*storage, error) {
-	pager, err := openPager(path, pageSize)
+// newStorage opens the storage of the file by the path, the locked file is
+// the file of the path that is already locked for writing, e.g. by the
+// rewrite that replaces it, nil if the file is opened and locked here.
+func newStorage(path string, cfg *config, locked *os.File) (*storage, error) {
+	file, readOnly, err := openFileBackend(path, cfg, locked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the file: %w", err)
+	}
+
+	// the tree in memory does not survive the crash anyway
+	logged := cfg.wal && path != InMemory
+
+	var wal *walFile
+	if readOnly && logged {
+		if err := checkWAL(path); err != nil {
+			file.Close()
+
+			return nil, err
+		}
+	} else if !readOnly {
+		if logged {
+			wal, err = openWAL(path, file, cfg.syncPolicy == NoSync)
+		} else {
+			wal, err = newWALFile(file)
+		}
+		if err != nil {
+			file.Close()
+
+			return nil, fmt.Errorf("failed to open the write-ahead log: %w", err)
+		}
+		file = wal
+	}
+
+	if cfg.cipher != nil {
+		file = newCipherFile(file, cfg.cipher, cfg.pageSize)
+	}
+
+	counter := newCountingFile(file)
+	counter.metrics = cfg.metrics
+	if readOnly {
+		// the new file can not be initialized
+		if info, err := file.Stat(); err == nil && info.Size() == 0 {
+			file.Close()
+
+			return nil, fmt.Errorf("the file is empty: %w", ErrReadOnly)
+		}
+	}
+
+	pager, err := newPager(counter, cfg.pageSize)
 	if err != nil {
+		file.Close()
+
 		return nil, fmt.Errorf("failed to instantiate the pager: %w", err)
 	}
+	pager.readOnly = readOnly
+	pager.wal = wal
+	pager.strictSync = cfg.strictMetadataSync
+	pager.secureDelete = cfg.secureDelete
+	pager.growth = cfg.growth
+	pager.logger = cfg.logger
 
-	return &storage{pager: pager, records: newRecords(pager)}, nil
+	records := newRecords(pager)
+	records.codec = cfg.codec
+
+	return &storage{
+		pager:       pager,
+		records:     records,
+		counter:     counter,
+		metrics:     cfg.metrics,
+		logger:      cfg.logger,
+		wal:         wal,
+		lifetime:    decodeStats(pager.metadata.stats),
+		cache:       newNodeCache(cfg.cacheSize),
+		leafAccess:  make(map[uint32]uint64),
+		hotLeaves:   decodeHotLeaves(pager.metadata.hotLeaves),
+		debugChecks: cfg.debugChecks,
+		compare:     cfg.compare,
+	}, nil
+}
+
+// openFileBackend opens the file by the path, unless it is already
+// opened and locked, and wraps it according to the configuration. The file
+// on the read-only file system or with the ReadOnly option is opened for
+// reading only.
+func openFileBackend(path string, cfg *config, locked *os.File) (randomAccessFile, bool, error) {
+	if path == InMemory {
+		return &memoryFile{}, cfg.readOnly, nil
+	}
+
+	readOnly := cfg.readOnly
+	file := locked
+	if file == nil {
+		var err error
+		if !readOnly {
+			file, err = openFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		}
+		if readOnly || errors.Is(err, syscall.EROFS) {
+			readOnly = true
+			file, err = openFile(path, os.O_RDONLY, 0)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to open %s: %w", path, err)
+		}
+
+		// the readers share the lock, so they exclude the writer only
+		if err := lockFile(file, readOnly); err != nil {
+			file.Close()
+
+			return nil, false, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+	}
+
+	backend := wrapFile(path, file)
+	if cfg.syncPolicy == NoSync {
+		backend = noSyncFile{backend}
+	}
+	if cfg.retryPolicy != nil {
+		backend = newRetryFile(backend, cfg.retryPolicy)
+	}
+
+	return backend, readOnly, nil
 }
 
 func (s *storage) loadMetadata() (*treeMetadata, error) {
@@ -36,6 +195,12 @@ func (s *storage) loadMetadata() (*treeMetadata, error) {
 }
 
 func (s *storage) updateMetadata(metadata *treeMetadata) error {
+	s.version++
+
+	if err := s.pager.setStatsMetadata(encodeStats(&s.lifetime)); err != nil {
+		return fmt.Errorf("failed to set statistics: %w", err)
+	}
+
 	data := encodeTreeMetadata(metadata)
 	err := s.pager.writeCustomMetadata(data)
 	if err != nil {
@@ -46,6 +211,12 @@ func (s *storage) updateMetadata(metadata *treeMetadata) error {
 }
 
 func (s *storage) deleteMetadata() error {
+	s.version++
+
+	if err := s.pager.setStatsMetadata(encodeStats(&s.lifetime)); err != nil {
+		return fmt.Errorf("failed to set statistics: %w", err)
+	}
+
 	var empty [0]byte
 	err := s.pager.writeCustomMetadata(empty[:])
 	if err != nil {
@@ -55,6 +226,45 @@ func (s *storage) deleteMetadata() error {
 	return nil
 }
 
+// change records the change of the node for the iterators.
+func (s *storage) change(nodeID uint32) {
+	s.version++
+
+	if s.changed == nil {
+		s.changed = make(map[uint32]uint64)
+	}
+	s.changed[nodeID] = s.version
+}
+
+// invalidate invalidates all the iterators.
+func (s *storage) invalidate() {
+	s.version++
+	s.invalidated = s.version
+}
+
+// changedSince returns true if any of the nodes is changed or all the
+// iterators are invalidated after the given version.
+func (s *storage) changedSince(version uint64, nodeIDs ...uint32) bool {
+	if s.invalidated > version {
+		return true
+	}
+
+	for _, nodeID := range nodeIDs {
+		if s.changed[nodeID] > version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forgetChanges drops the recorded changes of the nodes, it is called
+// when there are no open iterators, since the new ones are created
+// after the changes.
+func (s *storage) forgetChanges() {
+	s.changed = nil
+}
+
 func (s *storage) newNode() (uint32, error) {
 	recordID, err := s.records.new()
 	if err != nil {
@@ -65,31 +275,132 @@ func (s *storage) newNode() (uint32, error) {
 }
 
 func (s *storage) updateNodeByID(nodeID uint32, node *node) error {
-	data := encodeNode(node)
-	err := s.records.write(nodeID, data)
+	s.change(nodeID)
 
-	if err != nil {
-		return fmt.Errorf("failed to write the record %d: %w", nodeID, err)
+	// the fill is validated at the end of the write, see validateWrite
+	if s.debugChecks {
+		if err := node.validate(s.compare, 0); err != nil {
+			return fmt.Errorf("node invariant is violated: %w", err)
+		}
+	}
+
+	// the node keeps its key record while it has the long keys
+	tailSize := node.keyTailSize()
+	if tailSize > 0 && node.keyRecordID == 0 {
+		recordID, err := s.records.new()
+		if err != nil {
+			return fmt.Errorf("failed to instantiate the key record: %w", err)
+		}
+
+		node.keyRecordID = recordID
+	} else if tailSize == 0 && node.keyRecordID != 0 {
+		if err := s.records.free(node.keyRecordID); err != nil {
+			return fmt.Errorf("failed to free the key record %d: %w", node.keyRecordID, err)
+		}
+
+		node.keyRecordID = 0
 	}
 
+	data := encodeNode(node)
+	node.encoded = len(data)
+	if s.dirty != nil {
+		s.dirty[nodeID] = &dirtyNode{data: data, tailSize: tailSize}
+	} else if err := s.writeNode(nodeID, data, tailSize); err != nil {
+		return err
+	}
+	s.cache.put(nodeID, data)
+
 	return nil
 }
 
 func (s *storage) loadNodeByID(nodeID uint32) (*node, error) {
+	data, ok := s.bufferedNode(nodeID)
+	if ok {
+		atomic.AddUint64(&s.counter.stats.hits, 1)
+		if s.metrics != nil {
+			s.metrics.CacheHit()
+		}
+	} else {
+		atomic.AddUint64(&s.counter.stats.misses, 1)
+		if s.metrics != nil {
+			s.metrics.CacheMiss()
+		}
+
+		var err error
+		data, err = s.readNode(nodeID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the decoded node refers to the data, so the data kept by the cache
+	// or by the buffer is copied, while the data read from the file is
+	// decoded as it is if the cache does not keep it
+	decoded := data
+	if ok || s.cache.capacity > 0 {
+		decoded = copyBytes(data)
+	}
+	node, err := decodeNode(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode record %d: %w", nodeID, corruptionOf(err, nodeID))
+	}
+
+	if !ok {
+		s.cache.put(nodeID, data)
+	}
+
+	return node, nil
+}
+
+// readNode reads the encoded node from the file, followed by the tails
+// of its long keys from the key record.
+func (s *storage) readNode(nodeID uint32) ([]byte, error) {
 	data, err := s.records.read(nodeID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read record %d: %w", nodeID, err)
 	}
 
-	node, err := decodeNode(data)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode record %d: %w", nodeID, err)
+	if keyRecordID := keyRecordOf(data); keyRecordID != 0 {
+		tails, err := s.records.read(keyRecordID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the key record %d: %w", keyRecordID, err)
+		}
+
+		data = append(data, tails...)
 	}
 
-	return node, nil
+	return data, nil
+}
+
+// pageCount returns the number of the pages the node occupies
+// without its key record.
+func (s *storage) pageCount(node *node) int {
+	return s.records.pagesFor(len(encodeNode(node)) - node.keyTailSize())
 }
 
 func (s *storage) deleteNodeByID(nodeID uint32) error {
+	s.change(nodeID)
+
+	data, ok := s.bufferedNode(nodeID)
+	if !ok {
+		var err error
+		data, err = s.records.read(nodeID)
+		if err != nil {
+			return fmt.Errorf("failed to read record %d: %w", nodeID, err)
+		}
+	}
+
+	// the freed pages may be reused, so the buffered node is not written
+	delete(s.dirty, nodeID)
+	s.cache.remove(nodeID)
+	s.forgetLeaf(nodeID)
+
+	if keyRecordID := keyRecordOf(data); keyRecordID != 0 {
+		if err := s.records.free(keyRecordID); err != nil {
+			return fmt.Errorf("failed to free the key record %d: %w", keyRecordID, err)
+		}
+	}
+
 	err := s.records.free(nodeID)
 	if err != nil {
 		return fmt.Errorf("failed to free the record %d: %w", nodeID, err)
@@ -98,8 +409,176 @@ func (s *storage) deleteNodeByID(nodeID uint32) error {
 	return nil
 }
 
+// logged returns true if the write-ahead log is enabled.
+func (s *storage) logged() bool {
+	return s.wal != nil && s.wal.log != nil
+}
+
+// deferring returns true if the changes are deferred until commit.
+func (s *storage) deferring() bool {
+	return s.wal != nil && s.wal.active
+}
+
+// begin starts deferring the changes of the file until commit.
+func (s *storage) begin() {
+	if !s.deferring() {
+		s.wal.begin()
+	}
+}
+
+// beginInPlace starts deferring the changes of the file until commit except
+// the changes of the pages, they are written in place even with the
+// write-ahead log, so the pages must not be reachable until commit.
+func (s *storage) beginInPlace() {
+	if s.logged() && !s.deferring() {
+		s.wal.beginInPlace()
+	}
+}
+
+// commit commits the deferred changes through the write-ahead log
+// if it is enabled.
+func (s *storage) commit() error {
+	if !s.deferring() {
+		return nil
+	}
+
+	return s.wal.commit()
+}
+
+// rollback discards the deferred changes and reloads
+// the state of the pager from the file.
+func (s *storage) rollback() error {
+	if err := s.wal.rollback(); err != nil {
+		return err
+	}
+
+	return s.reload()
+}
+
+// reload replays the write-ahead log and reloads the state
+// of the pager from the file.
+func (s *storage) reload() error {
+	if err := s.wal.replay(); err != nil {
+		return err
+	}
+
+	if err := s.reloadPager(); err != nil {
+		return err
+	}
+	s.cache.clear()
+	s.invalidate()
+
+	return nil
+}
+
+// reloadPager reloads the state of the pager from the file.
+func (s *storage) reloadPager() error {
+	pager, records, err := s.loadPager()
+	if err != nil {
+		return err
+	}
+
+	s.pager = pager
+	s.records = records
+
+	return nil
+}
+
+// loadPager loads the state of the pager from the file
+// with the settings of the current pager.
+func (s *storage) loadPager() (*pager, *records, error) {
+	pager, err := newPager(s.counter, s.pager.pageSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to instantiate the pager: %w", err)
+	}
+	pager.readOnly = s.pager.readOnly
+	pager.wal = s.pager.wal
+	pager.strictSync = s.pager.strictSync
+	pager.secureDelete = s.pager.secureDelete
+	pager.growth = s.pager.growth
+	pager.logger = s.pager.logger
+	if s.pager.filePages > s.pager.lastPageId && pager.lastPageId > s.pager.lastPageId {
+		// the pages after the last allocated page are not in use,
+		// they are allocated in advance by the growth policy
+		pager.lastPageId = s.pager.lastPageId
+	}
+
+	records := newRecords(pager)
+	records.codec = s.records.codec
+
+	return pager, records, nil
+}
+
+// storedFile returns the file as it is stored, with the encrypted pages
+// if the file is encrypted.
+func (s *storage) storedFile() randomAccessFile {
+	if f, ok := s.counter.file.(*cipherFile); ok {
+		return f.file
+	}
+
+	return s.counter
+}
+
+// stats returns the counters of the file operations.
+func (s *storage) stats() ioStats {
+	return s.counter.counts()
+}
+
+// flush flushes all the changes to the persistent disk.
+func (s *storage) flush() error {
+	if err := s.pager.flush(); err != nil {
+		return fmt.Errorf("failed to flush the pager: %w", err)
+	}
+
+	return nil
+}
+
+// checkpoint writes the hot leaves and the statistics into the metadata
+// and flushes the file, so the file is complete as it is.
+func (s *storage) checkpoint() error {
+	if s.pager.readOnly {
+		return nil
+	}
+
+	if err := s.writeRuntimeMetadata(); err != nil {
+		return err
+	}
+
+	return s.flush()
+}
+
+// writeRuntimeMetadata writes the metadata that is kept in memory
+// while the file is open.
+func (s *storage) writeRuntimeMetadata() error {
+	if err := s.pager.setHotLeavesMetadata(encodeHotLeaves(s.hottestLeaves())); err != nil {
+		return fmt.Errorf("failed to set hot leaves: %w", err)
+	}
+
+	if err := s.pager.writeStatsMetadata(encodeStats(&s.lifetime)); err != nil {
+		return fmt.Errorf("failed to write statistics: %w", err)
+	}
+
+	return nil
+}
+
 // Close closes the tree and free the underlying resources.
 func (s *storage) close() error {
+	s.invalidate()
+
+	if s.pager.readOnly {
+		if err := s.pager.close(); err != nil {
+			return fmt.Errorf("failed to close the pager: %w", err)
+		}
+
+		return nil
+	}
+
+	if err := s.writeRuntimeMetadata(); err != nil {
+		s.pager.close()
+
+		return err
+	}
+
 	if err := s.pager.close(); err != nil {
 		return fmt.Errorf("failed to close the pager: %w", err)
 	}
@@ -0,0 +1,111 @@
+package fbptree
+
+import (
+	"fmt"
+	"time"
+)
+
+// SyncPolicy defines when the changes are synced to the persistent disk.
+type SyncPolicy int
+
+const (
+	// SyncOnClose syncs the file on close and flush only, the default.
+	// The sudden power loss may lose the recent writes. The WriteAheadLog
+	// option still syncs the log and the file on every write.
+	SyncOnClose SyncPolicy = iota
+	// SyncOnWrite syncs the file after every write, so the write is
+	// durable once it returns.
+	SyncOnWrite
+	// NoSync never syncs the file, not even on close, e.g. for the bulk
+	// loads that are repeated from scratch after the failure.
+	NoSync
+	// syncPeriodically syncs the file after the write if the sync
+	// interval has passed since the last sync, see SyncEvery
+	syncPeriodically
+)
+
+// Sync option sets the sync policy, SyncOnClose by default.
+func Sync(policy SyncPolicy) func(*config) error {
+	return func(c *config) error {
+		if policy < SyncOnClose || policy > NoSync {
+			return fmt.Errorf("unknown sync policy %d", policy)
+		}
+
+		c.syncPolicy = policy
+
+		return nil
+	}
+}
+
+// SyncEvery option syncs the file after the write if the given interval has
+// passed since the last sync, so at most the writes of the interval can be
+// lost.
+func SyncEvery(interval time.Duration) func(*config) error {
+	return func(c *config) error {
+		if interval <= 0 {
+			return fmt.Errorf("sync interval must be positive")
+		}
+
+		c.syncPolicy = syncPeriodically
+		c.syncInterval = interval
+
+		return nil
+	}
+}
+
+// Flush writes the statistics and the hot leaves kept in memory and syncs
+// the file, so the file is durable and complete as it is without closing the
+// tree. It is rejected with ErrTxOpen while the writable transaction is open.
+func (t *FBPTree) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if t.tx != nil {
+		return ErrTxOpen
+	}
+
+	if err := t.storage.checkpoint(); err != nil {
+		return fmt.Errorf("failed to flush the tree: %w", err)
+	}
+	t.lastSync = time.Now()
+
+	return nil
+}
+
+// syncWrite syncs the file after the successful write
+// according to the sync policy.
+func (t *FBPTree) syncWrite() error {
+	switch t.syncPolicy {
+	case SyncOnWrite:
+		if t.storage.logged() {
+			// the commit has synced the file
+			return nil
+		}
+	case syncPeriodically:
+		if time.Since(t.lastSync) < t.syncInterval {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if err := t.storage.flush(); err != nil {
+		return fmt.Errorf("failed to sync the write: %w", err)
+	}
+	t.lastSync = time.Now()
+
+	return nil
+}
+
+// noSyncFile skips the syncs of the file.
+type noSyncFile struct {
+	randomAccessFile
+}
+
+func (f noSyncFile) Sync() error {
+	return nil
+}
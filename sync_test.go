@@ -0,0 +1,185 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSyncPolicy(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	if _, err := Open(path.Join(dbDir, "invalid.data"), Sync(SyncPolicy(100))); err == nil {
+		t.Fatalf("expected an error for the unknown sync policy")
+	}
+	if _, err := Open(path.Join(dbDir, "invalid.data"), SyncEvery(0)); err == nil {
+		t.Fatalf("expected an error for the zero sync interval")
+	}
+
+	cases := []struct {
+		name    string
+		options []func(*config) error
+		syncs   uint64
+	}{
+		{"close", []func(*config) error{Sync(SyncOnClose)}, 0},
+		{"write", []func(*config) error{Sync(SyncOnWrite)}, 10},
+		{"every", []func(*config) error{SyncEvery(time.Hour)}, 0},
+	}
+
+	for _, c := range cases {
+		tree, err := Open(path.Join(dbDir, c.name+".data"), append(c.options, Order(3))...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		before := tree.storage.stats().syncs
+		for i := 0; i < 10; i++ {
+			key := encodeUint32(uint32(i))
+			if _, _, err := tree.Put(key, key); err != nil {
+				t.Fatalf("failed to put key %d: %s", i, err)
+			}
+		}
+
+		if syncs := tree.storage.stats().syncs - before; syncs != c.syncs {
+			t.Fatalf("expected %d syncs for %s, but got %d", c.syncs, c.name, syncs)
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+
+	tree, err := Open(path.Join(dbDir, "every.data"), Order(3), SyncEvery(time.Hour))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	// the interval has passed
+	tree.lastSync = time.Now().Add(-time.Hour)
+	before := tree.storage.stats().syncs
+	if _, _, err := tree.Put(encodeUint32(10), nil); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if _, _, err := tree.Put(encodeUint32(11), nil); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+	if syncs := tree.storage.stats().syncs - before; syncs != 1 {
+		t.Fatalf("expected 1 sync, but got %d", syncs)
+	}
+}
+
+func TestNoSync(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), Sync(NoSync), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if _, ok := tree.storage.wal.randomAccessFile.(noSyncFile); !ok {
+		t.Fatalf("expected the syncs of the file to be skipped")
+	}
+	if !tree.storage.wal.noSync {
+		t.Fatalf("expected the syncs of the log to be skipped")
+	}
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.Size() != 10 {
+		t.Fatalf("expected size 10, but got %d", tree.Size())
+	}
+}
+
+func TestFlush(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	before := tree.storage.stats().syncs
+	if err := tree.Flush(); err != nil {
+		t.Fatalf("failed to flush: %s", err)
+	}
+	if tree.storage.stats().syncs == before {
+		t.Fatalf("expected the file to be synced")
+	}
+
+	// the flushed file is complete without closing the tree
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if err := ioutil.WriteFile(path.Join(dbDir, "copy.data"), data, 0600); err != nil {
+		t.Fatalf("failed to write the file: %s", err)
+	}
+
+	copied, err := Open(path.Join(dbDir, "copy.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open the copy: %s", err)
+	}
+	defer copied.Close()
+
+	if copied.Size() != 10 {
+		t.Fatalf("expected size 10, but got %d", copied.Size())
+	}
+	if copied.Stats().Puts != 10 {
+		t.Fatalf("expected 10 puts in the statistics, but got %d", copied.Stats().Puts)
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	defer tx.Rollback()
+
+	if err := tree.Flush(); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package fbptree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyTrace is the path of the key lookup from the root to the leaf.
+type KeyTrace struct {
+	Key []byte
+	// Steps are the visited nodes starting from the root.
+	Steps []TraceStep
+	// LeafID is the identifier of the final leaf, 0 for the empty tree.
+	LeafID uint32
+	// Slot is the position of the key in the leaf or the position
+	// where it would be inserted.
+	Slot int
+	// Found is true if the key exists.
+	Found bool
+}
+
+// TraceStep is the visited node.
+type TraceStep struct {
+	NodeID uint32
+	Leaf   bool
+	// Comparisons are the keys of the node the key was compared with.
+	Comparisons []TraceComparison
+	// Position is the chosen child pointer position for
+	// the internal node or the slot for the leaf.
+	Position int
+}
+
+// TraceComparison is the result of comparing the traced key with the node key.
+type TraceComparison struct {
+	NodeKey []byte
+	// Result is negative if the traced key is less than the node key,
+	// 0 if they are equal and positive otherwise.
+	Result int
+}
+
+// Trace returns the sequence of the nodes, the key comparisons and
+// the final leaf slot visited while looking up the key. It helps to debug
+// the lookups against the real files.
+func (t *FBPTree) Trace(key []byte) (*KeyTrace, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	trace := &KeyTrace{Key: key, Steps: make([]TraceStep, 0)}
+	if t.metadata == nil {
+		return trace, nil
+	}
+
+	current, err := t.storage.loadNodeByID(t.metadata.rootID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load root node: %w", err)
+	}
+
+	for !current.leaf {
+		step := TraceStep{NodeID: current.id, Leaf: false, Comparisons: make([]TraceComparison, 0)}
+		position := 0
+		for position < current.keyNum {
+			cmp := t.compare(key, current.keys[position])
+			step.Comparisons = append(step.Comparisons, TraceComparison{current.keys[position], cmp})
+			if cmp < 0 {
+				break
+			}
+
+			position++
+		}
+		step.Position = position
+		trace.Steps = append(trace.Steps, step)
+
+		nextID := current.pointers[position].asNodeID()
+		current, err = t.storage.loadNodeByID(nextID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load next node %d: %w", nextID, err)
+		}
+	}
+
+	step := TraceStep{NodeID: current.id, Leaf: true, Comparisons: make([]TraceComparison, 0)}
+	slot := 0
+	for slot < current.keyNum {
+		cmp := t.compare(key, current.keys[slot])
+		step.Comparisons = append(step.Comparisons, TraceComparison{current.keys[slot], cmp})
+		if cmp == 0 {
+			trace.Found = true
+		}
+		if cmp <= 0 {
+			break
+		}
+
+		slot++
+	}
+	step.Position = slot
+	trace.Steps = append(trace.Steps, step)
+
+	trace.LeafID = current.id
+	trace.Slot = slot
+
+	return trace, nil
+}
+
+// String pretty-prints the trace.
+func (kt *KeyTrace) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "trace of key %x:\n", kt.Key)
+	if len(kt.Steps) == 0 {
+		b.WriteString("  the tree is empty\n")
+
+		return b.String()
+	}
+
+	for _, step := range kt.Steps {
+		kind := "internal"
+		if step.Leaf {
+			kind = "leaf"
+		}
+
+		comparisons := make([]string, len(step.Comparisons))
+		for i, c := range step.Comparisons {
+			comparisons[i] = fmt.Sprintf("%x %s", c.NodeKey, comparisonSign(c.Result))
+		}
+
+		if step.Leaf {
+			fmt.Fprintf(&b, "  node %d (%s): [%s] => slot %d", step.NodeID, kind, strings.Join(comparisons, ", "), step.Position)
+			if kt.Found {
+				b.WriteString(" (found)\n")
+			} else {
+				b.WriteString(" (not found)\n")
+			}
+		} else {
+			fmt.Fprintf(&b, "  node %d (%s): [%s] => pointer %d\n", step.NodeID, kind, strings.Join(comparisons, ", "), step.Position)
+		}
+	}
+
+	return b.String()
+}
+
+func comparisonSign(result int) string {
+	if result < 0 {
+		return "<"
+	} else if result > 0 {
+		return ">"
+	}
+
+	return "="
+}
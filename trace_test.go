@@ -0,0 +1,76 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	trace, err := tree.Trace([]byte{1})
+	if err != nil {
+		t.Fatalf("failed to trace: %s", err)
+	}
+	if len(trace.Steps) != 0 || trace.Found {
+		t.Fatalf("expected empty trace for the empty tree, but got %v", trace)
+	}
+
+	for _, c := range treeCases {
+		tree.Put([]byte{c.key}, []byte(c.value))
+	}
+
+	for _, c := range treeCases {
+		trace, err := tree.Trace([]byte{c.key})
+		if err != nil {
+			t.Fatalf("failed to trace: %s", err)
+		}
+
+		if !trace.Found {
+			t.Fatalf("key %d must be found:\n%s", c.key, trace)
+		}
+
+		if len(trace.Steps) < 2 {
+			t.Fatalf("expected at least two steps for order 3, but got %d", len(trace.Steps))
+		}
+
+		last := trace.Steps[len(trace.Steps)-1]
+		if !last.Leaf || last.NodeID != trace.LeafID || last.Position != trace.Slot {
+			t.Fatalf("the last step must be the leaf: %v", last)
+		}
+
+		leaf, err := tree.storage.loadNodeByID(trace.LeafID)
+		if err != nil {
+			t.Fatalf("failed to load the leaf: %s", err)
+		}
+		if leaf.keys[trace.Slot][0] != c.key {
+			t.Fatalf("expected key %d at slot %d, but got %d", c.key, trace.Slot, leaf.keys[trace.Slot][0])
+		}
+	}
+
+	trace, err = tree.Trace([]byte{3})
+	if err != nil {
+		t.Fatalf("failed to trace: %s", err)
+	}
+	if trace.Found {
+		t.Fatal("key 3 must not be found")
+	}
+	if !strings.Contains(trace.String(), "(not found)") {
+		t.Fatalf("unexpected pretty-printed trace:\n%s", trace)
+	}
+}
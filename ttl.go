@@ -0,0 +1,128 @@
+package fbptree
+
+import (
+	"fmt"
+	"time"
+)
+
+// PutWithTTL puts the key and the value that expires after the given time
+// to live. The expired key is not returned by Get, the iterators, the
+// cursors and the scans, and it does not exist for the writes, but it stays
+// in the tree and is counted by Size, CountRange and Rank until it is
+// deleted or purged with PurgeExpired. Any write of the value, e.g. Put,
+// clears its expiration. Dump writes the values that are not expired yet
+// without their expiration times.
+func (t *FBPTree) PutWithTTL(key, value []byte, ttl time.Duration) ([]byte, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if ttl <= 0 {
+		return nil, false, fmt.Errorf("ttl must be positive, but got %s", ttl)
+	}
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return nil, false, err
+	}
+
+	op := t.beginOperation()
+	prev, exists, err := t.putWithTTL(key, value, time.Now().Add(ttl).UnixNano())
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationPut, len(key), len(value), err)
+
+	return prev, exists, err
+}
+
+func (t *FBPTree) putWithTTL(key, value []byte, expiresAt int64) ([]byte, bool, error) {
+	prev, exists, err := t.put(key, value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	leaf, err := t.findLeaf(key)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	position := leaf.keyPosition(key, t.compare)
+	if position == -1 {
+		return nil, false, fmt.Errorf("the key is not found in the leaf %d after the put", leaf.id)
+	}
+
+	// the pointer is replaced, so the node read before the put keeps
+	// the value without the expiration
+	expiring := *leaf.pointers[position]
+	expiring.expiresAt = expiresAt
+	leaf.pointers[position] = &expiring
+
+	if err := t.storage.updateNodeByID(leaf.id, leaf); err != nil {
+		return nil, false, fmt.Errorf("failed to update the node %d: %w", leaf.id, err)
+	}
+
+	return prev, exists, nil
+}
+
+// PurgeExpired deletes the expired keys and frees their values, and
+// returns the number of the deleted keys. The leaves are traversed once
+// and the keys are deleted as with DeleteMany.
+func (t *FBPTree) PurgeExpired() (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	op := t.beginOperation()
+	purged, err := t.purgeExpired()
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationDeleteMany, 0, 0, err)
+
+	return purged, err
+}
+
+func (t *FBPTree) purgeExpired() (int, error) {
+	if t.metadata == nil {
+		return 0, nil
+	}
+
+	expired := make([][]byte, 0)
+	for nodeID := t.metadata.leftmostID; nodeID != 0; {
+		leaf, err := t.storage.loadNodeByID(nodeID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load the leaf %d: %w", nodeID, err)
+		}
+
+		for i := 0; i < leaf.keyNum; i++ {
+			if leaf.pointers[i].expired() {
+				// the leaves change while the keys are deleted
+				expired = append(expired, copyBytes(leaf.keys[i]))
+			}
+		}
+
+		nodeID = leaf.nextID()
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	return t.deleteMany(expired)
+}
+
+// expired returns true if the value of the leaf pointer is expired.
+func (p *pointer) expired() bool {
+	return p.expiresAt != 0 && time.Now().UnixNano() >= p.expiresAt
+}
+
+// livePosition returns the position of the key as keyPosition does,
+// but -1 if the key is expired.
+func (n *node) livePosition(key []byte, compare func(x, y []byte) int) int {
+	position := n.keyPosition(key, compare)
+	if position != -1 && n.pointers[position].expired() {
+		return -1
+	}
+
+	return position
+}
@@ -0,0 +1,165 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	large := bytes.Repeat([]byte{1}, 100000)
+	// the even keys expire, every third key expires in an hour
+	for i := 0; i < 30; i++ {
+		key, value := []byte{byte(i)}, []byte{byte(i)}
+		if i == 10 {
+			value = large
+		}
+
+		if i%2 == 0 {
+			_, _, err = tree.PutWithTTL(key, value, time.Millisecond)
+		} else if i%3 == 0 {
+			_, _, err = tree.PutWithTTL(key, value, time.Hour)
+		} else {
+			_, _, err = tree.Put(key, value)
+		}
+		if err != nil {
+			t.Fatalf("failed to put: %s", err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, PageSize(4096), Order(4))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+
+	for i := 0; i < 30; i++ {
+		value, ok, err := tree.Get([]byte{byte(i)})
+		if err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence %v of key %d", ok, i)
+		}
+		if ok && !bytes.Equal(value, []byte{byte(i)}) {
+			t.Fatalf("unexpected value %v for key %d", value, i)
+		}
+	}
+
+	count := 0
+	if err := tree.ForEach(func(key, value []byte) {
+		if key[0]%2 == 0 {
+			t.Fatalf("unexpected expired key %d", key[0])
+		}
+		count++
+	}); err != nil {
+		t.Fatalf("failed to iterate: %s", err)
+	}
+	if count != 15 {
+		t.Fatalf("expected 15 keys, but got %d", count)
+	}
+
+	it, err := tree.Iterator()
+	if err != nil {
+		t.Fatalf("failed to initialize iterator: %s", err)
+	}
+	for count = 0; it.HasNext(); count++ {
+		key, _, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to advance: %s", err)
+		}
+		if key[0] != byte(count*2+1) {
+			t.Fatalf("expected key %d, but got %d", count*2+1, key[0])
+		}
+	}
+	if count != 15 {
+		t.Fatalf("expected 15 keys, but got %d", count)
+	}
+
+	c := tree.Cursor()
+	if err := c.Last(); err != nil {
+		t.Fatalf("failed to move the cursor: %s", err)
+	}
+	for count = 0; c.Valid(); count++ {
+		if c.Key()[0] != byte(29-count*2) {
+			t.Fatalf("expected key %d, but got %d", 29-count*2, c.Key()[0])
+		}
+		if err := c.Prev(); err != nil {
+			t.Fatalf("failed to move the cursor: %s", err)
+		}
+	}
+	if count != 15 {
+		t.Fatalf("expected 15 keys, but got %d", count)
+	}
+
+	if key, _, ok, err := tree.Floor([]byte{10}); err != nil || !ok || key[0] != 9 {
+		t.Fatalf("expected the floor 9, but got %v, %v", key, err)
+	}
+	if key, _, ok, err := tree.Ceiling([]byte{10}); err != nil || !ok || key[0] != 11 {
+		t.Fatalf("expected the ceiling 11, but got %v, %v", key, err)
+	}
+
+	// the expired key does not exist for the writes
+	if _, exists, err := tree.Put([]byte{0}, []byte{0}); err != nil || exists {
+		t.Fatalf("expected the expired key to be replaced, but got %v, %v", exists, err)
+	}
+	if _, deleted, err := tree.Delete([]byte{2}); err != nil || deleted {
+		t.Fatalf("expected the expired key to be deleted silently, but got %v, %v", deleted, err)
+	}
+	if swapped, err := tree.CompareAndPut([]byte{4}, nil, []byte{4}); err != nil || !swapped {
+		t.Fatalf("expected the expired key to be put, but got %v, %v", swapped, err)
+	}
+
+	if size := tree.Size(); size != 29 {
+		t.Fatalf("expected size 29 with the expired keys, but got %d", size)
+	}
+
+	purged, err := tree.PurgeExpired()
+	if err != nil {
+		t.Fatalf("failed to purge: %s", err)
+	}
+	if purged != 12 {
+		t.Fatalf("expected 12 purged keys, but got %d", purged)
+	}
+	if size := tree.Size(); size != 17 {
+		t.Fatalf("expected size 17, but got %d", size)
+	}
+
+	report, err := tree.Check()
+	if err != nil {
+		t.Fatalf("failed to check: %s", err)
+	}
+	if !report.OK() {
+		t.Fatalf("expected no problems, but got %v", report.Problems)
+	}
+
+	if _, _, err := tree.PutWithTTL([]byte{1}, []byte{1}, 0); err == nil {
+		t.Fatalf("expected the error for the zero ttl")
+	}
+}
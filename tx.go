@@ -0,0 +1,311 @@
+package fbptree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTxOpen is returned by the writes to the tree and by Begin while
+// a transaction that conflicts with them is open.
+var ErrTxOpen = errors.New("the transaction is open")
+
+// ErrTxDone is returned by the transaction after it is committed
+// or rolled back.
+var ErrTxDone = errors.New("the transaction is committed or rolled back")
+
+// ErrTxReadOnly is returned by the writes in the read-only transaction.
+var ErrTxReadOnly = errors.New("the transaction is read-only")
+
+// Tx is the transaction. The changes of the writable transaction are kept
+// in memory until Commit, which applies them all or none of them, so
+// Rollback leaves the file as it was. The commit is also atomic on the crash
+// with the WriteAheadLog option. The reads of the tree and of the read-only
+// transactions do not see the changes until they are committed, while the
+// reads of the writable transaction see them and take the write lock.
+//
+// The read-only transaction sees the state of the tree as of Begin, but it
+// does not copy the tree, see Snapshot for that: it is consistent since the
+// writes to the tree and Begin of the writable transaction are rejected with
+// ErrTxOpen while it is open. Only one writable transaction can be open, the
+// writes to the tree outside of it and Begin of the read-only transaction
+// are rejected with ErrTxOpen. The transaction must be used by one goroutine.
+type Tx struct {
+	tree     *FBPTree
+	writable bool
+	done     bool
+
+	// the state of the tree before the transaction
+	w *write
+	// the state of the tree changed by the writable transaction,
+	// see swap
+	state *txState
+	// the error of the write that failed midway
+	failed error
+}
+
+// txState is the state of the tree changed by the writable transaction.
+// It is swapped in only for the operations of the transaction, so the
+// reads outside of it see the committed state.
+type txState struct {
+	metadata *treeMetadata
+	pager    *pager
+	records  *records
+	cache    *nodeCache
+	dirty    map[uint32]*dirtyNode
+}
+
+// Begin starts the transaction.
+func (t *FBPTree) Begin(writable bool) (*Tx, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, ErrClosed
+	}
+
+	if !writable {
+		if t.tx != nil {
+			return nil, ErrTxOpen
+		}
+
+		t.readers++
+
+		return &Tx{tree: t}, nil
+	}
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return nil, err
+	}
+	t.storage.begin()
+
+	// the pager of the transaction allocates and frees the pages,
+	// the pager of the tree keeps the committed free pages
+	pager, records, err := t.storage.loadPager()
+	if err != nil {
+		t.rollbackWrite(w, err)
+
+		return nil, fmt.Errorf("failed to load the pager of the transaction: %w", err)
+	}
+
+	state := &txState{
+		pager:   pager,
+		records: records,
+		// the committed nodes stay cached for the transaction
+		cache: t.storage.cache.clone(),
+		dirty: t.storage.dirty,
+	}
+	if t.metadata != nil {
+		metadata := *t.metadata
+		state.metadata = &metadata
+	}
+	t.storage.dirty = nil
+	t.storage.wal.hidden = true
+
+	t.tx = &Tx{tree: t, writable: true, w: w, state: state}
+
+	return t.tx, nil
+}
+
+// swap swaps the state of the tree and the state of the transaction,
+// it is called under the write lock.
+func (tx *Tx) swap() {
+	t, s, state := tx.tree, tx.tree.storage, tx.state
+
+	t.metadata, state.metadata = state.metadata, t.metadata
+	s.pager, state.pager = state.pager, s.pager
+	s.records, state.records = state.records, s.records
+	s.cache, state.cache = state.cache, s.cache
+	s.dirty, state.dirty = state.dirty, s.dirty
+	s.wal.hidden = !s.wal.hidden
+}
+
+// Writable returns true if the transaction is writable.
+func (tx *Tx) Writable() bool {
+	return tx.writable
+}
+
+// Get returns the value by the key.
+func (tx *Tx) Get(key []byte) ([]byte, bool, error) {
+	if tx.done {
+		return nil, false, ErrTxDone
+	}
+
+	if !tx.writable {
+		return tx.tree.Get(key)
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	tx.swap()
+	defer tx.swap()
+
+	op := tx.tree.beginOperation()
+	value, ok, err := tx.tree.get(key)
+	tx.tree.endOperation(op, OperationGet, len(key), len(value), err)
+
+	return value, ok, err
+}
+
+// ForEach calls the action for every key and value in the key order.
+func (tx *Tx) ForEach(action func(key []byte, value []byte)) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	if !tx.writable {
+		return tx.tree.ForEach(action)
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	tx.swap()
+	defer tx.swap()
+
+	return tx.tree.forEach(action)
+}
+
+// Size returns the number of the keys.
+func (tx *Tx) Size() int {
+	if !tx.writable || tx.done {
+		return tx.tree.Size()
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	tx.swap()
+	defer tx.swap()
+
+	return tx.tree.size()
+}
+
+// Put puts the key and the value.
+func (tx *Tx) Put(key, value []byte) ([]byte, bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return nil, false, err
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	tx.swap()
+	defer tx.swap()
+
+	writes := tx.tree.storage.stats().writes
+	op := tx.tree.beginOperation()
+	prev, exists, err := tx.tree.put(key, value)
+	tx.fail(writes, err)
+	tx.tree.endOperation(op, OperationPut, len(key), len(value), err)
+
+	return prev, exists, err
+}
+
+// Delete deletes the key.
+func (tx *Tx) Delete(key []byte) ([]byte, bool, error) {
+	if err := tx.checkWrite(); err != nil {
+		return nil, false, err
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	tx.swap()
+	defer tx.swap()
+
+	writes := tx.tree.storage.stats().writes
+	op := tx.tree.beginOperation()
+	value, deleted, err := tx.tree.delete(key)
+	tx.fail(writes, err)
+	tx.tree.endOperation(op, OperationDelete, len(key), len(value), err)
+
+	return value, deleted, err
+}
+
+// checkWrite returns an error if the transaction does not accept the writes.
+func (tx *Tx) checkWrite() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	if !tx.writable {
+		return ErrTxReadOnly
+	}
+
+	if tx.failed != nil {
+		return fmt.Errorf("the transaction must be rolled back: %w", tx.failed)
+	}
+
+	return nil
+}
+
+// fail records the error of the write that has changed
+// or tried to change the file.
+func (tx *Tx) fail(writes uint64, err error) {
+	if err != nil && tx.tree.storage.stats().writes != writes {
+		tx.failed = err
+	}
+}
+
+// Commit applies the changes of the transaction. The transaction with
+// the write that failed midway is rolled back.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	if !tx.writable {
+		return tx.rollback()
+	}
+
+	if tx.failed != nil {
+		if err := tx.rollback(); err != nil {
+			return err
+		}
+
+		return fmt.Errorf("the transaction is rolled back: %w", tx.failed)
+	}
+
+	tx.done = true
+	tx.tree.tx = nil
+	// the state of the transaction becomes the state of the tree
+	tx.swap()
+
+	return tx.tree.endWrite(tx.w, nil)
+}
+
+// Rollback discards the changes of the transaction.
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	tx.tree.mu.Lock()
+	defer tx.tree.mu.Unlock()
+
+	return tx.rollback()
+}
+
+func (tx *Tx) rollback() error {
+	tx.done = true
+
+	if !tx.writable {
+		tx.tree.readers--
+
+		return nil
+	}
+
+	tx.tree.tx = nil
+	// the state of the transaction is dropped
+	tx.tree.storage.wal.hidden = false
+	if err := tx.tree.rollbackWrite(tx.w, nil); err != nil {
+		return fmt.Errorf("failed to roll back the transaction: %w", err)
+	}
+
+	return nil
+}
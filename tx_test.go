@@ -0,0 +1,364 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestTxCommit(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	before, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tx.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if _, _, err := tx.Delete(encodeUint32(0)); err != nil {
+		t.Fatalf("failed to delete key 0: %s", err)
+	}
+
+	if _, _, err := tree.Put(encodeUint32(1000), nil); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+	if _, err := tree.Begin(false); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+
+	if after, err := ioutil.ReadFile(dbPath); err != nil || !bytes.Equal(before, after) {
+		t.Fatalf("expected the changes to be deferred until the commit")
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %s", err)
+	}
+	if _, _, err := tx.Put(encodeUint32(1000), nil); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, but got %v", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.Size() != 99 {
+		t.Fatalf("expected size 99, but got %d", tree.Size())
+	}
+	if err := tree.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	before, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := tx.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+	for i := 10; i < 50; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tx.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	if tx.Size() != 40 {
+		t.Fatalf("expected size 40 in the transaction, but got %d", tx.Size())
+	}
+
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("failed to roll back: %s", err)
+	}
+
+	after, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("expected the file not to be changed by the rolled back transaction")
+	}
+
+	if tree.Size() != 10 {
+		t.Fatalf("expected size 10, but got %d", tree.Size())
+	}
+	if err := tree.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+	if _, _, err := tree.Put(encodeUint32(10), nil); err != nil {
+		t.Fatalf("failed to put after the rollback: %s", err)
+	}
+}
+
+func TestTxFailedWrite(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	tx, err := tree.Begin(true)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tx.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the rejected write does not fail the transaction
+	if _, _, err := tx.Put(make([]byte, maxKeySize+1), nil); err == nil {
+		t.Fatalf("expected an error for the large key")
+	}
+
+	file := tree.storage.counter.file
+	tree.storage.counter.file = &brokenFile{randomAccessFile: file, writes: 1}
+	if _, _, err := tx.Put(encodeUint32(10), nil); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected the write error, but got %v", err)
+	}
+	tree.storage.counter.file = file
+
+	if _, _, err := tx.Put(encodeUint32(11), nil); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected the transaction to be failed, but got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected the commit to fail, but got %v", err)
+	}
+
+	if tree.Size() != 0 {
+		t.Fatalf("expected size 0, but got %d", tree.Size())
+	}
+	if tree.Poisoned() != nil {
+		t.Fatalf("expected the tree not to be poisoned, but got %s", tree.Poisoned())
+	}
+	if _, _, err := tree.Put(encodeUint32(0), nil); err != nil {
+		t.Fatalf("failed to put after the rollback: %s", err)
+	}
+}
+
+func TestReadOnlyTx(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	tree, err := Open(path.Join(dbDir, "sample.data"), Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if _, _, err := tree.Put([]byte{1}, []byte{1}); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+
+	tx, err := tree.Begin(false)
+	if err != nil {
+		t.Fatalf("failed to begin the transaction: %s", err)
+	}
+	if tx.Writable() {
+		t.Fatalf("expected the read-only transaction")
+	}
+
+	if value, ok, err := tx.Get([]byte{1}); err != nil || !ok || !bytes.Equal(value, []byte{1}) {
+		t.Fatalf("expected the value, but got %v, %v, %v", value, ok, err)
+	}
+	if _, _, err := tx.Put([]byte{2}, nil); !errors.Is(err, ErrTxReadOnly) {
+		t.Fatalf("expected ErrTxReadOnly, but got %v", err)
+	}
+	if _, _, err := tree.Put([]byte{2}, nil); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+	if _, err := tree.Begin(true); !errors.Is(err, ErrTxOpen) {
+		t.Fatalf("expected ErrTxOpen, but got %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("failed to commit: %s", err)
+	}
+	if err := tx.Rollback(); !errors.Is(err, ErrTxDone) {
+		t.Fatalf("expected ErrTxDone, but got %v", err)
+	}
+
+	if _, _, err := tree.Put([]byte{2}, nil); err != nil {
+		t.Fatalf("failed to put: %s", err)
+	}
+}
+
+func TestTxHidesUncommittedWrites(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	for i, options := range [][]func(*config) error{{Order(3)}, {Order(3), PageSize(256), WriteAheadLog()}} {
+		tree, err := Open(path.Join(dbDir, fmt.Sprintf("sample_%d.data", i)), options...)
+		if err != nil {
+			t.Fatalf("failed to open tree: %s", err)
+		}
+
+		for j := 0; j < 50; j++ {
+			tree.Put(encodeUint32(uint32(j)), encodeUint32(uint32(j)))
+		}
+
+		for _, commit := range []bool{false, true} {
+			tx, err := tree.Begin(true)
+			if err != nil {
+				t.Fatalf("failed to begin the transaction: %s", err)
+			}
+
+			// the reads outside of the transaction run while it splits
+			// and merges the nodes
+			done := make(chan error)
+			go func() {
+				for j := 0; j < 200; j++ {
+					if value, ok, err := tree.Get(encodeUint32(10)); err != nil || !ok || !bytes.Equal(value, encodeUint32(10)) {
+						done <- fmt.Errorf("expected the committed value, but got %v, %v, %v", value, ok, err)
+
+						return
+					}
+				}
+				done <- nil
+			}()
+
+			for j := 50; j < 150; j++ {
+				if _, _, err := tx.Put(encodeUint32(uint32(j)), bytes.Repeat([]byte{1}, 100)); err != nil {
+					t.Fatalf("failed to put: %s", err)
+				}
+			}
+			for j := 0; j < 40; j++ {
+				if _, _, err := tx.Delete(encodeUint32(uint32(j))); err != nil {
+					t.Fatalf("failed to delete: %s", err)
+				}
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok, _ := tree.Get(encodeUint32(100)); ok {
+				t.Fatal("expected the uncommitted put to be hidden")
+			}
+			if _, ok, _ := tree.Get(encodeUint32(0)); !ok {
+				t.Fatal("expected the uncommitted delete to be hidden")
+			}
+			keys := 0
+			if err := tree.ForEach(func(key, value []byte) { keys++ }); err != nil {
+				t.Fatalf("failed to iterate: %s", err)
+			}
+			if keys != 50 || tree.Size() != 50 {
+				t.Fatalf("expected the 50 committed keys, but iterated over %d and the size is %d", keys, tree.Size())
+			}
+			if report, err := tree.Check(); err != nil || !report.OK() {
+				t.Fatalf("expected the committed tree to be consistent, but got %v, %v", report, err)
+			}
+
+			if _, ok, _ := tx.Get(encodeUint32(100)); !ok {
+				t.Fatal("expected the transaction to see its put")
+			}
+			if _, ok, _ := tx.Get(encodeUint32(0)); ok {
+				t.Fatal("expected the transaction to see its delete")
+			}
+			if tx.Size() != 110 {
+				t.Fatalf("expected the transaction to have 110 keys, but got %d", tx.Size())
+			}
+
+			expected := 50
+			if commit {
+				expected = 110
+				err = tx.Commit()
+			} else {
+				err = tx.Rollback()
+			}
+			if err != nil {
+				t.Fatalf("failed to end the transaction: %s", err)
+			}
+
+			if tree.Size() != expected {
+				t.Fatalf("expected %d keys, but got %d", expected, tree.Size())
+			}
+			if _, ok, _ := tree.Get(encodeUint32(100)); ok != commit {
+				t.Fatalf("expected the put to be visible only after the commit")
+			}
+			if report, err := tree.Check(); err != nil || !report.OK() {
+				t.Fatalf("expected the tree to be consistent, but got %v, %v", report, err)
+			}
+		}
+
+		if err := tree.Close(); err != nil {
+			t.Fatalf("failed to close tree: %s", err)
+		}
+	}
+}
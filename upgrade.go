@@ -0,0 +1,74 @@
+package fbptree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Upgrade rewrites the tree file by the path into the current file format
+// with the compacting rewrite, see CompactRewrite. The page size, the order
+// and the collation are taken from the file, the options are applied after
+// them, e.g. for the logging. The progress callback, if given, is called
+// after every rewritten entry.
+func Upgrade(path string, progress func(done, total int), options ...func(*config) error) error {
+	detected, err := detectOptions(path)
+	if err != nil {
+		return err
+	}
+
+	tree, err := Open(path, append(detected, options...)...)
+	if err != nil {
+		return fmt.Errorf("failed to open the tree: %w", err)
+	}
+
+	if err := tree.compactTo(tree.path, progress); err != nil {
+		tree.Close()
+
+		return fmt.Errorf("failed to rewrite the tree: %w", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		return fmt.Errorf("failed to close the tree: %w", err)
+	}
+
+	return nil
+}
+
+// detectOptions returns the options the tree file by the path was created
+// with: the page size, the order, the collation, the compression and the
+// maximum node size.
+func detectOptions(path string) ([]func(*config) error, error) {
+	r, err := OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	pageSize, metadata := r.storage.pager.pageSize, r.metadata
+	if err := r.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close the reader: %w", err)
+	}
+
+	return optionsOf(pageSize, metadata), nil
+}
+
+// optionsOf returns the options of the tree with the given page size
+// and the tree metadata, nil for the empty tree.
+func optionsOf(pageSize uint16, metadata *treeMetadata) []func(*config) error {
+	detected := []func(*config) error{PageSize(int(pageSize))}
+	if metadata != nil {
+		detected = append(detected, Order(int(metadata.order)))
+
+		if strings.HasPrefix(metadata.ordering, collationPrefix) {
+			detected = append(detected, Collation(strings.TrimPrefix(metadata.ordering, collationPrefix)))
+		}
+
+		if metadata.codec == FlateCodec().Name() {
+			detected = append(detected, Compression(FlateCodec()))
+		}
+
+		if metadata.maxNodeSize != 0 {
+			detected = append(detected, MaxNodeSize(int(metadata.maxNodeSize)))
+		}
+	}
+
+	return detected
+}
@@ -0,0 +1,93 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestUpgrade(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(5), PageSize(128), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for _, c := range treeCases {
+		key := []byte(fmt.Sprintf("key %03d", c.key))
+		if _, _, err := tree.Put(key, []byte(c.value)); err != nil {
+			t.Fatalf("failed to put key %d: %s", c.key, err)
+		}
+	}
+
+	expected := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		expected = append(expected, key, value)
+	})
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	// the files of the older format have no metadata checksum
+	file, err := os.OpenFile(dbPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatalf("failed to open the file: %s", err)
+	}
+	if _, err := file.WriteAt(make([]byte, 4), metadataChecksumPosition); err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("failed to close the file: %s", err)
+	}
+
+	calls, lastDone := 0, 0
+	err = Upgrade(dbPath, func(done, total int) {
+		calls++
+		lastDone = done
+
+		if total != len(treeCases) {
+			t.Fatalf("expected total %d, but got %d", len(treeCases), total)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to upgrade: %s", err)
+	}
+
+	if calls != len(treeCases) || lastDone != len(treeCases) {
+		t.Fatalf("expected the progress for every entry, but got %d calls", calls)
+	}
+
+	data, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if decodeUint32(data[metadataChecksumPosition:metadataChecksumPosition+4]) == 0 {
+		t.Fatal("the upgraded file must have the metadata checksum")
+	}
+
+	tree, err = Open(dbPath, Order(5), PageSize(128), Collation("en"))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	actual := make([][]byte, 0)
+	tree.ForEach(func(key, value []byte) {
+		actual = append(actual, key, value)
+	})
+
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("expected %v, but got %v", expected, actual)
+	}
+}
@@ -0,0 +1,50 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// MaxUserMetadataSize is the maximum size of the user metadata.
+const MaxUserMetadataSize = userMetadataSize - 2
+
+// SetUserMetadata stores the application-defined bytes, e.g. the schema
+// version or the ownership information, in the region of the file metadata
+// reserved for the application. The nil or empty data removes it.
+func (t *FBPTree) SetUserMetadata(data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+
+	if err := t.storage.pager.writeUserMetadata(copyBytes(data)); err != nil {
+		return fmt.Errorf("failed to write the user metadata: %w", err)
+	}
+
+	if t.strictMetadataSync {
+		if err := t.storage.flush(); err != nil {
+			return fmt.Errorf("failed to flush metadata: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetUserMetadata returns the application-defined bytes or nil
+// if they are not set.
+func (t *FBPTree) GetUserMetadata() []byte {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.userMetadata()
+}
+
+func (t *FBPTree) userMetadata() []byte {
+	user := t.storage.pager.metadata.user
+	if len(user) == 0 {
+		return nil
+	}
+
+	return copyBytes(user)
+}
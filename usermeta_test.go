@@ -0,0 +1,77 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestUserMetadata(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	if tree.GetUserMetadata() != nil {
+		t.Fatalf("expected no user metadata")
+	}
+
+	if err := tree.SetUserMetadata([]byte("schema v2")); err != nil {
+		t.Fatalf("failed to set the user metadata: %s", err)
+	}
+
+	if err := tree.SetUserMetadata(make([]byte, MaxUserMetadataSize+1)); err == nil {
+		t.Fatalf("expected the error for too large user metadata")
+	}
+
+	// the tree metadata changes must not affect the user metadata
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Delete([]byte{byte(i)}); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if !bytes.Equal(tree.GetUserMetadata(), []byte("schema v2")) {
+		t.Fatalf("expected the user metadata, but got %s", tree.GetUserMetadata())
+	}
+
+	if err := tree.CompactRewrite(); err != nil {
+		t.Fatalf("failed to compact: %s", err)
+	}
+	if !bytes.Equal(tree.GetUserMetadata(), []byte("schema v2")) {
+		t.Fatalf("expected the user metadata after the compaction, but got %s", tree.GetUserMetadata())
+	}
+
+	if err := tree.SetUserMetadata(nil); err != nil {
+		t.Fatalf("failed to remove the user metadata: %s", err)
+	}
+	if tree.GetUserMetadata() != nil {
+		t.Fatalf("expected no user metadata")
+	}
+}
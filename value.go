@@ -0,0 +1,127 @@
+package fbptree
+
+import (
+	"fmt"
+)
+
+// Append appends the suffix to the value stored under the key and returns
+// the new value size. If the key does not exist, the suffix becomes the value.
+// Only the pages that are changed by the append are written.
+func (t *FBPTree) Append(key, suffix []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	op := t.beginOperation()
+	size, err := t.append(key, suffix)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationAppend, len(key), len(suffix), err)
+
+	return size, err
+}
+
+func (t *FBPTree) append(key, suffix []byte) (int, error) {
+	if t.metadata == nil {
+		if _, _, err := t.put(key, copyBytes(suffix)); err != nil {
+			return 0, fmt.Errorf("failed to put: %w", err)
+		}
+
+		return len(suffix), nil
+	}
+
+	leaf, err := t.descend(key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	var value []byte
+	if position := leaf.livePosition(key, t.compare); position != -1 {
+		existing, err := t.storage.readValue(leaf.pointers[position])
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the value: %w", err)
+		}
+
+		value = make([]byte, len(existing), len(existing)+len(suffix))
+		copy(value, existing)
+	}
+	value = append(value, suffix...)
+
+	if err := t.checkPut(key, value); err != nil {
+		return 0, err
+	}
+
+	if _, _, err := t.putIntoLeaf(leaf, key, value); err != nil {
+		return 0, fmt.Errorf("failed to put into the leaf %d: %w", leaf.id, err)
+	}
+
+	return len(value), nil
+}
+
+// WriteAt writes the data into the value stored under the key starting from
+// the offset. The value grows if the data does not fit into it. Only the pages
+// that contain the changed byte range are written. The key must exist and
+// the offset must not be greater than the value size.
+func (t *FBPTree) WriteAt(key []byte, offset int, data []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w, err := t.beginWrite()
+	if err != nil {
+		return err
+	}
+
+	op := t.beginOperation()
+	err = t.writeAt(key, offset, data)
+	err = t.endWrite(w, err)
+	t.endOperation(op, OperationWriteAt, len(key), len(data), err)
+
+	return err
+}
+
+func (t *FBPTree) writeAt(key []byte, offset int, data []byte) error {
+	if t.metadata == nil {
+		return fmt.Errorf("the key is not found")
+	}
+
+	leaf, err := t.descend(key)
+	if err != nil {
+		return fmt.Errorf("failed to find leaf: %w", err)
+	}
+
+	position := leaf.livePosition(key, t.compare)
+	if position == -1 {
+		return fmt.Errorf("the key is not found")
+	}
+
+	existing, err := t.storage.readValue(leaf.pointers[position])
+	if err != nil {
+		return fmt.Errorf("failed to read the value: %w", err)
+	}
+
+	if offset < 0 || offset > len(existing) {
+		return fmt.Errorf("offset %d is out of the value bounds [0, %d]", offset, len(existing))
+	}
+
+	size := len(existing)
+	if offset+len(data) > size {
+		size = offset + len(data)
+	}
+
+	value := make([]byte, size)
+	copy(value, existing)
+	copy(value[offset:], data)
+
+	if err := t.checkPut(key, value); err != nil {
+		return err
+	}
+
+	if _, _, err := t.putIntoLeaf(leaf, key, value); err != nil {
+		return fmt.Errorf("failed to put into the leaf %d: %w", leaf.id, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestAppend(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	var pagesWritten uint64
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(128), Order(50), OnOperation(func(info OperationInfo) {
+		pagesWritten = info.PagesWritten
+	}))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	size, err := tree.Append([]byte{0}, []byte{1, 2})
+	if err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	if size != 2 {
+		t.Fatalf("expected size 2, but got %d", size)
+	}
+
+	for i := 1; i < 20; i++ {
+		tree.Put([]byte{byte(i)}, bytes.Repeat([]byte{byte(i)}, 20))
+	}
+
+	size, err = tree.Append([]byte{0}, []byte{3})
+	if err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	if size != 3 {
+		t.Fatalf("expected size 3, but got %d", size)
+	}
+
+	value, _, _ := tree.Get([]byte{0})
+	if !bytes.Equal(value, []byte{1, 2, 3}) {
+		t.Fatalf("expected value %v, but got %v", []byte{1, 2, 3}, value)
+	}
+
+	leaf, err := tree.findLeaf([]byte{19})
+	if err != nil {
+		t.Fatalf("failed to find leaf: %s", err)
+	}
+	leafPages := tree.storage.pageCount(leaf)
+
+	if _, err := tree.Append([]byte{19}, []byte{1}); err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	if pagesWritten >= uint64(leafPages) {
+		t.Fatalf("expected to write less than %d pages of the leaf, but wrote %d", leafPages, pagesWritten)
+	}
+
+	value, _, _ = tree.Get([]byte{19})
+	if !bytes.Equal(value, append(bytes.Repeat([]byte{19}, 20), 1)) {
+		t.Fatalf("unexpected value after append: %v", value)
+	}
+
+	if _, err := tree.Append([]byte{100}, []byte{4}); err != nil {
+		t.Fatalf("failed to append: %s", err)
+	}
+	value, ok, _ := tree.Get([]byte{100})
+	if !ok || !bytes.Equal(value, []byte{4}) {
+		t.Fatalf("expected value %v, but got %v", []byte{4}, value)
+	}
+}
+
+func TestWriteAt(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	var pagesWritten uint64
+	tree, err := Open(path.Join(dbDir, "sample.data"), PageSize(64), Order(10), OnOperation(func(info OperationInfo) {
+		pagesWritten = info.PagesWritten
+	}))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if err := tree.WriteAt([]byte{1}, 0, []byte{1}); err == nil {
+		t.Fatal("must return an error for the non-existent key")
+	}
+
+	blob := bytes.Repeat([]byte{7}, 500)
+	tree.Put([]byte{1}, blob)
+
+	leaf, err := tree.findLeaf([]byte{1})
+	if err != nil {
+		t.Fatalf("failed to find leaf: %s", err)
+	}
+	leafPages := tree.storage.pageCount(leaf)
+
+	if err := tree.WriteAt([]byte{1}, 250, []byte{1, 2, 3}); err != nil {
+		t.Fatalf("failed to write at: %s", err)
+	}
+	if pagesWritten > 2 {
+		t.Fatalf("expected to write at most 2 of %d pages, but wrote %d", leafPages, pagesWritten)
+	}
+
+	copy(blob[250:], []byte{1, 2, 3})
+	value, _, _ := tree.Get([]byte{1})
+	if !bytes.Equal(value, blob) {
+		t.Fatal("the value is not updated at the offset")
+	}
+
+	if err := tree.WriteAt([]byte{1}, 499, []byte{9, 9}); err != nil {
+		t.Fatalf("failed to write at: %s", err)
+	}
+	value, _, _ = tree.Get([]byte{1})
+	if len(value) != 501 || value[499] != 9 || value[500] != 9 {
+		t.Fatal("the value must grow")
+	}
+
+	if err := tree.WriteAt([]byte{1}, 502, []byte{1}); err == nil {
+		t.Fatal("must return an error for the offset out of bounds")
+	}
+}
@@ -0,0 +1,487 @@
+package fbptree
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// the suffix of the write-ahead log file next to the tree file
+const walSuffix = ".wal"
+
+var walMagic = []byte("FBPTWAL1")
+
+// WriteAheadLog option makes every write of the tree atomic. The pages
+// changed by the write are kept in memory until it completes, then they are
+// written to the log file next to the tree file and the log is synced before
+// the pages are written in place. The log is replayed on open, so a crash in
+// the middle of a split or a merge never leaves the file half-updated. The
+// failed write is rolled back and does not poison the tree. The free page
+// lists are changed by the same writes, so the crash never leaves a page both
+// free and in use. Without the option the pages are written in place and the
+// crash may leave the page both free and in use, Check reports it.
+func WriteAheadLog() func(*config) error {
+	return func(c *config) error {
+		c.wal = true
+
+		return nil
+	}
+}
+
+// walKind is the kind of the change of the file, the pager marks the changes
+// of its structures, so they are deferred even if the pages are written in place.
+type walKind int
+
+const (
+	// the change of the page of the node or of the record
+	walPage walKind = iota
+	// the change of the free page list or of the metadata,
+	// or the truncation of the file
+	walStructure
+)
+
+// walOp is the deferred write of the data at the offset
+// or the deferred truncation of the file to the offset.
+type walOp struct {
+	offset   int64
+	data     []byte
+	truncate bool
+}
+
+// walFile defers the changes of the file made in the transaction until the
+// transaction is committed through the log. The reads see the deferred changes.
+type walFile struct {
+	randomAccessFile
+	// the log, nil if the changes are applied without logging
+	log randomAccessFile
+	// skip the syncs of the log, see NoSync
+	noSync bool
+
+	active bool
+	// the changes of the pages are written in place, it is safe only if
+	// they are not reachable until commit, e.g. the pages of the load
+	inPlace bool
+	// the kind of the changes being written, see walKind
+	kind walKind
+	// the sync of the file is requested while the changes are deferred
+	syncDeferred bool
+	// the deferred changes are not read, so the reads outside
+	// of the writable transaction see the file as it is
+	hidden bool
+	ops    []*walOp
+	// the deferred writes by the offset since the last truncation
+	written map[int64]*walOp
+	// the size of the file with the deferred changes
+	size int64
+}
+
+// newWALFile instantiates the file that defers the changes
+// and applies them on commit without logging.
+func newWALFile(file randomAccessFile) (*walFile, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat the file: %w", err)
+	}
+
+	return &walFile{randomAccessFile: file, size: info.Size()}, nil
+}
+
+// openWAL opens the log of the file and replays the committed
+// changes that were not applied.
+func openWAL(path string, file randomAccessFile, noSync bool) (*walFile, error) {
+	logFile, err := os.OpenFile(path+walSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the log: %w", err)
+	}
+	log := wrapFile(path+walSuffix, logFile)
+
+	f := &walFile{randomAccessFile: file, log: log, noSync: noSync}
+	if err := f.replay(); err != nil {
+		log.Close()
+
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// checkWAL returns an error if the log of the read-only file
+// has the changes that can not be replayed.
+func checkWAL(path string) error {
+	info, err := os.Stat(path + walSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat the log: %w", err)
+	}
+
+	if info.Size() > 0 {
+		return fmt.Errorf("the log must be replayed: %w", ErrReadOnly)
+	}
+
+	return nil
+}
+
+// replay applies the changes of the complete log record to the file. The
+// incomplete record was not committed, so the file was not changed by it.
+func (f *walFile) replay() error {
+	if f.log == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(f.log, 0, 1<<62))
+	if err != nil {
+		return fmt.Errorf("failed to read the log: %w", err)
+	}
+
+	if ops, ok := decodeWALRecord(data); ok {
+		if err := f.apply(ops); err != nil {
+			return fmt.Errorf("failed to replay the log: %w", err)
+		}
+
+		if err := f.randomAccessFile.Sync(); err != nil {
+			return fmt.Errorf("failed to sync the replayed changes: %w", err)
+		}
+	}
+
+	if len(data) > 0 {
+		if err := f.log.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate the log: %w", err)
+		}
+
+		if err := f.syncLog(); err != nil {
+			return fmt.Errorf("failed to sync the log: %w", err)
+		}
+	}
+
+	info, err := f.randomAccessFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat the file: %w", err)
+	}
+	f.size = info.Size()
+
+	return nil
+}
+
+// apply applies the changes to the file.
+func (f *walFile) apply(ops []*walOp) error {
+	for _, op := range ops {
+		if op.truncate {
+			if err := f.randomAccessFile.Truncate(op.offset); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, err := f.randomAccessFile.WriteAt(op.data, op.offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// begin starts deferring the changes.
+func (f *walFile) begin() {
+	f.active = true
+	f.inPlace = false
+	f.syncDeferred = false
+	f.ops = nil
+	f.written = make(map[int64]*walOp)
+}
+
+// beginInPlace starts deferring the changes except the changes
+// of the pages, they are written in place.
+func (f *walFile) beginInPlace() {
+	f.begin()
+	f.inPlace = true
+}
+
+// as makes the changes of fn the changes of the kind.
+func (f *walFile) as(kind walKind, fn func() error) error {
+	f.kind = kind
+	defer func() {
+		f.kind = walPage
+	}()
+
+	return fn()
+}
+
+// commit makes the deferred changes durable in the log and applies them.
+// Without the log the changes are applied as they are, and the file is synced
+// only if it is requested.
+func (f *walFile) commit() error {
+	ops, sync := f.ops, f.syncDeferred
+	f.active, f.inPlace, f.syncDeferred, f.ops, f.written = false, false, false, nil, nil
+
+	if len(ops) == 0 && !sync {
+		return nil
+	}
+
+	if f.log == nil || len(ops) == 0 {
+		if err := f.apply(ops); err != nil {
+			return fmt.Errorf("failed to apply the changes: %w", err)
+		}
+
+		if sync {
+			return f.randomAccessFile.Sync()
+		}
+
+		return nil
+	}
+
+	if _, err := f.log.WriteAt(encodeWALRecord(ops), 0); err != nil {
+		return fmt.Errorf("failed to write the log: %w", err)
+	}
+
+	if err := f.syncLog(); err != nil {
+		return fmt.Errorf("failed to sync the log: %w", err)
+	}
+
+	// from now on the changes are replayed on open if applying them fails
+	if err := f.apply(ops); err != nil {
+		return fmt.Errorf("failed to apply the log: %w", err)
+	}
+
+	if err := f.randomAccessFile.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the applied changes: %w", err)
+	}
+
+	if err := f.log.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate the log: %w", err)
+	}
+
+	return nil
+}
+
+// syncLog syncs the log unless the syncs are disabled.
+func (f *walFile) syncLog() error {
+	if f.noSync {
+		return nil
+	}
+
+	return f.log.Sync()
+}
+
+// rollback discards the deferred changes.
+func (f *walFile) rollback() error {
+	f.active, f.inPlace, f.syncDeferred, f.ops, f.written = false, false, false, nil, nil
+
+	info, err := f.randomAccessFile.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat the file: %w", err)
+	}
+	f.size = info.Size()
+
+	return nil
+}
+
+// discard discards the deferred changes of the file of the given size,
+// the size is known, so the file is not read.
+func (f *walFile) discard(size int64) {
+	f.active, f.inPlace, f.syncDeferred, f.ops, f.written = false, false, false, nil, nil
+	f.size = size
+}
+
+func (f *walFile) WriteAt(p []byte, off int64) (int, error) {
+	op, deferred := f.written[off]
+	deferred = deferred && len(op.data) == len(p)
+	// the page written in place must not be overwritten
+	// by the deferred change on commit
+	if !f.active || (f.inPlace && f.kind == walPage && !deferred) {
+		n, err := f.randomAccessFile.WriteAt(p, off)
+		if end := off + int64(n); end > f.size {
+			f.size = end
+		}
+
+		return n, err
+	}
+
+	if end := off + int64(len(p)); end > f.size {
+		f.size = end
+	}
+
+	// the page is usually written several times by the write
+	if deferred {
+		copy(op.data, p)
+
+		return len(p), nil
+	}
+
+	op = &walOp{offset: off, data: copyBytes(p)}
+	f.ops = append(f.ops, op)
+	f.written[off] = op
+
+	return len(p), nil
+}
+
+func (f *walFile) ReadAt(p []byte, off int64) (int, error) {
+	if len(f.ops) == 0 || f.hidden {
+		return f.randomAccessFile.ReadAt(p, off)
+	}
+
+	n, err := f.randomAccessFile.ReadAt(p, off)
+	if err != nil && err != io.EOF {
+		return n, err
+	}
+	// the file reads as zeros past its end
+	reset(p[n:])
+
+	for _, op := range f.ops {
+		if op.truncate {
+			if op.offset < off+int64(len(p)) {
+				from := op.offset - off
+				if from < 0 {
+					from = 0
+				}
+				reset(p[from:])
+			}
+
+			continue
+		}
+
+		from, to := op.offset, op.offset+int64(len(op.data))
+		if from < off {
+			from = off
+		}
+		if to > off+int64(len(p)) {
+			to = off + int64(len(p))
+		}
+
+		if from < to {
+			copy(p[from-off:to-off], op.data[from-op.offset:to-op.offset])
+		}
+	}
+
+	if off+int64(len(p)) > f.size {
+		n := int(f.size - off)
+		if n < 0 {
+			n = 0
+		}
+
+		return n, io.EOF
+	}
+
+	return len(p), nil
+}
+
+func (f *walFile) Truncate(size int64) error {
+	if !f.active {
+		if err := f.randomAccessFile.Truncate(size); err != nil {
+			return err
+		}
+		f.size = size
+
+		return nil
+	}
+
+	f.ops = append(f.ops, &walOp{offset: size, truncate: true})
+	// the writes before the truncation can not be overwritten in place
+	f.written = make(map[int64]*walOp)
+	f.size = size
+
+	return nil
+}
+
+func (f *walFile) Sync() error {
+	if f.active {
+		// the commit syncs the file
+		f.syncDeferred = true
+
+		return nil
+	}
+
+	return f.randomAccessFile.Sync()
+}
+
+func (f *walFile) Stat() (fs.FileInfo, error) {
+	info, err := f.randomAccessFile.Stat()
+	if err != nil || f.hidden {
+		return info, err
+	}
+
+	return &walFileInfo{info, f.size}, nil
+}
+
+func (f *walFile) Close() error {
+	if f.log == nil {
+		return f.randomAccessFile.Close()
+	}
+
+	if err := f.log.Close(); err != nil {
+		f.randomAccessFile.Close()
+
+		return fmt.Errorf("failed to close the log: %w", err)
+	}
+
+	return f.randomAccessFile.Close()
+}
+
+// walFileInfo reports the size of the file with the deferred changes.
+type walFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (i *walFileInfo) Size() int64 {
+	return i.size
+}
+
+// encodeWALRecord encodes the changes as the magic and the number of the
+// changes followed by the changes and the CRC32 checksum of the record. The
+// write is encoded as 0, the offset, the size and the data, the truncation
+// is encoded as 1 and the size of the file.
+func encodeWALRecord(ops []*walOp) []byte {
+	var buf bytes.Buffer
+	buf.Write(walMagic)
+	buf.Write(encodeUint32(uint32(len(ops))))
+	for _, op := range ops {
+		if op.truncate {
+			buf.Write(encodeBool(true))
+			buf.Write(encodeUint64(uint64(op.offset)))
+
+			continue
+		}
+
+		buf.Write(encodeBool(false))
+		buf.Write(encodeUint64(uint64(op.offset)))
+		buf.Write(encodeUint32(uint32(len(op.data))))
+		buf.Write(op.data)
+	}
+	buf.Write(encodeUint32(crc32.ChecksumIEEE(buf.Bytes())))
+
+	return buf.Bytes()
+}
+
+// decodeWALRecord decodes the changes of the record
+// and reports if the record is complete.
+func decodeWALRecord(data []byte) ([]*walOp, bool) {
+	if !bytes.HasPrefix(data, walMagic) {
+		return nil, false
+	}
+
+	d := &decoder{data: data, position: len(walMagic)}
+	count := int(d.uint32())
+	ops := make([]*walOp, 0)
+	for i := 0; i < count && d.err == nil; i++ {
+		op := &walOp{truncate: d.byte() == 1, offset: int64(d.uint64())}
+		if !op.truncate {
+			op.data = d.bytes(int(d.uint32()))
+		}
+
+		ops = append(ops, op)
+	}
+
+	end := d.position
+	checksum := d.uint32()
+	if d.err != nil || checksum != crc32.ChecksumIEEE(data[:end]) {
+		return nil, false
+	}
+
+	return ops, true
+}
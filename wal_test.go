@@ -0,0 +1,238 @@
+package fbptree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"syscall"
+	"testing"
+)
+
+func TestWriteAheadLog(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 100; i += 2 {
+		if _, _, err := tree.Delete(encodeUint32(uint32(i))); err != nil {
+			t.Fatalf("failed to delete key %d: %s", i, err)
+		}
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close tree: %s", err)
+	}
+
+	if info, err := os.Stat(dbPath + walSuffix); err != nil || info.Size() != 0 {
+		t.Fatalf("expected the empty log, but got %v, %v", info, err)
+	}
+
+	tree, err = Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if tree.Size() != 50 {
+		t.Fatalf("expected size 50, but got %d", tree.Size())
+	}
+	for i := 0; i < 100; i++ {
+		_, ok, err := tree.Get(encodeUint32(uint32(i)))
+		if err != nil {
+			t.Fatalf("failed to get key %d: %s", i, err)
+		}
+		if ok != (i%2 == 1) {
+			t.Fatalf("unexpected presence %v of key %d", ok, i)
+		}
+	}
+}
+
+func TestWriteAheadLogRollsBackFailedWrite(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	before, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+
+	// the split fails midway
+	file := tree.storage.counter.file
+	tree.storage.counter.file = &brokenFile{randomAccessFile: file, writes: 2}
+	if _, _, err := tree.Put(encodeUint32(10), nil); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected the write error, but got %v", err)
+	}
+	tree.storage.counter.file = file
+
+	if tree.Poisoned() != nil {
+		t.Fatalf("expected the tree not to be poisoned, but got %s", tree.Poisoned())
+	}
+
+	after, err := ioutil.ReadFile(dbPath)
+	if err != nil {
+		t.Fatalf("failed to read the file: %s", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("expected the file not to be changed by the failed write")
+	}
+
+	if err := tree.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+
+	for i := 10; i < 20; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	if tree.Size() != 20 {
+		t.Fatalf("expected size 20, but got %d", tree.Size())
+	}
+	if err := tree.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+}
+
+func TestWriteAheadLogReplaysInterruptedWrite(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	for i := 0; i < 10; i++ {
+		key := encodeUint32(uint32(i))
+		if _, _, err := tree.Put(key, key); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+
+	// the commit is interrupted after the log is synced
+	// and a part of the pages is written in place
+	file := tree.storage.wal.randomAccessFile
+	tree.storage.wal.randomAccessFile = &brokenFile{randomAccessFile: file, writes: 1}
+	key := encodeUint32(10)
+	if _, _, err := tree.Put(key, key); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("expected the write error, but got %v", err)
+	}
+	if !errors.Is(tree.Poisoned(), syscall.EIO) {
+		t.Fatalf("expected the tree to be poisoned by EIO, but got %v", tree.Poisoned())
+	}
+
+	// the crash leaves the files as they are
+	crashedPath := path.Join(dbDir, "crashed.data")
+	for _, suffix := range []string{"", walSuffix} {
+		data, err := ioutil.ReadFile(dbPath + suffix)
+		if err != nil {
+			t.Fatalf("failed to read the file: %s", err)
+		}
+
+		if err := ioutil.WriteFile(crashedPath+suffix, data, 0600); err != nil {
+			t.Fatalf("failed to write the file: %s", err)
+		}
+	}
+
+	crashed, err := Open(crashedPath, Order(3), WriteAheadLog())
+	if err != nil {
+		t.Fatalf("failed to open the crashed tree: %s", err)
+	}
+	defer crashed.Close()
+
+	if crashed.Size() != 11 {
+		t.Fatalf("expected size 11, but got %d", crashed.Size())
+	}
+	if err := crashed.verify(); err != nil {
+		t.Fatalf("expected the valid tree, but got %s", err)
+	}
+	if value, ok, err := crashed.Get(key); err != nil || !ok || !bytes.Equal(value, key) {
+		t.Fatalf("expected the replayed key, but got %v, %v, %v", value, ok, err)
+	}
+
+	// the original tree recovers by replaying the log as well
+	tree.storage.wal.randomAccessFile = file
+	if err := tree.Recover(); err != nil {
+		t.Fatalf("failed to recover: %s", err)
+	}
+	if tree.Size() != 11 {
+		t.Fatalf("expected size 11, but got %d", tree.Size())
+	}
+}
+
+func TestDecodeWALRecord(t *testing.T) {
+	ops := []*walOp{
+		{offset: 1000, data: []byte{1, 2, 3}},
+		{offset: 2000, truncate: true},
+		{offset: 3000, data: []byte{4}},
+	}
+
+	data := encodeWALRecord(ops)
+	decoded, ok := decodeWALRecord(data)
+	if !ok {
+		t.Fatalf("expected the complete record")
+	}
+	if len(decoded) != len(ops) {
+		t.Fatalf("expected %d changes, but got %d", len(ops), len(decoded))
+	}
+	for i, op := range ops {
+		if decoded[i].offset != op.offset || decoded[i].truncate != op.truncate || !bytes.Equal(decoded[i].data, op.data) {
+			t.Fatalf("expected change %v, but got %v", op, decoded[i])
+		}
+	}
+
+	for i := 0; i < len(data); i++ {
+		if _, ok := decodeWALRecord(data[:i]); ok {
+			t.Fatalf("expected the record truncated to %d bytes to be incomplete", i)
+		}
+	}
+
+	data[len(walMagic)+10] ^= 0xFF
+	if _, ok := decodeWALRecord(data); ok {
+		t.Fatalf("expected the corrupted record to be incomplete")
+	}
+}
@@ -0,0 +1,172 @@
+package fbptree
+
+import (
+	"fmt"
+	"sort"
+)
+
+// the number of the hot leaves recorded in the file
+const maxHotLeaves = (hotLeavesMetadataSize - 2) / 4
+
+// WarmupOnOpen option warms up the cache on open, see Warmup.
+func WarmupOnOpen(hotLeaves int) func(*config) error {
+	return func(c *config) error {
+		if hotLeaves < 0 {
+			return fmt.Errorf("the number of the hot leaves must be >= 0")
+		}
+
+		c.warmup = true
+		c.warmupLeaves = hotLeaves
+
+		return nil
+	}
+}
+
+// Warmup eagerly loads the internal nodes level by level from the root into
+// the cache while it has room, and then up to the given number of the leaves
+// that were accessed the most in the previous sessions, so the first requests
+// after a restart do not pay the cold read latency.
+func (t *FBPTree) Warmup(hotLeaves int) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosed
+	}
+
+	if t.metadata == nil {
+		return nil
+	}
+
+	capacity := t.storage.cache.capacity
+	loaded := 0
+	level := []uint32{t.metadata.rootID}
+	for len(level) > 0 && loaded < capacity {
+		children := make([]uint32, 0)
+		lastLevel := false
+		for _, nodeID := range level {
+			if loaded == capacity {
+				break
+			}
+
+			n, err := t.storage.loadNodeByID(nodeID)
+			if err != nil {
+				return fmt.Errorf("failed to load node %d: %w", nodeID, err)
+			}
+			loaded++
+
+			// all the leaves are at the same level, so the level of
+			// the leftmost leaf parent is the last internal level
+			if n.leaf || n.pointers[0].asNodeID() == t.metadata.leftmostID {
+				lastLevel = true
+			}
+			if lastLevel {
+				continue
+			}
+
+			for i := 0; i <= n.keyNum; i++ {
+				children = append(children, n.pointers[i].asNodeID())
+			}
+		}
+
+		level = children
+	}
+
+	for _, leafID := range t.storage.hottestLeaves() {
+		if hotLeaves == 0 || loaded == capacity {
+			break
+		}
+
+		if t.storage.cache.contains(leafID) {
+			continue
+		}
+
+		leaf, err := t.storage.loadNodeByID(leafID)
+		if err != nil {
+			return fmt.Errorf("failed to load the hot leaf %d: %w", leafID, err)
+		}
+		if !leaf.leaf {
+			// the recorded leaf is outdated
+			t.storage.cache.remove(leafID)
+
+			continue
+		}
+
+		hotLeaves--
+		loaded++
+	}
+
+	return nil
+}
+
+// recordLeafAccess counts the access to the leaf for the hot leaves.
+func (s *storage) recordLeafAccess(leafID uint32) {
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	s.leafAccess[leafID]++
+}
+
+// forgetLeaf removes the deleted node from the hot leaves.
+func (s *storage) forgetLeaf(nodeID uint32) {
+	delete(s.leafAccess, nodeID)
+
+	for i, leafID := range s.hotLeaves {
+		if leafID == nodeID {
+			s.hotLeaves = append(s.hotLeaves[:i], s.hotLeaves[i+1:]...)
+			// written with the next metadata write
+			s.pager.setHotLeavesMetadata(encodeHotLeaves(s.hotLeaves))
+
+			return
+		}
+	}
+}
+
+// hottestLeaves returns the most accessed leaves in this session
+// followed by the hot leaves of the previous sessions.
+func (s *storage) hottestLeaves() []uint32 {
+	leaves := make([]uint32, 0, len(s.leafAccess))
+	for leafID := range s.leafAccess {
+		leaves = append(leaves, leafID)
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		if s.leafAccess[leaves[i]] != s.leafAccess[leaves[j]] {
+			return s.leafAccess[leaves[i]] > s.leafAccess[leaves[j]]
+		}
+
+		return leaves[i] < leaves[j]
+	})
+	if len(leaves) > maxHotLeaves {
+		leaves = leaves[:maxHotLeaves]
+	}
+
+	for _, leafID := range s.hotLeaves {
+		if len(leaves) == maxHotLeaves {
+			break
+		}
+
+		if _, ok := s.leafAccess[leafID]; !ok {
+			leaves = append(leaves, leafID)
+		}
+	}
+
+	return leaves
+}
+
+func encodeHotLeaves(leaves []uint32) []byte {
+	data := make([]byte, 0, len(leaves)*4)
+	for _, leafID := range leaves {
+		data = append(data, encodeUint32(leafID)...)
+	}
+
+	return data
+}
+
+func decodeHotLeaves(data []byte) []uint32 {
+	leaves := make([]uint32, 0, len(data)/4)
+	for i := 0; i+4 <= len(data); i += 4 {
+		leaves = append(leaves, decodeUint32(data[i:i+4]))
+	}
+
+	return leaves
+}
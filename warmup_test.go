@@ -0,0 +1,79 @@
+package fbptree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestWarmup(t *testing.T) {
+	dbDir, _ := ioutil.TempDir(os.TempDir(), "example")
+	defer func() {
+		if err := os.RemoveAll(dbDir); err != nil {
+			panic(fmt.Errorf("failed to remove %s: %w", dbDir, err))
+		}
+	}()
+
+	dbPath := path.Join(dbDir, "sample.data")
+	tree, err := Open(dbPath, Order(3))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, _, err := tree.Put([]byte{byte(i)}, []byte{byte(i)}); err != nil {
+			t.Fatalf("failed to put key %d: %s", i, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := tree.Get([]byte{42}); err != nil {
+			t.Fatalf("failed to get: %s", err)
+		}
+	}
+
+	hotLeaf, err := tree.findLeaf([]byte{42})
+	if err != nil {
+		t.Fatalf("failed to find the leaf: %s", err)
+	}
+
+	if err := tree.Close(); err != nil {
+		t.Fatalf("failed to close: %s", err)
+	}
+
+	tree, err = Open(dbPath, Order(3), WarmupOnOpen(1))
+	if err != nil {
+		t.Fatalf("failed to open tree: %s", err)
+	}
+	defer tree.Close()
+
+	if !tree.storage.cache.contains(hotLeaf.id) {
+		t.Fatalf("the hot leaf %d must be cached", hotLeaf.id)
+	}
+
+	internal, leaves := 0, 0
+	for _, element := range tree.storage.cache.entries {
+		n, err := decodeNode(element.Value.(*cacheEntry).data)
+		if err != nil {
+			t.Fatalf("failed to decode the cached node: %s", err)
+		}
+
+		if n.leaf {
+			leaves++
+		} else {
+			internal++
+		}
+	}
+	if leaves != 1 || internal == 0 {
+		t.Fatalf("expected the internal nodes and one hot leaf, but got %d internal nodes and %d leaves", internal, leaves)
+	}
+
+	before := tree.storage.stats().misses
+	if _, _, err := tree.Get([]byte{42}); err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	if misses := tree.storage.stats().misses - before; misses != 0 {
+		t.Fatalf("expected no cache misses for the hot key, but got %d", misses)
+	}
+}